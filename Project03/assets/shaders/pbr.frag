@@ -15,12 +15,17 @@ layout(binding = 2) uniform sampler2D u_orm;
 layout(binding = 3) uniform samplerCube u_environment_diffuse;
 layout(binding = 4) uniform samplerCube u_environment_specualr;
 layout(binding = 5) uniform sampler2D u_environment_brdf_lut;
+// set from Material.TwoChannelNormal
+uniform bool u_normal_two_channel;
 uniform vec3 u_camera_position;
 uniform vec3[4] u_light_positions;
 uniform vec3[4] u_light_colors;
 uniform float u_ambient_factor;
 uniform mat4 u_environment_transform;
 uniform vec3 u_environment_origin;
+// the roughness each level of the specular environment was prefiltered for, ascending
+uniform float[8] u_environment_roughness;
+uniform int u_environment_levels;
 
 const float PI = 3.14159265359;
 
@@ -112,6 +117,19 @@ vec3 parallaxCorrectNormal(vec3 v, mat4 cubeTransform, vec3 cubeOrigin) {
     return boxIntersection - cubeOrigin;
 }
 
+// Inverts the roughness curve of the specular environment by interpolating between the levels
+float roughnessToLod(float roughness)
+{
+    for (int i = 1; i < u_environment_levels; i++) {
+        float r0 = u_environment_roughness[i-1];
+        float r1 = u_environment_roughness[i];
+        if (roughness <= r1) {
+            return float(i-1) + clamp((roughness - r0) / (r1 - r0), 0.0, 1.0);
+        }
+    }
+    return float(max(u_environment_levels - 1, 0));
+}
+
 vec3 sampleAmbient(vec3 N, vec3 V, vec3 R, vec3 F0, float roughness, float metallic, vec3 albedo, float ao)
 {
     vec3 F = fresnelSchlickRoughness(max(dot(N, V), 0.0), F0, roughness);
@@ -121,9 +139,8 @@ vec3 sampleAmbient(vec3 N, vec3 V, vec3 R, vec3 F0, float roughness, float metal
     vec3 irradiance = texture(u_environment_diffuse, N).rgb;
     vec3 diffuse    = irradiance * albedo;
 
-    const float MAX_REFLECTION_LOD = 4.0;
     vec3 correctR = parallaxCorrectNormal(R, u_environment_transform, u_environment_origin);
-    vec3 reflection = textureLod(u_environment_specualr, correctR, roughness * MAX_REFLECTION_LOD).rgb;   
+    vec3 reflection = textureLod(u_environment_specualr, correctR, roughnessToLod(roughness)).rgb;
     vec2 envBRDF  = texture(u_environment_brdf_lut, vec2(max(dot(N, V), 0.0), roughness)).rg;
     vec3 specular = reflection * (F * envBRDF.x + envBRDF.y);
 
@@ -140,6 +157,10 @@ void main()
     float ao        = orm.x;
 
     vec3 tN = texture(u_normal, in_uv).xyz * 2.0 - 1.0;
+    if (u_normal_two_channel) {
+        // two channel (BC5) normal maps have no z, it is reconstructed from the unit length
+        tN.z = sqrt(max(1.0 - dot(tN.xy, tN.xy), 0.0));
+    }
     roughness = adjustRoughness(tN, roughness);
 
     vec3 N = transformNormal(tN);
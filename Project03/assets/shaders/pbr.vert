@@ -1,12 +1,26 @@
 #version 450 core
 
+// The libscn.CompactVertex layout of RenderBatch
+// #define COMPACT_VERTICES
 
+#ifdef COMPACT_VERTICES
+// xyz relative to the bounds of the mesh and w the handedness of the tangent
+layout(location = 0) in vec4 in_position;
+layout(location = 1) in vec2 in_uv;
+// octahedral unit vectors
+layout(location = 2) in vec2 in_normal;
+layout(location = 3) in vec2 in_tangent;
+layout(location = 4) in mat4 in_model_mat;
+layout(location = 8) in vec3 in_position_offset;
+layout(location = 9) in vec3 in_position_scale;
+#else
 layout(location = 0) in vec3 in_position;
 layout(location = 1) in vec2 in_uv;
 layout(location = 2) in vec3 in_normal;
-layout(location = 3) in vec3 in_bitangent;
-layout(location = 4) in vec3 in_tangent;
-layout(location = 5) in mat4 in_model_mat;
+// xyz is the tangent and w the handedness of the MikkTSpace frame
+layout(location = 3) in vec4 in_tangent;
+layout(location = 4) in mat4 in_model_mat;
+#endif
 
 out gl_PerVertex {
   vec4 gl_Position;
@@ -18,8 +32,28 @@ layout(location = 2) out mat3 out_tbn;
 
 uniform mat4 u_view_projection_mat;
 
+#ifdef COMPACT_VERTICES
+vec3 decodeOctahedral(vec2 p) {
+  vec3 n = vec3(p, 1. - abs(p.x) - abs(p.y));
+  if (n.z < 0.) {
+    n.xy = (1. - abs(p.yx)) * vec2(p.x < 0. ? -1. : 1., p.y < 0. ? -1. : 1.);
+  }
+  return normalize(n);
+}
+#endif
+
 void main() {
-  vec4 worldPosition = in_model_mat * vec4(in_position, 1.);
+#ifdef COMPACT_VERTICES
+  vec3 position = in_position_offset + in_position.xyz * in_position_scale;
+  vec3 normal = decodeOctahedral(in_normal);
+  vec4 tangent = vec4(decodeOctahedral(in_tangent), in_position.w);
+#else
+  vec3 position = in_position;
+  vec3 normal = in_normal;
+  vec4 tangent = in_tangent;
+#endif
+
+  vec4 worldPosition = in_model_mat * vec4(position, 1.);
   gl_Position = u_view_projection_mat * worldPosition;
 
   out_world_position = worldPosition.xyz;
@@ -30,8 +64,9 @@ void main() {
   // mat3 normalMatrix = transpose(inverse(mat3(in_model_mat)));
   mat3 normalMatrix = mat3(in_model_mat);
 
-  vec3 T = normalize(normalMatrix * in_tangent);
-  vec3 B = normalize(normalMatrix * in_bitangent);
-  vec3 N = normalize(normalMatrix * in_normal);
+  // the bitangent is not normalized like the MikkTSpace bakers expect
+  vec3 N = normalize(normalMatrix * normal);
+  vec3 T = normalize(normalMatrix * tangent.xyz);
+  vec3 B = tangent.w * cross(N, T);
   out_tbn = mat3(T, B, N);
 }
\ No newline at end of file
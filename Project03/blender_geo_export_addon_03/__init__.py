@@ -15,7 +15,7 @@ bl_info = {
     "name": "Geo Format Exporter 03",
     "description": "Writes geometry format to disk, based on exporter by Mark Kughler",
     "author": "Qendolin",
-    "version": (1, 0),
+    "version": (2, 0),
     "blender": (3, 2, 1),
     "location": "File > Export > GEO",
     "warning": "",
@@ -44,6 +44,21 @@ class ObjectExport(bpy.types.Operator):
         description="",
         default=True,
     )
+    quantize: bpy.props.BoolProperty(
+        name="Quantize",
+        description="Store 16 bit positions, octahedral normals and half float uvs",
+        default=False,
+    )
+    compress: bpy.props.BoolProperty(
+        name="Compress",
+        description="Compress the vertex streams with lz4, needs the lz4 python module",
+        default=False,
+    )
+    write_skin: bpy.props.BoolProperty(
+        name="Skin Weights",
+        description="Write the four largest vertex group weights of each vertex",
+        default=False,
+    )
     write_scene: bpy.props.BoolProperty(
         name="Write .scn Files",
         description="",
@@ -90,7 +105,8 @@ class ObjectExport(bpy.types.Operator):
                 filename = re.sub(r'[-\s]+', '-', filename).strip('-_')
                 path = os.path.join(self.directory, filename + ".geo")
                 with open(path, 'wb') as file:
-                    write_geometry(me, transform, file)
+                    write_geometry(me, transform, file, quantize=self.quantize,
+                                   compress=self.compress, skin=self.write_skin)
                 context.window_manager.progress_update(progress)
 
             context.window_manager.progress_end()
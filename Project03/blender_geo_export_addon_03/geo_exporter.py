@@ -1,32 +1,163 @@
 import struct  # https://docs.python.org/3/library/struct.html
 
-
-def write_geometry(me, transform, file):
+# Version 2 of the geo format, see libscn/geo.go
+MAGIC_NUMBER_GEO2 = 0xc9dae18d
+GEO_VERSION_2 = 2_000_000
+
+ATTRIBUTE_POSITION = 1 << 0
+ATTRIBUTE_NORMAL = 1 << 1
+ATTRIBUTE_TANGENT = 1 << 2
+ATTRIBUTE_UV0 = 1 << 3
+ATTRIBUTE_UV1 = 1 << 4
+ATTRIBUTE_COLOR = 1 << 5
+ATTRIBUTE_JOINTS = 1 << 6
+ATTRIBUTE_WEIGHTS = 1 << 7
+
+FORMAT_FLOAT32 = 0
+FORMAT_FLOAT16 = 1
+FORMAT_UNORM16 = 2
+FORMAT_SNORM16 = 3
+FORMAT_OCTAHEDRAL16 = 4
+FORMAT_UNORM8 = 5
+FORMAT_UINT8 = 6
+FORMAT_UINT16 = 7
+FORMAT_UINT32 = 8
+
+COMPRESSION_NONE = 0
+COMPRESSION_LZ4 = 1
+
+
+def write_geometry(me, transform, file, quantize=False, compress=False, skin=False):
     name = me.name.encode('utf-8')
-    vertices, indices = _convert_mesh(me, transform)
-
-    print(f"{len(vertices)} vertices, {len(indices)} indices")
-
-    file.write(struct.pack("<I", 0xc9dae18c))
-    file.write(struct.pack("<I", len(name)))
-    file.write(struct.pack('<I', len(vertices)))
-    file.write(struct.pack('<I', len(indices)))
-
-    file.write(name)
-    for (pos, norm, uv) in vertices:
-        file.write(struct.pack('<3f', pos[0], pos[1], pos[2]))
-        file.write(struct.pack(
-            '<3f', norm[0], norm[1], norm[2]))
-        file.write(struct.pack('<2f', uv[0], uv[1]))
-
-    short = len(indices) < 0xffff
-    for i in indices:
-        file.write(struct.pack('<H' if short else '<I', i))
-    if short and len(indices) % 2 == 1:
-        file.write(struct.pack('<H', 0))
-
-
-def _convert_mesh(me, transform):
+    mesh = _convert_mesh(me, transform, skin)
+    vertices, indices, submeshes = mesh["vertices"], mesh["indices"], mesh["submeshes"]
+
+    print(f"{len(vertices)} vertices, {len(indices)} indices, {len(submeshes)} submeshes")
+
+    compressor = None
+    if compress:
+        try:
+            import lz4.frame
+        except ImportError:
+            raise RuntimeError("Compression needs the lz4 module in the python of blender")
+        compressor = lz4.frame.compress
+
+    attributes = ATTRIBUTE_POSITION | ATTRIBUTE_NORMAL | ATTRIBUTE_UV0
+    if mesh["tangents"]:
+        attributes |= ATTRIBUTE_TANGENT
+    if mesh["uv1"]:
+        attributes |= ATTRIBUTE_UV1
+    if mesh["colors"]:
+        attributes |= ATTRIBUTE_COLOR
+    if skin:
+        attributes |= ATTRIBUTE_JOINTS | ATTRIBUTE_WEIGHTS
+
+    bounds_min, bounds_max = _bounds([v["position"] for v in vertices])
+
+    file.write(struct.pack("<II", MAGIC_NUMBER_GEO2, GEO_VERSION_2))
+    file.write(struct.pack("<IIIIB3x", attributes, len(vertices),
+               len(indices), len(submeshes), COMPRESSION_LZ4 if compressor else COMPRESSION_NONE))
+    file.write(struct.pack("<6f", *bounds_min, *bounds_max))
+    _write_string(file, name)
+
+    for (material, first, count) in submeshes:
+        sub_min, sub_max = _bounds(
+            [vertices[i]["position"] for i in indices[first:first+count]])
+        file.write(struct.pack("<II6f", first, count, *sub_min, *sub_max))
+        _write_string(file, material.encode('utf-8'))
+
+    if max(indices, default=0) <= 0xffff:
+        _write_stream(file, compressor, FORMAT_UINT16,
+                      struct.pack(f"<{len(indices)}H", *indices))
+    else:
+        _write_stream(file, compressor, FORMAT_UINT32,
+                      struct.pack(f"<{len(indices)}I", *indices))
+
+    size = [bounds_max[c] - bounds_min[c] for c in range(3)]
+
+    def relative(p):
+        return [(p[c] - bounds_min[c]) / size[c] if size[c] > 0 else 0 for c in range(3)]
+
+    streams = [
+        (ATTRIBUTE_POSITION, "position",
+         (FORMAT_UNORM16, lambda p: struct.pack("<3H", *[_unorm(v, 16) for v in relative(p)])),
+         (FORMAT_FLOAT32, lambda p: struct.pack("<3f", *p))),
+        (ATTRIBUTE_NORMAL, "normal",
+         (FORMAT_OCTAHEDRAL16, lambda n: struct.pack("<2h", *_octahedral16(n))),
+         (FORMAT_FLOAT32, lambda n: struct.pack("<3f", *n))),
+        (ATTRIBUTE_TANGENT, "tangent",
+         (FORMAT_SNORM16, lambda t: struct.pack("<4h", *[_snorm16(v) for v in t])),
+         (FORMAT_FLOAT32, lambda t: struct.pack("<4f", *t))),
+        (ATTRIBUTE_UV0, "uv0",
+         (FORMAT_FLOAT16, lambda uv: struct.pack("<2e", *uv)),
+         (FORMAT_FLOAT32, lambda uv: struct.pack("<2f", *uv))),
+        (ATTRIBUTE_UV1, "uv1",
+         (FORMAT_FLOAT16, lambda uv: struct.pack("<2e", *uv)),
+         (FORMAT_FLOAT32, lambda uv: struct.pack("<2f", *uv))),
+        (ATTRIBUTE_COLOR, "color",
+         (FORMAT_UNORM8, lambda c: struct.pack("<4B", *[_unorm(v, 8) for v in c])),
+         (FORMAT_FLOAT32, lambda c: struct.pack("<4f", *c))),
+        (ATTRIBUTE_JOINTS, "joints",
+         (FORMAT_UINT16, lambda j: struct.pack("<4H", *j)),
+         (FORMAT_UINT16, lambda j: struct.pack("<4H", *j))),
+        (ATTRIBUTE_WEIGHTS, "weights",
+         (FORMAT_UNORM16, lambda w: struct.pack("<4H", *[_unorm(v, 16) for v in w])),
+         (FORMAT_FLOAT32, lambda w: struct.pack("<4f", *w))),
+    ]
+    for (attribute, key, quantized, full) in streams:
+        if attributes & attribute == 0:
+            continue
+        (format, pack) = quantized if quantize else full
+        data = b"".join(pack(v[key]) for v in vertices)
+        _write_stream(file, compressor, format, data)
+
+
+def _write_string(file, data):
+    file.write(struct.pack("<I", len(data)))
+    file.write(data)
+    file.write(bytes(_padding4(len(data))))
+
+
+def _write_stream(file, compressor, format, data):
+    if compressor is not None:
+        data = compressor(data)
+    file.write(struct.pack("<B3xI", format, len(data)))
+    file.write(data)
+    file.write(bytes(_padding4(len(data))))
+
+
+def _padding4(size):
+    return (4 - size % 4) % 4
+
+
+def _bounds(positions):
+    if len(positions) == 0:
+        return ([0, 0, 0], [0, 0, 0])
+    return ([min(p[c] for p in positions) for c in range(3)],
+            [max(p[c] for p in positions) for c in range(3)])
+
+
+def _unorm(v, bits):
+    scale = (1 << bits) - 1
+    return int(round(min(max(v, 0), 1) * scale))
+
+
+def _snorm16(v):
+    return int(round(min(max(v, -1), 1) * 0x7fff))
+
+
+def _octahedral16(n):
+    l1 = abs(n[0]) + abs(n[1]) + abs(n[2])
+    if l1 == 0:
+        return (0, 0)
+    x, y = n[0] / l1, n[1] / l1
+    if n[2] < 0:
+        x, y = ((1 - abs(y)) * (-1 if x < 0 else 1),
+                (1 - abs(x)) * (-1 if y < 0 else 1))
+    return (_snorm16(x), _snorm16(y))
+
+
+def _convert_mesh(me, transform, skin):
     me = me.copy()
 
     me.calc_loop_triangles()
@@ -34,32 +165,82 @@ def _convert_mesh(me, transform):
 
     me.transform(transform)
 
-    vertices = dict()
-    indices = []
-    index = 0
-
     uvmap = me.uv_layers.active
     loops = me.loop_triangles
 
     if len(loops) == 0:
         print("Mesh has no triangulated loops")
 
+    # MikkTSpace tangents like the baked normal maps, the loader generates them when this fails
+    tangents = False
+    if uvmap is not None:
+        try:
+            me.calc_tangents(uvmap=uvmap.name)
+            tangents = True
+        except RuntimeError as err:
+            print(f"Cannot calculate tangents: {err}")
+
+    uv1map = next((uv for uv in me.uv_layers if uv != uvmap), None)
+    colors = me.color_attributes.active_color if hasattr(
+        me, "color_attributes") else None
+
+    vertices = dict()
+    # triangles of the same material are written together
+    triangles = dict()
+
     for tri in loops:
+        corners = []
         for i in range(3):
             vert_index = tri.vertices[i]
             loop_index = tri.loops[i]
+            loop = me.loops[loop_index]
+
+            vert = {
+                "position": tuple(me.vertices[vert_index].co),
+                "normal": tuple(loop.normal),
+                "uv0": tuple(uvmap.data[loop_index].uv) if uvmap else (0, 0),
+            }
+            if tangents:
+                vert["tangent"] = (*loop.tangent, loop.bitangent_sign)
+            if uv1map is not None:
+                vert["uv1"] = tuple(uv1map.data[loop_index].uv)
+            if colors is not None:
+                index = vert_index if colors.domain == 'POINT' else loop_index
+                vert["color"] = tuple(colors.data[index].color)
+            if skin:
+                vert["joints"], vert["weights"] = _skin_weights(
+                    me.vertices[vert_index])
+
+            key = tuple(vert.items())
+            if key not in vertices:
+                vertices[key] = (len(vertices), vert)
+            corners.append(vertices[key][0])
+        triangles.setdefault(tri.material_index, []).extend(corners)
 
-            pos = tuple(me.vertices[vert_index].co)
-            norm = tuple(me.loops[loop_index].normal)
-            uv = tuple(uvmap.data[loop_index].uv)
-            vert = (pos, norm, uv)
-
-            if vert in vertices:
-                indices.append(vertices[vert])
-            else:
-                vertices[vert] = index
-                indices.append(index)
-                index += 1
-
-    vertices = list(vertices.keys())
-    return (vertices, indices)
+    indices = []
+    submeshes = []
+    for material_index in sorted(triangles.keys()):
+        material = ""
+        if material_index < len(me.materials) and me.materials[material_index] is not None:
+            material = me.materials[material_index].name
+        submeshes.append((material, len(indices), len(triangles[material_index])))
+        indices.extend(triangles[material_index])
+
+    return {
+        "vertices": [vert for (_, vert) in vertices.values()],
+        "indices": indices,
+        "submeshes": submeshes,
+        "tangents": tangents,
+        "uv1": uv1map is not None,
+        "colors": colors is not None,
+    }
+
+
+# The four vertex groups with the largest weights, the joints are the indices of the vertex groups
+def _skin_weights(vertex):
+    groups = sorted(vertex.groups, key=lambda g: g.weight, reverse=True)[:4]
+    total = sum(g.weight for g in groups)
+    joints = [g.group for g in groups] + [0] * (4 - len(groups))
+    weights = [g.weight / total if total > 0 else 0 for g in groups] + \
+        [0] * (4 - len(groups))
+    return (tuple(joints), tuple(weights))
@@ -40,7 +40,7 @@ func main() {
 	flag.IntVar(&args.size, "size", args.size, "size of the lut")
 	flag.BoolVar(&args.preview, "preview", args.preview, "generate normalized preview png")
 	flag.BoolVar(&args.grayscale, "grayscale", args.grayscale, "generate seperate grayscale images")
-	flag.IntVar(&args.compression, "compression", args.compression, "0=none, 1=fixed-point + lz4-fast")
+	flag.IntVar(&args.compression, "compression", args.compression, "0=none, 1=fixed-point + lz4-fast, 2=half-float + lz4-fast, 3=lossless byte-shuffle + lz4")
 
 	flag.Parse()
 
@@ -69,6 +69,10 @@ func saveFloatImage(img *libio.FloatImage, filename, fileext string) {
 	harderr(err)
 	defer file.Close()
 
+	img.Metadata = libio.FloatImageMetadata{
+		ColorSpace: "linear",
+		Semantic:   "brdf_lut",
+	}
 	err = libio.EncodeFloatImage(file, img, libio.FloatImageCompression(args.compression))
 	harderr(err)
 
@@ -80,6 +84,7 @@ func saveFloatImage(img *libio.FloatImage, filename, fileext string) {
 		file, err = os.OpenFile(filename+".png", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
 		harderr(err)
 
+		// the lut holds data and not colors, its color space is unknown so the values are written without a transfer function
 		img.Normalize()
 		rgba := img.ToIntImage().ToRGBA()
 		err = png.Encode(file, rgba)
@@ -84,6 +84,28 @@ func runConvert(args convertArgs, inputFiles []string) {
 		if !cargs.quiet {
 			fmt.Println("Using software implementation")
 		}
+	case implGl:
+		var release func()
+		release, err = initGlContext()
+		if err == nil {
+			defer release()
+			conv, err = ibl.NewGlConverter()
+		}
+		if err == nil {
+			defer conv.Release()
+			if !cargs.quiet {
+				fmt.Println("Using OpenGL implementation")
+			}
+			break
+		}
+		softerr(err)
+		if !cargs.quiet {
+			fmt.Println("Falling back to software implementation")
+		}
+		conv = ibl.NewSwConverter()
+		if !cargs.quiet {
+			fmt.Println("Using software implementation")
+		}
 	}
 
 	success := 0
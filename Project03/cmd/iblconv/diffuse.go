@@ -86,6 +86,28 @@ func runConvolve(args convolveArgs, inputFiles []string) {
 		if !cargs.quiet {
 			fmt.Println("Using software implementation")
 		}
+	case implGl:
+		var release func()
+		release, err = initGlContext()
+		if err == nil {
+			defer release()
+			conv, err = ibl.NewGlDiffuseConvolver(args.samples)
+		}
+		if err == nil {
+			defer conv.Release()
+			if !cargs.quiet {
+				fmt.Println("Using OpenGL implementation")
+			}
+			break
+		}
+		softerr(err)
+		if !cargs.quiet {
+			fmt.Println("Falling back to software implementation")
+		}
+		conv = ibl.NewSwDiffuseConvolver(args.samples)
+		if !cargs.quiet {
+			fmt.Println("Using software implementation")
+		}
 	}
 
 	success := 0
@@ -2,6 +2,8 @@ package main
 
 import (
 	"advanced-gl/Project03/ibl"
+	"advanced-gl/Project03/libgl"
+	"advanced-gl/Project03/libio"
 	"flag"
 	"fmt"
 	"io"
@@ -18,6 +20,7 @@ type impl string
 
 const (
 	implCl impl = "opencl"
+	implGl impl = "opengl"
 	implSw impl = "software"
 )
 
@@ -29,6 +32,8 @@ func (i *impl) Set(s string) error {
 	switch impl(s) {
 	case implCl:
 		*i = implCl
+	case implGl:
+		*i = implGl
 	case implSw:
 		*i = implSw
 	default:
@@ -71,6 +76,67 @@ func (d *device) clDevice() ibl.DeviceType {
 	}
 }
 
+type layout string
+
+const (
+	layoutCube       layout = "cube"
+	layoutLatLong    layout = "latlong"
+	layoutParaboloid layout = "paraboloid"
+)
+
+func (l *layout) String() string {
+	return string(*l)
+}
+
+func (l *layout) Set(s string) error {
+	switch layout(s) {
+	case layoutCube:
+		*l = layoutCube
+	case layoutLatLong:
+		*l = layoutLatLong
+	case layoutParaboloid:
+		*l = layoutParaboloid
+	default:
+		return fmt.Errorf("%s is not a valid layout", s)
+	}
+	return nil
+}
+
+func (l *layout) layout2D() ibl.Layout2D {
+	switch *l {
+	case layoutParaboloid:
+		return ibl.LayoutDualParaboloid
+	default:
+		return ibl.LayoutLatLong
+	}
+}
+
+type roughnessCurve struct {
+	ibl.RoughnessCurve
+}
+
+func (c *roughnessCurve) String() string {
+	return c.RoughnessCurve.String()
+}
+
+func (c *roughnessCurve) Set(s string) (err error) {
+	c.RoughnessCurve, err = ibl.ParseRoughnessCurve(s)
+	return err
+}
+
+type tonemapper struct {
+	libio.Tonemapper
+}
+
+func (t *tonemapper) String() string {
+	return t.Tonemapper.String()
+}
+
+func (t *tonemapper) Set(s string) (err error) {
+	t.Tonemapper, err = libio.ParseTonemapper(s)
+	return err
+}
+
 type sizeUnit string
 
 const (
@@ -172,6 +238,7 @@ func printCommandUsage(cmd *command, suffix string) {
 func main() {
 	commands = append(commands, createConvertCommand())
 	commands = append(commands, createConvolveCommand())
+	commands = append(commands, createOctahedralCommand())
 	commands = append(commands, createUpdateCommand())
 	commands = append(commands, createPrefilterCommand())
 	commands = append(commands, createPreviewCommand())
@@ -248,6 +315,19 @@ func gatherInputFiles(globs []string) []string {
 	return matched
 }
 
+// Creates an OpenGL context on the current thread.
+// The returned function destroys the context.
+func initGlContext() (release func(), err error) {
+	ctx, err := libgl.NewHeadlessContext(false)
+	if err != nil {
+		return nil, err
+	}
+	if !cargs.quiet {
+		fmt.Printf("Using OpenGL renderer %q\n", libgl.GlEnv.Renderer)
+	}
+	return ctx.Delete, nil
+}
+
 func close(closer io.Closer) {
 	closer.Close()
 }
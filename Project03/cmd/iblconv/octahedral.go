@@ -0,0 +1,217 @@
+package main
+
+import (
+	"advanced-gl/Project03/ibl"
+	"advanced-gl/Project03/libio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type octahedralArgs struct {
+	commonArgs
+	size     size
+	border   int
+	name     string
+	maxWidth int
+}
+
+// The json index written next to the atlas
+type atlasIndex struct {
+	Width  int          `json:"width"`
+	Height int          `json:"height"`
+	Border int          `json:"border"`
+	Probes []atlasProbe `json:"probes"`
+}
+
+type atlasProbe struct {
+	Name string `json:"name"`
+	Size int    `json:"size"`
+	// the uv rectangle (u0, v0, u1, v1) of each level, excluding the border
+	Levels [][4]float32 `json:"levels"`
+}
+
+func createOctahedralCommand() *command {
+	args := octahedralArgs{
+		commonArgs: commonArgs{
+			ext: ".f32",
+		},
+		size: size{
+			unit:    unitPercent,
+			percent: 200,
+		},
+		border:   1,
+		name:     "atlas",
+		maxWidth: 4096,
+	}
+
+	flags := flag.NewFlagSet("octahedral", flag.ExitOnError)
+
+	registerCommonFlags(flags, &args.commonArgs)
+	flags.Var(&args.size, "size", "the octahedral map resolution, either % of the cubemap face size or absolute px")
+	flags.Var(&args.size, "s", "shorthand for size")
+	flags.IntVar(&args.border, "border", args.border, "the border size in pixels around each level")
+	flags.StringVar(&args.name, "name", args.name, "the atlas file name, without extension")
+	flags.IntVar(&args.maxWidth, "max-width", args.maxWidth, "the maximum atlas width in pixels")
+
+	return &command{
+		Name: "octahedral",
+		Help: "pack ibl environments into an octahedral atlas",
+		Run: func(self *command) {
+			if self.Flags.NArg() < 1 || args.compress < 0 || args.compress > 10 || args.border < 0 {
+				printCommandUsage(self, " file-glob...")
+			}
+			setCommonArgs(&args.commonArgs)
+
+			runOctahedral(args, gatherInputFiles(self.Flags.Args()))
+		},
+		Flags: flags,
+	}
+}
+
+func runOctahedral(args octahedralArgs, inputFiles []string) {
+	start := time.Now()
+	names := []string{}
+	maps := []*ibl.OctahedralEnv{}
+	for i, p := range inputFiles {
+		if !cargs.quiet {
+			fmt.Printf("Processing file %d/%d %q ...\n", i+1, len(inputFiles), filepath.ToSlash(filepath.Clean(p)))
+		}
+		oct, err := octahedralFile(args, p)
+		softerr(err)
+		if err == nil {
+			names = append(names, strings.TrimSuffix(filepath.Base(p), filepath.Ext(p)))
+			maps = append(maps, oct)
+		}
+	}
+
+	if len(maps) == 0 {
+		harderr(fmt.Errorf("no environments to pack"))
+	}
+
+	atlas, index, err := packOctahedralAtlas(maps, names, args.maxWidth)
+	harderr(err)
+
+	outFilename := filepath.Join(cargs.out, args.name+cargs.suffix+cargs.ext)
+	if !cargs.quiet {
+		fmt.Printf("Writing %dx%d atlas %q ...\n", atlas.Width, atlas.Height, filepath.ToSlash(filepath.Clean(outFilename)))
+	}
+	err = writeAtlas(outFilename, atlas)
+	harderr(err)
+
+	indexFilename := filepath.Join(cargs.out, args.name+cargs.suffix+".json")
+	if !cargs.quiet {
+		fmt.Printf("Writing %q ...\n", filepath.ToSlash(filepath.Clean(indexFilename)))
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	harderr(err)
+	err = os.WriteFile(indexFilename, data, 0666)
+	harderr(err)
+
+	if !cargs.quiet {
+		took := float32(time.Since(start).Milliseconds()) / 1000
+		fmt.Printf("Packed %d/%d files in %.3f seconds\n", len(maps), len(inputFiles), took)
+	}
+}
+
+func octahedralFile(args octahedralArgs, p string) (*ibl.OctahedralEnv, error) {
+	inFile, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer close(inFile)
+
+	hdri, err := ibl.DecodeIblEnv(inFile)
+	if err != nil {
+		return nil, err
+	}
+
+	size := args.size.Calc(hdri.BaseSize)
+	if !cargs.quiet {
+		fmt.Printf("Converting to %dx%d octahedral map ...\n", size, size)
+	}
+
+	return ibl.CubeToOctahedral(hdri, size, args.border)
+}
+
+// Places the maps in rows from bottom to top, a new row is started when maxWidth would be exceeded
+func packOctahedralAtlas(maps []*ibl.OctahedralEnv, names []string, maxWidth int) (*libio.FloatImage, *atlasIndex, error) {
+	offsets := make([][2]int, len(maps))
+	width, height := 0, 0
+	x, rowHeight := 0, 0
+	for i, m := range maps {
+		if m.Image.Width > maxWidth {
+			return nil, nil, fmt.Errorf("%s is %d pixels wide and does not fit into the atlas", names[i], m.Image.Width)
+		}
+		if x+m.Image.Width > maxWidth {
+			height += rowHeight
+			x, rowHeight = 0, 0
+		}
+		offsets[i] = [2]int{x, height}
+		x += m.Image.Width
+		if x > width {
+			width = x
+		}
+		if m.Image.Height > rowHeight {
+			rowHeight = m.Image.Height
+		}
+	}
+	height += rowHeight
+
+	atlas := libio.NewFloatImage(make([]float32, width*height*3), 3, width, height)
+	index := &atlasIndex{
+		Width:  width,
+		Height: height,
+		Border: maps[0].Border,
+	}
+
+	for i, m := range maps {
+		ox, oy := offsets[i][0], offsets[i][1]
+		for y := 0; y < m.Image.Height; y++ {
+			src := m.Image.Pix[m.Image.Index(0, y):m.Image.Index(0, y+1)]
+			copy(atlas.Pix[atlas.Index(ox, oy+y):], src)
+		}
+
+		probe := atlasProbe{
+			Name:   names[i],
+			Size:   m.BaseSize,
+			Levels: make([][4]float32, m.Levels),
+		}
+		for lvl, r := range m.Rects {
+			probe.Levels[lvl] = [4]float32{
+				float32(ox+r[0]) / float32(width),
+				float32(oy+r[1]) / float32(height),
+				float32(ox+r[0]+r[2]) / float32(width),
+				float32(oy+r[1]+r[3]) / float32(height),
+			}
+		}
+		index.Probes = append(index.Probes, probe)
+	}
+
+	return atlas, index, nil
+}
+
+func writeAtlas(filename string, atlas *libio.FloatImage) error {
+	outFile, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer close(outFile)
+
+	compression := libio.FloatImageCompressionNone
+	if cargs.compress > 0 {
+		compression = libio.FloatImageCompressionFixedPoint16Lz4
+	}
+
+	err = libio.EncodeFloatImage(outFile, atlas, compression)
+	if err != nil {
+		outFile.Close()
+		os.Remove(filename)
+		return err
+	}
+	return nil
+}
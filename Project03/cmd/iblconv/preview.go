@@ -14,10 +14,9 @@ import (
 
 type previewArgs struct {
 	commonArgs
-	gamma     float64
-	scale     float64
+	exposure  float64
+	tonemap   tonemapper
 	device    device
-	reinhard  bool
 	normalize bool
 }
 
@@ -27,10 +26,9 @@ func createPreviewCommand() *command {
 		commonArgs: commonArgs{
 			ext: ".png",
 		},
-		gamma:     2.2,
-		scale:     1.0,
+		exposure:  1.0,
+		tonemap:   tonemapper{libio.TonemapperNone},
 		device:    deviceGpu,
-		reinhard:  false,
 		normalize: true,
 	}
 
@@ -38,11 +36,10 @@ func createPreviewCommand() *command {
 
 	registerCommonFlags(flags, &args.commonArgs)
 
-	flags.Float64Var(&args.gamma, "gamma", args.gamma, "gamma correction value")
-	flags.Float64Var(&args.scale, "scale", args.scale, "brightness scale factor")
+	flags.Float64Var(&args.exposure, "exposure", args.exposure, "brightness scale factor applied before tonemapping")
+	flags.Var(&args.tonemap, "tonemap", "the tonemapper; none, reinhard, aces, agx or uchimura")
 	flags.Var(&args.device, "device", "the preferred opencl deivce; gpu or cpu")
-	flags.BoolVar(&args.reinhard, "reinhard", args.reinhard, "apply reinhard tonemapping")
-	flags.BoolVar(&args.normalize, "normalize", args.normalize, "normalize pixel values to be from 0 to 1")
+	flags.BoolVar(&args.normalize, "normalize", args.normalize, "normalize the tonemapped values to be from 0 to 1")
 
 	return &command{
 		Name: "preview",
@@ -106,17 +103,14 @@ func previewFile(args previewArgs, p string, ext string) error {
 
 		pix := hdri.Level(i)
 		fimg := libio.NewFloatImage(pix, 3, hdri.Size(i), hdri.Size(i)*6)
-		if args.reinhard {
-			for i := 0; i < fimg.Count(); i++ {
-				fimg.Pix[i*3+0] = fimg.Pix[i*3+0] / (1 + fimg.Pix[i*3+0])
-				fimg.Pix[i*3+1] = fimg.Pix[i*3+1] / (1 + fimg.Pix[i*3+1])
-				fimg.Pix[i*3+2] = fimg.Pix[i*3+2] / (1 + fimg.Pix[i*3+2])
-			}
+		fimg.ColorSpace = libio.ColorSpaceLinearSrgb
+		if err := fimg.Tonemap(args.tonemap.Tonemapper, float32(args.exposure)); err != nil {
+			return err
 		}
-		fimg.Tonemap(float32(args.gamma), float32(args.scale))
 		if args.normalize {
 			fimg.Normalize()
 		}
+		// encoded with the sRGB transfer function
 		rgba := fimg.ToIntImage().ToRGBA()
 
 		if !cargs.quiet {
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"time"
 )
@@ -55,6 +56,8 @@ func createResizeCommand() *command {
 }
 
 func runResize(args resizeArgs, inputFiles []string) {
+	runtime.LockOSThread()
+
 	var err error
 	var resizer ibl.Resizer
 
@@ -78,6 +81,28 @@ func runResize(args resizeArgs, inputFiles []string) {
 		if !cargs.quiet {
 			fmt.Println("Using software implementation")
 		}
+	case implGl:
+		var release func()
+		release, err = initGlContext()
+		if err == nil {
+			defer release()
+			resizer, err = ibl.NewGlResizer(args.samples)
+		}
+		if err == nil {
+			defer resizer.Release()
+			if !cargs.quiet {
+				fmt.Println("Using OpenGL implementation")
+			}
+			break
+		}
+		softerr(err)
+		if !cargs.quiet {
+			fmt.Println("Falling back to software implementation")
+		}
+		resizer = ibl.NewSwResizer(args.samples)
+		if !cargs.quiet {
+			fmt.Println("Using software implementation")
+		}
 	}
 
 	ext := cargs.suffix + cargs.ext
@@ -2,6 +2,7 @@ package main
 
 import (
 	"advanced-gl/Project03/ibl"
+	"advanced-gl/Project03/libio"
 	"flag"
 	"fmt"
 	"io"
@@ -15,8 +16,10 @@ import (
 type prefilterArgs struct {
 	commonArgs
 	sizeImplArgs
-	samples int
-	levels  int
+	samples   int
+	levels    int
+	layout    layout
+	roughness roughnessCurve
 }
 
 func createPrefilterCommand() *command {
@@ -36,6 +39,10 @@ func createPrefilterCommand() *command {
 		},
 		samples: 1048576,
 		levels:  5,
+		layout:  layoutCube,
+		roughness: roughnessCurve{
+			RoughnessCurve: ibl.RoughnessLinear,
+		},
 	}
 
 	flags := flag.NewFlagSet("specular", flag.ExitOnError)
@@ -45,6 +52,8 @@ func createPrefilterCommand() *command {
 
 	flags.IntVar(&args.samples, "samples", args.samples, "number of samples used for convolution")
 	flags.IntVar(&args.levels, "levels", args.levels, "the number of precomputed levels")
+	flags.Var(&args.roughness, "roughness-curve", "the roughness of each level; linear, quadratic or a comma separated list with one ascending value per level")
+	flags.Var(&args.layout, "layout", "the output layout; cube, latlong or paraboloid. 2d layouts are written as one f32 image per level, with its roughness in the metadata")
 
 	return &command{
 		Name: "specular",
@@ -54,6 +63,7 @@ func createPrefilterCommand() *command {
 				printCommandUsage(self, " file-glob...")
 			}
 			setCommonArgs(&args.commonArgs)
+			harderr(args.roughness.Validate(args.levels))
 
 			runPrefilter(args, gatherInputFiles(self.Flags.Args()))
 		},
@@ -65,13 +75,17 @@ func runPrefilter(args prefilterArgs, inputFiles []string) {
 	runtime.LockOSThread()
 
 	ext := cargs.suffix + cargs.ext
+	if args.layout != layoutCube && cargs.ext == ".iblenv" {
+		ext = cargs.suffix + ".f32"
+	}
 
 	var err error
 	var conv ibl.Convolver
+	curve := ibl.OptRoughnessCurve(args.roughness.RoughnessCurve)
 
 	switch args.impl {
 	case implCl:
-		conv, err = ibl.NewClSpecularConvolver(args.device.clDevice(), args.samples, args.levels)
+		conv, err = ibl.NewClSpecularConvolver(args.device.clDevice(), args.samples, args.levels, curve)
 		if err == nil {
 			defer conv.Release()
 			if !cargs.quiet {
@@ -85,7 +99,29 @@ func runPrefilter(args prefilterArgs, inputFiles []string) {
 		}
 		fallthrough
 	case implSw:
-		conv = ibl.NewSwSpecularConvolver(args.samples, args.levels)
+		conv = ibl.NewSwSpecularConvolver(args.samples, args.levels, curve)
+		if !cargs.quiet {
+			fmt.Println("Using software implementation")
+		}
+	case implGl:
+		var release func()
+		release, err = initGlContext()
+		if err == nil {
+			defer release()
+			conv, err = ibl.NewGlSpecularConvolver(args.samples, args.levels, curve)
+		}
+		if err == nil {
+			defer conv.Release()
+			if !cargs.quiet {
+				fmt.Println("Using OpenGL implementation")
+			}
+			break
+		}
+		softerr(err)
+		if !cargs.quiet {
+			fmt.Println("Falling back to software implementation")
+		}
+		conv = ibl.NewSwSpecularConvolver(args.samples, args.levels, curve)
 		if !cargs.quiet {
 			fmt.Println("Using software implementation")
 		}
@@ -121,6 +157,10 @@ func prefilterFile(args prefilterArgs, p string, ext string, conv ibl.Convolver)
 		return err
 	}
 
+	if args.layout != layoutCube {
+		return prefilterFile2D(args, p, ext, conv, src)
+	}
+
 	outFilename := filepath.Join(cargs.out, strings.TrimSuffix(filepath.Base(p), filepath.Ext(p))+ext)
 	outFile, err := os.OpenFile(outFilename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
 	if err != nil {
@@ -154,3 +194,53 @@ func prefilterFile(args prefilterArgs, p string, ext string, conv ibl.Convolver)
 
 	return nil
 }
+
+func prefilterFile2D(args prefilterArgs, p string, ext string, conv ibl.Convolver, src *ibl.IblEnv) error {
+	conv2D, ok := conv.(ibl.Convolver2D)
+	if !ok {
+		return fmt.Errorf("the %s implementation does not support the %s layout", args.impl, args.layout)
+	}
+
+	size := args.size.Calc(src.BaseSize)
+	if !cargs.quiet {
+		fmt.Printf("Prefiltering to %dx%dx%d %s images ...\n", size*2, size, args.levels, args.layout)
+	}
+
+	chain, err := conv2D.Convolve2D(src, args.layout.layout2D(), size)
+	if err != nil {
+		return err
+	}
+
+	compression := libio.FloatImageCompressionNone
+	if cargs.compress > 0 {
+		compression = libio.FloatImageCompressionFixedPoint16Lz4
+	}
+
+	for lvl, img := range chain.Levels {
+		// the files of the levels only differ in their roughness and size
+		img.Metadata = libio.FloatImageMetadata{
+			Semantic:  "specular",
+			Layout:    string(args.layout),
+			Roughness: chain.Roughness.Roughness(lvl, len(chain.Levels)),
+		}
+
+		outFilename := filepath.Join(cargs.out, strings.TrimSuffix(filepath.Base(p), filepath.Ext(p))+fmt.Sprintf("_%d", lvl)+ext)
+		outFile, err := os.OpenFile(outFilename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+		if err != nil {
+			return err
+		}
+		defer close(outFile)
+
+		if !cargs.quiet {
+			fmt.Printf("Writing %q ...\n", filepath.ToSlash(filepath.Clean(outFilename)))
+		}
+
+		err = libio.EncodeFloatImage(outFile, img, compression)
+		if err != nil {
+			outFile.Close()
+			os.Remove(outFilename)
+			return err
+		}
+	}
+	return nil
+}
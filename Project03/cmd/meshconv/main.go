@@ -0,0 +1,122 @@
+package main
+
+import (
+	"advanced-gl/Project03/libscn"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var args = struct {
+	optimize bool
+	lods     int
+	lodError float64
+	quantize bool
+	compress int
+	legacy   bool
+}{
+	optimize: true,
+	lods:     0,
+	lodError: 0.01,
+	quantize: false,
+	compress: 0,
+	legacy:   false,
+}
+
+func printGeneralUsage() {
+	exe := filepath.Base(os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s [arguments] <in> [out]\n\n", exe)
+	fmt.Fprintf(os.Stderr, "Optimizes a .geo, .obj, .gltf or .glb mesh for rendering and writes it as .geo file, <out> defaults to <in> with a .geo extension.\n")
+	fmt.Fprintf(os.Stderr, "<out> is required for .geo files, so they are only overwritten on purpose.\n")
+	fmt.Fprintf(os.Stderr, "The nodes of glTF and the objects of obj files are merged into one mesh.\n\n")
+	fmt.Fprintf(os.Stderr, "The arguments are:\n\n")
+	flag.CommandLine.SetOutput(os.Stderr)
+	flag.PrintDefaults()
+	os.Exit(1)
+}
+
+func main() {
+	flag.BoolVar(&args.optimize, "optimize", args.optimize, "weld equal vertices and optimize the vertex cache, overdraw and vertex fetch order")
+	flag.IntVar(&args.lods, "lods", args.lods, "the number of levels of detail, each with about half the triangles of the previous one")
+	flag.Float64Var(&args.lodError, "lod-error", args.lodError, "the largest error of the levels of detail relative to the size of the mesh")
+	flag.BoolVar(&args.quantize, "quantize", args.quantize, "store quantized vertex attributes, like 16 bit positions and octahedral normals")
+	flag.IntVar(&args.compress, "compress", args.compress, "the compression level of the vertex streams from 0 (none) to 10 (high)")
+	flag.BoolVar(&args.legacy, "legacy", args.legacy, "write the original .geo format without tangents and submeshes")
+
+	flag.Parse()
+
+	if flag.NArg() < 1 || flag.NArg() > 2 || args.compress < 0 || args.compress > 10 || args.lods < 0 || args.lods > 255 {
+		printGeneralUsage()
+	}
+	inFilename := flag.Arg(0)
+	outFilename := strings.TrimSuffix(inFilename, filepath.Ext(inFilename)) + ".geo"
+	if flag.NArg() == 2 {
+		outFilename = flag.Arg(1)
+	} else if filepath.Clean(outFilename) == filepath.Clean(inFilename) {
+		harderr(fmt.Errorf("the default output would overwrite %q, give <out> explicitly", inFilename))
+	}
+
+	// the pack decodes all mesh formats, it names meshes up to the first dot of the file name
+	name, _, _ := strings.Cut(filepath.Base(inFilename), ".")
+	pack := &libscn.DirPack{MeshIndex: map[string]string{name: inFilename}}
+	mesh, err := pack.LoadMesh(name)
+	harderr(err)
+
+	fmt.Printf("%s: %d vertices, %d triangles, %d submeshes\n", inFilename, len(mesh.Vertices), len(mesh.Indices)/3, len(mesh.Submeshes))
+	printStatistics("before", mesh)
+	if args.optimize {
+		fmt.Printf("welded %d vertices\n", mesh.WeldVertices())
+	}
+	if args.lods > 0 {
+		mesh.GenerateLods(args.lods, float32(args.lodError))
+		for i, lod := range mesh.Lods {
+			fmt.Printf("lod %d: %d triangles, error %.5f\n", i+1, len(lod.Indices)/3, lod.Error)
+		}
+	}
+	if args.optimize {
+		mesh.Optimize()
+		printStatistics("after", mesh)
+	}
+
+	options := []libscn.MeshEncodeOption{libscn.OptGeoCompress(args.compress - 1)}
+	if args.quantize {
+		options = append(options, libscn.OptGeoQuantize())
+	}
+	if args.legacy {
+		options = append(options, libscn.OptGeoVersion1())
+	}
+	harderr(writeMesh(outFilename, mesh, options))
+	fmt.Printf("%s: %d vertices, %d triangles\n", outFilename, len(mesh.Vertices), len(mesh.Indices)/3)
+}
+
+// Removes the file again when the mesh could not be encoded, harderr exits without running defers
+func writeMesh(filename string, mesh *libscn.Mesh, options []libscn.MeshEncodeOption) error {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+
+	err = libscn.EncodeMesh(file, mesh, options...)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filename)
+		return err
+	}
+	return nil
+}
+
+func printStatistics(label string, mesh *libscn.Mesh) {
+	stats := libscn.AnalyzeVertexCache(mesh.Indices, len(mesh.Vertices), libscn.VertexCacheSize)
+	fmt.Printf("%-6s ACMR %.3f, ATVR %.3f, %d vertices transformed\n", label, stats.ACMR, stats.ATVR, stats.VerticesTransformed)
+}
+
+func harderr(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
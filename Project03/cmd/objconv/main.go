@@ -0,0 +1,240 @@
+package main
+
+import (
+	"advanced-gl/Project03/libio"
+	"advanced-gl/Project03/libscn"
+	"advanced-gl/Project03/stbi"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var args = struct {
+	merge     bool
+	materials bool
+	optimize  bool
+	lods      int
+	quantize  bool
+	compress  int
+	legacy    bool
+}{
+	merge:     false,
+	materials: false,
+	optimize:  false,
+	lods:      0,
+	quantize:  false,
+	compress:  0,
+	legacy:    false,
+}
+
+func printGeneralUsage() {
+	exe := filepath.Base(os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s [arguments] <in> [out]\n\n", exe)
+	fmt.Fprintf(os.Stderr, "Converts the meshes of a Wavefront .obj file to .geo files in the directory <out>, which defaults to the directory of <in>.\n\n")
+	fmt.Fprintf(os.Stderr, "The arguments are:\n\n")
+	flag.CommandLine.SetOutput(os.Stderr)
+	flag.PrintDefaults()
+	os.Exit(1)
+}
+
+func main() {
+	flag.BoolVar(&args.merge, "merge", args.merge, "merge all objects into a single mesh named like <in>")
+	flag.BoolVar(&args.materials, "materials", args.materials, "write a material .json for each material of the .mtl files, separate occlusion, roughness and metallic maps are packed into an orm .png")
+	flag.BoolVar(&args.optimize, "optimize", args.optimize, "weld equal vertices and optimize the vertex cache, overdraw and vertex fetch order of the meshes")
+	flag.IntVar(&args.lods, "lods", args.lods, "the number of levels of detail of the meshes, each with about half the triangles of the previous one")
+	flag.BoolVar(&args.quantize, "quantize", args.quantize, "store quantized vertex attributes, like 16 bit positions and octahedral normals")
+	flag.IntVar(&args.compress, "compress", args.compress, "the compression level of the vertex streams from 0 (none) to 10 (high)")
+	flag.BoolVar(&args.legacy, "legacy", args.legacy, "write the original .geo format without tangents and submeshes")
+
+	flag.Parse()
+
+	if flag.NArg() < 1 || flag.NArg() > 2 || args.compress < 0 || args.compress > 10 || args.lods < 0 || args.lods > 255 {
+		printGeneralUsage()
+	}
+	inFilename := flag.Arg(0)
+	inDir := filepath.Dir(inFilename)
+	outDir := inDir
+	if flag.NArg() == 2 {
+		outDir = flag.Arg(1)
+	}
+	harderr(os.MkdirAll(outDir, 0777))
+
+	file, err := os.Open(inFilename)
+	harderr(err)
+	scene, err := libscn.DecodeObj(file, os.DirFS(inDir))
+	file.Close()
+	harderr(err)
+
+	meshes := []*libscn.Mesh{}
+	if args.merge {
+		name := strings.TrimSuffix(filepath.Base(inFilename), filepath.Ext(inFilename))
+		meshes = append(meshes, scene.Flatten(name))
+	} else {
+		for _, mesh := range scene.Meshes {
+			meshes = append(meshes, mesh.Mesh)
+		}
+	}
+
+	for _, mesh := range meshes {
+		filename := filepath.Join(outDir, sanitize(mesh.Name)+".geo")
+		if args.lods > 0 {
+			mesh.WeldVertices()
+			// a hundredth of the size of the mesh
+			mesh.GenerateLods(args.lods, 0.01)
+		}
+		if args.optimize {
+			mesh.Optimize()
+		}
+		writeMesh(filename, mesh)
+		fmt.Printf("%s: %d vertices, %d triangles\n", filename, len(mesh.Vertices), len(mesh.Indices)/3)
+	}
+
+	if args.materials {
+		for _, mat := range scene.Materials {
+			filename := filepath.Join(outDir, sanitize(mat.Name)+".json")
+			writeMaterial(filename, inDir, outDir, mat)
+			fmt.Printf("%s: material %q\n", filename, mat.Name)
+		}
+	}
+}
+
+// Replaces characters which are not allowed in file names, the pack indexes files by the name up to the first dot
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"/\|?*. `, r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+func writeMesh(filename string, mesh *libscn.Mesh) {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	harderr(err)
+	defer file.Close()
+
+	options := []libscn.MeshEncodeOption{libscn.OptGeoCompress(args.compress - 1)}
+	if args.quantize {
+		options = append(options, libscn.OptGeoQuantize())
+	}
+	if args.legacy {
+		options = append(options, libscn.OptGeoVersion1())
+	}
+	harderr(libscn.EncodeMesh(file, mesh, options...))
+}
+
+func writeMaterial(filename, inDir, outDir string, mat libscn.ObjMaterial) {
+	desc := mat.Desc()
+	base := strings.TrimSuffix(filename, ".json")
+
+	// the material textures are relative to the material file
+	relative := func(name string) string {
+		rel, err := filepath.Rel(outDir, filepath.Join(inDir, filepath.FromSlash(name)))
+		harderr(err)
+		return filepath.ToSlash(rel)
+	}
+
+	if desc.Albedo != "" {
+		desc.Albedo = relative(desc.Albedo)
+	} else {
+		c := mat.DiffuseColor
+		desc.Albedo = writeTexel(base+"_albedo.png", [4]float32{libio.LinearToSrgb(c[0]), libio.LinearToSrgb(c[1]), libio.LinearToSrgb(c[2]), 1})
+	}
+	if desc.Normal != "" {
+		desc.Normal = relative(desc.Normal)
+	} else {
+		desc.Normal = writeTexel(base+"_normal.png", [4]float32{0.5, 0.5, 1, 1})
+	}
+	if desc.ORM != "" {
+		desc.ORM = relative(desc.ORM)
+	} else {
+		desc.ORM = packOrm(base+"_orm.png", inDir, mat)
+	}
+
+	data, err := json.MarshalIndent(struct {
+		Name string `json:"name"`
+		libscn.MaterialDesc
+	}{mat.Name, desc}, "", "\t")
+	harderr(err)
+	harderr(os.WriteFile(filename, data, 0666))
+}
+
+// Packs the occlusion, roughness and metallic maps into the channels of one texture, missing maps are 1, 1 and 0
+func packOrm(filename, inDir string, mat libscn.ObjMaterial) string {
+	maps := []string{mat.Occlusion, mat.Roughness, mat.Metallic}
+	defaults := []uint8{0xff, 0xff, 0}
+
+	images := make([]*libio.IntImage, len(maps))
+	width, height := 1, 1
+	for i, name := range maps {
+		if name == "" {
+			continue
+		}
+		images[i] = loadImage(filepath.Join(inDir, filepath.FromSlash(name)))
+		if images[i].Width*images[i].Height > width*height {
+			width, height = images[i].Width, images[i].Height
+		}
+	}
+
+	orm := libio.NewIntImage(make([]uint8, width*height*4), 4, width, height)
+	for ch, img := range images {
+		if img != nil && (img.Width != width || img.Height != height) {
+			var err error
+			img, err = img.Resample(width, height, libio.ResampleOptions{Filter: libio.ResampleFilterKaiser})
+			harderr(err)
+		}
+		for i := 0; i < width*height; i++ {
+			orm.Pix[i*4+3] = 0xff
+			if img == nil {
+				orm.Pix[i*4+ch] = defaults[ch]
+			} else {
+				// grayscale maps, the first channel is used
+				orm.Pix[i*4+ch] = img.Pix[i*img.Channels]
+			}
+		}
+	}
+
+	writePng(filename, orm)
+	return filepath.Base(filename)
+}
+
+// Writes a texture of a single texel with the color c in [0, 1]
+func writeTexel(filename string, c [4]float32) string {
+	pix := make([]uint8, 4)
+	for i, v := range c {
+		pix[i] = uint8(v*0xff + 0.5)
+	}
+	writePng(filename, libio.NewIntImage(pix, 4, 1, 1))
+	return filepath.Base(filename)
+}
+
+func loadImage(filename string) *libio.IntImage {
+	file, err := os.Open(filename)
+	harderr(err)
+	defer file.Close()
+
+	stbi.Default.FlipVertically = false
+	stbi.Default.CopyData = true
+	img, err := stbi.Load(file)
+	harderr(err)
+	return libio.NewIntImage(img.Pix, 4, img.Rect.Dx(), img.Rect.Dy())
+}
+
+func writePng(filename string, img *libio.IntImage) {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	harderr(err)
+	defer file.Close()
+
+	harderr(png.Encode(file, img.ToRGBA()))
+}
+
+func harderr(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
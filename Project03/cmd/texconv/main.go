@@ -0,0 +1,201 @@
+package main
+
+import (
+	"advanced-gl/Project03/libio"
+	"advanced-gl/Project03/libtex"
+	"advanced-gl/Project03/stbi"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var args = struct {
+	format           string
+	kind             string
+	mips             int
+	filter           string
+	maxSize          int
+	supercompression string
+}{
+	format:           "auto",
+	kind:             "auto",
+	mips:             0,
+	filter:           "kaiser",
+	maxSize:          0,
+	supercompression: "none",
+}
+
+var formats = map[string]libio.DxgiFormat{
+	"bc1": libio.DxgiFormatBC1Unorm,
+	"bc3": libio.DxgiFormatBC3Unorm,
+	"bc4": libio.DxgiFormatBC4Unorm,
+	"bc5": libio.DxgiFormatBC5Unorm,
+	"bc7": libio.DxgiFormatBC7Unorm,
+}
+
+var supercompressions = map[string]libio.Ktx2Supercompression{
+	"none": libio.Ktx2SupercompressionNone,
+	"zstd": libio.Ktx2SupercompressionZstd,
+	"zlib": libio.Ktx2SupercompressionZlib,
+}
+
+var filters = map[string]libio.MipFilter{
+	"box":    libio.MipFilterBox,
+	"kaiser": libio.MipFilterKaiser,
+}
+
+func printGeneralUsage() {
+	exe := filepath.Base(os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s [arguments] <in> [out]\n\n", exe)
+	fmt.Fprintf(os.Stderr, "Compresses a png or jpg image into a .dds or .ktx2 texture, <out> defaults to <in> with a .dds extension.\n\n")
+	fmt.Fprintf(os.Stderr, "The arguments are:\n\n")
+	flag.CommandLine.SetOutput(os.Stderr)
+	flag.PrintDefaults()
+	os.Exit(1)
+}
+
+func main() {
+	flag.StringVar(&args.format, "format", args.format, "auto, bc1, bc3, bc4, bc5 or bc7, auto chooses by the kind and the alpha channel")
+	flag.StringVar(&args.kind, "kind", args.kind, "auto, color, linear, mask or normal, auto guesses by the filename suffix like _normal or _orm")
+	flag.IntVar(&args.mips, "mips", args.mips, "number of mip levels, 0 for a complete mip chain")
+	flag.StringVar(&args.filter, "filter", args.filter, "mip filter, box or kaiser")
+	flag.IntVar(&args.maxSize, "maxsize", args.maxSize, "downscale images larger than this, 0 keeps the size")
+	flag.StringVar(&args.supercompression, "supercompression", args.supercompression, "none, zstd or zlib, the supercompression of .ktx2 files")
+
+	flag.Parse()
+
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		printGeneralUsage()
+	}
+	inFilename := flag.Arg(0)
+	outFilename := strings.TrimSuffix(inFilename, filepath.Ext(inFilename)) + ".dds"
+	if flag.NArg() == 2 {
+		outFilename = flag.Arg(1)
+	}
+	outExt := strings.ToLower(filepath.Ext(outFilename))
+	if outExt != ".dds" && outExt != ".ktx2" {
+		harderr(fmt.Errorf("unsupported output file type %q", outFilename))
+	}
+
+	kind := libtex.KindFromFilename(inFilename)
+	if args.kind != "auto" {
+		var err error
+		kind, err = libtex.ParseTextureKind(args.kind)
+		harderr(err)
+	}
+	filter, ok := filters[args.filter]
+	if !ok {
+		harderr(fmt.Errorf("unknown mip filter %q", args.filter))
+	}
+	supercompression, ok := supercompressions[args.supercompression]
+	if !ok {
+		harderr(fmt.Errorf("unknown supercompression %q", args.supercompression))
+	}
+
+	// dds files store the top row first, ktx2 files are written with the bottom row first like the textures of this module
+	img := loadImage(inFilename, outExt == ".ktx2")
+
+	format := libtex.ChooseFormat(kind, img)
+	if args.format != "auto" {
+		format, ok = formats[strings.ToLower(args.format)]
+		if !ok {
+			harderr(fmt.Errorf("unknown format %q", args.format))
+		}
+		format = libtex.WithSrgb(format, kind == libtex.TextureKindColor)
+	}
+
+	if args.maxSize > 0 && (img.Width > args.maxSize || img.Height > args.maxSize) {
+		img = downscale(img, kind, args.maxSize)
+	}
+
+	tex, err := libtex.GenerateMips(img, kind, args.mips, filter)
+	harderr(err)
+	levels, err := libtex.Compress(tex, format)
+	harderr(err)
+
+	fmt.Printf("%s: %dx%d %v texture as %v with %d levels\n", inFilename, img.Width, img.Height, kind, format, len(levels))
+	for lvl, blocks := range levels {
+		w, h, _ := tex.Size(lvl)
+		pix, err := libio.DecodeBlocks(format, w, h, blocks)
+		harderr(err)
+		decoded := libio.NewIntImage(pix, format.Channels(), w, h)
+		fmt.Printf("  level %2d %5dx%-5d psnr %6.2f dB\n", lvl, w, h, libtex.PSNR(tex.Image(lvl, 0, 0), decoded, format.Channels()))
+	}
+
+	file, err := os.OpenFile(outFilename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	harderr(err)
+	defer file.Close()
+
+	if outExt == ".ktx2" {
+		err = libio.EncodeKtx2(file, &libio.Ktx2Texture{
+			Format: libio.VkFormatFromBlockFormat(format),
+			Width:  img.Width,
+			Height: img.Height,
+			Depth:  1,
+			Layers: 1,
+			Faces:  1,
+			Levels: levels,
+			KeyValues: map[string]string{
+				"KTXorientation": "ru",
+				"KTXwriter":      "texconv",
+			},
+		}, supercompression)
+	} else {
+		err = libio.EncodeDds(file, &libio.DdsTexture{
+			Format: format,
+			Width:  img.Width,
+			Height: img.Height,
+			Depth:  1,
+			Layers: 1,
+			Faces:  1,
+			Levels: levels,
+		})
+	}
+	harderr(err)
+}
+
+func loadImage(filename string, flipVertically bool) *libio.IntImage {
+	file, err := os.Open(filename)
+	harderr(err)
+	defer file.Close()
+
+	stbi.Default.FlipVertically = flipVertically
+	stbi.Default.CopyData = true
+	img, err := stbi.Load(file)
+	harderr(err)
+	return libio.NewIntImage(img.Pix, 4, img.Rect.Dx(), img.Rect.Dy())
+}
+
+// Scales the image down so that its larger side is maxSize, keeping the aspect ratio
+func downscale(img *libio.IntImage, kind libtex.TextureKind, maxSize int) *libio.IntImage {
+	w, h := maxSize, maxSize
+	if img.Width > img.Height {
+		h = img.Height * maxSize / img.Width
+	} else {
+		w = img.Width * maxSize / img.Height
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	opts := libio.ResampleOptions{Filter: libio.ResampleFilterKaiser, Edge: libio.EdgeModeClamp}
+	if kind == libtex.TextureKindColor {
+		img.ColorSpace = libio.ColorSpaceSrgb
+		opts.Alpha = libio.AlphaModeStraight
+	}
+	result, err := img.Resample(w, h, opts)
+	harderr(err)
+	return result
+}
+
+func harderr(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -53,6 +53,39 @@ __kernel void convolve_diffuse(__read_only image2d_array_t srcImage,
   write_imagef(dstImage, (int4)(outu, outv, face, 0), color);
 }
 
+// Convolves the environment with the GGX samples around the normal
+float4 convolveSpecular(__read_only image2d_array_t srcImage, float4 normal,
+                        __global float4 *samples, int samplesStart,
+                        int samplesSize) {
+  float4 view = normal;
+  float4 up = (float4)(0.0f, 0.0f, 1.0f, 0.0f);
+  if (fabs(normal.z) >= 0.999f) {
+    up = (float4)(1.0f, 0.0f, 0.0f, 0.0f);
+  }
+  float4 tangent = normalize(cross(up, normal));
+  float4 bitangent = normalize(cross(normal, tangent));
+
+  float4 cumulative = (float4)(0.0f, 0.0f, 0.0f, 0.0f);
+  float totalWeight = 0.0f;
+  for (int i = 0; i < samplesSize; i++) {
+    float4 sample = samples[samplesStart + i];
+    float4 dir = sample.x * tangent + sample.y * bitangent + sample.z * normal;
+    if (dir.x == 0.0f && dir.y == 0.0f && dir.z == 0.0f) {
+      continue;
+    }
+    dir = normalize(dir);
+    float4 l = normalize(2.0f * dot(view, dir) * dir - view);
+    float ndotl = fmax(dot(normal, l), 0.0f);
+    if (ndotl > 0.0f) {
+      float4 uv = projectCubeMap(l);
+      float4 color = read_imagef(srcImage, srcSampler, uv);
+      cumulative += color * ndotl;
+      totalWeight += ndotl;
+    }
+  }
+  return cumulative / totalWeight;
+}
+
 // The kernel is invoked for every pixel on every face of the cubemap
 // 'size' is the size of a cube map face
 // 'sizefac' is 1/size precomputed
@@ -82,33 +115,35 @@ __kernel void convolve_specular(__read_only image2d_array_t srcImage,
   float z = dot(vec, zTransforms[face]);
 
   float4 normal = normalize((float4)(x, y, z, 0.0f));
-  float4 view = normal;
-  float4 up = (float4)(0.0f, 0.0f, 1.0f, 0.0f);
-  if (fabs(normal.z) >= 0.999f) {
-    up = (float4)(1.0f, 0.0f, 0.0f, 0.0f);
-  }
-  float4 tangent = normalize(cross(up, normal));
-  float4 bitangent = normalize(cross(normal, tangent));
+  float4 color =
+      convolveSpecular(srcImage, normal, samples, samplesStart, samplesSize);
 
-  float4 cumulative = (float4)(0.0f, 0.0f, 0.0f, 0.0f);
-  float totalWeight = 0.0f;
-  for (int i = 0; i < samplesSize; i++) {
-    float4 sample = samples[samplesStart + i];
-    float4 dir = sample.x * tangent + sample.y * bitangent + sample.z * normal;
-    if (dir.x == 0.0f && dir.y == 0.0f && dir.z == 0.0f) {
-      continue;
-    }
-    dir = normalize(dir);
-    float4 l = normalize(2.0f * dot(view, dir) * dir - view);
-    float ndotl = fmax(dot(normal, l), 0.0f);
-    if (ndotl > 0.0f) {
-      float4 uv = projectCubeMap(l);
-      float4 color = read_imagef(srcImage, srcSampler, uv);
-      cumulative += color * ndotl;
-      totalWeight += ndotl;
-    }
+  write_imagef(dstImage, (int4)(outu, outv, face, 0), color);
+}
+
+// The kernel is invoked for every pixel of a 2D layout
+// 'width' and 'height' are the size of the image
+// 'layout' is the Layout2D, see layout2DDirection
+// 'samplesStart' is the first sample index
+// 'samplesSize' is the number of samples
+__kernel void convolve_specular_2d(__read_only image2d_array_t srcImage,
+                                   __write_only image2d_t dstImage, int width,
+                                   int height, int layout,
+                                   __global float4 *samples, int samplesStart,
+                                   int samplesSize) {
+  int outu = get_global_id(0);
+  int outv = get_global_id(1);
+
+  if (outu >= width || outv >= height) {
+    return;
   }
-  float4 color = cumulative / totalWeight;
 
-  write_imagef(dstImage, (int4)(outu, outv, face, 0), color);
-}
\ No newline at end of file
+  float u = ((float)outu + 0.5f) / (float)width;
+  float v = ((float)outv + 0.5f) / (float)height;
+
+  float4 normal = layout2DDirection(layout, u, v);
+  float4 color =
+      convolveSpecular(srcImage, normal, samples, samplesStart, samplesSize);
+
+  write_imagef(dstImage, (int2)(outu, outv), color);
+}
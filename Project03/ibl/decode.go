@@ -2,7 +2,6 @@ package ibl
 
 import (
 	libio "advanced-gl/Project03/libio"
-	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -11,6 +10,7 @@ import (
 	"github.com/pierrec/lz4/v4"
 )
 
+// Decodes an .iblenv file, the rgbe pixels are decoded into new memory
 func DecodeIblEnv(r io.Reader) (env *IblEnv, err error) {
 	var br *libio.BinaryReader
 	var ok bool
@@ -22,49 +22,78 @@ func DecodeIblEnv(r io.Reader) (env *IblEnv, err error) {
 		}
 
 		defer func() {
-			if br.Err != nil {
-				if err == nil {
-					err = br.Err
-				} else {
-					err = fmt.Errorf("%v: %w", err, br.Err)
-				}
+			// errors of the reader are part of the DecodeErrors, unless the decoder did not check them
+			if err == nil && br.Err != nil {
+				err = br.Err
 			}
 		}()
 	}
 
 	header := IblEnvHeader{}
 	if !br.ReadRef(&header) {
-		return nil, fmt.Errorf("expected environment header; byte 0x%08x", br.LastIndex)
+		return nil, br.Errorf("expected environment header")
 	}
 
 	if header.Check != MagicNumberIBLENV {
-		return nil, fmt.Errorf("environment header is corrupt; byte 0x%08x", br.LastIndex)
+		return nil, br.Errorf("environment header is corrupt")
 	}
 
-	if header.Version != IblEnvVersion1_002_000 {
-		return nil, fmt.Errorf("environment version %d unsupported; byte 0x%08x", header.Version, br.LastIndex)
+	if header.Version != IblEnvVersion1_002_000 && header.Version != IblEnvVersion1_003_000 {
+		return nil, br.Errorf("environment version %d unsupported", header.Version)
 	}
 
-	pixr := br.Src
-	if header.Compression == IblEnvCompressionLZ4 || header.Compression == IblEnvCompressionLZ4Fast {
-		pixr = lz4.NewReader(br.Src)
-	} else if header.Compression != IblEnvCompressionNone {
-		return nil, fmt.Errorf("environment compression id %d unsupported; byte 0x%08x", header.Compression, br.LastIndex)
+	size, levels := int(header.Size), int(header.Levels)
+	if size < 1 || levels < 1 || levels > libio.MaxMipLevels(size, size, 1) {
+		return nil, br.Errorf("environment of size %d cannot have %d levels", size, levels)
+	}
+	// the decoded rgb floats of all faces, the levels are less than twice the base level
+	if !br.CheckAlloc(2*6*3*4, size, size) {
+		return nil, br.Errorf("environment size %d is too large", size)
 	}
 
-	pixels := calcCubeMapPixels(int(header.Size), int(header.Levels))
-	data := make([]byte, pixels*4)
-	_, err = io.ReadFull(pixr, data)
-	if err != nil {
-		return nil, fmt.Errorf("expected %d encoded pixels; %w", pixels, err)
+	// version 1.2 has no roughness, it was always linear
+	roughness := RoughnessLinear
+	if header.Version >= IblEnvVersion1_003_000 {
+		var kind int
+		table := make([]float32, levels)
+		if !br.ReadUInt32(&kind) || !br.ReadRef(table) {
+			return nil, br.Errorf("expected environment roughness")
+		}
+		roughness = RoughnessCurve{Kind: RoughnessCurveKind(kind)}
+		if roughness.Kind == RoughnessCurveTable {
+			roughness.Table = table
+		}
+		if err := roughness.Validate(levels); err != nil {
+			return nil, libio.NewDecodeError(br.LastIndex, err, "environment roughness is invalid")
+		}
+	}
+
+	pixels := calcCubeMapPixels(size, levels)
+	var data []byte
+	switch header.Compression {
+	case IblEnvCompressionNone:
+		// references the file when it is mapped
+		if data, ok = br.ReadView(pixels * 4); !ok {
+			return nil, br.Errorf("expected %d encoded pixels", pixels)
+		}
+	case IblEnvCompressionLZ4, IblEnvCompressionLZ4Fast:
+		data = make([]byte, pixels*4)
+		_, err = io.ReadFull(lz4.NewReader(br), data)
+		if err != nil {
+			return nil, libio.NewDecodeError(br.Index, err, "expected %d encoded pixels", pixels)
+		}
+	default:
+		return nil, br.Errorf("environment compression id %d unsupported", header.Compression)
 	}
 
-	colors, err := DecodeRgbe(bytes.NewBuffer(data), false)
+	colors, err := DecodeRgbeBytes(data, false)
 	if err != nil {
-		return nil, fmt.Errorf("decoding error: %w", err)
+		return nil, libio.NewDecodeError(br.Index, err, "environment pixels are corrupt")
 	}
 
-	return NewIblEnv(colors, int(header.Size), int(header.Levels)), nil
+	env = NewIblEnv(colors, size, levels)
+	env.Roughness = roughness
+	return env, nil
 }
 
 func DecodeRgbe(r io.Reader, hasAlpha bool) ([]float32, error) {
@@ -3,12 +3,16 @@ package ibl_test
 import (
 	"advanced-gl/Project03/ibl"
 	ibl_internal "advanced-gl/Project03/ibl/internal"
+	"advanced-gl/Project03/libio"
 	"advanced-gl/Project03/stbi"
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"math"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/chewxy/math32"
@@ -32,6 +36,32 @@ func TestDecodeIblEnv(t *testing.T) {
 	}
 }
 
+func FuzzDecodeIblEnv(f *testing.F) {
+	env := ibl.NewIblEnv(randomFloats(6*(4*4+2*2+1)*3, 0, 100), 4, 3)
+	env.Roughness = ibl.RoughnessCurve{Kind: ibl.RoughnessCurveTable, Table: []float32{0, 0.4, 1}}
+	for _, options := range [][]ibl.EncodeOption{nil, {ibl.OptCompress(0)}} {
+		buf := new(bytes.Buffer)
+		if err := ibl.EncodeIblEnv(buf, env, options...); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf.Bytes())
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		env, err := ibl.DecodeIblEnv(&libio.BinaryReader{Src: bytes.NewReader(data), Order: binary.LittleEndian, MaxAlloc: 1 << 20})
+		if err != nil {
+			var decodeErr *libio.DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Errorf("errors should be DecodeErrors but got: %v", err)
+			}
+			return
+		}
+		if size := env.Size(0); len(env.Face(0, 5)) != size*size*3 {
+			t.Errorf("a face of size %d should have %d floats but had %d", size, size*size*3, len(env.Face(0, 5)))
+		}
+	})
+}
+
 func TestDecodeRgbeChunk(t *testing.T) {
 	hdrData := randomFloats(300, 0, 100)
 	rgbeBuf := new(bytes.Buffer)
@@ -176,6 +206,52 @@ func BenchmarkDecodeCompressLevel1(b *testing.B) {
 	}
 }
 
+func benchmarkDecodeUncompressed(b *testing.B, mapped bool) {
+	env, err := ibl.DecodeIblEnv(bytes.NewBuffer(testdata.iblLevelFast))
+	if err != nil {
+		b.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := ibl.EncodeIblEnv(buf, env); err != nil {
+		b.Fatal(err)
+	}
+	name := filepath.Join(b.TempDir(), "env.iblenv")
+	if err := os.WriteFile(name, buf.Bytes(), 0666); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if mapped {
+			file, err := libio.MapFile(name)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err = ibl.DecodeIblEnv(file.Reader()); err != nil {
+				b.Error(err)
+			}
+			file.Close()
+		} else {
+			file, err := os.Open(name)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err = ibl.DecodeIblEnv(file); err != nil {
+				b.Error(err)
+			}
+			file.Close()
+		}
+	}
+}
+
+func BenchmarkDecodeUncompressedReader(b *testing.B) {
+	benchmarkDecodeUncompressed(b, false)
+}
+
+func BenchmarkDecodeUncompressedMapped(b *testing.B) {
+	benchmarkDecodeUncompressed(b, true)
+}
+
 func decodeRgbeGo(r io.Reader, hasAlpha bool) ([]float32, error) {
 	// 16 kb
 	buf := make([]byte, 16384)
@@ -76,9 +76,15 @@ func EncodeIblEnv(w io.Writer, env *IblEnv, options ...EncodeOption) (err error)
 		}
 	}
 
+	// environments with the linear roughness stay readable by decoders of version 1.2
+	version := IblEnvVersion1_002_000
+	if env.Roughness.Kind != RoughnessCurveLinear {
+		version = IblEnvVersion1_003_000
+	}
+
 	header := IblEnvHeader{
 		Check:       MagicNumberIBLENV,
-		Version:     IblEnvVersion1_002_000,
+		Version:     version,
 		Compression: ctx.Compression,
 		Size:        uint32(env.BaseSize),
 		Levels:      uint32(env.Levels),
@@ -87,6 +93,14 @@ func EncodeIblEnv(w io.Writer, env *IblEnv, options ...EncodeOption) (err error)
 		return fmt.Errorf("could not write ibl env header: %w", bw.Err)
 	}
 
+	// the roughness of every level follows the header, so readers don't have to know the curve
+	if version >= IblEnvVersion1_003_000 {
+		bw.WriteUInt32(uint32(env.Roughness.Kind))
+		if !bw.WriteRef(env.Roughness.Levels(env.Levels)) {
+			return fmt.Errorf("could not write ibl env roughness: %w", bw.Err)
+		}
+	}
+
 	if err := EncodeRgbe(ctx.Writer, env.All(), false); err != nil {
 		return fmt.Errorf("could not write ibl env encoded pixels: %w", err)
 	}
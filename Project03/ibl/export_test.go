@@ -9,3 +9,10 @@ var SampleSequenceImplementation = &sampleSequenceImplementation
 var HammersleySequence = generateHammersleySequence
 var RobertsSequence = generateRobertsSequence
 var RandomSequence = generateRandomSequence
+
+var EncodeOctahedral = encodeOctahedral
+var DecodeOctahedral = decodeOctahedral
+var ForEachCubeMapPixel = forEachCubeMapPixel
+
+var Layout2DDirection = layout2DDirection
+var Layout2DCoords = layout2DCoords
@@ -1,5 +1,10 @@
 package ibl
 
+import (
+	"advanced-gl/Project03/libio"
+	"fmt"
+)
+
 const MagicNumberIBLENV = 0x78b85411
 
 type CubeMapFace int
@@ -26,6 +31,8 @@ type IblEnvVersion uint32
 const (
 	IblEnvVersion1_001_000 = IblEnvVersion(1_001_000)
 	IblEnvVersion1_002_000 = IblEnvVersion(1_002_000)
+	// Adds the roughness curve after the header
+	IblEnvVersion1_003_000 = IblEnvVersion(1_003_000)
 )
 
 type IblEnvCompression uint32
@@ -59,10 +66,12 @@ type IblEnvHeader struct {
 type IblEnv struct {
 	Levels   int
 	BaseSize int
-	faces    [][6][]float32
-	sizes    []int
-	data     []float32
-	levels   [][]float32
+	// The roughness the levels were prefiltered for, only meaningful for specular environments
+	Roughness RoughnessCurve
+	faces     [][6][]float32
+	sizes     []int
+	data      []float32
+	levels    [][]float32
 }
 
 func NewIblEnv(data []float32, size int, levels int) *IblEnv {
@@ -118,6 +127,33 @@ func (env *IblEnv) Size(level int) int {
 	return env.sizes[level]
 }
 
+// Creates an IblEnv from a cube map texture with 3 or 4 channels, alpha is dropped
+func NewIblEnvFromTexture(tex *libio.FloatTexture) (*IblEnv, error) {
+	if !tex.CubeMap || tex.Layers != 6 {
+		return nil, fmt.Errorf("texture is not a single cube map")
+	}
+	if tex.Channels != 3 && tex.Channels != 4 {
+		return nil, fmt.Errorf("cube map must have 3 or 4 channels, not %d", tex.Channels)
+	}
+
+	data := tex.Pix
+	if tex.Channels == 4 {
+		data = make([]float32, tex.Count()*3)
+		for i := 0; i < tex.Count(); i++ {
+			copy(data[i*3:i*3+3], tex.Pix[i*4:i*4+3])
+		}
+	}
+	return NewIblEnv(data, tex.Width, tex.Levels), nil
+}
+
+// Copies the environment to a cube map texture
+func (env *IblEnv) Texture() *libio.FloatTexture {
+	tex := libio.NewFloatTexture(3, env.BaseSize, env.BaseSize, 1, 6, env.Levels)
+	tex.CubeMap = true
+	copy(tex.Pix, env.All())
+	return tex
+}
+
 func calcCubeMapPixels(size int, levels int) int {
 	sum := size * size * 6
 	for i := 1; i < levels; i++ {
@@ -0,0 +1,74 @@
+package ibl
+
+import (
+	"math"
+
+	"github.com/chewxy/math32"
+)
+
+// Layout2D specifies how the directions of an environment are mapped to a 2D image
+type Layout2D int
+
+const (
+	// Equirectangular mapping with a 2:1 aspect ratio, matches sampleSphericalMap.
+	LayoutLatLong = Layout2D(iota)
+	// Two paraboloids side by side with a 2:1 aspect ratio.
+	// The +z hemisphere is on the left, the -z hemisphere is on the right and mirrored horizontally.
+	LayoutDualParaboloid
+)
+
+// Returns the dimensions of the level for a layout with the given base height
+func layout2DSize(size, level int) (width, height int) {
+	height = size >> level
+	return height * 2, height
+}
+
+// Returns the direction for the uv coordinates in the range [0, 1] of the whole image
+func layout2DDirection(layout Layout2D, u, v float32) (x, y, z float32) {
+	switch layout {
+	case LayoutDualParaboloid:
+		back := u >= 0.5
+		s, t := u*4-1, v*2-1
+		if back {
+			s = 3 - u*4
+		}
+		r2 := s*s + t*t
+		x, y, z = 2*s/(1+r2), 2*t/(1+r2), (1-r2)/(1+r2)
+		if back {
+			z = -z
+		}
+		return normalize(x, y, z)
+	default:
+		phi := (u - 0.5) * 2 * math.Pi
+		theta := (v - 0.5) * math.Pi
+		return math32.Cos(theta) * math32.Cos(phi), math32.Sin(theta), math32.Cos(theta) * math32.Sin(phi)
+	}
+}
+
+// Returns the uv coordinates in the range [0, 1] of a normalized direction
+func layout2DCoords(layout Layout2D, x, y, z float32) (u, v float32) {
+	switch layout {
+	case LayoutDualParaboloid:
+		if z >= 0 {
+			u, v = x/(1+z), y/(1+z)
+			return u*0.25 + 0.25, v*0.5 + 0.5
+		}
+		u, v = x/(1-z), y/(1-z)
+		return 0.75 - u*0.25, v*0.5 + 0.5
+	default:
+		return sampleSphericalMap(x, y, z)
+	}
+}
+
+// Calls cb with the direction through the center of every pixel of a width by height image.
+// i is the pixel index.
+func forEachLayout2DPixel(layout Layout2D, width, height int, cb func(px, py int, x, y, z float32, i int)) {
+	for py := 0; py < height; py++ {
+		for px := 0; px < width; px++ {
+			u := (float32(px) + 0.5) / float32(width)
+			v := (float32(py) + 0.5) / float32(height)
+			x, y, z := layout2DDirection(layout, u, v)
+			cb(px, py, x, y, z, px+py*width)
+		}
+	}
+}
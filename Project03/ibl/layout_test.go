@@ -0,0 +1,73 @@
+package ibl_test
+
+import (
+	"advanced-gl/Project03/ibl"
+	"testing"
+
+	"github.com/chewxy/math32"
+)
+
+func TestLayout2DDirections(t *testing.T) {
+	coords := randomFloats(2*1000, 0.001, 0.999)
+	for _, layout := range []ibl.Layout2D{ibl.LayoutLatLong, ibl.LayoutDualParaboloid} {
+		for i := 0; i < len(coords); i += 2 {
+			u, v := coords[i], coords[i+1]
+			if layout == ibl.LayoutDualParaboloid {
+				// skip the corners outside of the paraboloids
+				s, t := math32.Mod(u*4, 2)-1, v*2-1
+				if s*s+t*t > 1 {
+					continue
+				}
+			}
+			x, y, z := ibl.Layout2DDirection(layout, u, v)
+			ru, rv := ibl.Layout2DCoords(layout, x, y, z)
+			if math32.Abs(ru-u) > 1e-4 || math32.Abs(rv-v) > 1e-4 {
+				t.Fatalf("layout %d: uv (%f, %f) is (%f, %f) after round trip", layout, u, v, ru, rv)
+			}
+		}
+	}
+}
+
+func TestConvolveSpecular2DSw(t *testing.T) {
+	// a smooth environment, the color is the direction
+	size := 32
+	data := make([]float32, size*size*6*3)
+	ibl.ForEachCubeMapPixel(size, func(face, pu, pv int, cx, cy, cz float32, i int) {
+		l := math32.Sqrt(cx*cx + cy*cy + cz*cz)
+		data[i*3+0] = cx/l + 1
+		data[i*3+1] = cy/l + 1
+		data[i*3+2] = cz/l + 1
+	})
+	env := ibl.NewIblEnv(data, size, 1)
+
+	conv := ibl.NewSwSpecularConvolver(64, 3).(ibl.Convolver2D)
+	for _, layout := range []ibl.Layout2D{ibl.LayoutLatLong, ibl.LayoutDualParaboloid} {
+		result, err := conv.Convolve2D(env, layout, 16)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result.Levels) != 3 {
+			t.Fatalf("result has %d levels, should be 3", len(result.Levels))
+		}
+		for lvl, img := range result.Levels {
+			if img.Width != 32>>lvl || img.Height != 16>>lvl {
+				t.Errorf("level %d is %dx%d, should be %dx%d", lvl, img.Width, img.Height, 32>>lvl, 16>>lvl)
+			}
+		}
+
+		// the first level is not blurred, so every pixel should be its direction
+		img := result.Levels[0]
+		for py := 0; py < img.Height; py++ {
+			for px := 0; px < img.Width; px++ {
+				u := (float32(px) + 0.5) / float32(img.Width)
+				v := (float32(py) + 0.5) / float32(img.Height)
+				x, y, z := ibl.Layout2DDirection(layout, u, v)
+				i := img.Index(px, py)
+				if math32.Abs(img.Pix[i+0]-x-1) > 0.05 || math32.Abs(img.Pix[i+1]-y-1) > 0.05 || math32.Abs(img.Pix[i+2]-z-1) > 0.05 {
+					t.Fatalf("layout %d: pixel (%d, %d) is %v, should be (%f, %f, %f)", layout, px, py, img.Pix[i:i+3], x+1, y+1, z+1)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package ibl
+
+import (
+	"advanced-gl/Project03/libio"
+	"fmt"
+
+	"github.com/chewxy/math32"
+)
+
+// An OctahedralEnv is an IblEnv stored as octahedral maps in a single 2D image.
+// Every level is a square tile with a border of 'Border' texels on each side.
+// The tiles are placed next to each other from left to right, bottom aligned.
+//
+// The border texels repeat the texels on the opposite side of the adjacent edge,
+// so bilinear filtering works across the edges of the octahedron.
+type OctahedralEnv struct {
+	Image    *libio.FloatImage
+	Levels   int
+	BaseSize int
+	Border   int
+	// the inner rectangle (x, y, width, height) of each level in pixels, excluding the border
+	Rects [][4]int
+}
+
+// Returns the inner rectangle of the level in uv coordinates as (u0, v0, u1, v1)
+func (oct *OctahedralEnv) UvRect(level int) [4]float32 {
+	r := oct.Rects[level]
+	w, h := float32(oct.Image.Width), float32(oct.Image.Height)
+	return [4]float32{
+		float32(r[0]) / w,
+		float32(r[1]) / h,
+		float32(r[0]+r[2]) / w,
+		float32(r[1]+r[3]) / h,
+	}
+}
+
+// Calculates the image size and level rectangles of an octahedral env
+func octahedralLayout(size, levels, border int) (width, height int, rects [][4]int) {
+	rects = make([][4]int, levels)
+	lvlsize := size
+	for lvl := 0; lvl < levels; lvl++ {
+		rects[lvl] = [4]int{width + border, border, lvlsize, lvlsize}
+		width += lvlsize + 2*border
+		lvlsize /= 2
+	}
+	height = size + 2*border
+	return
+}
+
+// Converts all levels of env to octahedral maps.
+// size is the resolution of the first level, the following levels are halved each.
+// border is the number of border texels, 1 is enough for bilinear filtering.
+func CubeToOctahedral(env *IblEnv, size, border int) (*OctahedralEnv, error) {
+	if size>>(env.Levels-1) < 1 {
+		return nil, fmt.Errorf("size %d is too small for %d levels", size, env.Levels)
+	}
+	if border < 0 || border > size>>(env.Levels-1) {
+		return nil, fmt.Errorf("invalid border size %d", border)
+	}
+
+	width, height, rects := octahedralLayout(size, env.Levels, border)
+	img := libio.NewFloatImage(make([]float32, width*height*3), 3, width, height)
+
+	for lvl := 0; lvl < env.Levels; lvl++ {
+		rect := rects[lvl]
+		lvlsize := rect[2]
+		envsize := env.Size(lvl)
+		for py := -border; py < lvlsize+border; py++ {
+			for px := -border; px < lvlsize+border; px++ {
+				wx, wy := wrapOctahedral(px, py, lvlsize)
+				u := (2*float32(wx)+1)/float32(lvlsize) - 1
+				v := (2*float32(wy)+1)/float32(lvlsize) - 1
+				dx, dy, dz := decodeOctahedral(u, v)
+
+				face, su, sv := sampleCubeMap(dx, dy, dz)
+				r, g, b := sampleBilinear(envsize, envsize, 3, env.Face(lvl, face), su, sv)
+
+				i := img.Index(rect[0]+px, rect[1]+py)
+				img.Pix[i+0] = r
+				img.Pix[i+1] = g
+				img.Pix[i+2] = b
+			}
+		}
+	}
+
+	return &OctahedralEnv{
+		Image:    img,
+		Levels:   env.Levels,
+		BaseSize: size,
+		Border:   border,
+		Rects:    rects,
+	}, nil
+}
+
+// Converts the octahedral maps back to a cube map.
+// size is the face resolution of the first level.
+func OctahedralToCube(oct *OctahedralEnv, size int) (*IblEnv, error) {
+	if size>>(oct.Levels-1) < 1 {
+		return nil, fmt.Errorf("size %d is too small for %d levels", size, oct.Levels)
+	}
+
+	result := make([]float32, calcCubeMapPixels(size, oct.Levels)*3)
+
+	lvlsize := size
+	for lvl := 0; lvl < oct.Levels; lvl++ {
+		tile, tilesize := octahedralTile(oct, lvl)
+		innersize := oct.Rects[lvl][2]
+		// scale and offset from [0, 1] of the inner area to the tile with borders
+		uvscale := float32(innersize) / float32(tilesize)
+		uvoffset := float32(oct.Border) / float32(tilesize)
+
+		lvlStart, lvlEnd := calcCubeMapOffset(size, lvl)
+		lvlResult := result[lvlStart*3 : lvlEnd*3]
+		forEachCubeMapPixel(lvlsize, func(face, pu, pv int, cx, cy, cz float32, i int) {
+			u, v := encodeOctahedral(cx, cy, cz)
+			u = (u*0.5+0.5)*uvscale + uvoffset
+			v = (v*0.5+0.5)*uvscale + uvoffset
+
+			r, g, b := sampleBilinear(tilesize, tilesize, 3, tile, u, v)
+			lvlResult[i*3+0] = r
+			lvlResult[i*3+1] = g
+			lvlResult[i*3+2] = b
+		})
+		lvlsize /= 2
+	}
+
+	return NewIblEnv(result, size, oct.Levels), nil
+}
+
+// Copies a level including its border out of the image
+func octahedralTile(oct *OctahedralEnv, level int) (tile []float32, size int) {
+	rect := oct.Rects[level]
+	size = rect[2] + 2*oct.Border
+	tile = make([]float32, size*size*3)
+	x0, y0 := rect[0]-oct.Border, rect[1]-oct.Border
+	for y := 0; y < size; y++ {
+		start := oct.Image.Index(x0, y0+y)
+		copy(tile[y*size*3:(y+1)*size*3], oct.Image.Pix[start:start+size*3])
+	}
+	return tile, size
+}
+
+// Maps pixels outside of the octahedral map to the pixel they should repeat.
+// Crossing an edge mirrors the position along that edge.
+func wrapOctahedral(px, py, size int) (int, int) {
+	if px < 0 {
+		px = -1 - px
+		py = size - 1 - py
+	} else if px >= size {
+		px = 2*size - 1 - px
+		py = size - 1 - py
+	}
+	if py < 0 {
+		py = -1 - py
+		px = size - 1 - px
+	} else if py >= size {
+		py = 2*size - 1 - py
+		px = size - 1 - px
+	}
+	return px, py
+}
+
+// Encodes a direction to octahedral coordinates in the range [-1, 1].
+// The upper hemisphere (+y) is in the center, the lower one is folded into the corners.
+//
+// See: https://jcgt.org/published/0003/02/01/
+func encodeOctahedral(x, y, z float32) (u, v float32) {
+	l1 := math32.Abs(x) + math32.Abs(y) + math32.Abs(z)
+	u, v = x/l1, z/l1
+	if y < 0 {
+		u, v = (1-math32.Abs(v))*signNotZero(u), (1-math32.Abs(u))*signNotZero(v)
+	}
+	return u, v
+}
+
+// Decodes octahedral coordinates in the range [-1, 1] to a normalized direction
+func decodeOctahedral(u, v float32) (x, y, z float32) {
+	x, y, z = u, 1-math32.Abs(u)-math32.Abs(v), v
+	if y < 0 {
+		x, z = (1-math32.Abs(v))*signNotZero(u), (1-math32.Abs(u))*signNotZero(v)
+	}
+	return normalize(x, y, z)
+}
+
+func signNotZero(v float32) float32 {
+	if v < 0 {
+		return -1
+	}
+	return 1
+}
@@ -0,0 +1,103 @@
+package ibl_test
+
+import (
+	"advanced-gl/Project03/ibl"
+	"testing"
+
+	"github.com/chewxy/math32"
+)
+
+func TestOctahedralDirections(t *testing.T) {
+	dirs := randomFloats(3*1000, -1, 1)
+	for i := 0; i < len(dirs); i += 3 {
+		x, y, z := dirs[i], dirs[i+1], dirs[i+2]
+		l := math32.Sqrt(x*x + y*y + z*z)
+		x, y, z = x/l, y/l, z/l
+
+		u, v := ibl.EncodeOctahedral(x, y, z)
+		if u < -1 || u > 1 || v < -1 || v > 1 {
+			t.Fatalf("octahedral coordinates (%f, %f) out of range", u, v)
+		}
+		dx, dy, dz := ibl.DecodeOctahedral(u, v)
+		if math32.Abs(dx-x) > 1e-5 || math32.Abs(dy-y) > 1e-5 || math32.Abs(dz-z) > 1e-5 {
+			t.Fatalf("direction (%f, %f, %f) decoded as (%f, %f, %f)", x, y, z, dx, dy, dz)
+		}
+	}
+}
+
+func TestOctahedralBorder(t *testing.T) {
+	oct, err := ibl.CubeToOctahedral(testdata.iblStudioSmall, 64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img := oct.Image
+	for lvl, rect := range oct.Rects {
+		x0, y0, size := rect[0], rect[1], rect[2]
+		for i := 0; i < size; i++ {
+			// left and right edges are mirrored vertically
+			expectEqualTexel(t, lvl, img.Pix[img.Index(x0-1, y0+i):], img.Pix[img.Index(x0, y0+size-1-i):])
+			expectEqualTexel(t, lvl, img.Pix[img.Index(x0+size, y0+i):], img.Pix[img.Index(x0+size-1, y0+size-1-i):])
+			// bottom and top edges are mirrored horizontally
+			expectEqualTexel(t, lvl, img.Pix[img.Index(x0+i, y0-1):], img.Pix[img.Index(x0+size-1-i, y0):])
+			expectEqualTexel(t, lvl, img.Pix[img.Index(x0+i, y0+size):], img.Pix[img.Index(x0+size-1-i, y0+size-1):])
+		}
+		// corners repeat the opposite corner
+		expectEqualTexel(t, lvl, img.Pix[img.Index(x0-1, y0-1):], img.Pix[img.Index(x0+size-1, y0+size-1):])
+		expectEqualTexel(t, lvl, img.Pix[img.Index(x0+size, y0+size):], img.Pix[img.Index(x0, y0):])
+	}
+}
+
+func expectEqualTexel(t *testing.T, level int, a, b []float32) {
+	t.Helper()
+	if a[0] != b[0] || a[1] != b[1] || a[2] != b[2] {
+		t.Fatalf("border texel %v of level %d should be %v", a[:3], level, b[:3])
+	}
+}
+
+func TestOctahedralRoundTrip(t *testing.T) {
+	// a smooth environment, the color is the direction
+	size, levels := 32, 3
+	data := []float32{}
+	for lvl := 0; lvl < levels; lvl++ {
+		lvlData := make([]float32, (size>>lvl)*(size>>lvl)*6*3)
+		ibl.ForEachCubeMapPixel(size>>lvl, func(face, pu, pv int, cx, cy, cz float32, i int) {
+			l := math32.Sqrt(cx*cx + cy*cy + cz*cz)
+			lvlData[i*3+0] = cx/l + 1
+			lvlData[i*3+1] = cy/l + 1
+			lvlData[i*3+2] = cz/l + 1
+		})
+		data = append(data, lvlData...)
+	}
+	env := ibl.NewIblEnv(data, size, levels)
+
+	oct, err := ibl.CubeToOctahedral(env, size*2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	width := (size*2 + 4) + (size + 4) + (size/2 + 4)
+	if oct.Image.Width != width || oct.Image.Height != size*2+4 {
+		t.Errorf("image size is %dx%d but should be %dx%d", oct.Image.Width, oct.Image.Height, width, size*2+4)
+	}
+
+	uv := oct.UvRect(1)
+	expected := [4]float32{
+		float32(size*2+4+2) / float32(width),
+		2 / float32(size*2+4),
+		float32(size*2+4+2+size) / float32(width),
+		float32(size+2) / float32(size*2+4),
+	}
+	if uv != expected {
+		t.Errorf("uv rect of level 1 is %v but should be %v", uv, expected)
+	}
+
+	result, err := ibl.OctahedralToCube(oct, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saveResultIbl(t.Name(), result)
+
+	compareIblEnv(t, env, result, 0.01)
+}
@@ -47,9 +47,11 @@ type clDiffuseConvolver struct {
 type clSpecularConvolver struct {
 	clCore
 	kernel       *cl.Kernel
+	kernel2D     *cl.Kernel
 	samples      *cl.MemObject
 	samplesIndex [][2]int
 	levels       int
+	curve        RoughnessCurve
 	resizer      *clResizer
 }
 
@@ -349,7 +351,9 @@ func (conv *clDiffuseConvolver) Release() {
 	conv.samples.Release()
 }
 
-func NewClSpecularConvolver(preferredDevice DeviceType, quality, levels int) (conv Convolver, err error) {
+func NewClSpecularConvolver(preferredDevice DeviceType, quality, levels int, options ...SpecularOption) (conv Convolver, err error) {
+	cfg := applySpecularOptions(options)
+
 	core, err := newClCore(preferredDevice, openclSharedSrc, openclConvolveSrc, openclResizeSrc)
 	if err != nil {
 		return nil, err
@@ -359,7 +363,7 @@ func NewClSpecularConvolver(preferredDevice DeviceType, quality, levels int) (co
 		return nil, err
 	}
 
-	samples := generateSpecularConvolutionSamples(quality, levels)
+	samples := generateSpecularConvolutionSamples(quality, levels, cfg.curve)
 
 	sampleCount := len(samples[0])
 	samplesIndex := make([][2]int, levels)
@@ -380,6 +384,16 @@ func NewClSpecularConvolver(preferredDevice DeviceType, quality, levels int) (co
 		return nil, err
 	}
 
+	kernel2D, err := core.program.CreateKernel("convolve_specular_2d")
+	if err != nil {
+		return nil, err
+	}
+
+	err = kernel2D.SetArgBuffer(5, sampleBuf)
+	if err != nil {
+		return nil, err
+	}
+
 	resizer, err := newClResizer(core, 11)
 	if err != nil {
 		return nil, err
@@ -388,9 +402,11 @@ func NewClSpecularConvolver(preferredDevice DeviceType, quality, levels int) (co
 	return &clSpecularConvolver{
 		clCore:       *core,
 		kernel:       kernel,
+		kernel2D:     kernel2D,
 		samples:      sampleBuf,
 		samplesIndex: samplesIndex,
 		levels:       levels,
+		curve:        cfg.curve,
 		resizer:      resizer,
 	}, nil
 }
@@ -415,10 +431,15 @@ func (conv *clSpecularConvolver) Convolve(env *IblEnv, size int) (*IblEnv, error
 	pixels := calcCubeMapPixels(size, conv.levels)
 	result := make([]float32, pixels*4)
 	lvlsize := size
-	resizeLevelCl(conv.clCore, conv.resizer.kernel, result, lvlsize)
-	lvlsize /= 2
+	first := 0
+	if conv.curve.Roughness(0, conv.levels) == 0 {
+		// roughness 0 is just a resized copy
+		resizeLevelCl(conv.clCore, conv.resizer.kernel, result, lvlsize)
+		lvlsize /= 2
+		first = 1
+	}
 
-	for lvl := 1; lvl < conv.levels; lvl++ {
+	for lvl := first; lvl < conv.levels; lvl++ {
 		dstImage, err := conv.context.CreateImage(cl.MemWriteOnly, cl.ImageFormat{
 			ChannelOrder:    cl.ChannelOrderRGBA,
 			ChannelDataType: cl.ChannelDataTypeFloat,
@@ -483,12 +504,93 @@ func (conv *clSpecularConvolver) Convolve(env *IblEnv, size int) (*IblEnv, error
 	result = result[: pixels*3 : pixels*3]
 
 	iblEnv := NewIblEnv(result, size, conv.levels)
+	iblEnv.Roughness = conv.curve
 
 	return iblEnv, nil
 }
 
+func (conv *clSpecularConvolver) Convolve2D(env *IblEnv, layout Layout2D, size int) (*MipChain2D, error) {
+	srcImage, err := iblEnvToClBuffer(env, conv.context)
+	if err != nil {
+		return nil, err
+	}
+	defer srcImage.Release()
+
+	err = conv.kernel2D.SetArgBuffer(0, srcImage)
+	if err != nil {
+		return nil, err
+	}
+	err = conv.kernel2D.SetArgInt32(4, int32(layout))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &MipChain2D{
+		Layout:    layout,
+		Levels:    make([]*libio.FloatImage, conv.levels),
+		Roughness: conv.curve,
+	}
+
+	for lvl := 0; lvl < conv.levels; lvl++ {
+		width, height := layout2DSize(size, lvl)
+		dstImage, err := conv.context.CreateImage(cl.MemWriteOnly, cl.ImageFormat{
+			ChannelOrder:    cl.ChannelOrderRGBA,
+			ChannelDataType: cl.ChannelDataTypeFloat,
+		}, cl.ImageDescription{
+			Type:   cl.MemObjectTypeImage2D,
+			Width:  width,
+			Height: height,
+		}, width*height*4*4, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer dstImage.Release()
+
+		err = conv.kernel2D.SetArgBuffer(1, dstImage)
+		if err != nil {
+			return nil, err
+		}
+		err = conv.kernel2D.SetArgInt32(2, int32(width))
+		if err != nil {
+			return nil, err
+		}
+		err = conv.kernel2D.SetArgInt32(3, int32(height))
+		if err != nil {
+			return nil, err
+		}
+		err = conv.kernel2D.SetArgInt32(6, int32(conv.samplesIndex[lvl][0]))
+		if err != nil {
+			return nil, err
+		}
+		err = conv.kernel2D.SetArgInt32(7, int32(conv.samplesIndex[lvl][1]))
+		if err != nil {
+			return nil, err
+		}
+
+		localWorkSize := []int{32, 32}
+		globalWorkSize := []int{roundUpKernelSize(localWorkSize[0], width), roundUpKernelSize(localWorkSize[1], height)}
+
+		_, err = conv.queue.EnqueueNDRangeKernel(conv.kernel2D, []int{0, 0}, globalWorkSize, localWorkSize, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		lvlResult := make([]float32, width*height*4)
+		_, err = conv.queue.EnqueueReadImage(dstImage, true, [3]int{}, [3]int{width, height, 1}, 0, 0, unsafe.Pointer(&lvlResult[0]), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		dstImage.Release()
+		result.Levels[lvl] = libio.NewFloatImage(lvlResult, 4, width, height).ToChannels(3)
+	}
+
+	return result, nil
+}
+
 func (conv *clSpecularConvolver) Release() {
 	conv.kernel.Release()
+	conv.kernel2D.Release()
 	conv.program.Release()
 	conv.queue.Release()
 	conv.context.Release()
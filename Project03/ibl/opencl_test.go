@@ -132,5 +132,5 @@ func TestIntegrateBrdfSpecularCl(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	saveResultFloatImage(t.Name(), img, 1.0, 1.0)
+	saveResultFloatImage(t.Name(), img)
 }
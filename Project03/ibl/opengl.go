@@ -17,6 +17,18 @@ var vertShaderSrc string
 //go:embed convert.frag
 var fragShaderSrc string
 
+//go:embed shared.glsl
+var glslSharedSrc string
+
+//go:embed convolve.comp
+var glslConvolveSrc string
+
+//go:embed resize.comp
+var glslResizeSrc string
+
+// the local work group size of the compute shaders in x and y
+const glWorkGroupSize = 8
+
 type glConverter struct {
 	hdrSampler     libgl.UnboundSampler
 	cubemapSampler libgl.UnboundSampler
@@ -160,3 +172,260 @@ func (conv *glConverter) Release() {
 	conv.shader.FragmentStage().Delete()
 	conv.shader.Delete()
 }
+
+type glComputeCore struct {
+	sampler libgl.UnboundSampler
+	shader  libgl.UnboundShaderPipeline
+	samples libgl.UnboundBuffer
+}
+
+type glDiffuseConvolver struct {
+	glComputeCore
+	sampleCount int
+}
+
+type glSpecularConvolver struct {
+	glComputeCore
+	samplesIndex [][2]int
+	levels       int
+	curve        RoughnessCurve
+	resizer      *glResizer
+}
+
+type glResizer struct {
+	glComputeCore
+	sampleCount int
+}
+
+// Compiles the concatenated sources into a compute shader pipeline and uploads the samples into a shader storage buffer
+func newGlComputeCore(samples any, defs map[string]string, sources ...string) (core *glComputeCore, err error) {
+	cleanup := []libutil.Deleter{}
+	defer func() {
+		if err != nil {
+			for _, v := range cleanup {
+				v.Delete()
+			}
+		}
+	}()
+
+	sampler := libgl.NewSampler()
+	sampler.WrapMode(gl.CLAMP_TO_EDGE, gl.CLAMP_TO_EDGE, 0)
+	sampler.FilterMode(gl.LINEAR, gl.LINEAR)
+	cleanup = append(cleanup, sampler)
+
+	src := ""
+	for _, s := range sources {
+		src += s
+	}
+
+	shader := libgl.NewPipeline()
+	cleanup = append(cleanup, shader)
+	csh := libgl.NewShader(src, gl.COMPUTE_SHADER)
+	cleanup = append(cleanup, csh)
+	if err := csh.CompileWith(defs); err != nil {
+		return nil, err
+	}
+	shader.Attach(csh, gl.COMPUTE_SHADER_BIT)
+
+	samplesBuf := libgl.NewBuffer()
+	cleanup = append(cleanup, samplesBuf)
+	samplesBuf.Allocate(samples, 0)
+
+	return &glComputeCore{
+		sampler: sampler,
+		shader:  shader,
+		samples: samplesBuf,
+	}, nil
+}
+
+func (core *glComputeCore) bind(src libgl.UnboundTexture) {
+	core.shader.Bind()
+	src.Bind(0)
+	core.sampler.Bind(0)
+	core.samples.BindBase(gl.SHADER_STORAGE_BUFFER, 0)
+}
+
+// Runs the bound compute shader for every pixel of the given level of dst
+func (core *glComputeCore) dispatch(dst libgl.UnboundTexture, level, size int) {
+	dst.BindImage(0, level, true, 0, gl.WRITE_ONLY, gl.RGBA32F)
+	groups := uint32(roundUpKernelSize(glWorkGroupSize, size) / glWorkGroupSize)
+	gl.DispatchCompute(groups, groups, 6)
+}
+
+func (core *glComputeCore) Release() {
+	core.shader.ComputeStage().Delete()
+	core.shader.Delete()
+	core.sampler.Delete()
+	core.samples.Delete()
+}
+
+func NewGlDiffuseConvolver(quality int) (conv Convolver, err error) {
+	samples := generateDiffuseConvolutionSamples(quality)
+	core, err := newGlComputeCore(samples, map[string]string{"DIFFUSE": ""}, glslSharedSrc, glslConvolveSrc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &glDiffuseConvolver{
+		glComputeCore: *core,
+		sampleCount:   len(samples),
+	}, nil
+}
+
+func (conv *glDiffuseConvolver) Convolve(env *IblEnv, size int) (*IblEnv, error) {
+	srcTexture := iblEnvToGlTexture(env)
+	defer srcTexture.Delete()
+
+	dstTexture := libgl.NewTexture(gl.TEXTURE_2D_ARRAY)
+	dstTexture.Allocate(1, gl.RGBA32F, size, size, 6)
+	defer dstTexture.Delete()
+
+	conv.bind(srcTexture)
+	conv.shader.ComputeStage().SetUniform("u_size", size)
+	conv.shader.ComputeStage().SetUniform("u_samples_start", 0)
+	conv.shader.ComputeStage().SetUniform("u_samples_count", conv.sampleCount)
+	conv.dispatch(dstTexture, 0, size)
+
+	result := make([]float32, calcCubeMapPixels(size, 1)*3)
+	readGlTextureLevel(dstTexture, 0, result)
+
+	return NewIblEnv(result, size, 1), nil
+}
+
+func NewGlSpecularConvolver(quality, levels int, options ...SpecularOption) (conv Convolver, err error) {
+	cfg := applySpecularOptions(options)
+	samples := generateSpecularConvolutionSamples(quality, levels, cfg.curve)
+
+	// all levels share one buffer, the index stores the start and count for each level
+	samplesIndex := make([][2]int, levels)
+	contiguous := []sample{}
+	for lvl, lvlSamples := range samples {
+		samplesIndex[lvl] = [2]int{len(contiguous), len(lvlSamples)}
+		contiguous = append(contiguous, lvlSamples...)
+	}
+
+	core, err := newGlComputeCore(contiguous, map[string]string{"SPECULAR": ""}, glslSharedSrc, glslConvolveSrc)
+	if err != nil {
+		return nil, err
+	}
+
+	resizer, err := newGlResizer(11)
+	if err != nil {
+		core.Release()
+		return nil, err
+	}
+
+	return &glSpecularConvolver{
+		glComputeCore: *core,
+		samplesIndex:  samplesIndex,
+		levels:        levels,
+		curve:         cfg.curve,
+		resizer:       resizer,
+	}, nil
+}
+
+func (conv *glSpecularConvolver) Convolve(env *IblEnv, size int) (*IblEnv, error) {
+	srcTexture := iblEnvToGlTexture(env)
+	defer srcTexture.Delete()
+
+	dstTexture := libgl.NewTexture(gl.TEXTURE_2D_ARRAY)
+	dstTexture.Allocate(conv.levels, gl.RGBA32F, size, size, 6)
+	defer dstTexture.Delete()
+
+	lvlsize := size
+	first := 0
+	if conv.curve.Roughness(0, conv.levels) == 0 {
+		// roughness 0 is just a resized copy
+		conv.resizer.bind(srcTexture)
+		conv.resizer.shader.ComputeStage().SetUniform("u_size", size)
+		conv.resizer.shader.ComputeStage().SetUniform("u_samples_count", conv.resizer.sampleCount)
+		conv.resizer.dispatch(dstTexture, 0, size)
+		lvlsize /= 2
+		first = 1
+	}
+
+	conv.bind(srcTexture)
+	for lvl := first; lvl < conv.levels; lvl++ {
+		conv.shader.ComputeStage().SetUniform("u_size", lvlsize)
+		conv.shader.ComputeStage().SetUniform("u_samples_start", conv.samplesIndex[lvl][0])
+		conv.shader.ComputeStage().SetUniform("u_samples_count", conv.samplesIndex[lvl][1])
+		conv.dispatch(dstTexture, lvl, lvlsize)
+		lvlsize /= 2
+	}
+
+	result := make([]float32, calcCubeMapPixels(size, conv.levels)*3)
+	for lvl := 0; lvl < conv.levels; lvl++ {
+		lvlStart, lvlEnd := calcCubeMapOffset(size, lvl)
+		readGlTextureLevel(dstTexture, lvl, result[lvlStart*3:lvlEnd*3])
+	}
+
+	iblEnv := NewIblEnv(result, size, conv.levels)
+	iblEnv.Roughness = conv.curve
+	return iblEnv, nil
+}
+
+func (conv *glSpecularConvolver) Release() {
+	conv.glComputeCore.Release()
+	conv.resizer.Release()
+}
+
+func NewGlResizer(supersample int) (resizer Resizer, err error) {
+	return newGlResizer(supersample)
+}
+
+func newGlResizer(supersample int) (*glResizer, error) {
+	samples := generateSuperSamples(supersample)
+	core, err := newGlComputeCore(samples, nil, glslSharedSrc, glslResizeSrc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &glResizer{
+		glComputeCore: *core,
+		sampleCount:   len(samples),
+	}, nil
+}
+
+func (resizer *glResizer) Resize(env *IblEnv, size int) (*IblEnv, error) {
+	srcTexture := iblEnvToGlTexture(env)
+	defer srcTexture.Delete()
+
+	dstTexture := libgl.NewTexture(gl.TEXTURE_2D_ARRAY)
+	dstTexture.Allocate(env.Levels, gl.RGBA32F, size, size, 6)
+	defer dstTexture.Delete()
+
+	resizer.bind(srcTexture)
+	resizer.shader.ComputeStage().SetUniform("u_samples_count", resizer.sampleCount)
+
+	// like the software implementation, every level is resized from the base level
+	lvlsize := size
+	for lvl := 0; lvl < env.Levels; lvl++ {
+		resizer.shader.ComputeStage().SetUniform("u_size", lvlsize)
+		resizer.dispatch(dstTexture, lvl, lvlsize)
+		lvlsize /= 2
+	}
+
+	result := make([]float32, calcCubeMapPixels(size, env.Levels)*3)
+	for lvl := 0; lvl < env.Levels; lvl++ {
+		lvlStart, lvlEnd := calcCubeMapOffset(size, lvl)
+		readGlTextureLevel(dstTexture, lvl, result[lvlStart*3:lvlEnd*3])
+	}
+
+	iblEnv := NewIblEnv(result, size, env.Levels)
+	iblEnv.Roughness = env.Roughness
+	return iblEnv, nil
+}
+
+// Uploads the base level of env to an RGB32F 2d array texture with one layer per face
+func iblEnvToGlTexture(env *IblEnv) libgl.UnboundTexture {
+	texture := libgl.NewTexture(gl.TEXTURE_2D_ARRAY)
+	texture.Allocate(1, gl.RGB32F, env.BaseSize, env.BaseSize, 6)
+	texture.Load(0, env.BaseSize, env.BaseSize, 6, gl.RGB, env.Level(0))
+	return texture
+}
+
+// Reads all six faces of a 2d array texture level as RGB
+func readGlTextureLevel(texture libgl.UnboundTexture, level int, result []float32) {
+	gl.MemoryBarrier(gl.TEXTURE_UPDATE_BARRIER_BIT)
+	gl.GetTextureImage(texture.Id(), int32(level), gl.RGB, gl.FLOAT, int32(len(result)*4), libgl.Pointer(result))
+}
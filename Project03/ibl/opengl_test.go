@@ -46,3 +46,141 @@ func TestConvertGl(t *testing.T) {
 		}
 	}
 }
+
+func TestConvolveDiffuseGl(t *testing.T) {
+	var conv ibl.Convolver
+	var err error
+
+	onMain <- func() {
+		conv, err = ibl.NewGlDiffuseConvolver(48)
+	}
+	<-onMainDone
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		onMain <- func() {
+			conv.Release()
+		}
+		<-onMainDone
+	}()
+
+	var hdri *ibl.IblEnv
+	onMain <- func() {
+		hdri, err = conv.Convolve(testdata.iblEnv, 32)
+	}
+	<-onMainDone
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saveResultIbl(t.Name(), hdri)
+
+	// same as the software implementation
+	expected := []float32{0.09986539, 0.09226462, 0.088060774, 0.10043078, 0.09293459, 0.09899382}
+
+	for i := 0; i < 6; i++ {
+		is := hdri.Face(0, i)[len(hdri.Face(0, i))-1]
+		should := expected[i]
+		if math.Abs(float64(is-should)) > 0.001 {
+			t.Errorf("conversion result incorrect for face %d, should be: %.4f but is %.4f\n", i, should, is)
+		}
+	}
+}
+
+func TestConvolveSpecularGl(t *testing.T) {
+	var conv ibl.Convolver
+	var err error
+
+	onMain <- func() {
+		conv, err = ibl.NewGlSpecularConvolver(256, 5)
+	}
+	<-onMainDone
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		onMain <- func() {
+			conv.Release()
+		}
+		<-onMainDone
+	}()
+
+	var hdri *ibl.IblEnv
+	onMain <- func() {
+		hdri, err = conv.Convolve(testdata.iblEnv, 32)
+	}
+	<-onMainDone
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saveResultIbl(t.Name(), hdri)
+
+	reference, err := ibl.NewSwSpecularConvolver(256, 5).Convolve(testdata.iblEnv, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compareIblEnv(t, reference, hdri, 0.01)
+}
+
+func TestResizeGl(t *testing.T) {
+	var resizer ibl.Resizer
+	var err error
+
+	onMain <- func() {
+		resizer, err = ibl.NewGlResizer(4)
+	}
+	<-onMainDone
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		onMain <- func() {
+			resizer.Release()
+		}
+		<-onMainDone
+	}()
+
+	var hdri *ibl.IblEnv
+	onMain <- func() {
+		hdri, err = resizer.Resize(testdata.iblEnv, 32)
+	}
+	<-onMainDone
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saveResultIbl(t.Name(), hdri)
+
+	reference, err := ibl.NewSwResizer(4).Resize(testdata.iblEnv, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compareIblEnv(t, reference, hdri, 0.01)
+}
+
+// Fails the test if the mean absolute difference of any level exceeds the relative tolerance
+func compareIblEnv(t *testing.T, expected, actual *ibl.IblEnv, tolerance float64) {
+	t.Helper()
+
+	if expected.Levels != actual.Levels || expected.BaseSize != actual.BaseSize {
+		t.Fatalf("result has %d levels of size %d, should be %d levels of size %d", actual.Levels, actual.BaseSize, expected.Levels, expected.BaseSize)
+	}
+
+	for lvl := 0; lvl < expected.Levels; lvl++ {
+		var diff, total float64
+		for i, v := range expected.Level(lvl) {
+			diff += math.Abs(float64(v - actual.Level(lvl)[i]))
+			total += math.Abs(float64(v))
+		}
+		if diff > total*tolerance {
+			t.Errorf("level %d differs from reference by %.4f%%", lvl, 100*diff/total)
+		}
+	}
+}
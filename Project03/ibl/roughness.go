@@ -0,0 +1,156 @@
+package ibl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type RoughnessCurveKind uint32
+
+const (
+	RoughnessCurveLinear = RoughnessCurveKind(iota)
+	RoughnessCurveQuadratic
+	RoughnessCurveTable
+)
+
+// A RoughnessCurve maps the levels of a specular environment to the roughness they are prefiltered for.
+// Shaders have to use the inverse mapping to select the level for a roughness.
+// The zero value is the linear curve.
+type RoughnessCurve struct {
+	Kind RoughnessCurveKind
+	// The roughness of each level, only used by RoughnessCurveTable
+	Table []float32
+}
+
+var RoughnessLinear = RoughnessCurve{Kind: RoughnessCurveLinear}
+
+// roughness = (level / (levels - 1))^2, which gives more levels to low roughness values
+var RoughnessQuadratic = RoughnessCurve{Kind: RoughnessCurveQuadratic}
+
+// Uses the given roughness for each level
+func RoughnessTable(roughness ...float32) RoughnessCurve {
+	return RoughnessCurve{Kind: RoughnessCurveTable, Table: roughness}
+}
+
+// Returns the roughness of the level
+func (curve RoughnessCurve) Roughness(level, levels int) float32 {
+	if levels <= 1 {
+		return 0
+	}
+	t := float32(level) / float32(levels-1)
+	switch curve.Kind {
+	case RoughnessCurveQuadratic:
+		return t * t
+	case RoughnessCurveTable:
+		if len(curve.Table) == 0 {
+			return t
+		}
+		if level >= len(curve.Table) {
+			return curve.Table[len(curve.Table)-1]
+		}
+		return curve.Table[level]
+	default:
+		return t
+	}
+}
+
+// Returns the roughness of all levels
+func (curve RoughnessCurve) Levels(levels int) []float32 {
+	roughness := make([]float32, levels)
+	for lvl := range roughness {
+		roughness[lvl] = curve.Roughness(lvl, levels)
+	}
+	return roughness
+}
+
+// Checks that the curve is valid for the given number of levels
+func (curve RoughnessCurve) Validate(levels int) error {
+	switch curve.Kind {
+	case RoughnessCurveLinear, RoughnessCurveQuadratic:
+		return nil
+	case RoughnessCurveTable:
+	default:
+		return fmt.Errorf("unknown roughness curve %d", curve.Kind)
+	}
+
+	if len(curve.Table) != levels {
+		return fmt.Errorf("roughness table has %d entries but there are %d levels", len(curve.Table), levels)
+	}
+	for i, r := range curve.Table {
+		if r < 0 || r > 1 {
+			return fmt.Errorf("roughness %f of level %d is not between 0 and 1", r, i)
+		}
+		if i > 0 && r <= curve.Table[i-1] {
+			return fmt.Errorf("roughness %f of level %d is not greater than the previous", r, i)
+		}
+	}
+	return nil
+}
+
+func (curve RoughnessCurve) String() string {
+	switch curve.Kind {
+	case RoughnessCurveLinear:
+		return "linear"
+	case RoughnessCurveQuadratic:
+		return "quadratic"
+	case RoughnessCurveTable:
+		values := make([]string, len(curve.Table))
+		for i, r := range curve.Table {
+			values[i] = strconv.FormatFloat(float64(r), 'f', -1, 32)
+		}
+		return strings.Join(values, ",")
+	default:
+		return fmt.Sprintf("unknown(%d)", curve.Kind)
+	}
+}
+
+// Parses "linear", "quadratic" or a comma separated list of roughness values
+func ParseRoughnessCurve(s string) (RoughnessCurve, error) {
+	s = strings.TrimSpace(s)
+	switch strings.ToLower(s) {
+	case "linear":
+		return RoughnessLinear, nil
+	case "quadratic":
+		return RoughnessQuadratic, nil
+	}
+
+	parts := strings.Split(s, ",")
+	table := make([]float32, len(parts))
+	for i, p := range parts {
+		r, err := strconv.ParseFloat(strings.TrimSpace(p), 32)
+		if err != nil {
+			return RoughnessCurve{}, fmt.Errorf("invalid roughness curve %q: %w", s, err)
+		}
+		table[i] = float32(r)
+	}
+
+	curve := RoughnessTable(table...)
+	if err := curve.Validate(len(table)); err != nil {
+		return RoughnessCurve{}, err
+	}
+	return curve, nil
+}
+
+type specularConfig struct {
+	curve RoughnessCurve
+}
+
+type SpecularOption func(cfg *specularConfig)
+
+// Sets the roughness curve used by a specular convolver, the default is RoughnessLinear
+func OptRoughnessCurve(curve RoughnessCurve) SpecularOption {
+	return func(cfg *specularConfig) {
+		cfg.curve = curve
+	}
+}
+
+func applySpecularOptions(options []SpecularOption) specularConfig {
+	cfg := specularConfig{curve: RoughnessLinear}
+	for _, opt := range options {
+		if opt != nil {
+			opt(&cfg)
+		}
+	}
+	return cfg
+}
@@ -0,0 +1,110 @@
+package ibl_test
+
+import (
+	"advanced-gl/Project03/ibl"
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/chewxy/math32"
+)
+
+func TestParseRoughnessCurve(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []float32
+	}{
+		{"linear", []float32{0, 0.25, 0.5, 0.75, 1}},
+		{"quadratic", []float32{0, 0.0625, 0.25, 0.5625, 1}},
+		{"0, 0.1,0.3,0.6,1", []float32{0, 0.1, 0.3, 0.6, 1}},
+	}
+
+	for _, test := range tests {
+		curve, err := ibl.ParseRoughnessCurve(test.input)
+		if err != nil {
+			t.Errorf("%q should be valid but got: %v", test.input, err)
+			continue
+		}
+		if err := curve.Validate(len(test.expected)); err != nil {
+			t.Errorf("%q should be valid for %d levels but got: %v", test.input, len(test.expected), err)
+		}
+		for lvl, r := range curve.Levels(len(test.expected)) {
+			if math32.Abs(r-test.expected[lvl]) > 1e-6 {
+				t.Errorf("%q level %d should have roughness %f but was %f", test.input, lvl, test.expected[lvl], r)
+			}
+		}
+	}
+
+	for _, input := range []string{"", "cubic", "0,0.5,0.5", "0,1.5", "0.5,0.1"} {
+		if _, err := ibl.ParseRoughnessCurve(input); err == nil {
+			t.Errorf("%q should be invalid", input)
+		}
+	}
+
+	if err := ibl.RoughnessTable(0, 0.5, 1).Validate(5); err == nil {
+		t.Errorf("a table with 3 entries should be invalid for 5 levels")
+	}
+}
+
+func TestEncodeIblEnvRoughness(t *testing.T) {
+	tests := []struct {
+		curve   ibl.RoughnessCurve
+		version ibl.IblEnvVersion
+	}{
+		// the linear curve is the only one version 1.2 can hold
+		{ibl.RoughnessLinear, ibl.IblEnvVersion1_002_000},
+		{ibl.RoughnessQuadratic, ibl.IblEnvVersion1_003_000},
+		{ibl.RoughnessTable(0.1, 0.2, 0.7), ibl.IblEnvVersion1_003_000},
+	}
+
+	for _, test := range tests {
+		curve := test.curve
+		env := ibl.NewIblEnv(randomFloats(3*(16*16+8*8+4*4)*6, 0, 10), 16, 3)
+		env.Roughness = curve
+
+		buf := new(bytes.Buffer)
+		err := ibl.EncodeIblEnv(buf, env, ibl.OptCompress(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		header := ibl.IblEnvHeader{}
+		if err := binary.Read(bytes.NewReader(buf.Bytes()), binary.LittleEndian, &header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Version != test.version {
+			t.Errorf("an environment with the %v roughness curve should be written as version %d but was %d", curve, test.version, header.Version)
+		}
+
+		result, err := ibl.DecodeIblEnv(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Roughness.Kind != curve.Kind {
+			t.Errorf("roughness curve should be %v but was %v", curve, result.Roughness)
+			continue
+		}
+		expected := curve.Levels(env.Levels)
+		for lvl, r := range result.Roughness.Levels(result.Levels) {
+			if r != expected[lvl] {
+				t.Errorf("level %d should have roughness %f but was %f", lvl, expected[lvl], r)
+			}
+		}
+	}
+}
+
+func TestConvolveSpecularSwRoughness(t *testing.T) {
+	curve := ibl.RoughnessTable(0.1, 0.4, 1)
+	conv := ibl.NewSwSpecularConvolver(16, 3, ibl.OptRoughnessCurve(curve))
+	defer conv.Release()
+
+	result, err := conv.Convolve(testdata.iblStudioSmall, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Roughness.String() != curve.String() {
+		t.Errorf("roughness curve should be %v but was %v", curve, result.Roughness)
+	}
+}
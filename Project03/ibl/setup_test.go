@@ -19,14 +19,13 @@ import (
 
 	"github.com/chewxy/math32"
 	"github.com/go-gl/gl/v4.5-core/gl"
-	"github.com/go-gl/glfw/v3.3/glfw"
 	"github.com/pierrec/lz4/v4"
 )
 
 var onMain chan func()
 var onMainDone chan struct{}
 
-var context *glfw.Window
+var context *libgl.HeadlessContext
 
 type bufferWriter []byte
 
@@ -58,27 +57,11 @@ func TestMain(m *testing.M) {
 	runtime.LockOSThread()
 	var err error
 
-	check(glfw.Init())
-	glfw.WindowHint(glfw.Visible, glfw.False)
-	glfw.WindowHint(glfw.OpenGLForwardCompatible, glfw.True)
-	glfw.WindowHint(glfw.ContextVersionMajor, 4)
-	glfw.WindowHint(glfw.ContextVersionMinor, 5)
-	glfw.WindowHint(glfw.OpenGLDebugContext, glfw.True)
-	ctx, err := glfw.CreateWindow(640, 480, "Testing Window", nil, nil)
+	// Without a display server the tests need the "egl" build tag, see libgl.NewHeadlessContext
+	ctx, err := libgl.NewHeadlessContext(true)
 	check(err)
-	ctx.MakeContextCurrent()
 	context = ctx
 
-	check(gl.InitWithProcAddrFunc(func(name string) unsafe.Pointer {
-		addr := glfw.GetProcAddress(name)
-		if addr == nil {
-			return unsafe.Pointer(uintptr(0xffff_ffff_ffff_ffff))
-		}
-		return addr
-	}))
-
-	libgl.GlEnv = libgl.GetGlEnv()
-	libgl.State = libgl.NewGlStateManager()
 	libgl.State.Enable(gl.DEBUG_OUTPUT)
 	libgl.State.Enable(gl.DEBUG_OUTPUT_SYNCHRONOUS)
 
@@ -224,12 +207,12 @@ func saveResultIbl(name string, hdri *ibl.IblEnv) {
 
 }
 
-func saveResultFloatImage(name string, img *libio.FloatImage, gamma, scale float32) {
+// Writes the values as they are, images of an unknown color space are not encoded
+func saveResultFloatImage(name string, img *libio.FloatImage) {
 	file, err := os.OpenFile(fmt.Sprintf("testout/%s.png", name), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
 	if err != nil {
 		return
 	}
 	defer file.Close()
-	img.Tonemap(gamma, scale)
 	png.Encode(file, img.ToIntImage().ToRGBA())
 }
@@ -41,4 +41,25 @@ float4 projectCubeMap(const float4 v) {
   }
   uv.xy = uv.xy * ma + (float2)(0.5f, 0.5f);
   return uv;
-}
\ No newline at end of file
+}
+
+// Returns the direction for the uv coordinates of a 2D layout, see layout.go
+// 0 is lat-long, 1 is dual paraboloid
+float4 layout2DDirection(int layout, float u, float v) {
+  if (layout == 1) {
+    int back = u >= 0.5f;
+    float s = back ? 3.0f - u * 4.0f : u * 4.0f - 1.0f;
+    float t = v * 2.0f - 1.0f;
+    float r2 = s * s + t * t;
+    float4 dir = (float4)(2.0f * s, 2.0f * t, 1.0f - r2, 0.0f) / (1.0f + r2);
+    if (back) {
+      dir.z = -dir.z;
+    }
+    return normalize(dir);
+  }
+
+  float phi = (u - 0.5f) * 2.0f * M_PI_F;
+  float theta = (v - 0.5f) * M_PI_F;
+  return (float4)(cos(theta) * cos(phi), sin(theta), cos(theta) * sin(phi),
+                  0.0f);
+}
@@ -0,0 +1,51 @@
+#version 450 core
+
+// These transforms specify the directions based on the cube face
+// They are the same as in shared.cl, see there for an explanation
+const vec3 xTransforms[6] = vec3[](
+    vec3(0.0, 0.0, 1.0), vec3(0.0, 0.0, -1.0),
+    vec3(1.0, 0.0, 0.0), vec3(1.0, 0.0, 0.0),
+    vec3(1.0, 0.0, 0.0), vec3(-1.0, 0.0, 0.0));
+const vec3 yTransforms[6] = vec3[](
+    vec3(0.0, -1.0, 0.0), vec3(0.0, -1.0, 0.0),
+    vec3(0.0, 0.0, 1.0),  vec3(0.0, 0.0, -1.0),
+    vec3(0.0, -1.0, 0.0), vec3(0.0, -1.0, 0.0));
+const vec3 zTransforms[6] = vec3[](
+    vec3(-1.0, 0.0, 0.0), vec3(1.0, 0.0, 0.0),
+    vec3(0.0, 1.0, 0.0),  vec3(0.0, -1.0, 0.0),
+    vec3(0.0, 0.0, 1.0),  vec3(0.0, 0.0, -1.0));
+
+const float pi = 3.14159265359;
+
+// Returns the direction through the center of the face pixel (u + offset.x, v + offset.y)
+vec3 cubeMapDirection(ivec3 pixel, vec2 offset, float sizefac) {
+  // The value range is (-1, 1)
+  float horizontal = (float(2 * pixel.x + 1) + offset.x) * sizefac - 1.0;
+  float vertical = (float(2 * pixel.y + 1) + offset.y) * sizefac - 1.0;
+
+  vec3 vec = vec3(horizontal, vertical, 1.0);
+  return normalize(vec3(dot(vec, xTransforms[pixel.z]), dot(vec, yTransforms[pixel.z]), dot(vec, zTransforms[pixel.z])));
+}
+
+// https://www.gamedev.net/forums/topic/687535-implementing-a-cube-map-lookup-function/
+// Returns (u, v, face) for use with a sampler2DArray
+vec3 projectCubeMap(vec3 v) {
+  vec3 vAbs = abs(v);
+  float ma;
+  vec3 uv = vec3(0.0);
+  if (vAbs.z >= vAbs.x && vAbs.z >= vAbs.y) {
+    uv.z = v.z < 0.0 ? 5.0 : 4.0;
+    ma = 0.5 / vAbs.z;
+    uv.xy = vec2(v.z < 0.0 ? -v.x : v.x, -v.y);
+  } else if (vAbs.y >= vAbs.x) {
+    uv.z = v.y < 0.0 ? 3.0 : 2.0;
+    ma = 0.5 / vAbs.y;
+    uv.xy = vec2(v.x, v.y < 0.0 ? -v.z : v.z);
+  } else {
+    uv.z = v.x < 0.0 ? 1.0 : 0.0;
+    ma = 0.5 / vAbs.x;
+    uv.xy = vec2(v.x < 0.0 ? v.z : -v.z, -v.y);
+  }
+  uv.xy = uv.xy * ma + vec2(0.5, 0.5);
+  return uv;
+}
@@ -1,6 +1,7 @@
 package ibl
 
 import (
+	"advanced-gl/Project03/libio"
 	"advanced-gl/Project03/stbi"
 	"math"
 	"math/rand"
@@ -426,7 +427,9 @@ func (resizer *swResizer) Resize(env *IblEnv, size int) (*IblEnv, error) {
 		lvlsize /= 2
 	}
 
-	return NewIblEnv(result, size, env.Levels), nil
+	iblEnv := NewIblEnv(result, size, env.Levels)
+	iblEnv.Roughness = env.Roughness
+	return iblEnv, nil
 }
 
 func resizeLevelSw(env *IblEnv, size int, samples [][2]float32, result []float32) {
@@ -449,12 +452,15 @@ func resizeLevelSw(env *IblEnv, size int, samples [][2]float32, result []float32
 type swSpecularConvolver struct {
 	samples [][]sample
 	levels  int
+	curve   RoughnessCurve
 }
 
-func NewSwSpecularConvolver(quality int, levels int) (conv Convolver) {
+func NewSwSpecularConvolver(quality int, levels int, options ...SpecularOption) (conv Convolver) {
+	cfg := applySpecularOptions(options)
 	return &swSpecularConvolver{
-		samples: generateSpecularConvolutionSamples(quality, levels),
+		samples: generateSpecularConvolutionSamples(quality, levels, cfg.curve),
 		levels:  levels,
+		curve:   cfg.curve,
 	}
 }
 
@@ -475,26 +481,40 @@ func generateHammersleySequence(count int) [][2]float32 {
 // hammersley produces the best results imo
 var sampleSequenceImplementation func(count int) [][2]float32 = generateHammersleySequence
 
-func generateSpecularConvolutionSamples(count int, levels int) [][]sample {
+func generateSpecularConvolutionSamples(count int, levels int, curve RoughnessCurve) [][]sample {
+	roughness := curve.Levels(levels)
+
+	total := 0
+	for _, r := range roughness {
+		if r == 0 {
+			total++
+		} else {
+			total += count
+		}
+	}
+
 	// store all samples in contiguous memory
-	samples := make([]sample, count*(levels-1)+1)
+	samples := make([]sample, total)
 	slicedSamples := make([][]sample, levels)
-	// roughtness 0 only requires a single sample
-	samples[0].x = 0
-	samples[0].y = 0
-	samples[0].z = 1
-	samples[0].weight = 1.0
-	slicedSamples[0] = samples[0:1:1]
-	i := 1
+	i := 0
 
 	pseudoRandomSeq := sampleSequenceImplementation(count)
 
-	for lvl := 1; lvl < levels; lvl++ {
+	for lvl := 0; lvl < levels; lvl++ {
 		start := i
-		roughness := float32(lvl) / float32(levels-1)
+		if roughness[lvl] == 0 {
+			// roughtness 0 only requires a single sample
+			samples[i].x = 0
+			samples[i].y = 0
+			samples[i].z = 1
+			samples[i].weight = 1.0
+			i++
+			slicedSamples[lvl] = samples[start:i:i]
+			continue
+		}
 		for si := 0; si < count; si++ {
 			hs := pseudoRandomSeq[si]
-			hx, hy, hz := importanceSampleGGX(hs[0], hs[1], roughness)
+			hx, hy, hz := importanceSampleGGX(hs[0], hs[1], roughness[lvl])
 			samples[i].x = hx
 			samples[i].y = hy
 			samples[i].z = hz
@@ -570,49 +590,79 @@ func importanceSampleGGX(su, sv float32, roughness float32) (x, y, z float32) {
 func (conv *swSpecularConvolver) Convolve(env *IblEnv, size int) (*IblEnv, error) {
 	result := make([]float32, calcCubeMapPixels(size, conv.levels)*3)
 	lvlsize := size
-	resizeLevelSw(env, lvlsize, generateSuperSamples(11), result)
-	lvlsize /= 2
-	for lvl := 1; lvl < conv.levels; lvl++ {
+	first := 0
+	if conv.curve.Roughness(0, conv.levels) == 0 {
+		// roughness 0 is just a resized copy
+		resizeLevelSw(env, lvlsize, generateSuperSamples(11), result)
+		lvlsize /= 2
+		first = 1
+	}
+	for lvl := first; lvl < conv.levels; lvl++ {
 		lvlStart, lvlEnd := calcCubeMapOffset(size, lvl)
 		lvlResult := result[lvlStart*3 : lvlEnd*3]
 		forEachCubeMapPixel(lvlsize, func(face, pu, pv int, cx, cy, cz float32, i int) {
 			nx, ny, nz := normalize(cx, cy, cz)
-			vx, vy, vz := nx, ny, nz
-			// from tangent-space vector to world-space sample vector
-			var upx, upy, upz float32 = 0.0, 0.0, 1.0
-			if math32.Abs(nz) >= 0.999 {
-				upx, upy, upz = 1.0, 0.0, 0.0
-			}
-			tx, ty, tz := normalize(cross(upx, upy, upz, nx, ny, nz))
-			bx, by, bz := cross(nx, ny, nz, tx, ty, tz)
+			lvlResult[i*3+0], lvlResult[i*3+1], lvlResult[i*3+2] = convolveSpecularSw(env, conv.samples[lvl], nx, ny, nz)
+		})
+		lvlsize /= 2
+	}
 
-			var cr, cg, cb float32
-			var totalWeight float32
-			for _, s := range conv.samples[lvl] {
+	iblEnv := NewIblEnv(result, size, conv.levels)
+	iblEnv.Roughness = conv.curve
+	return iblEnv, nil
+}
 
-				hx, hy, hz := normalize(transform(s.x, s.y, s.z, tx, ty, tz, bx, by, bz, nx, ny, nz))
-				vdoth := 2 * dot(vx, vy, vz, hx, hy, hz)
-				lx, ly, lz := normalize(vdoth*hx-vx, vdoth*hy-vy, vdoth*hz-vz)
+func (conv *swSpecularConvolver) Convolve2D(env *IblEnv, layout Layout2D, size int) (*MipChain2D, error) {
+	result := &MipChain2D{
+		Layout:    layout,
+		Levels:    make([]*libio.FloatImage, conv.levels),
+		Roughness: conv.curve,
+	}
 
-				ndotl := math32.Max(dot(nx, ny, nz, lx, ly, lz), 0.0)
-				if ndotl > 0 {
-					sface, su, sv := sampleCubeMap(lx, ly, lz)
-					sr, sg, sb := sampleBilinear(env.BaseSize, env.BaseSize, 3, env.Face(0, sface), su, sv)
+	for lvl := 0; lvl < conv.levels; lvl++ {
+		width, height := layout2DSize(size, lvl)
+		lvlResult := make([]float32, width*height*3)
+		// levels with roughness 0 only have a single sample, which is just a lookup
+		forEachLayout2DPixel(layout, width, height, func(px, py int, nx, ny, nz float32, i int) {
+			lvlResult[i*3+0], lvlResult[i*3+1], lvlResult[i*3+2] = convolveSpecularSw(env, conv.samples[lvl], nx, ny, nz)
+		})
+		result.Levels[lvl] = libio.NewFloatImage(lvlResult, 3, width, height)
+	}
 
-					cr += sr * ndotl
-					cg += sg * ndotl
-					cb += sb * ndotl
+	return result, nil
+}
 
-					totalWeight += ndotl
-				}
-			}
+// Convolves the environment with the GGX samples around the normalized direction n
+func convolveSpecularSw(env *IblEnv, samples []sample, nx, ny, nz float32) (r, g, b float32) {
+	vx, vy, vz := nx, ny, nz
+	// from tangent-space vector to world-space sample vector
+	var upx, upy, upz float32 = 0.0, 0.0, 1.0
+	if math32.Abs(nz) >= 0.999 {
+		upx, upy, upz = 1.0, 0.0, 0.0
+	}
+	tx, ty, tz := normalize(cross(upx, upy, upz, nx, ny, nz))
+	bx, by, bz := cross(nx, ny, nz, tx, ty, tz)
 
-			lvlResult[i*3+0] = cr / totalWeight
-			lvlResult[i*3+1] = cg / totalWeight
-			lvlResult[i*3+2] = cb / totalWeight
-		})
-		lvlsize /= 2
+	var cr, cg, cb float32
+	var totalWeight float32
+	for _, s := range samples {
+
+		hx, hy, hz := normalize(transform(s.x, s.y, s.z, tx, ty, tz, bx, by, bz, nx, ny, nz))
+		vdoth := 2 * dot(vx, vy, vz, hx, hy, hz)
+		lx, ly, lz := normalize(vdoth*hx-vx, vdoth*hy-vy, vdoth*hz-vz)
+
+		ndotl := math32.Max(dot(nx, ny, nz, lx, ly, lz), 0.0)
+		if ndotl > 0 {
+			sface, su, sv := sampleCubeMap(lx, ly, lz)
+			sr, sg, sb := sampleBilinear(env.BaseSize, env.BaseSize, 3, env.Face(0, sface), su, sv)
+
+			cr += sr * ndotl
+			cg += sg * ndotl
+			cb += sb * ndotl
+
+			totalWeight += ndotl
+		}
 	}
 
-	return NewIblEnv(result, size, conv.levels), nil
+	return cr / totalWeight, cg / totalWeight, cb / totalWeight
 }
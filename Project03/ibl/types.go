@@ -1,6 +1,9 @@
 package ibl
 
-import "advanced-gl/Project03/stbi"
+import (
+	"advanced-gl/Project03/libio"
+	"advanced-gl/Project03/stbi"
+)
 
 type Convolver interface {
 	Convolve(env *IblEnv, size int) (*IblEnv, error)
@@ -16,3 +19,17 @@ type Converter interface {
 	Convert(hdr *stbi.RgbaHdr, size int) (*IblEnv, error)
 	Release()
 }
+
+// A Convolver2D can additionally write its levels in a 2D layout instead of a cube map
+type Convolver2D interface {
+	Convolver
+	// size is the height of the first level, every level is twice as wide as it is high
+	Convolve2D(env *IblEnv, layout Layout2D, size int) (*MipChain2D, error)
+}
+
+// A MipChain2D holds the levels of a prefiltered environment in a 2D layout
+type MipChain2D struct {
+	Layout    Layout2D
+	Levels    []*libio.FloatImage
+	Roughness RoughnessCurve
+}
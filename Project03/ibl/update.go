@@ -33,7 +33,7 @@ func DecodeOldIblEnv(r io.Reader) (env *IblEnv, err error) {
 			return nil, err
 		}
 		return DecodeOldIblEnv(io.MultiReader(buf, r))
-	case IblEnvVersion1_002_000:
+	case IblEnvVersion1_002_000, IblEnvVersion1_003_000:
 		binary.Write(buf, le, header)
 		if err != nil {
 			return nil, err
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"log"
+	"unsafe"
 
 	"github.com/go-gl/gl/v4.5-core/gl"
 )
@@ -26,8 +27,11 @@ type UnboundBuffer interface {
 	Write(offset int, data any)
 	WriteRange(offset int, size int, data any)
 	WriteIndex(index int, data any)
+	MapRange(offset int, size int, access int) []byte
+	Unmap()
 	Size() int
 	Bind(target uint32) BoundBuffer
+	BindBase(target uint32, index int) BoundBuffer
 	Delete()
 }
 
@@ -56,6 +60,12 @@ func (vbo *buffer) Bind(target uint32) BoundBuffer {
 	return BoundBuffer(vbo)
 }
 
+// target must be GL_SHADER_STORAGE_BUFFER, GL_UNIFORM_BUFFER, GL_ATOMIC_COUNTER_BUFFER or GL_TRANSFORM_FEEDBACK_BUFFER
+func (vbo *buffer) BindBase(target uint32, index int) BoundBuffer {
+	State.BindBufferBase(target, index, vbo.glId)
+	return BoundBuffer(vbo)
+}
+
 func (vbo *buffer) Size() int {
 	return vbo.size
 }
@@ -205,6 +215,20 @@ func (vbo *buffer) WriteIndex(index int, data any) {
 	gl.NamedBufferSubData(vbo.glId, int(index*size), size, Pointer(data))
 }
 
+// Maps a range of the buffer into memory, immutable buffers must be allocated with the access flags like GL_MAP_WRITE_BIT.
+// The returned bytes are valid until Unmap.
+func (vbo *buffer) MapRange(offset int, size int, access int) []byte {
+	ptr := gl.MapNamedBufferRange(vbo.glId, offset, size, uint32(access))
+	if ptr == nil {
+		log.Panicf("Could not map %d bytes at %d of buffer %d", size, offset, vbo.glId)
+	}
+	return unsafe.Slice((*byte)(ptr), size)
+}
+
+func (vbo *buffer) Unmap() {
+	gl.UnmapNamedBuffer(vbo.glId)
+}
+
 func (vbo *buffer) Delete() {
 	gl.DeleteBuffers(1, &vbo.glId)
 	vbo.glId = 0
@@ -0,0 +1,130 @@
+package libgl
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"github.com/go-gl/gl/v4.5-core/gl"
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// A HeadlessContext is an OpenGL 4.5 core context without a visible window.
+// It can be used by tests and command line tools which only render offscreen.
+type HeadlessContext struct {
+	window *glfw.Window
+	egl    *eglContext
+}
+
+// Returned for missing functions so gl.Init doesn't fail on optional extensions
+const invalidAddress uintptr = 0xffff_ffff_ffff_ffff
+
+// Set when the library is built with the "egl" tag on linux, see headless_egl.go.
+// The tag is opt-in because it links libEGL, which not every system with GLFW has.
+var newEglContext func(debug bool) (*eglContext, error)
+
+var ErrNoHeadlessContext = errors.New("could not create a headless OpenGL context")
+
+// Creates a headless context and makes it current on the calling thread.
+// The caller should have called runtime.LockOSThread.
+// EGL surfaceless contexts are preferred if available, because they don't need a display server.
+// Otherwise an invisible GLFW window is created, which needs an X11 or Wayland display.
+// EGL is only available on linux when built with the "egl" tag, e.g. `go test -tags egl ./...` on a headless build agent.
+// On success GlEnv and State are initialized for the new context.
+func NewHeadlessContext(debug bool) (*HeadlessContext, error) {
+	var errs []error
+	ctx := &HeadlessContext{}
+
+	if newEglContext != nil {
+		egl, err := newEglContext(debug)
+		if err == nil {
+			ctx.egl = egl
+		} else {
+			errs = append(errs, fmt.Errorf("egl: %w", err))
+		}
+	}
+
+	if ctx.egl == nil {
+		window, err := newGlfwHeadlessWindow(debug)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("glfw: %w", err))
+			return nil, fmt.Errorf("%w: %w", ErrNoHeadlessContext, errors.Join(errs...))
+		}
+		ctx.window = window
+	}
+
+	err := gl.InitWithProcAddrFunc(func(name string) unsafe.Pointer {
+		addr := ctx.getProcAddress(name)
+		if addr == nil {
+			return unsafe.Pointer(invalidAddress)
+		}
+		return addr
+	})
+	if err != nil {
+		ctx.Delete()
+		return nil, err
+	}
+
+	GlEnv = GetGlEnv()
+	GlEnv.Headless = true
+	State = NewGlStateManager()
+
+	return ctx, nil
+}
+
+func newGlfwHeadlessWindow(debug bool) (*glfw.Window, error) {
+	if err := glfw.Init(); err != nil {
+		return nil, err
+	}
+
+	glfw.DefaultWindowHints()
+	glfw.WindowHint(glfw.Visible, glfw.False)
+	glfw.WindowHint(glfw.OpenGLForwardCompatible, glfw.True)
+	glfw.WindowHint(glfw.OpenGLProfile, glfw.OpenGLCoreProfile)
+	glfw.WindowHint(glfw.ContextVersionMajor, 4)
+	glfw.WindowHint(glfw.ContextVersionMinor, 5)
+	if debug {
+		glfw.WindowHint(glfw.OpenGLDebugContext, glfw.True)
+	}
+
+	window, err := glfw.CreateWindow(1, 1, "Headless", nil, nil)
+	if err != nil {
+		glfw.Terminate()
+		return nil, err
+	}
+	window.MakeContextCurrent()
+	return window, nil
+}
+
+func (ctx *HeadlessContext) getProcAddress(name string) unsafe.Pointer {
+	if ctx.egl != nil {
+		return ctx.egl.getProcAddress(name)
+	}
+	return glfw.GetProcAddress(name)
+}
+
+// Makes the context current on the calling thread
+func (ctx *HeadlessContext) MakeCurrent() {
+	if ctx.egl != nil {
+		ctx.egl.makeCurrent()
+		return
+	}
+	ctx.window.MakeContextCurrent()
+}
+
+// Returns the underlying window, or nil for EGL contexts
+func (ctx *HeadlessContext) Window() *glfw.Window {
+	return ctx.window
+}
+
+func (ctx *HeadlessContext) Delete() {
+	if ctx.egl != nil {
+		ctx.egl.delete()
+		ctx.egl = nil
+	}
+	if ctx.window != nil {
+		ctx.window.Destroy()
+		ctx.window = nil
+		glfw.Terminate()
+	}
+}
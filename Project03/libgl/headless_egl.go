@@ -0,0 +1,105 @@
+//go:build linux && egl
+
+package libgl
+
+/*
+#cgo LDFLAGS: -lEGL
+#include <stdlib.h>
+#include <EGL/egl.h>
+#include <EGL/eglext.h>
+
+static EGLDisplay getSurfacelessDisplay() {
+	PFNEGLGETPLATFORMDISPLAYEXTPROC getPlatformDisplay =
+		(PFNEGLGETPLATFORMDISPLAYEXTPROC) eglGetProcAddress("eglGetPlatformDisplayEXT");
+	if (getPlatformDisplay == NULL) {
+		return EGL_NO_DISPLAY;
+	}
+	return getPlatformDisplay(EGL_PLATFORM_SURFACELESS_MESA, EGL_DEFAULT_DISPLAY, NULL);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+type eglContext struct {
+	display C.EGLDisplay
+	context C.EGLContext
+}
+
+func init() {
+	newEglContext = createEglContext
+}
+
+// Creates a surfaceless context using EGL_MESA_platform_surfaceless
+func createEglContext(debug bool) (*eglContext, error) {
+	display := C.getSurfacelessDisplay()
+	if display == 0 {
+		return nil, fmt.Errorf("surfaceless platform is not supported")
+	}
+
+	if C.eglInitialize(display, nil, nil) == C.EGL_FALSE {
+		return nil, fmt.Errorf("eglInitialize failed with 0x%04x", C.eglGetError())
+	}
+
+	if C.eglBindAPI(C.EGL_OPENGL_API) == C.EGL_FALSE {
+		C.eglTerminate(display)
+		return nil, fmt.Errorf("eglBindAPI failed with 0x%04x", C.eglGetError())
+	}
+
+	configAttribs := []C.EGLint{
+		// the default would be EGL_WINDOW_BIT, which surfaceless displays don't support
+		C.EGL_SURFACE_TYPE, C.EGL_PBUFFER_BIT,
+		C.EGL_RENDERABLE_TYPE, C.EGL_OPENGL_BIT,
+		C.EGL_NONE,
+	}
+	var config C.EGLConfig
+	var numConfigs C.EGLint
+	if C.eglChooseConfig(display, &configAttribs[0], &config, 1, &numConfigs) == C.EGL_FALSE || numConfigs == 0 {
+		C.eglTerminate(display)
+		return nil, fmt.Errorf("no suitable EGL config")
+	}
+
+	var debugFlag C.EGLint = C.EGL_FALSE
+	if debug {
+		debugFlag = C.EGL_TRUE
+	}
+	contextAttribs := []C.EGLint{
+		C.EGL_CONTEXT_MAJOR_VERSION, 4,
+		C.EGL_CONTEXT_MINOR_VERSION, 5,
+		C.EGL_CONTEXT_OPENGL_PROFILE_MASK, C.EGL_CONTEXT_OPENGL_CORE_PROFILE_BIT,
+		C.EGL_CONTEXT_OPENGL_DEBUG, debugFlag,
+		C.EGL_NONE,
+	}
+	context := C.eglCreateContext(display, config, nil, &contextAttribs[0])
+	if context == nil {
+		C.eglTerminate(display)
+		return nil, fmt.Errorf("eglCreateContext failed with 0x%04x", C.eglGetError())
+	}
+
+	ctx := &eglContext{display: display, context: context}
+	if C.eglMakeCurrent(display, nil, nil, context) == C.EGL_FALSE {
+		ctx.delete()
+		return nil, fmt.Errorf("eglMakeCurrent failed with 0x%04x", C.eglGetError())
+	}
+
+	return ctx, nil
+}
+
+func (ctx *eglContext) getProcAddress(name string) unsafe.Pointer {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	return unsafe.Pointer(C.eglGetProcAddress(cname))
+}
+
+func (ctx *eglContext) makeCurrent() {
+	C.eglMakeCurrent(ctx.display, nil, nil, ctx.context)
+}
+
+func (ctx *eglContext) delete() {
+	C.eglMakeCurrent(ctx.display, nil, nil, nil)
+	C.eglDestroyContext(ctx.display, ctx.context)
+	C.eglTerminate(ctx.display)
+}
@@ -0,0 +1,15 @@
+//go:build !(linux && egl)
+
+package libgl
+
+import "unsafe"
+
+type eglContext struct{}
+
+func (*eglContext) getProcAddress(name string) unsafe.Pointer {
+	return nil
+}
+
+func (*eglContext) makeCurrent() {}
+
+func (*eglContext) delete() {}
@@ -35,6 +35,7 @@ type UnboundShaderPipeline interface {
 	Get(stage int) ShaderProgram
 	FragmentStage() ShaderProgram
 	VertexStage() ShaderProgram
+	ComputeStage() ShaderProgram
 	Id() uint32
 	Delete()
 }
@@ -134,6 +135,10 @@ func (shaderPipeline *shaderPipeline) FragmentStage() ShaderProgram {
 	return shaderPipeline.fragStage
 }
 
+func (shaderPipeline *shaderPipeline) ComputeStage() ShaderProgram {
+	return shaderPipeline.compStage
+}
+
 func (shaderPipeline *shaderPipeline) Bind() BoundShaderPipeline {
 	State.BindProgramPipeline(shaderPipeline.glId)
 	return BoundShaderPipeline(shaderPipeline)
@@ -337,6 +342,13 @@ func setProgramUniformAny(prog uint32, location int32, value any) {
 	}
 
 	switch v := value.(type) {
+	case bool:
+		// glsl bools are set as integers
+		var i int32
+		if v {
+			i = 1
+		}
+		gl.ProgramUniform1i(prog, location, i)
 	case float64:
 		gl.ProgramUniform1d(prog, location, v)
 	case float32:
@@ -124,6 +124,9 @@ var GlEnv *GlEnvironment
 // See https://doc.magnum.graphics/magnum/opengl-workarounds.html as a reference for workarounds
 type GlEnvironment struct {
 	Vendor                     string
+	Renderer                   string
+	SoftwareRenderer           bool // e.g. Mesa's llvmpipe
+	Headless                   bool // see NewHeadlessContext
 	UseIntelTextureBindingFix  bool
 	UseIntelCubemaDsaFix       bool
 	IntelTextureBindingTargets map[uint32]uint32
@@ -141,6 +144,18 @@ const (
 	VendorUnknown = "unknown"
 )
 
+// Reports whether the context supports the extension, like "GL_ARB_indirect_parameters"
+func HasExtension(name string) bool {
+	var count int32
+	gl.GetIntegerv(gl.NUM_EXTENSIONS, &count)
+	for i := uint32(0); i < uint32(count); i++ {
+		if gl.GoStr(gl.GetStringi(gl.EXTENSIONS, i)) == name {
+			return true
+		}
+	}
+	return false
+}
+
 func GetGlEnv() *GlEnvironment {
 	vendor := string(gl.GoStr(gl.GetString(gl.VENDOR)))
 	vendor = strings.ToLower(strings.TrimSuffix(vendor, "\x00"))
@@ -154,12 +169,19 @@ func GetGlEnv() *GlEnvironment {
 		vendor = VendorUnknown
 	}
 
+	renderer := string(gl.GoStr(gl.GetString(gl.RENDERER)))
+	renderer = strings.TrimSuffix(renderer, "\x00")
+	lowerRenderer := strings.ToLower(renderer)
+	software := strings.Contains(lowerRenderer, "llvmpipe") || strings.Contains(lowerRenderer, "softpipe") || strings.Contains(lowerRenderer, "swrast")
+
 	features := GlFeatures{}
 
 	gl.GetFloatv(gl.MAX_TEXTURE_MAX_ANISOTROPY, &features.MaxTextureMaxAnisotropy)
 
 	return &GlEnvironment{
 		Vendor:                     vendor,
+		Renderer:                   renderer,
+		SoftwareRenderer:           software,
 		UseIntelTextureBindingFix:  vendor == VendorIntel,
 		UseIntelCubemaDsaFix:       vendor == VendorIntel,
 		IntelTextureBindingTargets: map[uint32]uint32{},
@@ -475,6 +497,19 @@ func (s *GlStateManager) BindBuffer(target uint32, buffer uint32) {
 	}
 }
 
+// Indexed bindings are not tracked, but glBindBufferBase also changes the generic binding point
+func (s *GlStateManager) BindBufferBase(target uint32, index int, buffer uint32) {
+	gl.BindBufferBase(target, uint32(index), buffer)
+	switch target {
+	case gl.UNIFORM_BUFFER:
+		s.UniformBuffer = buffer
+	case gl.SHADER_STORAGE_BUFFER:
+		s.ShaderStorageBuffer = buffer
+	case gl.TRANSFORM_FEEDBACK_BUFFER:
+		s.TransformFeedbackBuffer = buffer
+	}
+}
+
 func (s *GlStateManager) BindArrayBuffer(buffer uint32) {
 	if s.ArrayBuffer == buffer {
 		return
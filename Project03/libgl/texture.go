@@ -24,9 +24,11 @@ type UnboundTexture interface {
 	Dimensions() int
 	As(dimensions uint32) UnboundTexture
 	Bind(unit int) BoundTexture
+	BindImage(unit, level int, layered bool, layer int, access, format uint32)
 	Allocate(levels int, internalFormat uint32, width, height, depth int)
 	AllocateMS(internalFormat uint32, width, height, depth, samples int, fixedSampleLocations bool)
 	Load(level int, width, height, depth int, format uint32, data any)
+	LoadCompressed(level int, width, height, depth int, internalFormat uint32, data []byte)
 	MipmapLevels(base, max int)
 	DepthStencilTextureMode(mode int32)
 	CreateView(dimensions, internalFormat uint32, minLevel, maxLevel, minLayer, maxLayer int) UnboundTexture
@@ -89,6 +91,12 @@ func (tex *texture) Bind(unit int) BoundTexture {
 	return BoundTexture(tex)
 }
 
+// Binds a single level of the texture to an image unit for load / store operations.
+// When layered is true all layers of an array, cube map or 3d texture are bound and layer is ignored.
+func (tex *texture) BindImage(unit, level int, layered bool, layer int, access, format uint32) {
+	gl.BindImageTexture(uint32(unit), tex.glId, int32(level), layered, int32(layer), access, format)
+}
+
 func (tex *texture) Delete() {
 	gl.DeleteTextures(1, &tex.glId)
 	tex.glId = 0
@@ -161,6 +169,19 @@ func (tex *texture) Load(level int, width, height, depth int, format uint32, dat
 	}
 }
 
+// Uploads block compressed data, internalFormat has to match the allocated format.
+// For cubemaps use depth=6
+func (tex *texture) LoadCompressed(level int, width, height, depth int, internalFormat uint32, data []byte) {
+	switch tex.Dimensions() {
+	case 1:
+		gl.CompressedTextureSubImage1D(tex.glId, int32(level), 0, int32(width), internalFormat, int32(len(data)), Pointer(data))
+	case 2:
+		gl.CompressedTextureSubImage2D(tex.glId, int32(level), 0, 0, int32(width), int32(height), internalFormat, int32(len(data)), Pointer(data))
+	case 3:
+		gl.CompressedTextureSubImage3D(tex.glId, int32(level), 0, 0, 0, int32(width), int32(height), int32(depth), internalFormat, int32(len(data)), Pointer(data))
+	}
+}
+
 func (tex *texture) GenerateMipmap() {
 	gl.GenerateTextureMipmap(tex.glId)
 }
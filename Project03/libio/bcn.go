@@ -0,0 +1,633 @@
+package libio
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// A DXGI format enum value, as used by dds files
+type DxgiFormat uint32
+
+const (
+	DxgiFormatUnknown      = DxgiFormat(0)
+	DxgiFormatBC1Unorm     = DxgiFormat(71)
+	DxgiFormatBC1UnormSrgb = DxgiFormat(72)
+	DxgiFormatBC3Unorm     = DxgiFormat(77)
+	DxgiFormatBC3UnormSrgb = DxgiFormat(78)
+	DxgiFormatBC4Unorm     = DxgiFormat(80)
+	DxgiFormatBC5Unorm     = DxgiFormat(83)
+	DxgiFormatBC7Unorm     = DxgiFormat(98)
+	DxgiFormatBC7UnormSrgb = DxgiFormat(99)
+)
+
+type blockFormatInfo struct {
+	name string
+	// the size of one 4x4 block in bytes
+	blockBytes int
+	// the channels of the decoded texels
+	channels int
+	srgb     bool
+}
+
+var blockFormats = map[DxgiFormat]blockFormatInfo{
+	DxgiFormatBC1Unorm:     {"bc1", 8, 4, false},
+	DxgiFormatBC1UnormSrgb: {"bc1_srgb", 8, 4, true},
+	DxgiFormatBC3Unorm:     {"bc3", 16, 4, false},
+	DxgiFormatBC3UnormSrgb: {"bc3_srgb", 16, 4, true},
+	DxgiFormatBC4Unorm:     {"bc4", 8, 1, false},
+	DxgiFormatBC5Unorm:     {"bc5", 16, 2, false},
+	DxgiFormatBC7Unorm:     {"bc7", 16, 4, false},
+	DxgiFormatBC7UnormSrgb: {"bc7_srgb", 16, 4, true},
+}
+
+func (format DxgiFormat) String() string {
+	if info, ok := blockFormats[format]; ok {
+		return info.name
+	}
+	return fmt.Sprintf("unknown(%d)", int(format))
+}
+
+// Returns true for the block compressed formats supported by this package
+func (format DxgiFormat) IsBlockCompressed() bool {
+	_, ok := blockFormats[format]
+	return ok
+}
+
+// Returns the size of one 4x4 block in bytes
+func (format DxgiFormat) BlockBytes() int {
+	return blockFormats[format].blockBytes
+}
+
+// Returns the number of channels of the decoded texels
+func (format DxgiFormat) Channels() int {
+	return blockFormats[format].channels
+}
+
+func (format DxgiFormat) IsSrgb() bool {
+	return blockFormats[format].srgb
+}
+
+// Returns the number of blocks covering a width x height slice
+func blockCount(width, height int) (x, y int) {
+	return (width + 3) / 4, (height + 3) / 4
+}
+
+// Returns the size of a width x height x depth slice in bytes
+func blockDataSize(format DxgiFormat, width, height, depth int) int {
+	bx, by := blockCount(width, height)
+	return bx * by * depth * format.BlockBytes()
+}
+
+// DecodeBlocks is a reference decoder for one block compressed 2D slice.
+// It is meant for tests and tools, not for speed.
+// The texels are returned in the order of the blocks, so the first row of the first block row comes first.
+func DecodeBlocks(format DxgiFormat, width, height int, data []byte) ([]uint8, error) {
+	info, ok := blockFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("format %v is not block compressed", format)
+	}
+	if width < 1 || height < 1 {
+		return nil, fmt.Errorf("invalid block compressed size %dx%d", width, height)
+	}
+	if size := blockDataSize(format, width, height, 1); len(data) != size {
+		return nil, fmt.Errorf("a %dx%d %v slice should be %d bytes but is %d", width, height, format, size, len(data))
+	}
+
+	bx, by := blockCount(width, height)
+	result := make([]uint8, width*height*info.channels)
+	var texels [16 * 4]uint8
+
+	for j := 0; j < by; j++ {
+		for i := 0; i < bx; i++ {
+			block := data[(j*bx+i)*info.blockBytes:]
+			switch format {
+			case DxgiFormatBC1Unorm, DxgiFormatBC1UnormSrgb:
+				decodeBC1Block(block, texels[:], true)
+			case DxgiFormatBC3Unorm, DxgiFormatBC3UnormSrgb:
+				decodeBC1Block(block[8:], texels[:], false)
+				decodeBC4Block(block, texels[3:], 4)
+			case DxgiFormatBC4Unorm:
+				decodeBC4Block(block, texels[:], 1)
+			case DxgiFormatBC5Unorm:
+				decodeBC4Block(block, texels[0:], 2)
+				decodeBC4Block(block[8:], texels[1:], 2)
+			case DxgiFormatBC7Unorm, DxgiFormatBC7UnormSrgb:
+				decodeBC7Block(block, texels[:])
+			}
+
+			// copy the texels which are inside the slice
+			for y := 0; y < 4 && j*4+y < height; y++ {
+				for x := 0; x < 4 && i*4+x < width; x++ {
+					dst := ((j*4+y)*width + i*4 + x) * info.channels
+					copy(result[dst:dst+info.channels], texels[(y*4+x)*info.channels:])
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// Decodes the levels of a block compressed texture, which are laid out like the levels of a Ktx2Texture
+func decodeBlockTexture(format DxgiFormat, width, height, depth, layers, faces int, levels [][]byte, flip bool) (*IntTexture, error) {
+	if !format.IsBlockCompressed() {
+		return nil, fmt.Errorf("format %v is not block compressed", format)
+	}
+	result := &IntTexture{
+		texture: newTexture(format.Channels(), width, height, depth, layers*faces, len(levels)),
+	}
+	result.CubeMap = faces == 6
+	if err := result.validate(); err != nil {
+		return nil, err
+	}
+	result.Pix = make([]uint8, result.Count()*result.Channels)
+
+	for lvl, level := range levels {
+		w, h, d := result.Size(lvl)
+		size := blockDataSize(format, w, h, 1)
+		if len(level) != size*d*layers*faces {
+			return nil, fmt.Errorf("level %d should be %d bytes but is %d", lvl, size*d*layers*faces, len(level))
+		}
+		dst := result.Level(lvl)
+		for slice := 0; slice < d*layers*faces; slice++ {
+			pix, err := DecodeBlocks(format, w, h, level[slice*size:(slice+1)*size])
+			if err != nil {
+				return nil, fmt.Errorf("could not decode level %d: %w", lvl, err)
+			}
+			copy(dst[slice*len(pix):], pix)
+		}
+		if flip {
+			flipLevel(&result.texture, lvl, dst)
+		}
+	}
+	return result, nil
+}
+
+// Flips every slice of the levels, see flipBlocks
+func flipBlockLevels(format DxgiFormat, width, height, depth, layers int, levels [][]byte) error {
+	for lvl, level := range levels {
+		w, h := max1(width>>lvl), max1(height>>lvl)
+		d := max1(depth >> lvl)
+		size := blockDataSize(format, w, h, 1)
+		if len(level) != size*d*layers {
+			return fmt.Errorf("level %d should be %d bytes but is %d", lvl, size*d*layers, len(level))
+		}
+		for slice := 0; slice < d*layers; slice++ {
+			if err := flipBlocks(format, w, h, level[slice*size:(slice+1)*size]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Expands a 565 color to rgb
+func unpack565(c uint16) (r, g, b uint8) {
+	r = uint8(c>>11) & 0x1f
+	g = uint8(c>>5) & 0x3f
+	b = uint8(c) & 0x1f
+	return r<<3 | r>>2, g<<2 | g>>4, b<<3 | b>>2
+}
+
+// Decodes the 8 byte color block into 16 rgba texels.
+// When punchThrough is false the block always uses four colors, like the color part of bc3.
+func decodeBC1Block(block []byte, texels []uint8, punchThrough bool) {
+	c0 := binary.LittleEndian.Uint16(block[0:])
+	c1 := binary.LittleEndian.Uint16(block[2:])
+	indices := binary.LittleEndian.Uint32(block[4:])
+
+	var palette [4][4]uint8
+	r0, g0, b0 := unpack565(c0)
+	r1, g1, b1 := unpack565(c1)
+	palette[0] = [4]uint8{r0, g0, b0, 0xff}
+	palette[1] = [4]uint8{r1, g1, b1, 0xff}
+	if c0 > c1 || !punchThrough {
+		for k := 0; k < 3; k++ {
+			a, b := int(palette[0][k]), int(palette[1][k])
+			palette[2][k] = uint8((2*a + b + 1) / 3)
+			palette[3][k] = uint8((a + 2*b + 1) / 3)
+		}
+		palette[2][3] = 0xff
+		palette[3][3] = 0xff
+	} else {
+		for k := 0; k < 3; k++ {
+			palette[2][k] = uint8((int(palette[0][k]) + int(palette[1][k]) + 1) / 2)
+		}
+		palette[2][3] = 0xff
+		// the fourth color is transparent black
+	}
+
+	for i := 0; i < 16; i++ {
+		copy(texels[i*4:i*4+4], palette[(indices>>(2*i))&3][:])
+	}
+}
+
+// Decodes the 8 byte single channel block, the texels are written every stride bytes
+func decodeBC4Block(block []byte, texels []uint8, stride int) {
+	var palette [8]uint8
+	a, b := int(block[0]), int(block[1])
+	palette[0], palette[1] = block[0], block[1]
+	if a > b {
+		for k := 1; k < 7; k++ {
+			palette[k+1] = uint8(((7-k)*a + k*b + 3) / 7)
+		}
+	} else {
+		for k := 1; k < 5; k++ {
+			palette[k+1] = uint8(((5-k)*a + k*b + 2) / 5)
+		}
+		palette[6] = 0
+		palette[7] = 0xff
+	}
+
+	var indices uint64
+	for k := 0; k < 6; k++ {
+		indices |= uint64(block[2+k]) << (8 * k)
+	}
+	for i := 0; i < 16; i++ {
+		texels[i*stride] = palette[(indices>>(3*i))&7]
+	}
+}
+
+// The properties of each bc7 mode, see https://learn.microsoft.com/en-us/windows/win32/direct3d11/bc7-format-mode-reference
+type bc7Mode struct {
+	subsets        int
+	partitionBits  int
+	rotationBits   int
+	selectionBits  int
+	colorBits      int
+	alphaBits      int
+	endpointPBits  bool
+	sharedPBits    bool
+	indexBits      int
+	secondaryIndex int
+}
+
+var bc7Modes = [8]bc7Mode{
+	{3, 4, 0, 0, 4, 0, true, false, 3, 0},
+	{2, 6, 0, 0, 6, 0, false, true, 3, 0},
+	{3, 6, 0, 0, 5, 0, false, false, 2, 0},
+	{2, 6, 0, 0, 7, 0, true, false, 2, 0},
+	{1, 0, 2, 1, 5, 6, false, false, 2, 3},
+	{1, 0, 2, 0, 7, 8, false, false, 2, 2},
+	{1, 0, 0, 0, 7, 7, true, false, 4, 0},
+	{2, 6, 0, 0, 5, 5, true, false, 2, 0},
+}
+
+var bc7Weights = [5][]int{
+	2: {0, 21, 43, 64},
+	3: {0, 9, 18, 27, 37, 46, 55, 64},
+	4: {0, 4, 9, 13, 17, 21, 26, 30, 34, 38, 43, 47, 51, 55, 60, 64},
+}
+
+// The two subset partitions, bit i is the subset of texel i
+var bc7Partitions2 = [64]uint16{
+	0xcccc, 0x8888, 0xeeee, 0xecc8, 0xc880, 0xfeec, 0xfec8, 0xec80,
+	0xc800, 0xffec, 0xfe80, 0xe800, 0xffe8, 0xff00, 0xfff0, 0xf000,
+	0xf710, 0x008e, 0x7100, 0x08ce, 0x008c, 0x7310, 0x3100, 0x8cce,
+	0x088c, 0x3110, 0x6666, 0x366c, 0x17e8, 0x0ff0, 0x718e, 0x399c,
+	0xaaaa, 0xf0f0, 0x5a5a, 0x33cc, 0x3c3c, 0x55aa, 0x9696, 0xa55a,
+	0x73ce, 0x13c8, 0x324c, 0x3bdc, 0x6996, 0xc33c, 0x9966, 0x0660,
+	0x0272, 0x04e4, 0x4e40, 0x2720, 0xc936, 0x936c, 0x39c6, 0x639c,
+	0x9336, 0x9cc6, 0x817e, 0xe718, 0xccf0, 0x0fcc, 0x7744, 0xee22,
+}
+
+// The three subset partitions, one row of texels per entry
+var bc7Partitions3 = [64][16]uint8{
+	{0, 0, 1, 1, 0, 0, 1, 1, 0, 2, 2, 1, 2, 2, 2, 2},
+	{0, 0, 0, 1, 0, 0, 1, 1, 2, 2, 1, 1, 2, 2, 2, 1},
+	{0, 0, 0, 0, 2, 0, 0, 1, 2, 2, 1, 1, 2, 2, 1, 1},
+	{0, 2, 2, 2, 0, 0, 2, 2, 0, 0, 1, 1, 0, 1, 1, 1},
+	{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 2, 2, 1, 1, 2, 2},
+	{0, 0, 1, 1, 0, 0, 1, 1, 0, 0, 2, 2, 0, 0, 2, 2},
+	{0, 0, 2, 2, 0, 0, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1},
+	{0, 0, 1, 1, 0, 0, 1, 1, 2, 2, 1, 1, 2, 2, 1, 1},
+	{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2},
+	{0, 0, 0, 0, 1, 1, 1, 1, 1, 1, 1, 1, 2, 2, 2, 2},
+	{0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 2, 2, 2, 2},
+	{0, 0, 1, 2, 0, 0, 1, 2, 0, 0, 1, 2, 0, 0, 1, 2},
+	{0, 1, 1, 2, 0, 1, 1, 2, 0, 1, 1, 2, 0, 1, 1, 2},
+	{0, 1, 2, 2, 0, 1, 2, 2, 0, 1, 2, 2, 0, 1, 2, 2},
+	{0, 0, 1, 1, 0, 1, 1, 2, 1, 1, 2, 2, 1, 2, 2, 2},
+	{0, 0, 1, 1, 2, 0, 0, 1, 2, 2, 0, 0, 2, 2, 2, 0},
+	{0, 0, 0, 1, 0, 0, 1, 1, 0, 1, 1, 2, 1, 1, 2, 2},
+	{0, 1, 1, 1, 0, 0, 1, 1, 2, 0, 0, 1, 2, 2, 0, 0},
+	{0, 0, 0, 0, 1, 1, 2, 2, 1, 1, 2, 2, 1, 1, 2, 2},
+	{0, 0, 2, 2, 0, 0, 2, 2, 0, 0, 2, 2, 1, 1, 1, 1},
+	{0, 1, 1, 1, 0, 1, 1, 1, 0, 2, 2, 2, 0, 2, 2, 2},
+	{0, 0, 0, 1, 0, 0, 0, 1, 2, 2, 2, 1, 2, 2, 2, 1},
+	{0, 0, 0, 0, 0, 0, 1, 1, 0, 1, 2, 2, 0, 1, 2, 2},
+	{0, 0, 0, 0, 1, 1, 0, 0, 2, 2, 1, 0, 2, 2, 1, 0},
+	{0, 1, 2, 2, 0, 1, 2, 2, 0, 0, 1, 1, 0, 0, 0, 0},
+	{0, 0, 1, 2, 0, 0, 1, 2, 1, 1, 2, 2, 2, 2, 2, 2},
+	{0, 1, 1, 0, 1, 2, 2, 1, 1, 2, 2, 1, 0, 1, 1, 0},
+	{0, 0, 0, 0, 0, 1, 1, 0, 1, 2, 2, 1, 1, 2, 2, 1},
+	{0, 0, 2, 2, 1, 1, 0, 2, 1, 1, 0, 2, 0, 0, 2, 2},
+	{0, 1, 1, 0, 0, 1, 1, 0, 2, 0, 0, 2, 2, 2, 2, 2},
+	{0, 0, 1, 1, 0, 1, 2, 2, 0, 1, 2, 2, 0, 0, 1, 1},
+	{0, 0, 0, 0, 2, 0, 0, 0, 2, 2, 1, 1, 2, 2, 2, 1},
+	{0, 0, 0, 0, 0, 0, 0, 2, 1, 1, 2, 2, 1, 2, 2, 2},
+	{0, 2, 2, 2, 0, 0, 2, 2, 0, 0, 1, 2, 0, 0, 1, 1},
+	{0, 0, 1, 1, 0, 0, 1, 2, 0, 0, 2, 2, 0, 2, 2, 2},
+	{0, 1, 2, 0, 0, 1, 2, 0, 0, 1, 2, 0, 0, 1, 2, 0},
+	{0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 0, 0, 0, 0},
+	{0, 1, 2, 0, 1, 2, 0, 1, 2, 0, 1, 2, 0, 1, 2, 0},
+	{0, 1, 2, 0, 2, 0, 1, 2, 1, 2, 0, 1, 0, 1, 2, 0},
+	{0, 0, 1, 1, 2, 2, 0, 0, 1, 1, 2, 2, 0, 0, 1, 1},
+	{0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 0, 0, 0, 0, 1, 1},
+	{0, 1, 0, 1, 0, 1, 0, 1, 2, 2, 2, 2, 2, 2, 2, 2},
+	{0, 0, 0, 0, 0, 0, 0, 0, 2, 1, 2, 1, 2, 1, 2, 1},
+	{0, 0, 2, 2, 1, 1, 2, 2, 0, 0, 2, 2, 1, 1, 2, 2},
+	{0, 0, 2, 2, 0, 0, 1, 1, 0, 0, 2, 2, 0, 0, 1, 1},
+	{0, 2, 2, 0, 1, 2, 2, 1, 0, 2, 2, 0, 1, 2, 2, 1},
+	{0, 1, 0, 1, 2, 2, 2, 2, 2, 2, 2, 2, 0, 1, 0, 1},
+	{0, 0, 0, 0, 2, 1, 2, 1, 2, 1, 2, 1, 2, 1, 2, 1},
+	{0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 2, 2, 2, 2},
+	{0, 2, 2, 2, 0, 1, 1, 1, 0, 2, 2, 2, 0, 1, 1, 1},
+	{0, 0, 0, 2, 1, 1, 1, 2, 0, 0, 0, 2, 1, 1, 1, 2},
+	{0, 0, 0, 0, 2, 1, 1, 2, 2, 1, 1, 2, 2, 1, 1, 2},
+	{0, 2, 2, 2, 0, 1, 1, 1, 0, 1, 1, 1, 0, 2, 2, 2},
+	{0, 0, 0, 2, 1, 1, 1, 2, 1, 1, 1, 2, 0, 0, 0, 2},
+	{0, 1, 1, 0, 0, 1, 1, 0, 0, 1, 1, 0, 2, 2, 2, 2},
+	{0, 0, 0, 0, 0, 0, 0, 0, 2, 1, 1, 2, 2, 1, 1, 2},
+	{0, 1, 1, 0, 0, 1, 1, 0, 2, 2, 2, 2, 2, 2, 2, 2},
+	{0, 0, 2, 2, 0, 0, 1, 1, 0, 0, 1, 1, 0, 0, 2, 2},
+	{0, 0, 2, 2, 1, 1, 2, 2, 1, 1, 2, 2, 0, 0, 2, 2},
+	{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 1, 1, 2},
+	{0, 0, 0, 2, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 1},
+	{0, 2, 2, 2, 1, 2, 2, 2, 0, 2, 2, 2, 1, 2, 2, 2},
+	{0, 1, 0, 1, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2},
+	{0, 1, 1, 1, 2, 0, 1, 1, 2, 2, 0, 1, 2, 2, 2, 0},
+}
+
+// The anchor texel of the second subset of the two subset partitions
+var bc7Anchors2 = [64]uint8{
+	15, 15, 15, 15, 15, 15, 15, 15,
+	15, 15, 15, 15, 15, 15, 15, 15,
+	15, 2, 8, 2, 2, 8, 8, 15,
+	2, 8, 2, 2, 8, 8, 2, 2,
+	15, 15, 6, 8, 2, 8, 15, 15,
+	2, 8, 2, 2, 2, 15, 15, 6,
+	6, 2, 6, 8, 15, 15, 2, 2,
+	15, 15, 15, 15, 15, 2, 2, 15,
+}
+
+// The anchor texels of the second and third subset of the three subset partitions
+var bc7Anchors3 = [2][64]uint8{
+	{
+		3, 3, 15, 15, 8, 3, 15, 15,
+		8, 8, 6, 6, 6, 5, 3, 3,
+		3, 3, 8, 15, 3, 3, 6, 10,
+		5, 8, 8, 6, 8, 5, 15, 15,
+		8, 15, 3, 5, 6, 10, 8, 15,
+		15, 3, 15, 5, 15, 15, 15, 15,
+		3, 15, 5, 5, 5, 8, 5, 10,
+		5, 10, 8, 13, 15, 12, 3, 3,
+	},
+	{
+		15, 8, 8, 3, 15, 15, 3, 8,
+		15, 15, 15, 15, 15, 15, 15, 8,
+		15, 8, 15, 3, 15, 8, 15, 8,
+		3, 15, 6, 10, 15, 15, 10, 8,
+		15, 3, 15, 10, 10, 8, 9, 10,
+		6, 15, 8, 15, 3, 6, 6, 8,
+		15, 3, 15, 15, 15, 15, 15, 15,
+		15, 15, 15, 15, 3, 15, 15, 8,
+	},
+}
+
+// Returns the subset of texel i in a partition of a mode with 1, 2 or 3 subsets and whether it is the anchor of the subset.
+// The index of an anchor texel has one bit less.
+func BC7Subset(subsets, partition, i int) (subset int, anchor bool) {
+	switch subsets {
+	case 2:
+		subset = int(bc7Partitions2[partition]>>i) & 1
+		if subset == 1 {
+			return subset, i == int(bc7Anchors2[partition])
+		}
+	case 3:
+		subset = int(bc7Partitions3[partition][i])
+		if subset > 0 {
+			return subset, i == int(bc7Anchors3[subset-1][partition])
+		}
+	}
+	return subset, i == 0
+}
+
+// Reads the bits of a block, starting at the least significant bit of the first byte
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (br *bitReader) read(n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		bit := int(br.data[br.pos>>3]>>(br.pos&7)) & 1
+		v |= bit << i
+		br.pos++
+	}
+	return v
+}
+
+// Decodes the 16 byte block into 16 rgba texels
+func decodeBC7Block(block []byte, texels []uint8) {
+	modeIndex := 0
+	for modeIndex < 8 && block[0]&(1<<modeIndex) == 0 {
+		modeIndex++
+	}
+	if modeIndex == 8 {
+		// reserved, decodes to transparent black
+		for i := range texels[:64] {
+			texels[i] = 0
+		}
+		return
+	}
+	mode := bc7Modes[modeIndex]
+	br := &bitReader{data: block[:16], pos: modeIndex + 1}
+
+	partition := br.read(mode.partitionBits)
+	rotation := br.read(mode.rotationBits)
+	selection := br.read(mode.selectionBits)
+
+	// [subset*2+endpoint][channel]
+	var endpoints [6][4]int
+	for ch := 0; ch < 3; ch++ {
+		for e := 0; e < mode.subsets*2; e++ {
+			endpoints[e][ch] = br.read(mode.colorBits)
+		}
+	}
+	for e := 0; e < mode.subsets*2; e++ {
+		endpoints[e][3] = br.read(mode.alphaBits)
+	}
+
+	colorBits, alphaBits := mode.colorBits, mode.alphaBits
+	if mode.endpointPBits || mode.sharedPBits {
+		var pBits [6]int
+		if mode.endpointPBits {
+			for e := 0; e < mode.subsets*2; e++ {
+				pBits[e] = br.read(1)
+			}
+		} else {
+			for s := 0; s < mode.subsets; s++ {
+				pBits[s*2] = br.read(1)
+				pBits[s*2+1] = pBits[s*2]
+			}
+		}
+		for e := 0; e < mode.subsets*2; e++ {
+			for ch := 0; ch < 4; ch++ {
+				endpoints[e][ch] = endpoints[e][ch]<<1 | pBits[e]
+			}
+		}
+		colorBits++
+		if alphaBits > 0 {
+			alphaBits++
+		}
+	}
+
+	for e := 0; e < mode.subsets*2; e++ {
+		for ch := 0; ch < 3; ch++ {
+			endpoints[e][ch] = expandBits(endpoints[e][ch], colorBits)
+		}
+		if alphaBits > 0 {
+			endpoints[e][3] = expandBits(endpoints[e][3], alphaBits)
+		} else {
+			endpoints[e][3] = 0xff
+		}
+	}
+
+	var indices, secondary [16]int
+	for i := 0; i < 16; i++ {
+		_, anchor := BC7Subset(mode.subsets, partition, i)
+		if anchor {
+			indices[i] = br.read(mode.indexBits - 1)
+		} else {
+			indices[i] = br.read(mode.indexBits)
+		}
+	}
+	if mode.secondaryIndex > 0 {
+		for i := 0; i < 16; i++ {
+			if i == 0 {
+				secondary[i] = br.read(mode.secondaryIndex - 1)
+			} else {
+				secondary[i] = br.read(mode.secondaryIndex)
+			}
+		}
+	}
+
+	for i := 0; i < 16; i++ {
+		subset, _ := BC7Subset(mode.subsets, partition, i)
+		e0, e1 := endpoints[subset*2], endpoints[subset*2+1]
+
+		colorWeights, alphaWeights := bc7Weights[mode.indexBits], bc7Weights[mode.indexBits]
+		colorIndex, alphaIndex := indices[i], indices[i]
+		if mode.secondaryIndex > 0 {
+			alphaWeights, alphaIndex = bc7Weights[mode.secondaryIndex], secondary[i]
+			if selection == 1 {
+				colorWeights, alphaWeights = alphaWeights, colorWeights
+				colorIndex, alphaIndex = alphaIndex, colorIndex
+			}
+		}
+
+		var texel [4]int
+		for ch := 0; ch < 3; ch++ {
+			texel[ch] = bc7Interpolate(e0[ch], e1[ch], colorWeights[colorIndex])
+		}
+		texel[3] = bc7Interpolate(e0[3], e1[3], alphaWeights[alphaIndex])
+		if rotation > 0 {
+			texel[3], texel[rotation-1] = texel[rotation-1], texel[3]
+		}
+
+		for ch := 0; ch < 4; ch++ {
+			texels[i*4+ch] = uint8(texel[ch])
+		}
+	}
+}
+
+// Returns the interpolation weight of an index with 2, 3 or 4 bits, in 64ths
+func BC7Weight(indexBits, index int) int {
+	return bc7Weights[indexBits][index]
+}
+
+// Expands a value with the given number of bits to 8 bits by replicating the high bits
+func expandBits(v, bits int) int {
+	v <<= 8 - bits
+	return v | v>>bits
+}
+
+func bc7Interpolate(e0, e1, weight int) int {
+	return ((64-weight)*e0 + weight*e1 + 32) >> 6
+}
+
+// Flips the block rows of a slice and the texel rows inside each block, so the last row becomes the first.
+// Only heights which are a multiple of 4 or fit into a single block can be flipped without re-encoding.
+func flipBlocks(format DxgiFormat, width, height int, data []byte) error {
+	if format == DxgiFormatBC7Unorm || format == DxgiFormatBC7UnormSrgb {
+		return fmt.Errorf("%v blocks cannot be flipped without re-encoding", format)
+	}
+	if height > 4 && height%4 != 0 {
+		return fmt.Errorf("a %v slice with a height of %d cannot be flipped without re-encoding", format, height)
+	}
+
+	// the source row of each destination row in a block
+	rows := [4]int{3, 2, 1, 0}
+	if height < 4 {
+		for y := 0; y < height; y++ {
+			rows[y] = height - 1 - y
+		}
+		for y := height; y < 4; y++ {
+			rows[y] = y
+		}
+	}
+
+	blockBytes := format.BlockBytes()
+	bx, by := blockCount(width, height)
+	rowBytes := bx * blockBytes
+	tmp := make([]byte, rowBytes)
+	for j := 0; j < by/2; j++ {
+		a := data[j*rowBytes : (j+1)*rowBytes]
+		b := data[(by-1-j)*rowBytes : (by-j)*rowBytes]
+		copy(tmp, a)
+		copy(a, b)
+		copy(b, tmp)
+	}
+
+	for k := 0; k < bx*by; k++ {
+		block := data[k*blockBytes : (k+1)*blockBytes]
+		switch format {
+		case DxgiFormatBC1Unorm, DxgiFormatBC1UnormSrgb:
+			flipBC1Block(block, rows)
+		case DxgiFormatBC3Unorm, DxgiFormatBC3UnormSrgb:
+			flipBC4Block(block, rows)
+			flipBC1Block(block[8:], rows)
+		case DxgiFormatBC4Unorm:
+			flipBC4Block(block, rows)
+		case DxgiFormatBC5Unorm:
+			flipBC4Block(block, rows)
+			flipBC4Block(block[8:], rows)
+		}
+	}
+	return nil
+}
+
+// Each row of a bc1 block has 8 index bits
+func flipBC1Block(block []byte, rows [4]int) {
+	var indices [4]byte
+	copy(indices[:], block[4:8])
+	for y, src := range rows {
+		block[4+y] = indices[src]
+	}
+}
+
+// Each row of a bc4 block has 12 index bits
+func flipBC4Block(block []byte, rows [4]int) {
+	var indices, flipped uint64
+	for k := 0; k < 6; k++ {
+		indices |= uint64(block[2+k]) << (8 * k)
+	}
+	for y, src := range rows {
+		flipped |= (indices >> (12 * src) & 0xfff) << (12 * y)
+	}
+	for k := 0; k < 6; k++ {
+		block[2+k] = uint8(flipped >> (8 * k))
+	}
+}
@@ -2,43 +2,190 @@ package libio
 
 import (
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
+	"unsafe"
 )
 
+// The allocation limit of a BinaryReader without a MaxAlloc, larger than any texture or mesh of this module
+const DefaultMaxAlloc = 1 << 30
+
+// Wrapped by the errors of decoders when the data claims to be larger than the allocation limit
+var ErrAllocLimit = errors.New("allocation limit exceeded")
+
+// A DecodeError is returned by the decoders of binary formats and carries the offset where decoding failed
+type DecodeError struct {
+	// what the decoder expected or found, e.g. "expected mesh header"
+	Msg string
+	// the offset in bytes from the start of the data
+	Offset int
+	// the cause like io.ErrUnexpectedEOF or ErrAllocLimit, may be nil
+	Err error
+}
+
+func NewDecodeError(offset int, err error, format string, a ...any) *DecodeError {
+	return &DecodeError{
+		Msg:    fmt.Sprintf(format, a...),
+		Offset: offset,
+		Err:    err,
+	}
+}
+
+func (e *DecodeError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v; byte 0x%08x", e.Msg, e.Err, e.Offset)
+	}
+	return fmt.Sprintf("%s; byte 0x%08x", e.Msg, e.Offset)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// A BinaryReader reads exactly the requested number of bytes and keeps the first error.
+// Index is the number of bytes read so far and LastIndex the offset at which the last read started.
 type BinaryReader struct {
 	Order     binary.ByteOrder
 	Src       io.Reader
 	Index     int
 	LastIndex int
 	Err       error
-	buf       []byte
+	// The largest allocation decoders may make for sizes read from the data, DefaultMaxAlloc when 0
+	MaxAlloc int
+	// reused by ReadBytes and the integer reads
+	buf []byte
 }
 
-func (br *BinaryReader) ReadBytes(n int) (ok bool) {
+// Returns the allocation limit
+func (br *BinaryReader) Limit() int {
+	if br.MaxAlloc <= 0 {
+		return DefaultMaxAlloc
+	}
+	return br.MaxAlloc
+}
+
+// Reports whether elements of size bytes times all counts are within the allocation limit, sets Err otherwise.
+// Decoders check the counts read from the data before they allocate memory for them, the product cannot overflow.
+func (br *BinaryReader) CheckAlloc(size int, counts ...int) (ok bool) {
 	if br.Err != nil {
 		return false
 	}
+	limit := br.Limit()
+	total := size
+	for _, count := range counts {
+		if count < 0 || (count > 0 && total > limit/count) {
+			total = -1
+			break
+		}
+		total *= count
+	}
+	if total < 0 || total > limit {
+		br.LastIndex = br.Index
+		br.Err = fmt.Errorf("%v elements of %d bytes: %w", counts, size, ErrAllocLimit)
+		return false
+	}
+	return true
+}
+
+// Returns a DecodeError at the start of the last read, caused by the error of the reader
+func (br *BinaryReader) Errorf(format string, a ...any) error {
+	return NewDecodeError(br.LastIndex, br.Err, format, a...)
+}
+
+// Reads n bytes into an internal buffer, which is valid until the next read and returned by Bytes
+func (br *BinaryReader) ReadBytes(n int) (ok bool) {
+	if !br.CheckAlloc(1, n) {
+		return false
+	}
 
-	if cap(br.buf) <= n {
+	if cap(br.buf) < n {
 		br.buf = make([]byte, n)
 	} else {
 		br.buf = br.buf[:n]
 	}
 
-	nread, err := br.Src.Read(br.buf)
+	return br.ReadFull(br.buf)
+}
+
+// Returns the bytes of the last ReadBytes call
+func (br *BinaryReader) Bytes() []byte {
+	return br.buf
+}
+
+// Reads exactly len(p) bytes into p
+func (br *BinaryReader) ReadFull(p []byte) (ok bool) {
+	if br.Err != nil {
+		return false
+	}
+
+	br.LastIndex = br.Index
+	nread, err := io.ReadFull(br.Src, p)
+	br.Index += nread
 	if err != nil {
 		br.Err = err
-		ok = false
+		return false
+	}
+	return true
+}
+
+// Reads n bytes, which reference the source when it is a Viewer like the reader of a MappedFile.
+// Other sources are read into a new slice, which unlike Bytes stays valid.
+func (br *BinaryReader) ReadView(n int) (p []byte, ok bool) {
+	if !br.CheckAlloc(1, n) {
+		return nil, false
+	}
+
+	viewer, isViewer := br.Src.(Viewer)
+	if !isViewer {
+		p = make([]byte, n)
+		return p, br.ReadFull(p)
 	}
 
 	br.LastIndex = br.Index
-	br.Index += nread
+	p, err := viewer.View(n)
+	if err != nil {
+		br.Err = err
+		return nil, false
+	}
+	br.Index += n
+	return p, true
+}
 
-	return br.Err == nil
+// Reads count elements of a fixed size type of numbers like ReadRef.
+// The elements reference the source when it is a Viewer, its data is aligned and the byte order matches the machine.
+func ReadSlice[E any](br *BinaryReader, count int) (s []E, ok bool) {
+	var zero E
+	size := int(unsafe.Sizeof(zero))
+	if !br.CheckAlloc(size, count) {
+		return nil, false
+	}
+
+	_, isViewer := br.Src.(Viewer)
+	if !isViewer || br.Order != binary.LittleEndian || !nativeLittleEndian {
+		s = make([]E, count)
+		return s, br.ReadRef(s)
+	}
+
+	p, ok := br.ReadView(size * count)
+	if !ok {
+		return nil, false
+	}
+	if count == 0 {
+		return []E{}, true
+	}
+	if uintptr(unsafe.Pointer(unsafe.SliceData(p)))%unsafe.Alignof(zero) != 0 {
+		s = make([]E, count)
+		copy(unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(s))), len(p)), p)
+		return s, true
+	}
+	return unsafe.Slice((*E)(unsafe.Pointer(unsafe.SliceData(p))), count), true
 }
 
 func (br *BinaryReader) Read(p []byte) (n int, err error) {
-	return br.Src.Read(p)
+	n, err = br.Src.Read(p)
+	br.Index += n
+	return n, err
 }
 
 func (br *BinaryReader) ReadUInt8(i *int) (ok bool) {
@@ -65,17 +212,54 @@ func (br *BinaryReader) ReadUInt32(i *int) (ok bool) {
 	return true
 }
 
+// Whether the memory layout of numbers matches binary.LittleEndian
+var nativeLittleEndian = func() bool {
+	v := uint16(1)
+	return *(*byte)(unsafe.Pointer(&v)) == 1
+}()
+
+// Reads fixed size data like binary.Read.
+// Slices of numbers are read directly into their memory when the byte order matches the machine.
 func (br *BinaryReader) ReadRef(data any) (ok bool) {
 	if br.Err != nil {
 		return false
 	}
-	err := binary.Read(br.Src, br.Order, data)
-	br.Err = err
+
+	if br.Order == binary.LittleEndian && nativeLittleEndian {
+		switch s := data.(type) {
+		case []byte:
+			return br.ReadFull(s)
+		case []uint16:
+			return readRaw(br, s)
+		case []uint32:
+			return readRaw(br, s)
+		case []float32:
+			return readRaw(br, s)
+		}
+	}
+
+	size := binary.Size(data)
+	if size < 0 {
+		br.Err = fmt.Errorf("cannot read %T", data)
+		return false
+	}
 	br.LastIndex = br.Index
-	if err == nil {
-		br.Index += binary.Size(data)
+	err := binary.Read(br.Src, br.Order, data)
+	if err != nil {
+		br.Err = err
+		return false
 	}
-	return err == nil
+	br.Index += size
+	return true
+}
+
+func readRaw[E uint16 | uint32 | float32](br *BinaryReader, s []E) bool {
+	if len(s) == 0 {
+		br.LastIndex = br.Index
+		return true
+	}
+	bytes := unsafe.Slice((*byte)(unsafe.Pointer(&s[0])), len(s)*int(unsafe.Sizeof(s[0])))
+	return br.ReadFull(bytes)
 }
 
 type BinaryWriter struct {
@@ -0,0 +1,519 @@
+package libio
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/chewxy/math32"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// The red, green and blue primaries and the white point of an RGB color space
+type ColorPrimaries int
+
+const (
+	// The primaries of sRGB and Rec.709 with a D65 white point
+	ColorPrimariesRec709 = ColorPrimaries(iota)
+	// The primaries of DCI-P3 with a D65 white point, as used by Display P3
+	ColorPrimariesDisplayP3
+	// The ACES AP1 primaries with the ACES white point, as used by ACEScg
+	ColorPrimariesAP1
+)
+
+func (p ColorPrimaries) String() string {
+	switch p {
+	case ColorPrimariesRec709:
+		return "rec709"
+	case ColorPrimariesDisplayP3:
+		return "display_p3"
+	case ColorPrimariesAP1:
+		return "ap1"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(p))
+	}
+}
+
+// The CIE xy chromaticities of red, green, blue and white
+var primariesChromaticities = map[ColorPrimaries][4][2]float64{
+	ColorPrimariesRec709:    {{0.640, 0.330}, {0.300, 0.600}, {0.150, 0.060}, {0.3127, 0.3290}},
+	ColorPrimariesDisplayP3: {{0.680, 0.320}, {0.265, 0.690}, {0.150, 0.060}, {0.3127, 0.3290}},
+	ColorPrimariesAP1:       {{0.713, 0.293}, {0.165, 0.830}, {0.128, 0.044}, {0.32168, 0.33767}},
+}
+
+// A ColorSpace tags what the values of an image mean.
+// The names are the ones used by FloatImageMetadata.ColorSpace.
+type ColorSpace int
+
+const (
+	// Data like normals or lookup tables, or colors of an unknown color space, which are never converted
+	ColorSpaceUnknown = ColorSpace(iota)
+	// Rec.709 primaries encoded with the sRGB transfer function, the color space of 8 bit images and pngs
+	ColorSpaceSrgb
+	// Rec.709 primaries without a transfer function, the working space of the renderer
+	ColorSpaceLinearSrgb
+	// Display P3 primaries encoded with the sRGB transfer function
+	ColorSpaceDisplayP3
+	// Display P3 primaries without a transfer function
+	ColorSpaceLinearDisplayP3
+	// ACES AP1 primaries without a transfer function
+	ColorSpaceAcesCg
+)
+
+func (cs ColorSpace) String() string {
+	switch cs {
+	case ColorSpaceUnknown:
+		return "unknown"
+	case ColorSpaceSrgb:
+		return "srgb"
+	case ColorSpaceLinearSrgb:
+		return "linear_srgb"
+	case ColorSpaceDisplayP3:
+		return "display_p3"
+	case ColorSpaceLinearDisplayP3:
+		return "linear_display_p3"
+	case ColorSpaceAcesCg:
+		return "acescg"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(cs))
+	}
+}
+
+func ParseColorSpace(name string) (ColorSpace, error) {
+	for cs := ColorSpaceUnknown; cs <= ColorSpaceAcesCg; cs++ {
+		if strings.EqualFold(name, cs.String()) {
+			return cs, nil
+		}
+	}
+	return ColorSpaceUnknown, fmt.Errorf("unknown color space %q", name)
+}
+
+// Returns the color space named by metadata, names this package does not know are ColorSpaceUnknown
+func colorSpaceFromMetadata(meta FloatImageMetadata) ColorSpace {
+	cs, _ := ParseColorSpace(meta.ColorSpace)
+	return cs
+}
+
+func (cs ColorSpace) Primaries() ColorPrimaries {
+	switch cs {
+	case ColorSpaceDisplayP3, ColorSpaceLinearDisplayP3:
+		return ColorPrimariesDisplayP3
+	case ColorSpaceAcesCg:
+		return ColorPrimariesAP1
+	default:
+		return ColorPrimariesRec709
+	}
+}
+
+// Reports whether the values are encoded with the sRGB transfer function
+func (cs ColorSpace) IsSrgbEncoded() bool {
+	return cs == ColorSpaceSrgb || cs == ColorSpaceDisplayP3
+}
+
+// Returns the color space with the same primaries but without a transfer function
+func (cs ColorSpace) Linear() ColorSpace {
+	switch cs {
+	case ColorSpaceSrgb:
+		return ColorSpaceLinearSrgb
+	case ColorSpaceDisplayP3:
+		return ColorSpaceLinearDisplayP3
+	default:
+		return cs
+	}
+}
+
+// Returns the color space with the same primaries encoded with the sRGB transfer function.
+// ACEScg has no encoded variant and is returned as it is.
+func (cs ColorSpace) Encoded() ColorSpace {
+	switch cs {
+	case ColorSpaceLinearSrgb:
+		return ColorSpaceSrgb
+	case ColorSpaceLinearDisplayP3:
+		return ColorSpaceDisplayP3
+	default:
+		return cs
+	}
+}
+
+// The sRGB electro-optical transfer function, converts an encoded value to linear light
+func SrgbToLinear(v float32) float32 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math32.Pow((v+0.055)/1.055, 2.4)
+}
+
+// The inverse of SrgbToLinear, converts linear light to an encoded value
+func LinearToSrgb(v float32) float32 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math32.Pow(v, 1/2.4) - 0.055
+}
+
+// SrgbToLinear for every 8 bit value
+var srgbToLinearTable = func() (table [256]float32) {
+	for i := range table {
+		table[i] = SrgbToLinear(float32(i) / 0xff)
+	}
+	return table
+}()
+
+// Returns the matrix which converts linear colors from one set of primaries to another.
+// The white points are adapted with the Bradford transform.
+func ColorPrimariesMatrix(from, to ColorPrimaries) mgl32.Mat3 {
+	return primariesMatrices[from][to]
+}
+
+var primariesMatrices = func() (matrices [3][3]mgl32.Mat3) {
+	for from := range matrices {
+		for to := range matrices[from] {
+			matrices[from][to] = primariesMatrix(ColorPrimaries(from), ColorPrimaries(to))
+		}
+	}
+	return matrices
+}()
+
+// A row major 3x3 matrix in double precision, the matrices are only converted to float32 at the end
+type mat3d [3][3]float64
+
+func (a mat3d) mul(b mat3d) (c mat3d) {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				c[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return c
+}
+
+func (a mat3d) mulVec(v [3]float64) (r [3]float64) {
+	for i := 0; i < 3; i++ {
+		r[i] = a[i][0]*v[0] + a[i][1]*v[1] + a[i][2]*v[2]
+	}
+	return r
+}
+
+func (a mat3d) inverse() (inv mat3d) {
+	det := a[0][0]*(a[1][1]*a[2][2]-a[1][2]*a[2][1]) -
+		a[0][1]*(a[1][0]*a[2][2]-a[1][2]*a[2][0]) +
+		a[0][2]*(a[1][0]*a[2][1]-a[1][1]*a[2][0])
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			// the cofactor of the transposed position
+			r0, r1 := (j+1)%3, (j+2)%3
+			c0, c1 := (i+1)%3, (i+2)%3
+			inv[i][j] = (a[r0][c0]*a[r1][c1] - a[r0][c1]*a[r1][c0]) / det
+		}
+	}
+	return inv
+}
+
+func (a mat3d) toMat3() mgl32.Mat3 {
+	// mgl32 matrices are column major
+	return mgl32.Mat3{
+		float32(a[0][0]), float32(a[1][0]), float32(a[2][0]),
+		float32(a[0][1]), float32(a[1][1]), float32(a[2][1]),
+		float32(a[0][2]), float32(a[1][2]), float32(a[2][2]),
+	}
+}
+
+func xyToXYZ(xy [2]float64) [3]float64 {
+	return [3]float64{xy[0] / xy[1], 1, (1 - xy[0] - xy[1]) / xy[1]}
+}
+
+// Returns the matrix which converts linear RGB to CIE XYZ
+func rgbToXYZ(p ColorPrimaries) mat3d {
+	c := primariesChromaticities[p]
+	var m mat3d
+	for col := 0; col < 3; col++ {
+		xyz := xyToXYZ(c[col])
+		for row := 0; row < 3; row++ {
+			m[row][col] = xyz[row]
+		}
+	}
+	// scale the primaries so that rgb (1, 1, 1) is the white point
+	s := m.inverse().mulVec(xyToXYZ(c[3]))
+	for row := 0; row < 3; row++ {
+		for col := 0; col < 3; col++ {
+			m[row][col] *= s[col]
+		}
+	}
+	return m
+}
+
+var bradford = mat3d{
+	{0.8951, 0.2664, -0.1614},
+	{-0.7502, 1.7135, 0.0367},
+	{0.0389, -0.0685, 1.0296},
+}
+
+// Returns the chromatic adaptation of XYZ colors from one white point to another
+func adaptWhite(from, to [2]float64) mat3d {
+	src, dst := bradford.mulVec(xyToXYZ(from)), bradford.mulVec(xyToXYZ(to))
+	var scale mat3d
+	for i := 0; i < 3; i++ {
+		scale[i][i] = dst[i] / src[i]
+	}
+	return bradford.inverse().mul(scale).mul(bradford)
+}
+
+func primariesMatrix(from, to ColorPrimaries) mgl32.Mat3 {
+	if from == to {
+		return mgl32.Ident3()
+	}
+	adapt := adaptWhite(primariesChromaticities[from][3], primariesChromaticities[to][3])
+	return rgbToXYZ(to).inverse().mul(adapt).mul(rgbToXYZ(from)).toMat3()
+}
+
+// Converts the first three channels of pix from one color space to another, other channels are left as they are
+func convertColors(pix []float32, channels int, from, to ColorSpace) error {
+	if from == to {
+		return nil
+	}
+	if from == ColorSpaceUnknown || to == ColorSpaceUnknown {
+		return fmt.Errorf("cannot convert from color space %v to %v", from, to)
+	}
+	if channels < 3 {
+		return fmt.Errorf("color space conversion needs at least 3 channels but the image has %d", channels)
+	}
+
+	m := ColorPrimariesMatrix(from.Primaries(), to.Primaries())
+	identity := from.Primaries() == to.Primaries()
+	for i := 0; i < len(pix); i += channels {
+		c := mgl32.Vec3{pix[i], pix[i+1], pix[i+2]}
+		if from.IsSrgbEncoded() {
+			for ch := range c {
+				c[ch] = SrgbToLinear(c[ch])
+			}
+		}
+		if !identity {
+			c = m.Mul3x1(c)
+		}
+		if to.IsSrgbEncoded() {
+			for ch := range c {
+				// negative values are out of gamut and encoding them is undefined
+				c[ch] = LinearToSrgb(math32.Max(c[ch], 0))
+			}
+		}
+		copy(pix[i:i+3], c[:])
+	}
+	return nil
+}
+
+// Quantizes v from [0, 1] to 8 bit with rounding
+func quantizeUnorm8(v float32) uint8 {
+	if !(v > 0) {
+		return 0
+	}
+	if v >= 1 {
+		return 0xff
+	}
+	return uint8(v*0xff + 0.5)
+}
+
+// Returns the luminance of a linear Rec.709 color
+func Luminance(c mgl32.Vec3) float32 {
+	return 0.2126*c[0] + 0.7152*c[1] + 0.0722*c[2]
+}
+
+// A Tonemapper maps linear hdr colors to linear display colors in [0, 1]
+type Tonemapper int
+
+const (
+	// Clamps the colors to [0, 1]
+	TonemapperNone = Tonemapper(iota)
+	// Reinhard with a white point, which is mapped to 1
+	TonemapperReinhardExtended
+	// Stephen Hill's fit of the ACES reference rendering and output transforms
+	TonemapperAcesFitted
+	// Troy Sobotka's AgX with the default contrast look, as a polynomial approximation
+	TonemapperAgX
+	// Hajime Uchimura's Gran Turismo tonemapper with its default parameters
+	TonemapperUchimura
+)
+
+func (op Tonemapper) String() string {
+	switch op {
+	case TonemapperNone:
+		return "none"
+	case TonemapperReinhardExtended:
+		return "reinhard"
+	case TonemapperAcesFitted:
+		return "aces"
+	case TonemapperAgX:
+		return "agx"
+	case TonemapperUchimura:
+		return "uchimura"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(op))
+	}
+}
+
+func ParseTonemapper(name string) (Tonemapper, error) {
+	for op := TonemapperNone; op <= TonemapperUchimura; op++ {
+		if strings.EqualFold(name, op.String()) {
+			return op, nil
+		}
+	}
+	return TonemapperNone, fmt.Errorf("unknown tonemapper %q", name)
+}
+
+// Maps c with c*(1+c/white²)/(1+c) per channel, white is mapped to 1
+func ReinhardExtended(c mgl32.Vec3, white float32) mgl32.Vec3 {
+	w2 := white * white
+	for ch, v := range c {
+		c[ch] = math32.Min(v*(1+v/w2)/(1+v), 1)
+	}
+	return c
+}
+
+// sRGB to the ACES RRT input space, including the RRT saturation, and back from the ODT output space
+var (
+	acesInput = mgl32.Mat3{
+		0.59719, 0.07600, 0.02840,
+		0.35458, 0.90834, 0.13383,
+		0.04823, 0.01566, 0.83777,
+	}
+	acesOutput = mgl32.Mat3{
+		1.60475, -0.10208, -0.00327,
+		-0.53108, 1.10813, -0.07276,
+		-0.07367, -0.00605, 1.07602,
+	}
+)
+
+// The ACES filmic curve fitted by Stephen Hill, for linear Rec.709 colors
+func AcesFitted(c mgl32.Vec3) mgl32.Vec3 {
+	c = acesInput.Mul3x1(c)
+	for ch, v := range c {
+		a := v*(v+0.0245786) - 0.000090537
+		b := v*(0.983729*v+0.4329510) + 0.238081
+		c[ch] = a / b
+	}
+	c = acesOutput.Mul3x1(c)
+	for ch, v := range c {
+		c[ch] = math32.Min(math32.Max(v, 0), 1)
+	}
+	return c
+}
+
+// The AgX inset and outset matrices for Rec.709 colors
+var (
+	agxInset = mgl32.Mat3{
+		0.842479062253094, 0.0423282422610123, 0.0423756549057051,
+		0.0784335999999992, 0.878468636469772, 0.0784336,
+		0.0792237451477643, 0.0791661274605434, 0.879142973793104,
+	}
+	agxOutset = mgl32.Mat3{
+		1.19687900512017, -0.0528968517574562, -0.0529716355144438,
+		-0.0980208811401368, 1.15190312990417, -0.0980434501171241,
+		-0.0990297440797205, -0.0989611768448433, 1.15107367264116,
+	}
+)
+
+// The exposure range of AgX in stops around middle grey
+const (
+	agxMinEv = -12.47393
+	agxMaxEv = 4.026069
+)
+
+// AgX by Troy Sobotka, for linear Rec.709 colors
+func AgX(c mgl32.Vec3) mgl32.Vec3 {
+	c = agxInset.Mul3x1(c)
+	for ch, v := range c {
+		// log2 encoding over the exposure range
+		v = math32.Log2(math32.Max(v, 1e-10))
+		v = (v - agxMinEv) / (agxMaxEv - agxMinEv)
+		v = math32.Min(math32.Max(v, 0), 1)
+
+		// the sigmoid of the default look
+		x2 := v * v
+		x4 := x2 * x2
+		c[ch] = 15.5*x4*x2 - 40.14*x4*v + 31.96*x4 - 6.868*x2*v + 0.4298*x2 + 0.1191*v - 0.00232
+	}
+	c = agxOutset.Mul3x1(c)
+	for ch, v := range c {
+		// the curve produces display encoded values
+		c[ch] = math32.Pow(math32.Min(math32.Max(v, 0), 1), 2.2)
+	}
+	return c
+}
+
+// The default parameters of the Gran Turismo tonemapper
+const (
+	// maximum brightness
+	uchimuraP = 1.0
+	// contrast
+	uchimuraA = 1.0
+	// start of the linear section
+	uchimuraM = 0.22
+	// length of the linear section
+	uchimuraL = 0.4
+	// black tightness
+	uchimuraC = 1.33
+	// pedestal
+	uchimuraB = 0.0
+)
+
+// The Gran Turismo tonemapper by Hajime Uchimura, a toe, a linear section and a shoulder per channel
+func Uchimura(c mgl32.Vec3) mgl32.Vec3 {
+	const (
+		l0 = (uchimuraP - uchimuraM) * uchimuraL / uchimuraA
+		s0 = uchimuraM + l0
+		s1 = uchimuraM + uchimuraA*l0
+		c2 = uchimuraA * uchimuraP / (uchimuraP - s1)
+		cp = -c2 / uchimuraP
+	)
+	for ch, x := range c {
+		x = math32.Max(x, 0)
+		t := uchimuraM*math32.Pow(x/uchimuraM, uchimuraC) + uchimuraB
+		s := uchimuraP - (uchimuraP-s1)*math32.Exp(cp*(x-s0))
+		l := uchimuraM + uchimuraA*(x-uchimuraM)
+
+		w0 := 1 - smoothstep(0, uchimuraM, x)
+		var w2 float32
+		if x >= s0 {
+			w2 = 1
+		}
+		w1 := 1 - w0 - w2
+		c[ch] = t*w0 + l*w1 + s*w2
+	}
+	return c
+}
+
+func smoothstep(edge0, edge1, x float32) float32 {
+	t := math32.Min(math32.Max((x-edge0)/(edge1-edge0), 0), 1)
+	return t * t * (3 - 2*t)
+}
+
+// Applies the tonemapper to a linear Rec.709 color, white is the white point of TonemapperReinhardExtended
+func (op Tonemapper) Apply(c mgl32.Vec3, white float32) mgl32.Vec3 {
+	switch op {
+	case TonemapperReinhardExtended:
+		return ReinhardExtended(c, white)
+	case TonemapperAcesFitted:
+		return AcesFitted(c)
+	case TonemapperAgX:
+		return AgX(c)
+	case TonemapperUchimura:
+		return Uchimura(c)
+	default:
+		for ch, v := range c {
+			c[ch] = math32.Min(math32.Max(v, 0), 1)
+		}
+		return c
+	}
+}
+
+// The largest luminance of the linear Rec.709 colors in pix, at least a small positive value
+func maxLuminance(pix []float32, channels int) float32 {
+	var result float32 = 1e-6
+	for i := 0; i < len(pix); i += channels {
+		l := Luminance(mgl32.Vec3{pix[i], pix[i+1], pix[i+2]})
+		if l > result && !math.IsInf(float64(l), 1) {
+			result = l
+		}
+	}
+	return result
+}
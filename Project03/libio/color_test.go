@@ -0,0 +1,136 @@
+package libio_test
+
+import (
+	"advanced-gl/Project03/libio"
+	"testing"
+
+	"github.com/chewxy/math32"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func TestSrgbTransfer(t *testing.T) {
+	tests := []struct {
+		linear, encoded float32
+	}{
+		{0, 0},
+		{1, 1},
+		{0.0031308, 0.04045},
+		{0.18, 0.4613561},
+		{0.5, 0.7353570},
+	}
+	for _, test := range tests {
+		if v := libio.LinearToSrgb(test.linear); math32.Abs(v-test.encoded) > 1e-5 {
+			t.Errorf("%g should be encoded as %g but was %g", test.linear, test.encoded, v)
+		}
+		if v := libio.SrgbToLinear(test.encoded); math32.Abs(v-test.linear) > 1e-5 {
+			t.Errorf("%g should be decoded to %g but was %g", test.encoded, test.linear, v)
+		}
+	}
+
+	// every 8 bit value survives the round trip through linear floats
+	img := libio.NewIntImage(make([]uint8, 256*3), 3, 256, 1)
+	img.ColorSpace = libio.ColorSpaceSrgb
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i / 3)
+	}
+	linear := img.ToFloatImage()
+	if linear.ColorSpace != libio.ColorSpaceLinearSrgb || linear.Pix[128*3] > 0.22 {
+		t.Fatalf("the decoded image should be linear but was %v with %g for 128", linear.ColorSpace, linear.Pix[128*3])
+	}
+	encoded := linear.ToIntImage()
+	if encoded.ColorSpace != libio.ColorSpaceSrgb {
+		t.Fatalf("the encoded image should be srgb but was %v", encoded.ColorSpace)
+	}
+	for i := range img.Pix {
+		if encoded.Pix[i] != img.Pix[i] {
+			t.Fatalf("value %d should survive the round trip but became %d", img.Pix[i], encoded.Pix[i])
+		}
+	}
+}
+
+func TestColorPrimariesMatrix(t *testing.T) {
+	// the Rec.709 to ACEScg matrix with Bradford adaptation, as published by the ACES project
+	expected := [3][3]float32{
+		{0.6131, 0.3395, 0.0474},
+		{0.0702, 0.9164, 0.0134},
+		{0.0206, 0.1096, 0.8698},
+	}
+	m := libio.ColorPrimariesMatrix(libio.ColorPrimariesRec709, libio.ColorPrimariesAP1)
+	for row := 0; row < 3; row++ {
+		for col := 0; col < 3; col++ {
+			if v := m.At(row, col); math32.Abs(v-expected[row][col]) > 2e-4 {
+				t.Errorf("element %d,%d should be %g but was %g", row, col, expected[row][col], v)
+			}
+		}
+	}
+
+	primaries := []libio.ColorPrimaries{libio.ColorPrimariesRec709, libio.ColorPrimariesDisplayP3, libio.ColorPrimariesAP1}
+	for _, from := range primaries {
+		for _, to := range primaries {
+			// white stays white and the conversions invert each other
+			white := libio.ColorPrimariesMatrix(from, to).Mul3x1(mgl32.Vec3{1, 1, 1})
+			if !white.ApproxEqualThreshold(mgl32.Vec3{1, 1, 1}, 1e-4) {
+				t.Errorf("white should stay white from %v to %v but became %v", from, to, white)
+			}
+			roundTrip := libio.ColorPrimariesMatrix(to, from).Mul3(libio.ColorPrimariesMatrix(from, to))
+			for i, v := range roundTrip.Sub(mgl32.Ident3()) {
+				if math32.Abs(v) > 1e-5 {
+					t.Errorf("converting from %v to %v and back should be the identity but element %d was off by %g", from, to, i, v)
+				}
+			}
+		}
+	}
+}
+
+func TestConvertColorSpace(t *testing.T) {
+	// pure sRGB red is inside of P3, so it must be less saturated there
+	img := libio.NewFloatImage([]float32{1, 0, 0, 0.5}, 4, 1, 1)
+	img.ColorSpace = libio.ColorSpaceSrgb
+	if err := img.ConvertColorSpace(libio.ColorSpaceDisplayP3); err != nil {
+		t.Fatal(err)
+	}
+	if img.Pix[0] >= 1 || img.Pix[1] <= 0 || img.Pix[3] != 0.5 {
+		t.Errorf("sRGB red should be a less saturated red in P3 with the same alpha but was %v", img.Pix)
+	}
+
+	data := libio.NewFloatImage([]float32{1, 0, 0}, 3, 1, 1)
+	if err := data.ConvertColorSpace(libio.ColorSpaceSrgb); err == nil {
+		t.Errorf("images of an unknown color space should not be converted")
+	}
+}
+
+func TestTonemappers(t *testing.T) {
+	for op := libio.TonemapperNone; op <= libio.TonemapperUchimura; op++ {
+		parsed, err := libio.ParseTonemapper(op.String())
+		if err != nil || parsed != op {
+			t.Errorf("%v should parse to itself but was %v, %v", op, parsed, err)
+		}
+
+		// monotonic and in [0, 1] over a wide range of values
+		var previous float32 = -1
+		for ev := -12; ev <= 12; ev++ {
+			x := math32.Exp2(float32(ev))
+			c := op.Apply(mgl32.Vec3{x, x, x}, 16)
+			if c[0] < 0 || c[0] > 1 || c[0] < previous {
+				t.Errorf("%v should be monotonic in [0, 1] but mapped 2^%d to %g after %g", op, ev, c[0], previous)
+			}
+			previous = c[0]
+		}
+		if c := op.Apply(mgl32.Vec3{0, 0, 0}, 16); c[0] > 0.01 {
+			t.Errorf("%v should map black to black but mapped it to %g", op, c[0])
+		}
+	}
+
+	if c := libio.ReinhardExtended(mgl32.Vec3{4, 4, 4}, 4); math32.Abs(c[0]-1) > 1e-6 {
+		t.Errorf("the reinhard white point should map to 1 but mapped to %g", c[0])
+	}
+}
+
+func TestColorSpaceMetadata(t *testing.T) {
+	img := libio.NewFloatImage([]float32{0.1, 0.2, 0.3}, 3, 1, 1)
+	img.ColorSpace = libio.ColorSpaceAcesCg
+	result := encodeDecodeFloatImage(t, img, libio.FloatImageCompressionNone)
+	if result.ColorSpace != libio.ColorSpaceAcesCg || result.Metadata.ColorSpace != "acescg" {
+		t.Errorf("the color space should be stored in the metadata but was %v and %q", result.ColorSpace, result.Metadata.ColorSpace)
+	}
+}
@@ -0,0 +1,299 @@
+package libio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+// See: https://learn.microsoft.com/en-us/windows/win32/direct3ddds/dds-header
+const ddsMagic = "DDS "
+
+const (
+	ddsPixelFormatFourCC = 0x4
+	ddsCaps2CubeMap      = 0x200
+	ddsCaps2Volume       = 0x200000
+
+	ddsDimensionTexture2D = 3
+	ddsDimensionTexture3D = 4
+	ddsMiscTextureCube    = 0x4
+)
+
+type ddsPixelFormat struct {
+	Size        uint32
+	Flags       uint32
+	FourCC      [4]byte
+	RGBBitCount uint32
+	BitMasks    [4]uint32
+}
+
+type ddsHeader struct {
+	Magic             [4]byte
+	Size              uint32
+	Flags             uint32
+	Height            uint32
+	Width             uint32
+	PitchOrLinearSize uint32
+	Depth             uint32
+	MipMapCount       uint32
+	Reserved1         [11]uint32
+	PixelFormat       ddsPixelFormat
+	Caps              [4]uint32
+	Reserved2         uint32
+}
+
+type ddsHeaderDx10 struct {
+	Format            DxgiFormat
+	ResourceDimension uint32
+	MiscFlag          uint32
+	ArraySize         uint32
+	MiscFlags2        uint32
+}
+
+// The formats of files without a dx10 header
+var ddsFourCCFormats = map[string]DxgiFormat{
+	"DXT1": DxgiFormatBC1Unorm,
+	"DXT5": DxgiFormatBC3Unorm,
+	"ATI1": DxgiFormatBC4Unorm,
+	"BC4U": DxgiFormatBC4Unorm,
+	"ATI2": DxgiFormatBC5Unorm,
+	"BC5U": DxgiFormatBC5Unorm,
+}
+
+// A DdsTexture holds the raw blocks of a block compressed dds file.
+// The levels are laid out like a Ktx2Texture, the faces of a cube map are consecutive layers.
+// As in every dds file the first row of blocks is the top of the image.
+type DdsTexture struct {
+	Format        DxgiFormat
+	Width, Height int
+	// 1 for 2D textures
+	Depth int
+	// the array layers, 1 for textures that are not arrays
+	Layers int
+	// 6 for cube maps, 1 otherwise
+	Faces int
+	// the blocks of each level, starting with the base level
+	Levels [][]byte
+}
+
+// Returns the size of the level in texels
+func (tex *DdsTexture) Size(level int) (width, height, depth int) {
+	return max1(tex.Width >> level), max1(tex.Height >> level), max1(tex.Depth >> level)
+}
+
+// Returns the size of one slice of the level in bytes
+func (tex *DdsTexture) sliceSize(level int) int {
+	w, h, _ := tex.Size(level)
+	return blockDataSize(tex.Format, w, h, 1)
+}
+
+// Reads a block compressed dds file, with or without a dx10 header
+func DecodeDds(r io.Reader) (tex *DdsTexture, err error) {
+	var br *BinaryReader
+	var ok bool
+
+	if br, ok = r.(*BinaryReader); !ok {
+		br = &BinaryReader{
+			Src:   r,
+			Order: binary.LittleEndian,
+		}
+	}
+
+	start := br.Index
+	header := ddsHeader{}
+	if !br.ReadRef(&header) {
+		return nil, br.Errorf("expected dds header")
+	}
+	if string(header.Magic[:]) != ddsMagic || header.Size != 124 || header.PixelFormat.Size != 32 {
+		return nil, br.Errorf("dds header is corrupt")
+	}
+	if header.PixelFormat.Flags&ddsPixelFormatFourCC == 0 {
+		offset := start + int(unsafe.Offsetof(header.PixelFormat)+unsafe.Offsetof(header.PixelFormat.Flags))
+		return nil, NewDecodeError(offset, nil, "uncompressed dds files are unsupported")
+	}
+
+	tex = &DdsTexture{
+		Width:  int(header.Width),
+		Height: int(header.Height),
+		Depth:  1,
+		Layers: 1,
+		Faces:  1,
+	}
+
+	// the offset of the field which determines the format
+	formatOffset := start + int(unsafe.Offsetof(header.PixelFormat)+unsafe.Offsetof(header.PixelFormat.FourCC))
+	fourCC := string(header.PixelFormat.FourCC[:])
+	if fourCC == "DX10" {
+		dx10 := ddsHeaderDx10{}
+		if !br.ReadRef(&dx10) {
+			return nil, br.Errorf("expected dds dx10 header")
+		}
+		formatOffset = br.LastIndex + int(unsafe.Offsetof(dx10.Format))
+		tex.Format = dx10.Format
+		tex.Layers = max1(int(dx10.ArraySize))
+		switch dx10.ResourceDimension {
+		case ddsDimensionTexture2D:
+			if dx10.MiscFlag&ddsMiscTextureCube != 0 {
+				tex.Faces = 6
+			}
+		case ddsDimensionTexture3D:
+			tex.Depth = max1(int(header.Depth))
+		default:
+			return nil, NewDecodeError(br.LastIndex+int(unsafe.Offsetof(dx10.ResourceDimension)), nil, "dds resource dimension %d unsupported", dx10.ResourceDimension)
+		}
+	} else {
+		format, ok := ddsFourCCFormats[fourCC]
+		if !ok {
+			return nil, NewDecodeError(formatOffset, nil, "dds format %q unsupported", fourCC)
+		}
+		tex.Format = format
+		if header.Caps[1]&ddsCaps2CubeMap != 0 {
+			tex.Faces = 6
+		} else if header.Caps[1]&ddsCaps2Volume != 0 {
+			tex.Depth = max1(int(header.Depth))
+		}
+	}
+
+	if !tex.Format.IsBlockCompressed() {
+		return nil, NewDecodeError(formatOffset, nil, "dds format %d unsupported", tex.Format)
+	}
+	if tex.Width < 1 || tex.Height < 1 {
+		return nil, NewDecodeError(start+int(unsafe.Offsetof(header.Height)), nil, "dds size %dx%d is invalid", tex.Width, tex.Height)
+	}
+	if tex.Depth > 1 && tex.Layers > 1 {
+		return nil, NewDecodeError(start+int(unsafe.Offsetof(header.Depth)), nil, "dds 3D textures cannot have layers")
+	}
+
+	levels := max1(int(header.MipMapCount))
+	if levels > MaxMipLevels(tex.Width, tex.Height, tex.Depth) {
+		return nil, NewDecodeError(start+int(unsafe.Offsetof(header.MipMapCount)), nil, "a %dx%dx%d dds texture cannot have %d levels", tex.Width, tex.Height, tex.Depth, levels)
+	}
+
+	// a complete mip chain is less than twice the size of the base level
+	if !br.CheckAlloc(2*tex.Format.BlockBytes(), (tex.Width+3)/4, (tex.Height+3)/4, tex.Depth, tex.Layers, tex.Faces) {
+		return nil, br.Errorf("dds header is invalid")
+	}
+	tex.Levels = make([][]byte, levels)
+	for lvl := range tex.Levels {
+		_, _, d := tex.Size(lvl)
+		tex.Levels[lvl] = make([]byte, tex.sliceSize(lvl)*d*tex.Layers*tex.Faces)
+	}
+
+	// the file stores the complete mip chain of each layer and face one after another
+	for slice := 0; slice < tex.Layers*tex.Faces; slice++ {
+		for lvl, level := range tex.Levels {
+			_, _, d := tex.Size(lvl)
+			size := tex.sliceSize(lvl) * d
+			if !br.ReadFull(level[slice*size : (slice+1)*size]) {
+				return nil, br.Errorf("expected dds level %d of layer %d", lvl, slice)
+			}
+		}
+	}
+
+	return tex, nil
+}
+
+// Flips every level so the first row of blocks is the bottom of the image, like the rest of this package.
+// Cube map faces are not flipped, as they are already in the orientation OpenGL expects.
+// Fails for formats or sizes which cannot be flipped without re-encoding, the texture may be partially flipped then.
+func (tex *DdsTexture) FlipVertically() error {
+	if tex.Faces != 1 {
+		return nil
+	}
+	return flipBlockLevels(tex.Format, tex.Width, tex.Height, tex.Depth, tex.Layers, tex.Levels)
+}
+
+// Decodes all blocks with the reference decoder.
+// Rows are flipped so the origin is in the bottom left, except for cube maps.
+func (tex *DdsTexture) ToIntTexture() (*IntTexture, error) {
+	return decodeBlockTexture(tex.Format, tex.Width, tex.Height, tex.Depth, tex.Layers, tex.Faces, tex.Levels, tex.Faces == 1)
+}
+
+// Writes the texture as a dds file with a dx10 header
+func EncodeDds(w io.Writer, tex *DdsTexture) error {
+	if !tex.Format.IsBlockCompressed() {
+		return fmt.Errorf("dds format %d unsupported", tex.Format)
+	}
+	if tex.Faces != 1 && tex.Faces != 6 {
+		return fmt.Errorf("dds face count must be 1 or 6, not %d", tex.Faces)
+	}
+	if tex.Depth > 1 && (tex.Layers > 1 || tex.Faces > 1) {
+		return fmt.Errorf("dds 3D textures cannot have layers")
+	}
+	for lvl, level := range tex.Levels {
+		_, _, d := tex.Size(lvl)
+		if expected := tex.sliceSize(lvl) * d * tex.Layers * tex.Faces; len(level) != expected {
+			return fmt.Errorf("dds level %d should be %d bytes but is %d", lvl, expected, len(level))
+		}
+	}
+
+	const (
+		ddsFlagCaps        = 0x1
+		ddsFlagHeight      = 0x2
+		ddsFlagWidth       = 0x4
+		ddsFlagPixelFormat = 0x1000
+		ddsFlagMipMapCount = 0x20000
+		ddsFlagLinearSize  = 0x80000
+		ddsFlagDepth       = 0x800000
+		ddsCapsComplex     = 0x8
+		ddsCapsTexture     = 0x1000
+		ddsCapsMipMap      = 0x400000
+		ddsCaps2AllFace    = 0xfc00
+	)
+
+	header := ddsHeader{
+		Size:              124,
+		Flags:             ddsFlagCaps | ddsFlagHeight | ddsFlagWidth | ddsFlagPixelFormat | ddsFlagMipMapCount | ddsFlagLinearSize,
+		Height:            uint32(tex.Height),
+		Width:             uint32(tex.Width),
+		PitchOrLinearSize: uint32(tex.sliceSize(0)),
+		Depth:             uint32(tex.Depth),
+		MipMapCount:       uint32(len(tex.Levels)),
+		PixelFormat: ddsPixelFormat{
+			Size:   32,
+			Flags:  ddsPixelFormatFourCC,
+			FourCC: [4]byte{'D', 'X', '1', '0'},
+		},
+	}
+	copy(header.Magic[:], ddsMagic)
+	header.Caps[0] = ddsCapsTexture
+	if len(tex.Levels) > 1 {
+		header.Caps[0] |= ddsCapsComplex | ddsCapsMipMap
+	}
+
+	dx10 := ddsHeaderDx10{
+		Format:            tex.Format,
+		ResourceDimension: ddsDimensionTexture2D,
+		ArraySize:         uint32(tex.Layers),
+	}
+	if tex.Faces == 6 {
+		header.Caps[0] |= ddsCapsComplex
+		header.Caps[1] = ddsCaps2CubeMap | ddsCaps2AllFace
+		dx10.MiscFlag = ddsMiscTextureCube
+	}
+	if tex.Depth > 1 {
+		header.Flags |= ddsFlagDepth
+		header.Caps[1] = ddsCaps2Volume
+		dx10.ResourceDimension = ddsDimensionTexture3D
+	}
+
+	bw := &BinaryWriter{
+		Dst:   w,
+		Order: binary.LittleEndian,
+	}
+	bw.WriteRef(&header)
+	bw.WriteRef(&dx10)
+	// the complete mip chain of each layer and face one after another
+	for slice := 0; slice < tex.Layers*tex.Faces; slice++ {
+		for lvl, level := range tex.Levels {
+			_, _, d := tex.Size(lvl)
+			size := tex.sliceSize(lvl) * d
+			bw.WriteBytes(level[slice*size : (slice+1)*size])
+		}
+	}
+	if bw.Err != nil {
+		return fmt.Errorf("could not write dds: %w", bw.Err)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package libio_test
+
+import (
+	"advanced-gl/Project03/libio"
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// A bc1 block from red to blue, each row uses one palette index
+var testBC1Block = []byte{0x00, 0xf8, 0x1f, 0x00, 0x00, 0x55, 0xaa, 0xff}
+
+func TestDecodeBC1(t *testing.T) {
+	pix, err := libio.DecodeBlocks(libio.DxgiFormatBC1Unorm, 4, 4, testBC1Block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][4]uint8{{255, 0, 0, 255}, {0, 0, 255, 255}, {170, 0, 85, 255}, {85, 0, 170, 255}}
+	for y, color := range expected {
+		for x := 0; x < 4; x++ {
+			texel := pix[(y*4+x)*4 : (y*4+x)*4+4]
+			if !bytes.Equal(texel, color[:]) {
+				t.Errorf("texel %d,%d should be %v but was %v", x, y, color, texel)
+			}
+		}
+	}
+
+	// swapped endpoints use three colors and transparent black
+	punchThrough := []byte{0x1f, 0x00, 0x00, 0xf8, 0xff, 0xff, 0xff, 0xff}
+	pix, err = libio.DecodeBlocks(libio.DxgiFormatBC1Unorm, 4, 4, punchThrough)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pix[:4], []uint8{0, 0, 0, 0}) {
+		t.Errorf("texel should be transparent black but was %v", pix[:4])
+	}
+}
+
+func TestDecodeBC4BC5(t *testing.T) {
+	// 8 values from 255 to 0, the indices count up along the row
+	block := []byte{255, 0, 0x88, 0xc6, 0xfa, 0x88, 0xc6, 0xfa}
+	pix, err := libio.DecodeBlocks(libio.DxgiFormatBC4Unorm, 4, 4, block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first two rows use the indices 0 to 7
+	expected := []uint8{255, 0, 219, 182, 146, 109, 73, 36}
+	for i, v := range expected {
+		if pix[i] != v {
+			t.Errorf("texel %d should be %d but was %d", i, v, pix[i])
+		}
+	}
+
+	bc5 := append(append([]byte{}, block...), 10, 20, 0, 0, 0, 0, 0, 0)
+	pix, err = libio.DecodeBlocks(libio.DxgiFormatBC5Unorm, 4, 4, bc5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pix) != 32 || pix[0] != 255 || pix[1] != 10 || pix[2] != 0 || pix[3] != 10 {
+		t.Errorf("bc5 texels should interleave both channels but were %v", pix[:4])
+	}
+}
+
+// Writes bits into a block starting at the least significant bit
+type bitWriter struct {
+	block [16]byte
+	pos   int
+}
+
+func (bw *bitWriter) write(v, n int) {
+	for i := 0; i < n; i++ {
+		bw.block[bw.pos>>3] |= byte((v>>i)&1) << (bw.pos & 7)
+		bw.pos++
+	}
+}
+
+func TestDecodeBC7Mode6(t *testing.T) {
+	bw := &bitWriter{}
+	bw.write(1<<6, 7)
+	// r, g, b, a endpoints
+	for _, e := range [][2]int{{127, 0}, {0, 127}, {64, 64}, {127, 127}} {
+		bw.write(e[0], 7)
+		bw.write(e[1], 7)
+	}
+	// p bits
+	bw.write(1, 1)
+	bw.write(0, 1)
+	// the anchor has 3 bits, then index i for texel i
+	for i := 0; i < 16; i++ {
+		if i == 0 {
+			bw.write(0, 3)
+		} else {
+			bw.write(i, 4)
+		}
+	}
+	if bw.pos != 128 {
+		t.Fatalf("block should have 128 bits but has %d", bw.pos)
+	}
+
+	pix, err := libio.DecodeBlocks(libio.DxgiFormatBC7Unorm, 4, 4, bw.block[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 127<<1|1 = 255, 0<<1|0 = 0, 64<<1|1 = 129 and 64<<1|0 = 128
+	if !bytes.Equal(pix[0:4], []uint8{255, 1, 129, 255}) {
+		t.Errorf("first texel should be the first endpoint but was %v", pix[0:4])
+	}
+	if !bytes.Equal(pix[60:64], []uint8{0, 254, 128, 254}) {
+		t.Errorf("last texel should be the second endpoint but was %v", pix[60:64])
+	}
+	// weight 34 of 64
+	if pix[8*4] != 120 || pix[8*4+1] != 135 {
+		t.Errorf("texel 8 should be interpolated but was %v", pix[8*4:8*4+4])
+	}
+}
+
+func TestDecodeBC7Mode1(t *testing.T) {
+	bw := &bitWriter{}
+	bw.write(1<<1, 2)
+	// partition 13, the top two rows are subset 0
+	bw.write(13, 6)
+	// subset 0 is red, subset 1 is green
+	for _, e := range [][4]int{{63, 63, 0, 0}, {0, 0, 63, 63}, {0, 0, 0, 0}} {
+		for _, v := range e {
+			bw.write(v, 6)
+		}
+	}
+	// shared p bits
+	bw.write(1, 1)
+	bw.write(1, 1)
+	// all indices 0, the anchors have 2 bits
+	bw.write(0, 2)
+	for i := 1; i < 16; i++ {
+		if i == 15 {
+			bw.write(0, 2)
+		} else {
+			bw.write(0, 3)
+		}
+	}
+	if bw.pos != 128 {
+		t.Fatalf("block should have 128 bits but has %d", bw.pos)
+	}
+
+	pix, err := libio.DecodeBlocks(libio.DxgiFormatBC7Unorm, 4, 4, bw.block[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 16; i++ {
+		// 0 with a p bit of 1 expands to 2
+		expected := []uint8{255, 2, 2, 255}
+		if i >= 8 {
+			expected = []uint8{2, 255, 2, 255}
+		}
+		if !bytes.Equal(pix[i*4:i*4+4], expected) {
+			t.Errorf("texel %d should be %v but was %v", i, expected, pix[i*4:i*4+4])
+		}
+	}
+}
+
+// Writes a dds file with a dx10 header
+func writeDds(format libio.DxgiFormat, width, height, levels, arraySize int, cube bool, data []byte) []byte {
+	buf := new(bytes.Buffer)
+	le := binary.LittleEndian
+	buf.WriteString("DDS ")
+	header := make([]uint32, 31)
+	header[0] = 124
+	header[1] = 0x1007 | 0x20000
+	header[2] = uint32(height)
+	header[3] = uint32(width)
+	header[6] = uint32(levels)
+	// pixel format
+	header[18] = 32
+	header[19] = 0x4
+	header[20] = le.Uint32([]byte("DX10"))
+	binary.Write(buf, le, header)
+
+	misc := uint32(0)
+	if cube {
+		misc = 0x4
+	}
+	binary.Write(buf, le, []uint32{uint32(format), 3, misc, uint32(arraySize), 0})
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func TestDecodeDds(t *testing.T) {
+	// two layers of an 8x4 texture with 3 levels, the file stores each layer's mip chain in turn
+	data := []byte{}
+	for layer := 0; layer < 2; layer++ {
+		for _, blocks := range []int{2, 1, 1} {
+			for i := 0; i < blocks; i++ {
+				block := append([]byte{}, testBC1Block...)
+				block[7] = byte(layer)
+				data = append(data, block...)
+			}
+		}
+	}
+
+	tex, err := libio.DecodeDds(bytes.NewReader(writeDds(libio.DxgiFormatBC1UnormSrgb, 8, 4, 3, 2, false, data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tex.Format != libio.DxgiFormatBC1UnormSrgb || tex.Width != 8 || tex.Height != 4 || tex.Layers != 2 || tex.Faces != 1 || len(tex.Levels) != 3 {
+		t.Fatalf("decoded dds has the wrong shape: %+v", tex)
+	}
+	if len(tex.Levels[0]) != 32 || len(tex.Levels[1]) != 16 || len(tex.Levels[2]) != 16 {
+		t.Fatalf("dds levels have the wrong size")
+	}
+	// the second layer of each level follows the first
+	if tex.Levels[1][7] != 0 || tex.Levels[1][15] != 1 {
+		t.Errorf("dds levels are not grouped by level")
+	}
+
+	result, err := tex.ToIntTexture()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Channels != 4 || result.Layers != 2 || result.Levels != 3 {
+		t.Fatalf("decoded texture has the wrong shape: %+v", result)
+	}
+	// the top row is red, it ends up at the top with a bottom left origin
+	top := result.Level(0)[result.Index(0, 0, 3, 0, 0):]
+	if top[0] != 255 || top[2] != 0 {
+		t.Errorf("the top row should be red but was %v", top[:4])
+	}
+
+	if _, err := libio.DecodeDds(bytes.NewReader(writeDds(libio.DxgiFormatBC1Unorm, 8, 4, 3, 2, false, data[:40]))); err == nil {
+		t.Errorf("decoding a truncated dds should fail")
+	}
+	if _, err := libio.DecodeDds(bytes.NewReader(writeDds(libio.DxgiFormatBC1Unorm, 8, 4, 5, 1, false, data))); err == nil {
+		t.Errorf("decoding a dds with too many levels should fail")
+	}
+}
+
+func TestDdsFlipVertically(t *testing.T) {
+	for _, format := range []libio.DxgiFormat{libio.DxgiFormatBC1Unorm, libio.DxgiFormatBC3Unorm, libio.DxgiFormatBC4Unorm, libio.DxgiFormatBC5Unorm} {
+		// an 8x8 texture of noise, the levels are 8x8, 4x4, 2x2 and 1x1
+		tex := &libio.DdsTexture{Format: format, Width: 8, Height: 8, Depth: 1, Layers: 1, Faces: 1}
+		seed := byte(1)
+		for _, size := range []int{4, 1, 1, 1} {
+			level := make([]byte, size*format.BlockBytes())
+			for i := range level {
+				seed = seed*97 + 13
+				level[i] = seed
+			}
+			tex.Levels = append(tex.Levels, level)
+		}
+
+		expected, err := tex.ToIntTexture()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tex.FlipVertically(); err != nil {
+			t.Fatal(err)
+		}
+		flipped, err := tex.ToIntTexture()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// decoding flips the rows, so the flipped blocks decode to the rows of the original blocks in reverse
+		for lvl := 0; lvl < 4; lvl++ {
+			w, h, _ := expected.Size(lvl)
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					a := expected.Level(lvl)[expected.Index(lvl, x, y, 0, 0):][:format.Channels()]
+					b := flipped.Level(lvl)[flipped.Index(lvl, x, h-1-y, 0, 0):][:format.Channels()]
+					if !bytes.Equal(a, b) {
+						t.Fatalf("%v level %d texel %d,%d should be %v but was %v", format, lvl, x, y, a, b)
+					}
+				}
+			}
+		}
+	}
+
+	tex := &libio.DdsTexture{Format: libio.DxgiFormatBC7Unorm, Width: 4, Height: 4, Depth: 1, Layers: 1, Faces: 1, Levels: [][]byte{make([]byte, 16)}}
+	if err := tex.FlipVertically(); err == nil {
+		t.Errorf("flipping bc7 blocks should fail")
+	}
+}
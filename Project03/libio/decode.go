@@ -3,14 +3,29 @@ package libio
 import (
 	"bytes"
 	"encoding/binary"
-	"fmt"
 	"io"
 
 	"github.com/chewxy/math32"
 	"github.com/pierrec/lz4/v4"
 )
 
+// Decodes a single 2D image, use DecodeFloatTexture for textures with levels, layers or depth
 func DecodeFloatImage(r io.Reader) (img *FloatImage, err error) {
+	start := 0
+	if br, ok := r.(*BinaryReader); ok {
+		start = br.Index
+	}
+	tex, err := DecodeFloatTexture(r)
+	if err != nil {
+		return nil, err
+	}
+	if tex.Depth != 1 || tex.Layers != 1 || tex.Levels != 1 {
+		return nil, NewDecodeError(start, nil, "f32 contains a %dx%dx%d texture with %d layers and %d levels, not an image", tex.Width, tex.Height, tex.Depth, tex.Layers, tex.Levels)
+	}
+	return tex.Image(0, 0, 0), nil
+}
+
+func DecodeFloatTexture(r io.Reader) (tex *FloatTexture, err error) {
 	var br *BinaryReader
 	var ok bool
 
@@ -21,55 +36,135 @@ func DecodeFloatImage(r io.Reader) (img *FloatImage, err error) {
 		}
 
 		defer func() {
-			if br.Err != nil {
-				if err == nil {
-					err = br.Err
-				} else {
-					err = fmt.Errorf("%v: %w", err, br.Err)
-				}
+			// errors of the reader are part of the DecodeErrors, unless the decoder did not check them
+			if err == nil && br.Err != nil {
+				err = br.Err
 			}
 		}()
 	}
 
 	header := FloatImageHeader{}
 	if !br.ReadRef(&header) {
-		return nil, fmt.Errorf("expected f32 header; byte 0x%08x", br.LastIndex)
+		return nil, br.Errorf("expected f32 header")
 	}
 
 	if header.Check != MagicNumberF32 {
-		return nil, fmt.Errorf("f32 header is corrupt; byte 0x%08x", br.LastIndex)
+		return nil, br.Errorf("f32 header is corrupt")
 	}
 
-	if header.Version != F32Version1_002_001 {
-		return nil, fmt.Errorf("f32 version %d unsupported; byte 0x%08x", header.Version, br.LastIndex)
+	switch header.Version {
+	case F32Version1_001_000, F32Version1_002_000, F32Version1_002_001:
+		// older versions share the header layout, the flags were unused
+		header.Flags = 0
+		fallthrough
+	case F32Version1_003_000:
+		// a single 2D image
+		header.Depth, header.Layers, header.Levels = 1, 1, 1
+	case F32Version1_004_000:
+	default:
+		return nil, br.Errorf("f32 version %d unsupported", header.Version)
 	}
 
+	var meta FloatImageMetadata
+	if header.Flags&FloatImageFlagMetadata != 0 {
+		var size int
+		if !br.ReadUInt32(&size) || !br.ReadBytes(size) {
+			return nil, br.Errorf("expected f32 metadata")
+		}
+		meta, err = decodeFloatImageMetadata(br.Bytes(), br.LastIndex)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the base level must be within the limit before the size of the levels can be calculated without overflows
+	if !br.CheckAlloc(4*int(header.Channels), int(header.Width), int(header.Height), int(header.Depth), int(header.Layers)) {
+		return nil, br.Errorf("f32 header is invalid")
+	}
+	tex = &FloatTexture{
+		texture: newTexture(int(header.Channels), int(header.Width), int(header.Height), int(header.Depth), int(header.Layers), int(header.Levels)),
+	}
+	tex.CubeMap = header.Flags&FloatImageFlagCubeMap != 0
+	tex.Metadata = meta
+	if err := tex.validate(); err != nil {
+		return nil, NewDecodeError(br.LastIndex, err, "f32 header is invalid")
+	}
+
+	channels, count := tex.Channels, tex.Count()
+	if !br.CheckAlloc(4*channels, count) {
+		return nil, br.Errorf("f32 header is invalid")
+	}
 	var data []float32
 
 	switch header.Compression {
 	case FloatImageCompressionNone:
-		data = make([]float32, header.Width*header.Height*uint32(header.Channels))
-		br.ReadRef(data)
-		err = br.Err
+		// references the file when it is mapped
+		if data, ok = ReadSlice[float32](br, count*channels); !ok {
+			return nil, br.Errorf("expected %d f32 pixels", count)
+		}
 	case FloatImageCompressionFixedPoint16Lz4:
-		rangeBytes := 4 * 2 * int(header.Channels)
-		dataBytes := int(header.Width*header.Height) * int(header.Channels) * 2
+		rangeBytes := 4 * 2 * channels
+		dataBytes := count * channels * 2
 		buf := make([]byte, rangeBytes+dataBytes)
-		lzr := lz4.NewReader(br.Src)
+		lzr := lz4.NewReader(br)
 		_, err = io.ReadFull(lzr, buf)
 		if err != nil {
 			break
 		}
-		data, err = decompressFixedPoint16(int(header.Channels), int(header.Width*header.Height), buf)
+		data, err = decompressFixedPoint16(channels, count, buf)
+	case FloatImageCompressionHalfLz4:
+		buf := make([]byte, count*channels*2)
+		_, err = io.ReadFull(lz4.NewReader(br), buf)
+		if err != nil {
+			break
+		}
+		data = decompressHalf(buf)
+	case FloatImageCompressionShuffleLz4:
+		buf := make([]byte, count*channels*4)
+		_, err = io.ReadFull(lz4.NewReader(br), buf)
+		if err != nil {
+			break
+		}
+		data = unshuffleBytes(buf)
 	default:
-		err = fmt.Errorf("unknown compression enum value: %d", header.Compression)
+		return nil, br.Errorf("f32 compression %d unsupported", header.Compression)
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("could not decompress f32 pixels: %w", err)
+		return nil, NewDecodeError(br.Index, err, "could not decompress f32 pixels")
 	}
 
-	return NewFloatImage(data, int(header.Channels), int(header.Width), int(header.Height)), nil
+	tex.Pix = data
+	return tex, nil
+}
+
+// The offset of the block is used for the DecodeErrors
+func decodeFloatImageMetadata(block []byte, offset int) (meta FloatImageMetadata, err error) {
+	fields := []*string{&meta.ColorSpace, &meta.Semantic, &meta.Layout}
+	for i, f := range fields {
+		if len(block) == 0 {
+			// written by an older version with fewer fields
+			return meta, nil
+		}
+		if len(block) < 2 {
+			return meta, NewDecodeError(offset, io.ErrUnexpectedEOF, "f32 metadata field %d length is truncated", i)
+		}
+		n := int(binary.LittleEndian.Uint16(block))
+		if len(block) < 2+n {
+			return meta, NewDecodeError(offset, io.ErrUnexpectedEOF, "f32 metadata field %d is truncated", i)
+		}
+		*f = string(block[2 : 2+n])
+		block = block[2+n:]
+		offset += 2 + n
+	}
+	if len(block) == 0 {
+		return meta, nil
+	}
+	if len(block) < 4 {
+		return meta, NewDecodeError(offset, io.ErrUnexpectedEOF, "f32 metadata roughness is truncated")
+	}
+	meta.Roughness = math32.Float32frombits(binary.LittleEndian.Uint32(block))
+	return meta, nil
 }
 
 func decompressFixedPoint16(channels, count int, data []byte) ([]float32, error) {
@@ -105,3 +200,21 @@ func decompressChannelFixedPoint16(channels, count int, pix []float32, br *Binar
 		pix[i*channels+ch] = flt
 	}
 }
+
+func decompressHalf(data []byte) []float32 {
+	result := make([]float32, len(data)/2)
+	for i := range result {
+		result[i] = Float16FromBits(binary.LittleEndian.Uint16(data[i*2:]))
+	}
+	return result
+}
+
+func unshuffleBytes(data []byte) []float32 {
+	count := len(data) / 4
+	result := make([]float32, count)
+	for i := range result {
+		bits := uint32(data[i]) | uint32(data[count+i])<<8 | uint32(data[2*count+i])<<16 | uint32(data[3*count+i])<<24
+		result[i] = math32.Float32frombits(bits)
+	}
+	return result
+}
@@ -0,0 +1,190 @@
+package libio_test
+
+import (
+	"advanced-gl/Project03/libio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/chewxy/math32"
+)
+
+func TestFloatImageConstantChannel(t *testing.T) {
+	img := randomHdrImage(3, 8, 8)
+	for i := 0; i < img.Count(); i++ {
+		img.Pix[i*3+1] = 0.5
+	}
+
+	result := encodeDecodeFloatImage(t, img, libio.FloatImageCompressionFixedPoint16Lz4)
+
+	for i := 0; i < img.Count(); i++ {
+		if result.Pix[i*3+1] != 0.5 {
+			t.Fatalf("constant channel of pixel %d should be 0.5 but was %g", i, result.Pix[i*3+1])
+		}
+	}
+}
+
+func TestFloatImageMetadata(t *testing.T) {
+	img := randomHdrImage(2, 4, 4)
+	img.Metadata = libio.FloatImageMetadata{
+		ColorSpace: "linear",
+		Semantic:   "specular",
+		Layout:     "latlong",
+		Roughness:  0.25,
+	}
+
+	for _, compression := range []libio.FloatImageCompression{libio.FloatImageCompressionNone, libio.FloatImageCompressionShuffleLz4} {
+		result := encodeDecodeFloatImage(t, img, compression)
+		if result.Metadata != img.Metadata {
+			t.Errorf("metadata should be %+v but was %+v", img.Metadata, result.Metadata)
+		}
+		for i := range img.Pix {
+			if result.Pix[i] != img.Pix[i] {
+				t.Fatalf("decoded float %d should be %g but was %g", i, img.Pix[i], result.Pix[i])
+			}
+		}
+	}
+
+	result := encodeDecodeFloatImage(t, randomHdrImage(1, 2, 2), libio.FloatImageCompressionNone)
+	if !result.Metadata.IsZero() {
+		t.Errorf("metadata should be empty but was %+v", result.Metadata)
+	}
+}
+
+func TestDecodeFloatImageVersions(t *testing.T) {
+	pix := []float32{0, 0.25, 1, 1e6, -3, 8}
+
+	for _, version := range []libio.FloatImageVersion{libio.F32Version1_001_000, libio.F32Version1_002_000, libio.F32Version1_002_001} {
+		buf := new(bytes.Buffer)
+		binary.Write(buf, binary.LittleEndian, libio.FloatImageHeader{
+			Check:       libio.MagicNumberF32,
+			Version:     version,
+			Width:       3,
+			Height:      1,
+			Channels:    2,
+			Compression: libio.FloatImageCompressionNone,
+			// garbage in the formerly unused bytes must not be read as flags
+			Flags: 0xff,
+		})
+		binary.Write(buf, binary.LittleEndian, pix)
+
+		img, err := libio.DecodeFloatImage(buf)
+		if err != nil {
+			t.Errorf("version %d should be supported but got: %v", version, err)
+			continue
+		}
+		if img.Width != 3 || img.Height != 1 || img.Channels != 2 {
+			t.Errorf("version %d decoded size should be 3x1x2 but was %dx%dx%d", version, img.Width, img.Height, img.Channels)
+			continue
+		}
+		for i := range pix {
+			if math32.Float32bits(img.Pix[i]) != math32.Float32bits(pix[i]) {
+				t.Errorf("version %d float %d should be %g but was %g", version, i, pix[i], img.Pix[i])
+			}
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, libio.FloatImageHeader{
+		Check:   libio.MagicNumberF32,
+		Version: 9_000_000,
+	})
+	if _, err := libio.DecodeFloatImage(buf); err == nil {
+		t.Errorf("unknown versions should be rejected")
+	}
+}
+
+func TestEncodeFloatImageVersion(t *testing.T) {
+	plain := libio.NewFloatTexture(3, 4, 4, 1, 1, 1)
+	meta := libio.NewFloatTexture(3, 4, 4, 1, 1, 1)
+	meta.Metadata.Semantic = "brdf_lut"
+	levels := libio.NewFloatTexture(3, 4, 4, 1, 1, 3)
+
+	for _, test := range []struct {
+		tex         *libio.FloatTexture
+		compression libio.FloatImageCompression
+		version     libio.FloatImageVersion
+	}{
+		{plain, libio.FloatImageCompressionNone, libio.F32Version1_002_001},
+		{plain, libio.FloatImageCompressionFixedPoint16Lz4, libio.F32Version1_002_001},
+		{plain, libio.FloatImageCompressionHalfLz4, libio.F32Version1_003_000},
+		{meta, libio.FloatImageCompressionNone, libio.F32Version1_003_000},
+		{levels, libio.FloatImageCompressionNone, libio.F32Version1_004_000},
+	} {
+		buf := new(bytes.Buffer)
+		if err := libio.EncodeFloatTexture(buf, test.tex, test.compression); err != nil {
+			t.Fatal(err)
+		}
+		header := libio.FloatImageHeader{}
+		binary.Read(bytes.NewReader(buf.Bytes()), binary.LittleEndian, &header)
+		if header.Version != test.version {
+			t.Errorf("compression %d with %d levels and metadata %+v should write version %d but wrote %d",
+				test.compression, test.tex.Levels, test.tex.Metadata, test.version, header.Version)
+		}
+		if _, err := libio.DecodeFloatTexture(buf); err != nil {
+			t.Errorf("version %d should decode but got: %v", header.Version, err)
+		}
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, libio.FloatImageHeader{
+		Check:       libio.MagicNumberF32,
+		Version:     libio.F32Version1_002_001,
+		Width:       1 << 20,
+		Height:      1 << 20,
+		Channels:    4,
+		Compression: libio.FloatImageCompressionNone,
+	})
+	_, err := libio.DecodeFloatImage(buf)
+	if !errors.Is(err, libio.ErrAllocLimit) {
+		t.Errorf("a huge image should exceed the allocation limit but got: %v", err)
+	}
+
+	buf.Reset()
+	binary.Write(buf, binary.LittleEndian, libio.FloatImageHeader{
+		Check:       libio.MagicNumberF32,
+		Version:     libio.F32Version1_002_001,
+		Width:       4,
+		Height:      4,
+		Channels:    1,
+		Compression: libio.FloatImageCompressionNone,
+	})
+	headerSize := buf.Len()
+	binary.Write(buf, binary.LittleEndian, make([]float32, 7))
+	_, err = libio.DecodeFloatImage(buf)
+	var decodeErr *libio.DecodeError
+	if !errors.As(err, &decodeErr) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("truncated pixels should be a DecodeError caused by io.ErrUnexpectedEOF but got: %v", err)
+	}
+	if decodeErr.Offset != headerSize {
+		t.Errorf("the error should be at the start of the pixels at %d but was at %d", headerSize, decodeErr.Offset)
+	}
+}
+
+func FuzzDecodeFloatImage(f *testing.F) {
+	for _, compression := range []libio.FloatImageCompression{libio.FloatImageCompressionNone, libio.FloatImageCompressionShuffleLz4, libio.FloatImageCompressionFixedPoint16Lz4} {
+		buf := new(bytes.Buffer)
+		if err := libio.EncodeFloatImage(buf, randomHdrImage(3, 4, 3), compression); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf.Bytes())
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		img, err := libio.DecodeFloatImage(&libio.BinaryReader{Src: bytes.NewReader(data), Order: binary.LittleEndian, MaxAlloc: 1 << 20})
+		if err != nil {
+			var decodeErr *libio.DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Errorf("errors should be DecodeErrors but got: %v", err)
+			}
+			return
+		}
+		if len(img.Pix) != img.Width*img.Height*img.Channels {
+			t.Errorf("a %dx%dx%d image should have %d floats but had %d", img.Width, img.Height, img.Channels, img.Width*img.Height*img.Channels, len(img.Pix))
+		}
+	})
+}
@@ -11,6 +11,10 @@ import (
 )
 
 func EncodeFloatImage(w io.Writer, img *FloatImage, compression FloatImageCompression) (err error) {
+	return EncodeFloatTexture(w, FloatTextureFromImage(img), compression)
+}
+
+func EncodeFloatTexture(w io.Writer, tex *FloatTexture, compression FloatImageCompression) (err error) {
 	var bw *BinaryWriter
 	var ok bool
 
@@ -31,41 +35,65 @@ func EncodeFloatImage(w io.Writer, img *FloatImage, compression FloatImageCompre
 		}()
 	}
 
+	if err := tex.validate(); err != nil {
+		return err
+	}
+
 	header := FloatImageHeader{
 		Check:       MagicNumberF32,
 		Version:     F32Version1_002_001,
-		Width:       uint32(img.Width),
-		Height:      uint32(img.Height),
-		Channels:    uint8(img.Channels),
+		Width:       uint32(tex.Width),
+		Height:      uint32(tex.Height),
+		Channels:    uint8(tex.Channels),
 		Compression: compression,
 	}
+	// files stay readable by older decoders unless they need the fields of a later version
+	if !tex.Metadata.IsZero() {
+		header.Version = F32Version1_003_000
+		header.Flags |= FloatImageFlagMetadata
+	}
+	if compression != FloatImageCompressionNone && compression != FloatImageCompressionFixedPoint16Lz4 {
+		header.Version = F32Version1_003_000
+	}
+	if tex.Depth != 1 || tex.Layers != 1 || tex.Levels != 1 || tex.CubeMap {
+		header.Version = F32Version1_004_000
+		header.Depth, header.Layers, header.Levels = uint32(tex.Depth), uint32(tex.Layers), uint8(tex.Levels)
+	}
+	if tex.CubeMap {
+		header.Flags |= FloatImageFlagCubeMap
+	}
 
 	if !bw.WriteRef(header) {
 		return fmt.Errorf("could not write f32 header: %w", bw.Err)
 	}
 
+	if header.Flags&FloatImageFlagMetadata != 0 {
+		if !bw.WriteBytes(encodeFloatImageMetadata(tex.Metadata)) {
+			return fmt.Errorf("could not write f32 metadata: %w", bw.Err)
+		}
+	}
+
 	var data []byte
 
+	// all levels are compressed together
 	switch compression {
 	case FloatImageCompressionNone:
-		buf := bytes.NewBuffer(make([]byte, img.Bytes()))
+		buf := bytes.NewBuffer(make([]byte, len(tex.Pix)*4))
 		buf.Reset()
-		err = binary.Write(buf, bw.Order, img.Pix)
+		err = binary.Write(buf, bw.Order, tex.Pix)
 		data = buf.Bytes()
 	case FloatImageCompressionFixedPoint16Lz4:
-		data, err = compressFixedPoint16(img.Channels, img.Count(), img.Pix)
-		if err != nil {
-			break
-		}
-		buf := bytes.NewBuffer(nil)
-		lzw := lz4.NewWriter(buf)
-		lzw.Apply(lz4.CompressionLevelOption(lz4.Fast))
-		_, err = lzw.Write(data)
+		data, err = compressFixedPoint16(tex.Channels, tex.Count(), tex.Pix)
 		if err != nil {
 			break
 		}
-		err = lzw.Flush()
-		data = buf.Bytes()
+		data, err = compressLz4(data, lz4.Fast)
+	case FloatImageCompressionHalfLz4:
+		data, err = compressLz4(compressHalf(tex.Pix), lz4.Fast)
+	case FloatImageCompressionShuffleLz4:
+		data, err = compressLz4(shuffleBytes(tex.Pix), lz4.Level5)
+	default:
+		err = fmt.Errorf("unknown compression enum value: %d", compression)
 	}
 
 	if err != nil {
@@ -110,9 +138,71 @@ func compressChannelFixedPoint16(channels int, count int, pix []float32, bw *Bin
 	bw.WriteUInt32(math32.Float32bits(max))
 
 	r := max - min
+	if r == 0 {
+		// constant channel, every value decodes to min.
+		// Before version 1.3 this wrote the undefined uint16(NaN).
+		r = 1
+	}
 	for i := 0; i < count; i++ {
 		flt := pix[i*channels+ch]
-		fix := uint16(((flt - min) / r) * 0xffff)
+		norm := (flt - min) / r
+		if !(norm > 0) {
+			// also catches NaN
+			norm = 0
+		} else if norm > 1 {
+			norm = 1
+		}
+		fix := uint16(norm * 0xffff)
 		bw.WriteUInt16(fix)
 	}
 }
+
+func compressLz4(data []byte, level lz4.CompressionLevel) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	lzw := lz4.NewWriter(buf)
+	lzw.Apply(lz4.CompressionLevelOption(level))
+	_, err := lzw.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = lzw.Flush()
+	return buf.Bytes(), err
+}
+
+func compressHalf(pix []float32) []byte {
+	data := make([]byte, len(pix)*2)
+	for i, v := range pix {
+		binary.LittleEndian.PutUint16(data[i*2:], Float16Bits(v))
+	}
+	return data
+}
+
+// Stores byte n of every float in plane n.
+// The sign and exponent bytes of neighboring pixels are very similar and end up next to each other.
+func shuffleBytes(pix []float32) []byte {
+	count := len(pix)
+	data := make([]byte, count*4)
+	for i, v := range pix {
+		bits := math32.Float32bits(v)
+		data[i] = byte(bits)
+		data[count+i] = byte(bits >> 8)
+		data[2*count+i] = byte(bits >> 16)
+		data[3*count+i] = byte(bits >> 24)
+	}
+	return data
+}
+
+// The block starts with its size, so readers can skip fields they don't know.
+// The string fields are length prefixed utf-8, the roughness follows them as a float32.
+func encodeFloatImageMetadata(meta FloatImageMetadata) []byte {
+	fields := []string{meta.ColorSpace, meta.Semantic, meta.Layout}
+	buf := bytes.NewBuffer(nil)
+	bw := &BinaryWriter{Order: binary.LittleEndian, Dst: buf}
+	for _, f := range fields {
+		bw.WriteUInt16(uint16(len(f)))
+		bw.WriteBytes([]byte(f))
+	}
+	bw.WriteRef(meta.Roughness)
+	block := binary.LittleEndian.AppendUint32(nil, uint32(buf.Len()))
+	return append(block, buf.Bytes()...)
+}
@@ -0,0 +1,126 @@
+package libio_test
+
+import (
+	"advanced-gl/Project03/libio"
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/chewxy/math32"
+)
+
+// Random hdr like data with values over many orders of magnitude
+func randomHdrImage(channels, width, height int) *libio.FloatImage {
+	rng := rand.New(rand.NewSource(0))
+	pix := make([]float32, channels*width*height)
+	for i := range pix {
+		pix[i] = math32.Exp2(rng.Float32()*30 - 15)
+	}
+	pix[0] = 0
+	pix[1] = 65504
+	pix[2] = math32.Float32frombits(1)
+	return libio.NewFloatImage(pix, channels, width, height)
+}
+
+func encodeDecodeFloatImage(t *testing.T, img *libio.FloatImage, compression libio.FloatImageCompression) *libio.FloatImage {
+	buf := new(bytes.Buffer)
+	err := libio.EncodeFloatImage(buf, img, compression)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := libio.DecodeFloatImage(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Width != img.Width || result.Height != img.Height || result.Channels != img.Channels {
+		t.Fatalf("decoded size should be %dx%dx%d but was %dx%dx%d", img.Width, img.Height, img.Channels, result.Width, result.Height, result.Channels)
+	}
+	return result
+}
+
+func TestFloatImageShuffleLz4(t *testing.T) {
+	img := randomHdrImage(3, 67, 31)
+	img.Pix[3] = math32.NaN()
+	img.Pix[4] = math32.Inf(-1)
+	img.Pix[5] = math32.Copysign(0, -1)
+
+	result := encodeDecodeFloatImage(t, img, libio.FloatImageCompressionShuffleLz4)
+
+	for i := range img.Pix {
+		if math32.Float32bits(result.Pix[i]) != math32.Float32bits(img.Pix[i]) {
+			t.Fatalf("decoded float %d should be exactly %g but was %g", i, img.Pix[i], result.Pix[i])
+		}
+	}
+}
+
+func TestFloatImageNone(t *testing.T) {
+	img := randomHdrImage(4, 16, 16)
+	result := encodeDecodeFloatImage(t, img, libio.FloatImageCompressionNone)
+
+	for i := range img.Pix {
+		if result.Pix[i] != img.Pix[i] {
+			t.Fatalf("decoded float %d should be exactly %g but was %g", i, img.Pix[i], result.Pix[i])
+		}
+	}
+}
+
+func TestFloatImageHalfLz4(t *testing.T) {
+	img := randomHdrImage(3, 64, 32)
+	result := encodeDecodeFloatImage(t, img, libio.FloatImageCompressionHalfLz4)
+
+	for i, v := range img.Pix {
+		if v < 6.1e-5 {
+			// subnormal halfs have an absolute precision of 2^-24
+			if math32.Abs(result.Pix[i]-v) > 0x1p-25 {
+				t.Fatalf("decoded float %d should be %g but was %g", i, v, result.Pix[i])
+			}
+			continue
+		}
+		// 10 bit mantissa, so the relative error is at most 2^-11
+		if math32.Abs(result.Pix[i]-v)/v > 0x1p-11 {
+			t.Fatalf("decoded float %d should be %g but was %g", i, v, result.Pix[i])
+		}
+	}
+}
+
+func TestFloat16Bits(t *testing.T) {
+	tests := []struct {
+		value float32
+		bits  uint16
+	}{
+		{0, 0x0000},
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{65504, 0x7bff},
+		{65520, 0x7c00},
+		{0x1p-24, 0x0001},
+		{0x1p-14, 0x0400},
+		{0.333333333, 0x3555},
+		{math32.Inf(1), 0x7c00},
+		{math32.Inf(-1), 0xfc00},
+	}
+
+	for _, test := range tests {
+		bits := libio.Float16Bits(test.value)
+		if bits != test.bits {
+			t.Errorf("%g should be 0x%04x but was 0x%04x", test.value, test.bits, bits)
+		}
+	}
+
+	if !math32.IsNaN(libio.Float16FromBits(libio.Float16Bits(math32.NaN()))) {
+		t.Errorf("NaN should stay NaN")
+	}
+
+	// every half except NaNs must survive a round trip
+	for h := 0; h <= 0xffff; h++ {
+		if h&0x7c00 == 0x7c00 && h&0x3ff != 0 {
+			continue
+		}
+		bits := libio.Float16Bits(libio.Float16FromBits(uint16(h)))
+		if bits != uint16(h) {
+			t.Fatalf("0x%04x should round trip but was 0x%04x", h, bits)
+		}
+	}
+}
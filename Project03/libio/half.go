@@ -0,0 +1,74 @@
+package libio
+
+import "github.com/chewxy/math32"
+
+// Converts f to an IEEE 754 half precision float, rounding to the nearest even value.
+// Values outside of the half range become infinity, NaN stays NaN.
+func Float16Bits(f float32) uint16 {
+	bits := math32.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int32(bits>>23) & 0xff
+	mant := bits & 0x7fffff
+
+	if exp == 0xff {
+		if mant != 0 {
+			// keep NaN a NaN, even if the payload is only in the low bits
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	}
+
+	// re-bias the exponent from 127 to 15
+	exp = exp - 127 + 15
+	if exp >= 0x1f {
+		return sign | 0x7c00
+	}
+
+	if exp <= 0 {
+		// subnormal or zero
+		if exp < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		shift := uint32(14 - exp)
+		half := uint16(mant >> shift)
+		rest := mant & (1<<shift - 1)
+		halfway := uint32(1) << (shift - 1)
+		if rest > halfway || (rest == halfway && half&1 == 1) {
+			half++
+		}
+		return sign | half
+	}
+
+	half := uint16(exp)<<10 | uint16(mant>>13)
+	rest := mant & 0x1fff
+	if rest > 0x1000 || (rest == 0x1000 && half&1 == 1) {
+		// may carry into the exponent, which correctly rounds up to infinity
+		half++
+	}
+	return sign | half
+}
+
+// Converts an IEEE 754 half precision float to a float32, this is exact
+func Float16FromBits(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := int32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+
+	switch {
+	case exp == 0x1f:
+		return math32.Float32frombits(sign | 0x7f800000 | mant<<13)
+	case exp == 0 && mant == 0:
+		return math32.Float32frombits(sign)
+	case exp == 0:
+		// normalize the subnormal
+		exp = 1
+		for mant&0x400 == 0 {
+			mant <<= 1
+			exp--
+		}
+		mant &= 0x3ff
+	}
+
+	return math32.Float32frombits(sign | uint32(exp+127-15)<<23 | mant<<13)
+}
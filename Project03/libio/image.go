@@ -1,11 +1,13 @@
 package libio
 
 import (
+	"fmt"
 	"unsafe"
 
 	goimg "image"
 
 	"github.com/chewxy/math32"
+	"github.com/go-gl/mathgl/mgl32"
 )
 
 const MagicNumberF32 = 0x6d16837d
@@ -16,18 +18,38 @@ const (
 	F32Version1_001_000 = FloatImageVersion(1_001_000)
 	F32Version1_002_000 = FloatImageVersion(1_002_000)
 	F32Version1_002_001 = FloatImageVersion(1_002_001)
+	// Well defined fixed point encoding of constant channels and an optional metadata block
+	F32Version1_003_000 = FloatImageVersion(1_003_000)
+	// Adds depth, array layers and mip levels
+	F32Version1_004_000 = FloatImageVersion(1_004_000)
+)
+
+type FloatImageFlags uint8
+
+const (
+	// A FloatImageMetadata block follows the header
+	FloatImageFlagMetadata = FloatImageFlags(1 << iota)
+	// The layers are the faces of one or more cube maps
+	FloatImageFlagCubeMap
 )
 
 type FloatImageCompression uint8
 
 const (
 	FloatImageCompressionNone = FloatImageCompression(iota)
+	// Quantizes each channel to 16 bit over its min/max range, lossy
 	FloatImageCompressionFixedPoint16Lz4
+	// IEEE 754 half precision floats, lossy but keeps the relative precision of hdr data
+	FloatImageCompressionHalfLz4
+	// Lossless, the bytes of every float are split into 4 planes which compress much better
+	FloatImageCompressionShuffleLz4
 )
 
 type image struct {
 	Channels      int
 	Width, Height int
+	// What the values of the first three channels mean, the alpha channel is always linear
+	ColorSpace ColorSpace
 }
 
 // Calculates the tuple index into the images data.
@@ -68,7 +90,9 @@ func (img *IntImage) Bytes() int {
 func (img *IntImage) ToChannels(count int, defaults ...uint8) *IntImage {
 	dst := toChannels(img.Channels, count, img.Count(), img.Pix, defaults...)
 
-	return NewIntImage(dst, count, img.Width, img.Height)
+	result := NewIntImage(dst, count, img.Width, img.Height)
+	result.ColorSpace = img.ColorSpace
+	return result
 }
 
 func toChannels[P ~[]E, E any](srcCh, dstCh int, count int, pix P, defaults ...E) P {
@@ -138,7 +162,31 @@ func shuffle[P ~[]E, E any](order []int, srcCh int, count int, pix P, defaults .
 	return dst
 }
 
+// Converts the image to floats in [0, 1], sRGB encoded colors are decoded to linear light
+func (img *IntImage) ToFloatImage() *FloatImage {
+	result := NewFloatImage(make([]float32, len(img.Pix)), img.Channels, img.Width, img.Height)
+	result.ColorSpace = img.ColorSpace
+	for i, v := range img.Pix {
+		result.Pix[i] = float32(v) / 0xff
+	}
+	if img.ColorSpace.IsSrgbEncoded() && img.Channels >= 3 {
+		result.ColorSpace = img.ColorSpace.Linear()
+		for i := 0; i < len(img.Pix); i += img.Channels {
+			for ch := 0; ch < 3; ch++ {
+				result.Pix[i+ch] = srgbToLinearTable[img.Pix[i+ch]]
+			}
+		}
+	}
+	return result
+}
+
+// Converts the image to a Go image, which is expected to hold sRGB encoded colors.
+// Images tagged with a linear color space are encoded first, images of an unknown color space are copied as they are.
 func (img *IntImage) ToRGBA() *goimg.RGBA {
+	if img.ColorSpace != ColorSpaceUnknown && !img.ColorSpace.IsSrgbEncoded() && img.Channels >= 3 {
+		img = img.ToFloatImage().ToIntImage()
+	}
+
 	rgba := goimg.NewRGBA(goimg.Rect(0, 0, img.Width, img.Height))
 
 	for y := 0; y < img.Height; y++ {
@@ -167,12 +215,35 @@ type FloatImageHeader struct {
 	Width, Height uint32
 	Channels      uint8
 	Compression   FloatImageCompression
-	Unused        [14]uint8
+	// Since version 1.3, zero before
+	Flags FloatImageFlags
+	// Since version 1.4, zero before
+	Depth, Layers uint32
+	Levels        uint8
+	Unused        [4]uint8
+}
+
+// Optional information about the content of a FloatImage
+type FloatImageMetadata struct {
+	// e.g. "linear_srgb" or "acescg", empty if unknown.
+	// The names of the ColorSpace constants set the ColorSpace of decoded images.
+	ColorSpace string
+	// What the image is used for, e.g. "brdf_lut"
+	Semantic string
+	// The projection of an environment, e.g. "latlong" or "paraboloid"
+	Layout string
+	// The roughness a level of a prefiltered environment was convolved for
+	Roughness float32
+}
+
+func (meta FloatImageMetadata) IsZero() bool {
+	return meta == FloatImageMetadata{}
 }
 
 type FloatImage struct {
 	image
-	Pix []float32
+	Pix      []float32
+	Metadata FloatImageMetadata
 }
 
 func NewFloatImage(pix []float32, channels int, width, height int) *FloatImage {
@@ -197,7 +268,9 @@ func (img *FloatImage) Bytes() int {
 func (img *FloatImage) ToChannels(count int, defaults ...float32) *FloatImage {
 	dst := toChannels(img.Channels, count, img.Count(), img.Pix, defaults...)
 
-	return NewFloatImage(dst, count, img.Width, img.Height)
+	result := NewFloatImage(dst, count, img.Width, img.Height)
+	result.ColorSpace = img.ColorSpace
+	return result
 }
 
 func (img *FloatImage) Shuffle(order []int, defaults ...float32) *FloatImage {
@@ -212,23 +285,69 @@ func (img *FloatImage) Shuffle(order []int, defaults ...float32) *FloatImage {
 func (img *FloatImage) Copy() *FloatImage {
 	pix := make([]float32, len(img.Pix))
 	copy(pix, img.Pix)
-	return NewFloatImage(pix, img.Channels, img.Width, img.Height)
+	cpy := NewFloatImage(pix, img.Channels, img.Width, img.Height)
+	cpy.ColorSpace = img.ColorSpace
+	cpy.Metadata = img.Metadata
+	return cpy
 }
 
+// Converts the image to 8 bit, clamping the values to [0, 1].
+// Linear colors are encoded with the sRGB transfer function, ACEScg is converted to sRGB first.
+// Images of an unknown color space are quantized as they are.
 func (img *FloatImage) ToIntImage() *IntImage {
-	pix := make([]uint8, len(img.Pix))
+	src := img
+	if img.ColorSpace != ColorSpaceUnknown && !img.ColorSpace.IsSrgbEncoded() && img.Channels >= 3 {
+		target := img.ColorSpace.Encoded()
+		if !target.IsSrgbEncoded() {
+			target = ColorSpaceSrgb
+		}
+		src = img.Copy()
+		src.ConvertColorSpace(target)
+	}
 
-	for i := 0; i < len(img.Pix); i++ {
-		pix[i] = uint8(math32.Min(math32.Max(0.0, img.Pix[i]), 1.0) * 0xff)
+	result := NewIntImage(make([]uint8, len(src.Pix)), src.Channels, src.Width, src.Height)
+	result.ColorSpace = src.ColorSpace
+	for i, v := range src.Pix {
+		result.Pix[i] = quantizeUnorm8(v)
 	}
+	return result
+}
 
-	return NewIntImage(pix, img.Channels, img.Width, img.Height)
+// Converts the colors of the image to another color space in place, the alpha channel is left as it is.
+// Fails for images with less than three channels and for images of an unknown color space.
+func (img *FloatImage) ConvertColorSpace(to ColorSpace) error {
+	if err := convertColors(img.Pix, img.Channels, img.ColorSpace, to); err != nil {
+		return err
+	}
+	img.ColorSpace = to
+	return nil
 }
 
-func (img *FloatImage) Tonemap(gamma, scale float32) {
-	for i := 0; i < len(img.Pix); i++ {
-		img.Pix[i] = tonemap(img.Pix[i], 1.0/gamma, scale)
+// Scales the colors by exposure and maps them to [0, 1] with the tonemapper, in place.
+// The result is linear Rec.709, images of an unknown color space are assumed to be linear Rec.709 already.
+// The white point of TonemapperReinhardExtended is the brightest pixel.
+func (img *FloatImage) Tonemap(op Tonemapper, exposure float32) error {
+	if img.Channels < 3 {
+		return fmt.Errorf("tonemapping needs at least 3 channels but the image has %d", img.Channels)
 	}
+	if img.ColorSpace == ColorSpaceUnknown {
+		img.ColorSpace = ColorSpaceLinearSrgb
+	}
+	if err := img.ConvertColorSpace(ColorSpaceLinearSrgb); err != nil {
+		return err
+	}
+
+	for i := 0; i < len(img.Pix); i += img.Channels {
+		img.Pix[i+0] *= exposure
+		img.Pix[i+1] *= exposure
+		img.Pix[i+2] *= exposure
+	}
+	white := maxLuminance(img.Pix, img.Channels)
+	for i := 0; i < len(img.Pix); i += img.Channels {
+		c := op.Apply(mgl32.Vec3{img.Pix[i], img.Pix[i+1], img.Pix[i+2]}, white)
+		copy(img.Pix[i:i+3], c[:])
+	}
+	return nil
 }
 
 // Normalizes all pixel values to be from 0 to 1
@@ -247,8 +366,3 @@ func (img *FloatImage) Normalize() {
 		img.Pix[i] = (img.Pix[i] - min) / diff
 	}
 }
-
-func tonemap(value, gamma, scale float32) float32 {
-	value = math32.Pow(value, gamma) * scale
-	return math32.Min(math32.Max(0.0, value), 1.0)
-}
@@ -0,0 +1,815 @@
+package libio
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unsafe"
+
+	"github.com/DataDog/zstd"
+	"github.com/chewxy/math32"
+)
+
+// See: https://registry.khronos.org/KTX/specs/2.0/ktxspec.v2.html
+var ktx2Identifier = [12]byte{0xAB, 'K', 'T', 'X', ' ', '2', '0', 0xBB, '\r', '\n', 0x1A, '\n'}
+
+// A Vulkan format enum value
+type VkFormat uint32
+
+const (
+	VkFormatUndefined          = VkFormat(0)
+	VkFormatR8Unorm            = VkFormat(9)
+	VkFormatR8Srgb             = VkFormat(15)
+	VkFormatR8G8Unorm          = VkFormat(16)
+	VkFormatR8G8Srgb           = VkFormat(22)
+	VkFormatR8G8B8Unorm        = VkFormat(23)
+	VkFormatR8G8B8Srgb         = VkFormat(29)
+	VkFormatR8G8B8A8Unorm      = VkFormat(37)
+	VkFormatR8G8B8A8Srgb       = VkFormat(43)
+	VkFormatR16Sfloat          = VkFormat(76)
+	VkFormatR16G16Sfloat       = VkFormat(83)
+	VkFormatR16G16B16Sfloat    = VkFormat(90)
+	VkFormatR16G16B16A16Sfloat = VkFormat(97)
+	VkFormatR32Sfloat          = VkFormat(100)
+	VkFormatR32G32Sfloat       = VkFormat(103)
+	VkFormatR32G32B32Sfloat    = VkFormat(106)
+	VkFormatR32G32B32A32Sfloat = VkFormat(109)
+	VkFormatBC1RgbaUnormBlock  = VkFormat(133)
+	VkFormatBC1RgbaSrgbBlock   = VkFormat(134)
+	VkFormatBC3UnormBlock      = VkFormat(137)
+	VkFormatBC3SrgbBlock       = VkFormat(138)
+	VkFormatBC4UnormBlock      = VkFormat(139)
+	VkFormatBC5UnormBlock      = VkFormat(141)
+	VkFormatBC7UnormBlock      = VkFormat(145)
+	VkFormatBC7SrgbBlock       = VkFormat(146)
+)
+
+type vkFormatKind int
+
+const (
+	vkFormatKindUnorm = vkFormatKind(iota)
+	vkFormatKindSrgb
+	vkFormatKindSfloat
+)
+
+type vkFormatInfo struct {
+	channels int
+	// the size of one channel in bytes
+	typeSize int
+	kind     vkFormatKind
+}
+
+var vkFormats = map[VkFormat]vkFormatInfo{
+	VkFormatR8Unorm:            {1, 1, vkFormatKindUnorm},
+	VkFormatR8Srgb:             {1, 1, vkFormatKindSrgb},
+	VkFormatR8G8Unorm:          {2, 1, vkFormatKindUnorm},
+	VkFormatR8G8Srgb:           {2, 1, vkFormatKindSrgb},
+	VkFormatR8G8B8Unorm:        {3, 1, vkFormatKindUnorm},
+	VkFormatR8G8B8Srgb:         {3, 1, vkFormatKindSrgb},
+	VkFormatR8G8B8A8Unorm:      {4, 1, vkFormatKindUnorm},
+	VkFormatR8G8B8A8Srgb:       {4, 1, vkFormatKindSrgb},
+	VkFormatR16Sfloat:          {1, 2, vkFormatKindSfloat},
+	VkFormatR16G16Sfloat:       {2, 2, vkFormatKindSfloat},
+	VkFormatR16G16B16Sfloat:    {3, 2, vkFormatKindSfloat},
+	VkFormatR16G16B16A16Sfloat: {4, 2, vkFormatKindSfloat},
+	VkFormatR32Sfloat:          {1, 4, vkFormatKindSfloat},
+	VkFormatR32G32Sfloat:       {2, 4, vkFormatKindSfloat},
+	VkFormatR32G32B32Sfloat:    {3, 4, vkFormatKindSfloat},
+	VkFormatR32G32B32A32Sfloat: {4, 4, vkFormatKindSfloat},
+}
+
+// The block compressed formats and their dds equivalent
+var vkBlockFormats = map[VkFormat]DxgiFormat{
+	VkFormatBC1RgbaUnormBlock: DxgiFormatBC1Unorm,
+	VkFormatBC1RgbaSrgbBlock:  DxgiFormatBC1UnormSrgb,
+	VkFormatBC3UnormBlock:     DxgiFormatBC3Unorm,
+	VkFormatBC3SrgbBlock:      DxgiFormatBC3UnormSrgb,
+	VkFormatBC4UnormBlock:     DxgiFormatBC4Unorm,
+	VkFormatBC5UnormBlock:     DxgiFormatBC5Unorm,
+	VkFormatBC7UnormBlock:     DxgiFormatBC7Unorm,
+	VkFormatBC7SrgbBlock:      DxgiFormatBC7UnormSrgb,
+}
+
+// Returns the dds format of a block compressed format or DxgiFormatUnknown
+func (format VkFormat) BlockFormat() DxgiFormat {
+	return vkBlockFormats[format]
+}
+
+// Returns the ktx2 format of a block compressed dds format
+func VkFormatFromBlockFormat(format DxgiFormat) VkFormat {
+	for vk, dxgi := range vkBlockFormats {
+		if dxgi == format {
+			return vk
+		}
+	}
+	return VkFormatUndefined
+}
+
+func (info vkFormatInfo) texelBytes() int {
+	return info.channels * info.typeSize
+}
+
+// Returns the 8 bit format with the given channel count
+func VkFormatUnorm8(channels int, srgb bool) VkFormat {
+	for format, info := range vkFormats {
+		if info.channels == channels && info.typeSize == 1 && (info.kind == vkFormatKindSrgb) == srgb {
+			return format
+		}
+	}
+	return VkFormatUndefined
+}
+
+// Returns the float format with the given channel count, typeSize is 2 for half floats or 4
+func VkFormatSfloat(channels int, typeSize int) VkFormat {
+	for format, info := range vkFormats {
+		if info.channels == channels && info.typeSize == typeSize && info.kind == vkFormatKindSfloat {
+			return format
+		}
+	}
+	return VkFormatUndefined
+}
+
+type Ktx2Supercompression uint32
+
+const (
+	Ktx2SupercompressionNone = Ktx2Supercompression(0)
+	Ktx2SupercompressionZstd = Ktx2Supercompression(2)
+	Ktx2SupercompressionZlib = Ktx2Supercompression(3)
+)
+
+type ktx2Header struct {
+	Identifier             [12]byte
+	Format                 VkFormat
+	TypeSize               uint32
+	PixelWidth             uint32
+	PixelHeight            uint32
+	PixelDepth             uint32
+	LayerCount             uint32
+	FaceCount              uint32
+	LevelCount             uint32
+	SupercompressionScheme Ktx2Supercompression
+	DfdByteOffset          uint32
+	DfdByteLength          uint32
+	KvdByteOffset          uint32
+	KvdByteLength          uint32
+	SgdByteOffset          uint64
+	SgdByteLength          uint64
+}
+
+type ktx2LevelIndex struct {
+	ByteOffset             uint64
+	ByteLength             uint64
+	UncompressedByteLength uint64
+}
+
+// A Ktx2Texture holds the raw data of a ktx2 file.
+// The levels are laid out like a FloatTexture, the faces of a cube map are consecutive layers.
+type Ktx2Texture struct {
+	Format        VkFormat
+	Width, Height int
+	// 1 for 2D textures
+	Depth int
+	// the array layers, 1 for textures that are not arrays
+	Layers int
+	// 6 for cube maps, 1 otherwise
+	Faces int
+	// the raw data of each level, starting with the base level
+	Levels [][]byte
+	// see https://registry.khronos.org/KTX/specs/2.0/ktxspec.v2.html#_keyvalue_data
+	KeyValues map[string]string
+}
+
+// Returns the orientation of the y axis, 'd' when the first row is the top and 'u' when it is the bottom
+func (tex *Ktx2Texture) OrientationY() byte {
+	orientation := tex.KeyValues["KTXorientation"]
+	if len(orientation) < 2 {
+		return 'd'
+	}
+	return orientation[1]
+}
+
+// The whole file is read into memory, up to the allocation limit when r is a BinaryReader
+func DecodeKtx2(r io.Reader) (tex *Ktx2Texture, err error) {
+	limit := DefaultMaxAlloc
+	if src, ok := r.(*BinaryReader); ok {
+		limit = src.Limit()
+	}
+	data, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, NewDecodeError(limit, ErrAllocLimit, "ktx2 file is too large")
+	}
+
+	br := &BinaryReader{
+		Src:      bytes.NewReader(data),
+		Order:    binary.LittleEndian,
+		MaxAlloc: limit,
+	}
+
+	header := ktx2Header{}
+	if !br.ReadRef(&header) {
+		return nil, br.Errorf("expected ktx2 header")
+	}
+	if header.Identifier != ktx2Identifier {
+		return nil, br.Errorf("ktx2 identifier is corrupt")
+	}
+
+	levelCount := int(header.LevelCount)
+	if levelCount == 0 {
+		// the loader should generate the mips, there is only the base level
+		levelCount = 1
+	}
+	if levelCount > 32 {
+		return nil, NewDecodeError(int(unsafe.Offsetof(header.LevelCount)), nil, "ktx2 level count %d is invalid", levelCount)
+	}
+	levelIndex := make([]ktx2LevelIndex, levelCount)
+	if !br.ReadRef(levelIndex) {
+		return nil, br.Errorf("expected ktx2 level index")
+	}
+
+	tex = &Ktx2Texture{
+		Format:    header.Format,
+		Width:     int(header.PixelWidth),
+		Height:    max1(int(header.PixelHeight)),
+		Depth:     max1(int(header.PixelDepth)),
+		Layers:    max1(int(header.LayerCount)),
+		Faces:     int(header.FaceCount),
+		Levels:    make([][]byte, levelCount),
+		KeyValues: map[string]string{},
+	}
+	if tex.Width < 1 {
+		return nil, NewDecodeError(int(unsafe.Offsetof(header.PixelWidth)), nil, "ktx2 pixel width %d is invalid", tex.Width)
+	}
+	if tex.Faces != 1 && tex.Faces != 6 {
+		return nil, NewDecodeError(int(unsafe.Offsetof(header.FaceCount)), nil, "ktx2 face count %d is invalid", tex.Faces)
+	}
+
+	if header.KvdByteLength > 0 {
+		end := uint64(header.KvdByteOffset) + uint64(header.KvdByteLength)
+		if end > uint64(len(data)) {
+			return nil, NewDecodeError(int(header.KvdByteOffset), nil, "ktx2 key/value data is out of bounds")
+		}
+		tex.KeyValues, err = decodeKtx2KeyValues(data[header.KvdByteOffset:end])
+		if err != nil {
+			return nil, NewDecodeError(int(header.KvdByteOffset), err, "ktx2 key/value data is corrupt")
+		}
+	}
+
+	for lvl, index := range levelIndex {
+		end := index.ByteOffset + index.ByteLength
+		if end > uint64(len(data)) || end < index.ByteOffset {
+			return nil, NewDecodeError(int(index.ByteOffset), nil, "ktx2 level %d is out of bounds", lvl)
+		}
+		level := data[index.ByteOffset:end]
+
+		switch header.SupercompressionScheme {
+		case Ktx2SupercompressionNone:
+		case Ktx2SupercompressionZstd, Ktx2SupercompressionZlib:
+			if index.UncompressedByteLength > uint64(limit) {
+				return nil, NewDecodeError(int(index.ByteOffset), ErrAllocLimit, "ktx2 level %d is too large", lvl)
+			}
+			if header.SupercompressionScheme == Ktx2SupercompressionZstd {
+				level, err = decompressZstd(level, index.UncompressedByteLength)
+			} else {
+				level, err = decompressZlib(level, index.UncompressedByteLength)
+			}
+			if err != nil {
+				return nil, NewDecodeError(int(index.ByteOffset), err, "could not decompress ktx2 level %d", lvl)
+			}
+		default:
+			return nil, NewDecodeError(int(unsafe.Offsetof(header.SupercompressionScheme)), nil, "ktx2 supercompression scheme %d unsupported", header.SupercompressionScheme)
+		}
+		tex.Levels[lvl] = level
+	}
+
+	return tex, nil
+}
+
+func decompressZstd(data []byte, size uint64) ([]byte, error) {
+	result := make([]byte, size)
+	// the cgo binding can't decompress into an empty slice
+	if size == 0 {
+		return result, nil
+	}
+	if len(data) == 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	n, err := zstd.DecompressInto(result, data)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(n) != size {
+		return nil, fmt.Errorf("expected %d bytes but got %d", size, n)
+	}
+	return result, nil
+}
+
+func decompressZlib(data []byte, size uint64) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	result := make([]byte, size)
+	_, err = io.ReadFull(zr, result)
+	return result, err
+}
+
+func decodeKtx2KeyValues(data []byte) (map[string]string, error) {
+	kv := map[string]string{}
+	for len(data) >= 4 {
+		length := int(binary.LittleEndian.Uint32(data))
+		data = data[4:]
+		if length > len(data) {
+			return nil, fmt.Errorf("entry is truncated")
+		}
+		key, value, ok := strings.Cut(string(data[:length]), "\x00")
+		if !ok {
+			return nil, fmt.Errorf("key is not terminated")
+		}
+		kv[key] = strings.TrimSuffix(value, "\x00")
+		// entries are padded to 4 bytes
+		length = (length + 3) &^ 3
+		if length > len(data) {
+			break
+		}
+		data = data[length:]
+	}
+	return kv, nil
+}
+
+func EncodeKtx2(w io.Writer, tex *Ktx2Texture, supercompression Ktx2Supercompression) error {
+	info, ok := vkFormats[tex.Format]
+	blockFormat := tex.Format.BlockFormat()
+	if !ok && blockFormat == DxgiFormatUnknown {
+		return fmt.Errorf("ktx2 format %d unsupported", tex.Format)
+	}
+	switch supercompression {
+	case Ktx2SupercompressionNone, Ktx2SupercompressionZstd, Ktx2SupercompressionZlib:
+	default:
+		return fmt.Errorf("ktx2 supercompression scheme %d unsupported", supercompression)
+	}
+	if tex.Faces != 1 && tex.Faces != 6 {
+		return fmt.Errorf("ktx2 face count must be 1 or 6, not %d", tex.Faces)
+	}
+
+	var dfd []byte
+	typeSize, texelBytes := info.typeSize, info.texelBytes()
+	if blockFormat != DxgiFormatUnknown {
+		dfd = encodeKtx2BlockDfd(tex.Format, blockFormat)
+		typeSize, texelBytes = 1, blockFormat.BlockBytes()
+	} else {
+		dfd = encodeKtx2Dfd(info)
+	}
+	kvd := encodeKtx2KeyValues(tex.KeyValues)
+
+	header := ktx2Header{
+		Identifier:             ktx2Identifier,
+		Format:                 tex.Format,
+		TypeSize:               uint32(typeSize),
+		PixelWidth:             uint32(tex.Width),
+		PixelHeight:            uint32(tex.Height),
+		PixelDepth:             uint32(tex.Depth),
+		LayerCount:             uint32(tex.Layers),
+		FaceCount:              uint32(tex.Faces),
+		LevelCount:             uint32(len(tex.Levels)),
+		SupercompressionScheme: supercompression,
+	}
+	if tex.Depth <= 1 {
+		header.PixelDepth = 0
+	}
+	if tex.Layers <= 1 {
+		header.LayerCount = 0
+	}
+
+	levels := make([][]byte, len(tex.Levels))
+	for lvl, level := range tex.Levels {
+		levels[lvl] = level
+		switch supercompression {
+		case Ktx2SupercompressionZstd:
+			compressed, err := zstd.Compress(nil, level)
+			if err != nil {
+				return err
+			}
+			levels[lvl] = compressed
+		case Ktx2SupercompressionZlib:
+			buf := new(bytes.Buffer)
+			zw := zlib.NewWriter(buf)
+			if _, err := zw.Write(level); err != nil {
+				return err
+			}
+			if err := zw.Close(); err != nil {
+				return err
+			}
+			levels[lvl] = buf.Bytes()
+		}
+	}
+
+	offset := binary.Size(header) + binary.Size(ktx2LevelIndex{})*len(levels)
+	header.DfdByteOffset = uint32(offset)
+	header.DfdByteLength = uint32(len(dfd))
+	offset += len(dfd)
+	if len(kvd) > 0 {
+		header.KvdByteOffset = uint32(offset)
+		header.KvdByteLength = uint32(len(kvd))
+		offset += len(kvd)
+	}
+
+	// the levels are stored from the smallest to the largest
+	alignment := 1
+	if supercompression == Ktx2SupercompressionNone {
+		alignment = lcm(texelBytes, 4)
+	}
+	levelIndex := make([]ktx2LevelIndex, len(levels))
+	padding := make([][]byte, len(levels))
+	for lvl := len(levels) - 1; lvl >= 0; lvl-- {
+		pad := (alignment - offset%alignment) % alignment
+		padding[lvl] = make([]byte, pad)
+		offset += pad
+		levelIndex[lvl] = ktx2LevelIndex{
+			ByteOffset:             uint64(offset),
+			ByteLength:             uint64(len(levels[lvl])),
+			UncompressedByteLength: uint64(len(tex.Levels[lvl])),
+		}
+		offset += len(levels[lvl])
+	}
+
+	bw := &BinaryWriter{
+		Dst:   w,
+		Order: binary.LittleEndian,
+	}
+	bw.WriteRef(&header)
+	bw.WriteRef(levelIndex)
+	bw.WriteBytes(dfd)
+	bw.WriteBytes(kvd)
+	for lvl := len(levels) - 1; lvl >= 0; lvl-- {
+		bw.WriteBytes(padding[lvl])
+		bw.WriteBytes(levels[lvl])
+	}
+	if bw.Err != nil {
+		return fmt.Errorf("could not write ktx2: %w", bw.Err)
+	}
+	return nil
+}
+
+// Writes a basic data format descriptor
+func encodeKtx2Dfd(info vkFormatInfo) []byte {
+	const (
+		khrDfModelRgbsda    = 1
+		khrDfPrimariesBt709 = 1
+		khrDfTransferLinear = 1
+		khrDfTransferSrgb   = 2
+		qualifierLinear     = 0x10
+		qualifierSigned     = 0x40
+		qualifierFloat      = 0x80
+	)
+	channelIds := []uint32{0, 1, 2, 15}
+
+	transfer := uint32(khrDfTransferLinear)
+	if info.kind == vkFormatKindSrgb {
+		transfer = khrDfTransferSrgb
+	}
+
+	blockSize := 24 + 16*info.channels
+	words := []uint32{
+		uint32(4 + blockSize),
+		// vendor and descriptor type are 0
+		0,
+		2 | uint32(blockSize)<<16,
+		khrDfModelRgbsda | khrDfPrimariesBt709<<8 | transfer<<16,
+		// texel block dimensions are 1x1x1x1
+		0,
+		uint32(info.texelBytes()),
+		0,
+	}
+	for ch := 0; ch < info.channels; ch++ {
+		bits := info.typeSize * 8
+		channel := channelIds[ch]
+		lower, upper := uint32(0), uint32(1)<<bits-1
+		switch info.kind {
+		case vkFormatKindSfloat:
+			channel |= qualifierFloat | qualifierSigned
+			lower, upper = math32.Float32bits(-1), math32.Float32bits(1)
+		case vkFormatKindSrgb:
+			if ch == 3 {
+				channel |= qualifierLinear
+			}
+		}
+		words = append(words,
+			uint32(ch*bits)|uint32(bits-1)<<16|channel<<24,
+			0,
+			lower,
+			upper,
+		)
+	}
+
+	data := make([]byte, len(words)*4)
+	for i, w := range words {
+		binary.LittleEndian.PutUint32(data[i*4:], w)
+	}
+	return data
+}
+
+// Writes a basic data format descriptor for a block compressed format.
+// Each sample covers a whole channel of the block.
+func encodeKtx2BlockDfd(format VkFormat, blockFormat DxgiFormat) []byte {
+	const (
+		khrDfModelBc1a      = 128
+		khrDfModelBc3       = 130
+		khrDfModelBc4       = 131
+		khrDfModelBc5       = 132
+		khrDfModelBc7       = 134
+		khrDfPrimariesBt709 = 1
+		khrDfTransferLinear = 1
+		khrDfTransferSrgb   = 2
+		qualifierLinear     = 0x10
+	)
+
+	type sample struct {
+		offset, length, channel uint32
+	}
+	var model uint32
+	var samples []sample
+	switch blockFormat {
+	case DxgiFormatBC1Unorm, DxgiFormatBC1UnormSrgb:
+		model, samples = khrDfModelBc1a, []sample{{0, 64, 1}}
+	case DxgiFormatBC3Unorm, DxgiFormatBC3UnormSrgb:
+		model, samples = khrDfModelBc3, []sample{{0, 64, 15 | qualifierLinear}, {64, 64, 0}}
+	case DxgiFormatBC4Unorm:
+		model, samples = khrDfModelBc4, []sample{{0, 64, 0}}
+	case DxgiFormatBC5Unorm:
+		model, samples = khrDfModelBc5, []sample{{0, 64, 0}, {64, 64, 1}}
+	case DxgiFormatBC7Unorm, DxgiFormatBC7UnormSrgb:
+		model, samples = khrDfModelBc7, []sample{{0, 128, 0}}
+	}
+
+	transfer := uint32(khrDfTransferLinear)
+	if blockFormat.IsSrgb() {
+		transfer = khrDfTransferSrgb
+	}
+
+	blockSize := 24 + 16*len(samples)
+	words := []uint32{
+		uint32(4 + blockSize),
+		0,
+		2 | uint32(blockSize)<<16,
+		model | khrDfPrimariesBt709<<8 | transfer<<16,
+		// texel block dimensions are 4x4x1x1
+		3 | 3<<8,
+		uint32(blockFormat.BlockBytes()),
+		0,
+	}
+	for _, s := range samples {
+		words = append(words, s.offset|(s.length-1)<<16|s.channel<<24, 0, 0, 0xffffffff)
+	}
+
+	data := make([]byte, len(words)*4)
+	for i, w := range words {
+		binary.LittleEndian.PutUint32(data[i*4:], w)
+	}
+	return data
+}
+
+func encodeKtx2KeyValues(kv map[string]string) []byte {
+	keys := make([]string, 0, len(kv))
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := new(bytes.Buffer)
+	for _, k := range keys {
+		entry := k + "\x00" + kv[k] + "\x00"
+		binary.Write(buf, binary.LittleEndian, uint32(len(entry)))
+		buf.WriteString(entry)
+		for buf.Len()%4 != 0 {
+			buf.WriteByte(0)
+		}
+	}
+	return buf.Bytes()
+}
+
+// Converts the texture to a ktx2 texture with the given uncompressed format.
+// Values are clamped to [0, 1] for 8 bit formats, no transfer function is applied for srgb formats.
+func NewKtx2FromFloatTexture(tex *FloatTexture, format VkFormat) (*Ktx2Texture, error) {
+	info, ok := vkFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("ktx2 format %d unsupported", format)
+	}
+	if info.channels != tex.Channels {
+		return nil, fmt.Errorf("a %d channel texture cannot be stored as a %d channel format", tex.Channels, info.channels)
+	}
+
+	result := newKtx2FromTexture(&tex.texture, format)
+	for lvl := range result.Levels {
+		src := tex.Level(lvl)
+		dst := make([]byte, len(src)*info.typeSize)
+		for i, v := range src {
+			switch info.typeSize {
+			case 1:
+				if v < 0 {
+					v = 0
+				} else if v > 1 {
+					v = 1
+				}
+				dst[i] = uint8(v*0xff + 0.5)
+			case 2:
+				binary.LittleEndian.PutUint16(dst[i*2:], Float16Bits(v))
+			case 4:
+				binary.LittleEndian.PutUint32(dst[i*4:], math32.Float32bits(v))
+			}
+		}
+		result.Levels[lvl] = dst
+	}
+	return result, nil
+}
+
+func NewKtx2FromIntTexture(tex *IntTexture, srgb bool) (*Ktx2Texture, error) {
+	format := VkFormatUnorm8(tex.Channels, srgb)
+	if format == VkFormatUndefined {
+		return nil, fmt.Errorf("a %d channel texture cannot be stored as ktx2", tex.Channels)
+	}
+
+	result := newKtx2FromTexture(&tex.texture, format)
+	for lvl := range result.Levels {
+		result.Levels[lvl] = append([]byte(nil), tex.Level(lvl)...)
+	}
+	return result, nil
+}
+
+func newKtx2FromTexture(tex *texture, format VkFormat) *Ktx2Texture {
+	result := &Ktx2Texture{
+		Format:    format,
+		Width:     tex.Width,
+		Height:    tex.Height,
+		Depth:     tex.Depth,
+		Layers:    tex.Layers,
+		Faces:     1,
+		Levels:    make([][]byte, tex.Levels),
+		KeyValues: map[string]string{"KTXwriter": "advanced-gl libio"},
+	}
+	if tex.CubeMap {
+		result.Faces = 6
+		result.Layers = tex.Layers / 6
+	} else if tex.Depth > 1 {
+		// the first row is the bottom, like the rest of this package
+		result.KeyValues["KTXorientation"] = "rui"
+	} else {
+		result.KeyValues["KTXorientation"] = "ru"
+	}
+	return result
+}
+
+func (tex *Ktx2Texture) texture() (texture, error) {
+	result := newTexture(vkFormats[tex.Format].channels, tex.Width, tex.Height, tex.Depth, tex.Layers*tex.Faces, len(tex.Levels))
+	result.CubeMap = tex.Faces == 6
+	if err := result.validate(); err != nil {
+		return result, err
+	}
+	for lvl, level := range tex.Levels {
+		expected := (result.offsets[lvl+1] - result.offsets[lvl]) * vkFormats[tex.Format].texelBytes()
+		if len(level) != expected {
+			return result, fmt.Errorf("ktx2 level %d should be %d bytes but is %d", lvl, expected, len(level))
+		}
+	}
+	return result, nil
+}
+
+// Converts the texture to floats, 8 bit values are mapped to [0, 1].
+// Rows are flipped so the origin is in the bottom left.
+func (tex *Ktx2Texture) ToFloatTexture() (*FloatTexture, error) {
+	info, ok := vkFormats[tex.Format]
+	if !ok {
+		return nil, fmt.Errorf("ktx2 format %d cannot be converted to floats", tex.Format)
+	}
+	shape, err := tex.texture()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &FloatTexture{
+		texture: shape,
+		Pix:     make([]float32, shape.Count()*info.channels),
+	}
+	if info.kind == vkFormatKindSrgb {
+		result.Metadata.ColorSpace = "srgb"
+	}
+	for lvl, level := range tex.Levels {
+		dst := result.Level(lvl)
+		for i := range dst {
+			switch info.typeSize {
+			case 1:
+				dst[i] = float32(level[i]) / 0xff
+			case 2:
+				dst[i] = Float16FromBits(binary.LittleEndian.Uint16(level[i*2:]))
+			case 4:
+				dst[i] = math32.Float32frombits(binary.LittleEndian.Uint32(level[i*4:]))
+			}
+		}
+		if tex.needsFlip() {
+			flipLevel(&result.texture, lvl, dst)
+		}
+	}
+	return result, nil
+}
+
+// Converts an 8 bit texture, rows are flipped so the origin is in the bottom left.
+// Block compressed textures are decoded with the reference decoder.
+func (tex *Ktx2Texture) ToIntTexture() (*IntTexture, error) {
+	if blockFormat := tex.Format.BlockFormat(); blockFormat != DxgiFormatUnknown {
+		return decodeBlockTexture(blockFormat, tex.Width, tex.Height, tex.Depth, tex.Layers, tex.Faces, tex.Levels, tex.needsFlip())
+	}
+	info, ok := vkFormats[tex.Format]
+	if !ok || info.typeSize != 1 {
+		return nil, fmt.Errorf("ktx2 format %d is not an 8 bit format", tex.Format)
+	}
+	shape, err := tex.texture()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &IntTexture{
+		texture: shape,
+		Pix:     make([]uint8, 0, shape.Count()*info.channels),
+	}
+	for lvl, level := range tex.Levels {
+		result.Pix = append(result.Pix, level...)
+		if tex.needsFlip() {
+			flipLevel(&result.texture, lvl, result.Level(lvl))
+		}
+	}
+	return result, nil
+}
+
+// Cube map faces are always stored with the first row at the top, like OpenGL expects them
+func (tex *Ktx2Texture) needsFlip() bool {
+	return tex.Faces == 1 && tex.OrientationY() == 'd'
+}
+
+// Flips the blocks of a block compressed texture and updates the orientation, cube maps are not flipped.
+// Fails for formats or sizes which cannot be flipped without re-encoding, the texture may be partially flipped then.
+func (tex *Ktx2Texture) FlipVertically() error {
+	blockFormat := tex.Format.BlockFormat()
+	if blockFormat == DxgiFormatUnknown {
+		return fmt.Errorf("ktx2 format %d is not block compressed", tex.Format)
+	}
+	if tex.Faces != 1 {
+		return nil
+	}
+	if err := flipBlockLevels(blockFormat, tex.Width, tex.Height, tex.Depth, tex.Layers, tex.Levels); err != nil {
+		return err
+	}
+
+	orientation := []byte(tex.KeyValues["KTXorientation"])
+	if len(orientation) < 2 {
+		orientation = []byte("rd")
+	}
+	if orientation[1] == 'd' {
+		orientation[1] = 'u'
+	} else {
+		orientation[1] = 'd'
+	}
+	if tex.KeyValues == nil {
+		tex.KeyValues = map[string]string{}
+	}
+	tex.KeyValues["KTXorientation"] = string(orientation)
+	return nil
+}
+
+// Flips the rows of every slice in the level
+func flipLevel[E any](tex *texture, level int, pix []E) {
+	w, h, d := tex.Size(level)
+	row := w * tex.Channels
+	tmp := make([]E, row)
+	for slice := 0; slice < d*tex.Layers; slice++ {
+		base := slice * w * h * tex.Channels
+		for y := 0; y < h/2; y++ {
+			a := pix[base+y*row : base+(y+1)*row]
+			b := pix[base+(h-1-y)*row : base+(h-y)*row]
+			copy(tmp, a)
+			copy(a, b)
+			copy(b, tmp)
+		}
+	}
+}
+
+func max1(v int) int {
+	if v < 1 {
+		return 1
+	}
+	return v
+}
+
+func lcm(a, b int) int {
+	x, y := a, b
+	for y != 0 {
+		x, y = y, x%y
+	}
+	return a / x * b
+}
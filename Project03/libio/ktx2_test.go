@@ -0,0 +1,165 @@
+package libio_test
+
+import (
+	"advanced-gl/Project03/libio"
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+)
+
+func TestKtx2FloatCubeMap(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	tex := libio.NewFloatTexture(3, 8, 8, 1, 6, 4)
+	tex.CubeMap = true
+	for i := range tex.Pix {
+		tex.Pix[i] = rng.Float32() * 1000
+	}
+
+	for _, supercompression := range []libio.Ktx2Supercompression{libio.Ktx2SupercompressionNone, libio.Ktx2SupercompressionZstd, libio.Ktx2SupercompressionZlib} {
+		ktx, err := libio.NewKtx2FromFloatTexture(tex, libio.VkFormatR32G32B32Sfloat)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf := new(bytes.Buffer)
+		err = libio.EncodeKtx2(buf, ktx, supercompression)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data := buf.Bytes()
+		if string(data[1:4]) != "KTX" || binary.LittleEndian.Uint32(data[12:]) != uint32(libio.VkFormatR32G32B32Sfloat) {
+			t.Fatalf("ktx2 header is wrong")
+		}
+		if faces := binary.LittleEndian.Uint32(data[36:]); faces != 6 {
+			t.Errorf("ktx2 face count should be 6 but was %d", faces)
+		}
+		// the first level index entry is at 80, zstd frames start with the magic number 0xFD2FB528
+		if offset := binary.LittleEndian.Uint64(data[80:]); supercompression == libio.Ktx2SupercompressionZstd && binary.LittleEndian.Uint32(data[offset:]) != 0xFD2FB528 {
+			t.Errorf("ktx2 level 0 should be a zstd frame")
+		}
+
+		decoded, err := libio.DecodeKtx2(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := decoded.ToFloatTexture()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !result.CubeMap || result.Layers != 6 || result.Levels != 4 || result.Width != 8 {
+			t.Fatalf("decoded texture has the wrong shape: %+v", result)
+		}
+		for i := range tex.Pix {
+			if result.Pix[i] != tex.Pix[i] {
+				t.Fatalf("decoded float %d should be %g but was %g", i, tex.Pix[i], result.Pix[i])
+			}
+		}
+	}
+}
+
+func TestKtx2HalfFloat(t *testing.T) {
+	tex := libio.NewFloatTexture(4, 4, 2, 3, 1, 2)
+	for i := range tex.Pix {
+		tex.Pix[i] = float32(i) / 4
+	}
+
+	ktx, err := libio.NewKtx2FromFloatTexture(tex, libio.VkFormatSfloat(4, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := libio.EncodeKtx2(buf, ktx, libio.Ktx2SupercompressionNone); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := libio.DecodeKtx2(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := decoded.ToFloatTexture()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Depth != 3 || result.Levels != 2 {
+		t.Fatalf("decoded texture should be 3 deep with 2 levels but was %d deep with %d levels", result.Depth, result.Levels)
+	}
+	// quarters are exact in half precision
+	for i := range tex.Pix {
+		if result.Pix[i] != tex.Pix[i] {
+			t.Fatalf("decoded float %d should be %g but was %g", i, tex.Pix[i], result.Pix[i])
+		}
+	}
+}
+
+func TestKtx2IntArray(t *testing.T) {
+	tex := libio.NewIntTexture(4, 4, 4, 1, 3, 3)
+	for i := range tex.Pix {
+		tex.Pix[i] = uint8(i)
+	}
+
+	ktx, err := libio.NewKtx2FromIntTexture(tex, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ktx.Format != libio.VkFormatR8G8B8A8Srgb {
+		t.Errorf("format should be %d but was %d", libio.VkFormatR8G8B8A8Srgb, ktx.Format)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := libio.EncodeKtx2(buf, ktx, libio.Ktx2SupercompressionZlib); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := libio.DecodeKtx2(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := decoded.ToIntTexture()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Layers != 3 || result.Levels != 3 || result.CubeMap {
+		t.Fatalf("decoded texture should have 3 layers and 3 levels: %+v", result)
+	}
+	if !bytes.Equal(result.Pix, tex.Pix) {
+		t.Errorf("decoded pixels differ")
+	}
+}
+
+func TestKtx2Orientation(t *testing.T) {
+	// 1x2 image, the first row in the file is the top
+	ktx := &libio.Ktx2Texture{
+		Format:    libio.VkFormatR8Unorm,
+		Width:     1,
+		Height:    2,
+		Depth:     1,
+		Layers:    1,
+		Faces:     1,
+		Levels:    [][]byte{{10, 20}},
+		KeyValues: map[string]string{"KTXorientation": "rd"},
+	}
+
+	buf := new(bytes.Buffer)
+	if err := libio.EncodeKtx2(buf, ktx, libio.Ktx2SupercompressionNone); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := libio.DecodeKtx2(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.KeyValues["KTXorientation"] != "rd" {
+		t.Errorf("orientation should be %q but was %q", "rd", decoded.KeyValues["KTXorientation"])
+	}
+
+	result, err := decoded.ToIntTexture()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the origin is in the bottom left
+	if result.Pix[0] != 20 || result.Pix[1] != 10 {
+		t.Errorf("rows should be flipped to [20 10] but were %v", result.Pix)
+	}
+}
@@ -0,0 +1,84 @@
+package libio
+
+import (
+	"fmt"
+)
+
+type MipFilter int
+
+const (
+	// Averages 2x2(x2) texels, fast but slightly blurry and prone to aliasing
+	MipFilterBox = MipFilter(iota)
+	// Kaiser windowed sinc, sharper levels with less aliasing
+	MipFilterKaiser
+)
+
+func (filter MipFilter) String() string {
+	switch filter {
+	case MipFilterBox:
+		return "box"
+	case MipFilterKaiser:
+		return "kaiser"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(filter))
+	}
+}
+
+// Returns a copy of the base level of tex with the given number of mip levels.
+// A complete mip chain is generated when levels is 0.
+// Every level is filtered from the previous one, the layers are filtered separately.
+func GenerateMips(tex *FloatTexture, levels int, filter MipFilter) (*FloatTexture, error) {
+	if levels == 0 {
+		levels = MaxMipLevels(tex.Width, tex.Height, tex.Depth)
+	}
+	if levels > MaxMipLevels(tex.Width, tex.Height, tex.Depth) || levels < 0 {
+		return nil, fmt.Errorf("a %dx%dx%d texture cannot have %d levels", tex.Width, tex.Height, tex.Depth, levels)
+	}
+	if filter != MipFilterBox && filter != MipFilterKaiser {
+		return nil, fmt.Errorf("unknown mip filter %v", filter)
+	}
+
+	result := NewFloatTexture(tex.Channels, tex.Width, tex.Height, tex.Depth, tex.Layers, levels)
+	result.CubeMap = tex.CubeMap
+	result.Metadata = tex.Metadata
+	copy(result.Level(0), tex.Level(0))
+
+	for lvl := 1; lvl < levels; lvl++ {
+		sw, sh, sd := result.Size(lvl - 1)
+		src := result.Level(lvl - 1)
+		dst := result.Level(lvl)
+		layerSize := sw * sh * sd * tex.Channels
+		for layer := 0; layer < tex.Layers; layer++ {
+			layerPix := src[layer*layerSize : (layer+1)*layerSize]
+			downsampled := downsampleVolume(layerPix, tex.Channels, sw, sh, sd, filter)
+			copy(dst[layer*len(downsampled):], downsampled)
+		}
+	}
+
+	return result, nil
+}
+
+// Halves each axis of the volume that is larger than 1
+func downsampleVolume(pix []float32, channels, width, height, depth int, filter MipFilter) []float32 {
+	pix, width = downsampleAxis(pix, channels, height*depth, width, 1, filter)
+	pix, height = downsampleAxis(pix, channels, depth, height, width, filter)
+	pix, _ = downsampleAxis(pix, channels, 1, depth, width*height, filter)
+	return pix
+}
+
+// Downsamples an axis of 'size' texels to half its size, the edges are clamped.
+// The pixels are laid out as [lines][size][stride] tuples, where stride covers the faster axes.
+func downsampleAxis(pix []float32, channels, lines, size, stride int, filter MipFilter) ([]float32, int) {
+	if size <= 1 {
+		return pix, size
+	}
+	weights := resampleWeights(size, size/2, filter.resampleFilter(), EdgeModeClamp)
+	return resampleAxis(pix, channels, lines, size, stride, weights), size / 2
+}
+
+func (filter MipFilter) resampleFilter() ResampleFilter {
+	if filter == MipFilterKaiser {
+		return ResampleFilterKaiser
+	}
+	return ResampleFilterBox
+}
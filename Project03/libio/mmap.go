@@ -0,0 +1,81 @@
+package libio
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// A MappedFile is a file mapped into memory. Decoders reading from its Reader reference the data of the file
+// instead of copying it, so their results are only valid until the file is closed.
+// Only blocks whose stored layout is their decoded layout are referenced, like the uncompressed pixels of
+// DecodeFloatImage, blocks which are converted are still read into new memory.
+// The mapping is private, changes to the data are never written back to the file.
+type MappedFile struct {
+	data  []byte
+	unmap func() error
+}
+
+// Maps the whole file into memory, on platforms without mmap the file is read instead
+func MapFile(name string) (*MappedFile, error) {
+	data, unmap, err := mapFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return &MappedFile{data: data, unmap: unmap}, nil
+}
+
+// Returns the contents of the file, valid until Close
+func (m *MappedFile) Bytes() []byte {
+	return m.data
+}
+
+// Returns a little endian reader over the contents of the file, whose reads of blocks are views into the mapping
+func (m *MappedFile) Reader() *BinaryReader {
+	return &BinaryReader{
+		Src:   &viewReader{data: m.data},
+		Order: binary.LittleEndian,
+	}
+}
+
+// Unmaps the file, the data returned by decoders must not be used afterwards
+func (m *MappedFile) Close() error {
+	if m.unmap == nil {
+		return nil
+	}
+	err := m.unmap()
+	m.data, m.unmap = nil, nil
+	return err
+}
+
+// A Viewer returns its next n bytes without copying them, BinaryReader.ReadView uses it when it is the source
+type Viewer interface {
+	View(n int) ([]byte, error)
+}
+
+type viewReader struct {
+	data []byte
+	off  int
+}
+
+func (r *viewReader) Read(p []byte) (n int, err error) {
+	if r.off >= len(r.data) {
+		return 0, io.EOF
+	}
+	n = copy(p, r.data[r.off:])
+	r.off += n
+	return n, nil
+}
+
+func (r *viewReader) View(n int) ([]byte, error) {
+	remaining := len(r.data) - r.off
+	if n > remaining {
+		r.off = len(r.data)
+		if remaining == 0 {
+			return nil, io.EOF
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+	p := r.data[r.off : r.off+n : r.off+n]
+	r.off += n
+	return p, nil
+}
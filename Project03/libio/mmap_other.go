@@ -0,0 +1,10 @@
+//go:build !unix
+
+package libio
+
+import "os"
+
+func mapFile(name string) (data []byte, unmap func() error, err error) {
+	data, err = os.ReadFile(name)
+	return data, nil, err
+}
@@ -0,0 +1,141 @@
+package libio_test
+
+import (
+	"advanced-gl/Project03/libio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFloatImageFile(tb testing.TB, img *libio.FloatImage, compression libio.FloatImageCompression) string {
+	buf := new(bytes.Buffer)
+	if err := libio.EncodeFloatImage(buf, img, compression); err != nil {
+		tb.Fatal(err)
+	}
+	name := filepath.Join(tb.TempDir(), "image.f32")
+	if err := os.WriteFile(name, buf.Bytes(), 0666); err != nil {
+		tb.Fatal(err)
+	}
+	return name
+}
+
+func TestMapFile(t *testing.T) {
+	img := randomHdrImage(3, 17, 9)
+	name := writeFloatImageFile(t, img, libio.FloatImageCompressionNone)
+
+	file, err := libio.MapFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	result, err := libio.DecodeFloatImage(file.Reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range img.Pix {
+		if result.Pix[i] != img.Pix[i] {
+			t.Fatalf("mapped float %d should be %g but was %g", i, img.Pix[i], result.Pix[i])
+		}
+	}
+
+	// the pixels are a view of the mapping, which is private
+	result.Pix[0] = 42
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data[len(data)-len(img.Pix)*4:len(data)-len(img.Pix)*4+4], []byte{0, 0, 0, 0}) {
+		t.Errorf("changes to the mapping should not be written to the file")
+	}
+}
+
+func TestReadSlice(t *testing.T) {
+	data := make([]byte, 1+3*4)
+	binary.LittleEndian.PutUint32(data[1:], 1)
+	binary.LittleEndian.PutUint32(data[5:], 0x01020304)
+	binary.LittleEndian.PutUint32(data[9:], 3)
+	name := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(name, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := libio.MapFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	readers := map[string]*libio.BinaryReader{
+		"mapped": file.Reader(),
+		"reader": {Src: bytes.NewReader(data), Order: binary.LittleEndian},
+	}
+	for kind, br := range readers {
+		// the elements are not aligned after the first byte
+		br.ReadBytes(1)
+		s, ok := libio.ReadSlice[uint32](br, 3)
+		if !ok || s[0] != 1 || s[1] != 0x01020304 || s[2] != 3 {
+			t.Errorf("%s should read the unaligned elements but read %v, %v", kind, s, br.Err)
+		}
+		if br.Index != len(data) {
+			t.Errorf("%s should be at byte %d but was at %d", kind, len(data), br.Index)
+		}
+		if _, ok := libio.ReadSlice[uint32](br, 1); ok || !errors.Is(br.Err, io.EOF) {
+			t.Errorf("%s should fail at the end of the data with io.EOF but got %v", kind, br.Err)
+		}
+	}
+}
+
+var benchmarkSink float32
+
+// Touches every pixel like an upload would, mapped pages are only read on access
+func sumPixels(img *libio.FloatImage) (sum float32) {
+	for _, v := range img.Pix {
+		sum += v
+	}
+	return sum
+}
+
+func benchmarkDecodeFloatImage(b *testing.B, mapped bool) {
+	name := writeFloatImageFile(b, randomHdrImage(4, 1024, 1024), libio.FloatImageCompressionNone)
+	b.SetBytes(4 * 4 * 1024 * 1024)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if mapped {
+			file, err := libio.MapFile(name)
+			if err != nil {
+				b.Fatal(err)
+			}
+			img, err := libio.DecodeFloatImage(file.Reader())
+			if err != nil {
+				b.Fatal(err)
+			}
+			benchmarkSink += sumPixels(img)
+			file.Close()
+		} else {
+			file, err := os.Open(name)
+			if err != nil {
+				b.Fatal(err)
+			}
+			img, err := libio.DecodeFloatImage(file)
+			if err != nil {
+				b.Fatal(err)
+			}
+			benchmarkSink += sumPixels(img)
+			file.Close()
+		}
+	}
+}
+
+func BenchmarkDecodeFloatImageReader(b *testing.B) {
+	benchmarkDecodeFloatImage(b, false)
+}
+
+func BenchmarkDecodeFloatImageMapped(b *testing.B) {
+	benchmarkDecodeFloatImage(b, true)
+}
@@ -0,0 +1,38 @@
+//go:build unix
+
+package libio
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+func mapFile(name string) (data []byte, unmap func() error, err error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the mapping stays valid after the file is closed
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	size := info.Size()
+	if size == 0 {
+		// mmap rejects empty mappings
+		return []byte{}, nil, nil
+	}
+	if int64(int(size)) != size {
+		return nil, nil, fmt.Errorf("file %q is too large to be mapped", name)
+	}
+
+	// copy-on-write, so decoders and callers can modify the data in place like a buffer that was read
+	data, err = syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not map file %q: %w", name, err)
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,408 @@
+package libio
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// The reconstruction filter of a resampling operation
+type ResampleFilter int
+
+const (
+	// Averages the covered texels, fast but blocky when upsampling and prone to aliasing
+	ResampleFilterBox = ResampleFilter(iota)
+	// Linear interpolation, bilinear filtering when upsampling
+	ResampleFilterTriangle
+	// Mitchell-Netravali cubic with B = C = 1/3, a good compromise between blurring and ringing
+	ResampleFilterMitchell
+	// Lanczos windowed sinc with 3 lobes, sharp with some ringing
+	ResampleFilterLanczos3
+	// Kaiser windowed sinc, sharp with less ringing than lanczos
+	ResampleFilterKaiser
+)
+
+func (filter ResampleFilter) String() string {
+	switch filter {
+	case ResampleFilterBox:
+		return "box"
+	case ResampleFilterTriangle:
+		return "triangle"
+	case ResampleFilterMitchell:
+		return "mitchell"
+	case ResampleFilterLanczos3:
+		return "lanczos3"
+	case ResampleFilterKaiser:
+		return "kaiser"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(filter))
+	}
+}
+
+func ParseResampleFilter(name string) (ResampleFilter, error) {
+	for filter := ResampleFilterBox; filter <= ResampleFilterKaiser; filter++ {
+		if strings.EqualFold(name, filter.String()) {
+			return filter, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown resample filter %q", name)
+}
+
+// Returns the radius of the filter, in destination texels
+func (filter ResampleFilter) support() float64 {
+	switch filter {
+	case ResampleFilterTriangle:
+		return 1
+	case ResampleFilterMitchell:
+		return 2
+	case ResampleFilterLanczos3:
+		return 3
+	case ResampleFilterKaiser:
+		return kaiserRadius
+	default:
+		return 0.5
+	}
+}
+
+func (filter ResampleFilter) eval(t float64) float64 {
+	switch filter {
+	case ResampleFilterTriangle:
+		return triangle(t)
+	case ResampleFilterMitchell:
+		return mitchell(t)
+	case ResampleFilterLanczos3:
+		return lanczos3(t)
+	case ResampleFilterKaiser:
+		return kaiser(t)
+	default:
+		return box(t)
+	}
+}
+
+// How texels outside of the image are addressed
+type EdgeMode int
+
+const (
+	// Repeats the texels at the edges
+	EdgeModeClamp = EdgeMode(iota)
+	// Continues at the opposite edge, for tiling textures
+	EdgeModeWrap
+	// Reflects the image at its edges, the edge texels are repeated once
+	EdgeModeMirror
+)
+
+func (mode EdgeMode) String() string {
+	switch mode {
+	case EdgeModeClamp:
+		return "clamp"
+	case EdgeModeWrap:
+		return "wrap"
+	case EdgeModeMirror:
+		return "mirror"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(mode))
+	}
+}
+
+func ParseEdgeMode(name string) (EdgeMode, error) {
+	for mode := EdgeModeClamp; mode <= EdgeModeMirror; mode++ {
+		if strings.EqualFold(name, mode.String()) {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown edge mode %q", name)
+}
+
+// Maps an index outside of [0, size) into it
+func (mode EdgeMode) address(index, size int) int {
+	if index >= 0 && index < size {
+		return index
+	}
+	switch mode {
+	case EdgeModeWrap:
+		index %= size
+		if index < 0 {
+			index += size
+		}
+		return index
+	case EdgeModeMirror:
+		index %= 2 * size
+		if index < 0 {
+			index += 2 * size
+		}
+		if index >= size {
+			index = 2*size - 1 - index
+		}
+		return index
+	default:
+		if index < 0 {
+			return 0
+		}
+		return size - 1
+	}
+}
+
+// How the alpha channel of images with 4 channels is treated
+type AlphaMode int
+
+const (
+	// Every channel is filtered on its own
+	AlphaModeNone = AlphaMode(iota)
+	// The colors are premultiplied with alpha for filtering, so transparent texels do not bleed into opaque ones
+	AlphaModeStraight
+	// The colors are premultiplied already and are filtered as they are
+	AlphaModePremultiplied
+)
+
+type ResampleOptions struct {
+	Filter ResampleFilter
+	Edge   EdgeMode
+	Alpha  AlphaMode
+}
+
+// Returns a copy of the image resampled to width x height.
+// Colors encoded with the sRGB transfer function are filtered in linear space, the result keeps the color space of img.
+func (img *FloatImage) Resample(width, height int, opts ResampleOptions) (*FloatImage, error) {
+	pix := make([]float32, len(img.Pix))
+	copy(pix, img.Pix)
+
+	pix, err := resampleImage(pix, &img.image, width, height, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := NewFloatImage(pix, img.Channels, width, height)
+	result.ColorSpace = img.ColorSpace
+	result.Metadata = img.Metadata
+	return result, nil
+}
+
+// Returns a copy of the image resampled to width x height.
+// Colors encoded with the sRGB transfer function are filtered in linear space, the result keeps the color space of img.
+func (img *IntImage) Resample(width, height int, opts ResampleOptions) (*IntImage, error) {
+	pix := make([]float32, len(img.Pix))
+	for i, v := range img.Pix {
+		pix[i] = float32(v) / 0xff
+	}
+	if img.ColorSpace.IsSrgbEncoded() && img.Channels >= 3 {
+		for i := 0; i < len(pix); i += img.Channels {
+			for ch := 0; ch < 3; ch++ {
+				pix[i+ch] = srgbToLinearTable[img.Pix[i+ch]]
+			}
+		}
+	}
+
+	// the transfer function is handled here with the lookup table
+	shape := img.image
+	shape.ColorSpace = shape.ColorSpace.Linear()
+	pix, err := resampleImage(pix, &shape, width, height, opts)
+	if err != nil {
+		return nil, err
+	}
+	if img.ColorSpace.IsSrgbEncoded() && img.Channels >= 3 {
+		encodeSrgb(pix, img.Channels)
+	}
+
+	result := NewIntImage(make([]uint8, len(pix)), img.Channels, width, height)
+	result.ColorSpace = img.ColorSpace
+	for i, v := range pix {
+		result.Pix[i] = quantizeUnorm8(v)
+	}
+	return result, nil
+}
+
+// Resamples the pixels of an image with the shape src, pix is modified
+func resampleImage(pix []float32, src *image, width, height int, opts ResampleOptions) ([]float32, error) {
+	if width < 1 || height < 1 {
+		return nil, fmt.Errorf("invalid resample size %dx%d", width, height)
+	}
+	if opts.Filter < ResampleFilterBox || opts.Filter > ResampleFilterKaiser {
+		return nil, fmt.Errorf("unknown resample filter %v", opts.Filter)
+	}
+	channels := src.Channels
+	srgb := src.ColorSpace.IsSrgbEncoded() && channels >= 3
+	alpha := opts.Alpha != AlphaModeNone && channels == 4
+
+	if srgb {
+		for i := 0; i < len(pix); i += channels {
+			for ch := 0; ch < 3; ch++ {
+				pix[i+ch] = SrgbToLinear(pix[i+ch])
+			}
+		}
+	}
+	if alpha && opts.Alpha == AlphaModeStraight {
+		for i := 0; i < len(pix); i += 4 {
+			pix[i+0] *= pix[i+3]
+			pix[i+1] *= pix[i+3]
+			pix[i+2] *= pix[i+3]
+		}
+	}
+
+	pix = resampleAxis(pix, channels, src.Height, src.Width, 1, resampleWeights(src.Width, width, opts.Filter, opts.Edge))
+	pix = resampleAxis(pix, channels, 1, src.Height, width, resampleWeights(src.Height, height, opts.Filter, opts.Edge))
+
+	if alpha && opts.Alpha == AlphaModeStraight {
+		for i := 0; i < len(pix); i += 4 {
+			a := pix[i+3]
+			if a <= 1e-6 {
+				pix[i+0], pix[i+1], pix[i+2] = 0, 0, 0
+				continue
+			}
+			pix[i+0] /= a
+			pix[i+1] /= a
+			pix[i+2] /= a
+		}
+	}
+	if srgb {
+		encodeSrgb(pix, channels)
+	}
+	return pix, nil
+}
+
+func encodeSrgb(pix []float32, channels int) {
+	for i := 0; i < len(pix); i += channels {
+		for ch := 0; ch < 3; ch++ {
+			v := pix[i+ch]
+			if v < 0 {
+				// negative lobes of the filters
+				v = 0
+			}
+			pix[i+ch] = LinearToSrgb(v)
+		}
+	}
+}
+
+// Resamples an axis of 'size' texels to len(weights) texels.
+// The pixels are laid out as [lines][size][stride] tuples, where stride covers the faster axes.
+func resampleAxis(pix []float32, channels, lines, size, stride int, weights [][]filterTap) []float32 {
+	newSize := len(weights)
+	result := make([]float32, lines*newSize*stride*channels)
+
+	for line := 0; line < lines; line++ {
+		for k, taps := range weights {
+			dst := (line*newSize + k) * stride * channels
+			for _, tap := range taps {
+				src := (line*size + tap.index) * stride * channels
+				for i := 0; i < stride*channels; i++ {
+					result[dst+i] += pix[src+i] * tap.weight
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+type filterTap struct {
+	index  int
+	weight float32
+}
+
+// Calculates the normalized taps for each destination texel.
+// When downsampling the filter is stretched over the source texels, when upsampling it interpolates between them.
+func resampleWeights(size, newSize int, filter ResampleFilter, edge EdgeMode) [][]filterTap {
+	scale := float64(size) / float64(newSize)
+	filterScale := scale
+	if filterScale < 1 {
+		filterScale = 1
+	}
+	support := filter.support()
+
+	weights := make([][]filterTap, newSize)
+	for i := range weights {
+		center := (float64(i) + 0.5) * scale
+		lo := int(math.Floor(center - support*filterScale))
+		hi := int(math.Ceil(center + support*filterScale))
+
+		taps := []filterTap{}
+		var sum float64
+		for j := lo; j <= hi; j++ {
+			t := (float64(j) + 0.5 - center) / filterScale
+			w := filter.eval(t)
+			if w == 0 {
+				continue
+			}
+			taps = append(taps, filterTap{index: edge.address(j, size), weight: float32(w)})
+			sum += w
+		}
+		for k := range taps {
+			taps[k].weight = float32(float64(taps[k].weight) / sum)
+		}
+		weights[i] = taps
+	}
+	return weights
+}
+
+// The radius and shape of the kaiser filter, in destination texels
+const (
+	kaiserRadius = 3.0
+	kaiserAlpha  = 4.0
+)
+
+func box(t float64) float64 {
+	t = math.Abs(t)
+	if t < 0.5 {
+		return 1
+	}
+	if t == 0.5 {
+		// the texel is split between two destination texels
+		return 0.5
+	}
+	return 0
+}
+
+func triangle(t float64) float64 {
+	t = math.Abs(t)
+	if t >= 1 {
+		return 0
+	}
+	return 1 - t
+}
+
+func mitchell(t float64) float64 {
+	const b, c = 1.0 / 3, 1.0 / 3
+	t = math.Abs(t)
+	if t < 1 {
+		return ((12-9*b-6*c)*t*t*t + (-18+12*b+6*c)*t*t + (6 - 2*b)) / 6
+	}
+	if t < 2 {
+		return ((-b-6*c)*t*t*t + (6*b+30*c)*t*t + (-12*b-48*c)*t + (8*b + 24*c)) / 6
+	}
+	return 0
+}
+
+func lanczos3(t float64) float64 {
+	if math.Abs(t) >= 3 {
+		return 0
+	}
+	return sinc(t) * sinc(t/3)
+}
+
+func kaiser(t float64) float64 {
+	if math.Abs(t) >= kaiserRadius {
+		return 0
+	}
+	x := t / kaiserRadius
+	return sinc(t) * besselI0(kaiserAlpha*math.Sqrt(1-x*x)) / besselI0(kaiserAlpha)
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	x *= math.Pi
+	return math.Sin(x) / x
+}
+
+// The zeroth order modified bessel function of the first kind
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; k < 32; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+		if term < sum*1e-12 {
+			break
+		}
+	}
+	return sum
+}
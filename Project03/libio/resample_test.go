@@ -0,0 +1,119 @@
+package libio_test
+
+import (
+	"advanced-gl/Project03/libio"
+	"testing"
+
+	"github.com/chewxy/math32"
+)
+
+var resampleFilters = []libio.ResampleFilter{
+	libio.ResampleFilterBox,
+	libio.ResampleFilterTriangle,
+	libio.ResampleFilterMitchell,
+	libio.ResampleFilterLanczos3,
+	libio.ResampleFilterKaiser,
+}
+
+func TestResampleConstant(t *testing.T) {
+	img := libio.NewFloatImage(make([]float32, 7*5*2), 2, 7, 5)
+	for i := range img.Pix {
+		img.Pix[i] = float32(i%2) + 0.25
+	}
+
+	sizes := [][2]int{{3, 2}, {7, 5}, {16, 11}, {1, 1}}
+	for _, filter := range resampleFilters {
+		for edge := libio.EdgeModeClamp; edge <= libio.EdgeModeMirror; edge++ {
+			for _, size := range sizes {
+				result, err := img.Resample(size[0], size[1], libio.ResampleOptions{Filter: filter, Edge: edge})
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i, v := range result.Pix {
+					if math32.Abs(v-(float32(i%2)+0.25)) > 1e-5 {
+						t.Fatalf("%v with %v edges should keep a constant image constant at %dx%d but had %g", filter, edge, size[0], size[1], v)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestResampleIdentity(t *testing.T) {
+	img := libio.NewFloatImage(make([]float32, 3*6*4), 3, 6, 4)
+	for i := range img.Pix {
+		img.Pix[i] = float32(i*7%11) / 10
+	}
+	// filters which are 1 at 0 and 0 at every other integer interpolate the texels
+	for _, filter := range []libio.ResampleFilter{libio.ResampleFilterBox, libio.ResampleFilterTriangle, libio.ResampleFilterLanczos3, libio.ResampleFilterKaiser} {
+		result, err := img.Resample(img.Width, img.Height, libio.ResampleOptions{Filter: filter})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, v := range result.Pix {
+			if math32.Abs(v-img.Pix[i]) > 1e-5 {
+				t.Fatalf("%v should not change an image resampled to its own size but texel value %d was %g instead of %g", filter, i, v, img.Pix[i])
+			}
+		}
+	}
+}
+
+func TestResampleEdgeModes(t *testing.T) {
+	img := libio.NewFloatImage([]float32{0, 0, 0, 1}, 1, 4, 1)
+	expected := map[libio.EdgeMode]float32{
+		libio.EdgeModeClamp:  0,
+		libio.EdgeModeWrap:   0.125,
+		libio.EdgeModeMirror: 0,
+	}
+	for edge, value := range expected {
+		result, err := img.Resample(2, 1, libio.ResampleOptions{Filter: libio.ResampleFilterTriangle, Edge: edge})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// only wrapping reaches the last texel from the left edge
+		if math32.Abs(result.Pix[0]-value) > 1e-6 {
+			t.Errorf("the first texel with %v edges should be %g but was %g", edge, value, result.Pix[0])
+		}
+	}
+}
+
+func TestResampleSrgb(t *testing.T) {
+	img := libio.NewIntImage([]uint8{0, 0, 0, 255, 255, 255}, 3, 2, 1)
+	result, err := img.Resample(1, 1, libio.ResampleOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Pix[0] != 128 {
+		t.Errorf("data should be averaged as it is to 128 but was %d", result.Pix[0])
+	}
+
+	img.ColorSpace = libio.ColorSpaceSrgb
+	result, err = img.Resample(1, 1, libio.ResampleOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Pix[0] != 188 || result.ColorSpace != libio.ColorSpaceSrgb {
+		t.Errorf("srgb colors should be averaged in linear space to 188 and stay srgb but were %d and %v", result.Pix[0], result.ColorSpace)
+	}
+}
+
+func TestResampleAlpha(t *testing.T) {
+	// an opaque red texel next to a transparent green one
+	img := libio.NewIntImage([]uint8{255, 0, 0, 255, 0, 255, 0, 0}, 4, 2, 1)
+
+	result, err := img.Resample(1, 1, libio.ResampleOptions{Alpha: libio.AlphaModeStraight})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Pix[0] != 255 || result.Pix[1] != 0 || result.Pix[3] != 128 {
+		t.Errorf("the transparent texel should not bleed into the result but was %v", result.Pix)
+	}
+
+	result, err = img.Resample(1, 1, libio.ResampleOptions{Alpha: libio.AlphaModeNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Pix[0] != 128 || result.Pix[1] != 128 {
+		t.Errorf("every channel should be averaged on its own but was %v", result.Pix)
+	}
+}
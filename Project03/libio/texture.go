@@ -0,0 +1,204 @@
+package libio
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// The shape of a texture with mip levels, array layers and depth.
+// Each level stores its layers one after another, each layer stores its depth slices one after another.
+// The depth is halved with every level, the layers are not.
+type texture struct {
+	Channels      int
+	Width, Height int
+	// 1 for 2D textures
+	Depth int
+	// 1 for textures that are not arrays, a multiple of 6 for cube maps
+	Layers  int
+	Levels  int
+	CubeMap bool
+	// the start of each level and the end of the last one, in tuples
+	offsets []int
+}
+
+func newTexture(channels, width, height, depth, layers, levels int) texture {
+	tex := texture{
+		Channels: channels,
+		Width:    width,
+		Height:   height,
+		Depth:    depth,
+		Layers:   layers,
+		Levels:   levels,
+		offsets:  make([]int, levels+1),
+	}
+	for lvl := 0; lvl < levels; lvl++ {
+		w, h, d := tex.Size(lvl)
+		tex.offsets[lvl+1] = tex.offsets[lvl] + w*h*d*layers
+	}
+	return tex
+}
+
+// Returns the number of levels of a complete mip chain
+func MaxMipLevels(width, height, depth int) int {
+	if width < 1 || height < 1 || depth < 1 {
+		return 0
+	}
+	size := width
+	if height > size {
+		size = height
+	}
+	if depth > size {
+		size = depth
+	}
+	return bits.Len(uint(size))
+}
+
+// Returns the size of the level
+func (tex *texture) Size(level int) (width, height, depth int) {
+	width, height, depth = tex.Width>>level, tex.Height>>level, tex.Depth>>level
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	if depth < 1 {
+		depth = 1
+	}
+	return
+}
+
+// Calculates the tuple index into the levels data.
+//
+// Note that the origin (0,0) is in the bottom left, as opposed to Go's top left origin
+func (tex *texture) Index(level, x, y, z, layer int) int {
+	w, h, d := tex.Size(level)
+	return (x + y*w + z*w*h + layer*w*h*d) * tex.Channels
+}
+
+// Returns the number of tuples of all levels
+func (tex *texture) Count() int {
+	return tex.offsets[tex.Levels]
+}
+
+func (tex *texture) validate() error {
+	if tex.Channels < 1 || tex.Width < 1 || tex.Height < 1 || tex.Depth < 1 || tex.Layers < 1 || tex.Levels < 1 {
+		return fmt.Errorf("invalid texture size %dx%dx%d, %d layers, %d levels, %d channels", tex.Width, tex.Height, tex.Depth, tex.Layers, tex.Levels, tex.Channels)
+	}
+	if tex.Levels > MaxMipLevels(tex.Width, tex.Height, tex.Depth) {
+		return fmt.Errorf("a %dx%dx%d texture cannot have %d levels", tex.Width, tex.Height, tex.Depth, tex.Levels)
+	}
+	if tex.CubeMap && (tex.Width != tex.Height || tex.Depth != 1 || tex.Layers%6 != 0) {
+		return fmt.Errorf("a %dx%dx%d texture with %d layers cannot be a cube map", tex.Width, tex.Height, tex.Depth, tex.Layers)
+	}
+	return nil
+}
+
+// A FloatTexture holds the mip levels, array layers and depth slices of a texture
+type FloatTexture struct {
+	texture
+	// all levels, starting with the base level
+	Pix      []float32
+	Metadata FloatImageMetadata
+}
+
+func NewFloatTexture(channels, width, height, depth, layers, levels int) *FloatTexture {
+	tex := &FloatTexture{
+		texture: newTexture(channels, width, height, depth, layers, levels),
+	}
+	tex.Pix = make([]float32, tex.Count()*channels)
+	return tex
+}
+
+// Creates a single level 2D texture that shares the pixels of img
+// The color space of img is stored in the metadata, unless the metadata names one already.
+func FloatTextureFromImage(img *FloatImage) *FloatTexture {
+	tex := &FloatTexture{
+		texture:  newTexture(img.Channels, img.Width, img.Height, 1, 1, 1),
+		Pix:      img.Pix,
+		Metadata: img.Metadata,
+	}
+	if tex.Metadata.ColorSpace == "" && img.ColorSpace != ColorSpaceUnknown {
+		tex.Metadata.ColorSpace = img.ColorSpace.String()
+	}
+	return tex
+}
+
+// Returns the pixels of all layers and slices of the level
+func (tex *FloatTexture) Level(level int) []float32 {
+	return tex.Pix[tex.offsets[level]*tex.Channels : tex.offsets[level+1]*tex.Channels]
+}
+
+// Returns a 2D image which shares the pixels of the depth slice z of a layer in the level
+func (tex *FloatTexture) Image(level, layer, z int) *FloatImage {
+	w, h, _ := tex.Size(level)
+	start := tex.offsets[level]*tex.Channels + tex.Index(level, 0, 0, z, layer)
+	img := NewFloatImage(tex.Pix[start:start+w*h*tex.Channels], tex.Channels, w, h)
+	img.Metadata = tex.Metadata
+	img.ColorSpace = colorSpaceFromMetadata(tex.Metadata)
+	return img
+}
+
+// An IntTexture holds the mip levels, array layers and depth slices of an 8 bit texture
+type IntTexture struct {
+	texture
+	// all levels, starting with the base level
+	Pix []uint8
+}
+
+func NewIntTexture(channels, width, height, depth, layers, levels int) *IntTexture {
+	tex := &IntTexture{
+		texture: newTexture(channels, width, height, depth, layers, levels),
+	}
+	tex.Pix = make([]uint8, tex.Count()*channels)
+	return tex
+}
+
+// Creates a single level 2D texture that shares the pixels of img
+func IntTextureFromImage(img *IntImage) *IntTexture {
+	return &IntTexture{
+		texture: newTexture(img.Channels, img.Width, img.Height, 1, 1, 1),
+		Pix:     img.Pix,
+	}
+}
+
+// Returns the pixels of all layers and slices of the level
+func (tex *IntTexture) Level(level int) []uint8 {
+	return tex.Pix[tex.offsets[level]*tex.Channels : tex.offsets[level+1]*tex.Channels]
+}
+
+// Returns a 2D image which shares the pixels of the depth slice z of a layer in the level
+func (tex *IntTexture) Image(level, layer, z int) *IntImage {
+	w, h, _ := tex.Size(level)
+	start := tex.offsets[level]*tex.Channels + tex.Index(level, 0, 0, z, layer)
+	return NewIntImage(tex.Pix[start:start+w*h*tex.Channels], tex.Channels, w, h)
+}
+
+// Converts the texture to floats in the range [0, 1]
+func (tex *IntTexture) ToFloatTexture() *FloatTexture {
+	result := &FloatTexture{
+		texture: tex.texture,
+		Pix:     make([]float32, len(tex.Pix)),
+	}
+	for i, v := range tex.Pix {
+		result.Pix[i] = float32(v) / 0xff
+	}
+	return result
+}
+
+// Converts the texture to 8 bit, clamping the values to [0, 1]
+func (tex *FloatTexture) ToIntTexture() *IntTexture {
+	result := &IntTexture{
+		texture: tex.texture,
+		Pix:     make([]uint8, len(tex.Pix)),
+	}
+	for i, v := range tex.Pix {
+		if v < 0 {
+			v = 0
+		} else if v > 1 {
+			v = 1
+		}
+		result.Pix[i] = uint8(v*0xff + 0.5)
+	}
+	return result
+}
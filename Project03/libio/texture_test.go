@@ -0,0 +1,153 @@
+package libio_test
+
+import (
+	"advanced-gl/Project03/libio"
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/chewxy/math32"
+)
+
+func TestMaxMipLevels(t *testing.T) {
+	tests := [][4]int{
+		{1, 1, 1, 1},
+		{256, 256, 1, 9},
+		{300, 20, 1, 9},
+		{4, 4, 64, 7},
+		{0, 4, 1, 0},
+	}
+	for _, test := range tests {
+		levels := libio.MaxMipLevels(test[0], test[1], test[2])
+		if levels != test[3] {
+			t.Errorf("a %dx%dx%d texture should have %d levels but has %d", test[0], test[1], test[2], test[3], levels)
+		}
+	}
+}
+
+func TestFloatTextureLayout(t *testing.T) {
+	tex := libio.NewFloatTexture(2, 8, 4, 2, 3, 4)
+
+	expected := [][3]int{{8, 4, 2}, {4, 2, 1}, {2, 1, 1}, {1, 1, 1}}
+	total := 0
+	for lvl, size := range expected {
+		w, h, d := tex.Size(lvl)
+		if w != size[0] || h != size[1] || d != size[2] {
+			t.Errorf("level %d should be %dx%dx%d but was %dx%dx%d", lvl, size[0], size[1], size[2], w, h, d)
+		}
+		if len(tex.Level(lvl)) != w*h*d*3*2 {
+			t.Errorf("level %d should have %d floats but has %d", lvl, w*h*d*3*2, len(tex.Level(lvl)))
+		}
+		total += w * h * d * 3
+	}
+	if tex.Count() != total || len(tex.Pix) != total*2 {
+		t.Errorf("texture should have %d tuples but has %d", total, tex.Count())
+	}
+
+	// the images share the pixels of the texture
+	img := tex.Image(1, 2, 0)
+	img.Pix[img.Index(3, 1)+1] = 42
+	if tex.Level(1)[tex.Index(1, 3, 1, 0, 2)+1] != 42 {
+		t.Errorf("image does not share the texture pixels")
+	}
+}
+
+func TestFloatTextureRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	tex := libio.NewFloatTexture(3, 16, 16, 1, 6, 5)
+	tex.CubeMap = true
+	tex.Metadata.Semantic = "environment"
+	for i := range tex.Pix {
+		tex.Pix[i] = rng.Float32() * 100
+	}
+
+	buf := new(bytes.Buffer)
+	err := libio.EncodeFloatTexture(buf, tex, libio.FloatImageCompressionShuffleLz4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := libio.DecodeFloatTexture(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Width != 16 || result.Height != 16 || result.Depth != 1 || result.Layers != 6 || result.Levels != 5 || !result.CubeMap {
+		t.Fatalf("decoded texture has the wrong shape: %+v", result)
+	}
+	if result.Metadata != tex.Metadata {
+		t.Errorf("metadata should be %+v but was %+v", tex.Metadata, result.Metadata)
+	}
+	for i := range tex.Pix {
+		if result.Pix[i] != tex.Pix[i] {
+			t.Fatalf("decoded float %d should be %g but was %g", i, tex.Pix[i], result.Pix[i])
+		}
+	}
+
+	buf.Reset()
+	libio.EncodeFloatTexture(buf, tex, libio.FloatImageCompressionNone)
+	if _, err := libio.DecodeFloatImage(buf); err == nil {
+		t.Errorf("decoding a texture with levels as an image should fail")
+	}
+}
+
+func TestGenerateMipsBox(t *testing.T) {
+	tex := libio.NewFloatTexture(1, 4, 2, 2, 1, 1)
+	for i := range tex.Pix {
+		tex.Pix[i] = float32(i)
+	}
+
+	result, err := libio.GenerateMips(tex, 0, libio.MipFilterBox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Levels != 3 {
+		t.Fatalf("texture should have 3 levels but has %d", result.Levels)
+	}
+
+	// level 1 is 2x1x1, each texel averages a 2x2x2 block
+	level1 := result.Level(1)
+	expected := []float32{(0 + 1 + 4 + 5 + 8 + 9 + 12 + 13) / 8.0, (2 + 3 + 6 + 7 + 10 + 11 + 14 + 15) / 8.0}
+	for i, v := range expected {
+		if math32.Abs(level1[i]-v) > 1e-5 {
+			t.Errorf("level 1 texel %d should be %g but was %g", i, v, level1[i])
+		}
+	}
+	if math32.Abs(result.Level(2)[0]-7.5) > 1e-5 {
+		t.Errorf("level 2 should be 7.5 but was %g", result.Level(2)[0])
+	}
+}
+
+func TestGenerateMipsKaiser(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	tex := libio.NewFloatTexture(2, 32, 16, 1, 2, 1)
+	for i := 0; i < tex.Count(); i++ {
+		// a constant first channel and a noisy second one
+		tex.Pix[i*2+0] = 0.25
+		tex.Pix[i*2+1] = rng.Float32()
+	}
+
+	result, err := libio.GenerateMips(tex, 4, libio.MipFilterKaiser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for lvl := 1; lvl < result.Levels; lvl++ {
+		level := result.Level(lvl)
+		var mean float32
+		for i := 0; i < len(level)/2; i++ {
+			if math32.Abs(level[i*2]-0.25) > 1e-5 {
+				t.Fatalf("level %d texel %d of a constant channel should be 0.25 but was %g", lvl, i, level[i*2])
+			}
+			mean += level[i*2+1]
+		}
+		mean /= float32(len(level) / 2)
+		if math32.Abs(mean-0.5) > 0.05 {
+			t.Errorf("level %d mean should be about 0.5 but was %g", lvl, mean)
+		}
+	}
+
+	if _, err := libio.GenerateMips(tex, 7, libio.MipFilterKaiser); err == nil {
+		t.Errorf("a 32x16 texture should not have 7 levels")
+	}
+}
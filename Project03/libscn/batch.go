@@ -5,31 +5,56 @@ import (
 	"log"
 	"unsafe"
 
+	"github.com/chewxy/math32"
+
 	"github.com/go-gl/gl/v4.5-core/gl"
 	"github.com/go-gl/mathgl/mgl32"
 )
 
 type RenderBatch struct {
-	VertexArray        libgl.UnboundVertexArray
-	AttributesBuffer   libgl.UnboundBuffer
+	Layout           VertexLayout
+	VertexArray      libgl.UnboundVertexArray
+	AttributesBuffer libgl.UnboundBuffer
+	// The VertexQuantization of the mesh of each instance, only used by VertexLayoutCompact
+	QuantizationBuffer libgl.UnboundBuffer
 	VertexBuffer       libgl.UnboundBuffer
 	ElementBuffer      libgl.UnboundBuffer
 	CommandBuffer      libgl.UnboundBuffer
 	TotatCommandRange  [2]int
-	materials          []MaterialSlice
-	materialIndex      map[string]int
-	meshLocations      []MeshLocation
-	meshIndex          map[string]int
-	attributesPosition int
-	vertexPosition     int
-	elementPosition    int
-	commands           []DrawElementsIndirectCommand
+	instanceSet
+	materialIndex   map[string]int
+	meshLocations   []MeshLocation
+	meshIndex       map[string]int
+	vertexPosition  int
+	elementPosition int
+	// The contents of AttributesBuffer and QuantizationBuffer by slot, the slots of removed instances are reused
+	attributes      []InstanceAttributes
+	quantizations   []VertexQuantization
+	attributesDirty dirtyRange
+	// The contents of CommandBuffer
+	commands      []DrawElementsIndirectCommand
+	commandsDirty dirtyRange
+	cullInstances []CullInstance
 }
 
 type MeshLocation struct {
-	BaseVertex int32
-	BaseIndex  uint32
-	Indices    uint32
+	BaseVertex   int32
+	BaseIndex    uint32
+	Indices      uint32
+	Quantization VertexQuantization
+	// The coarser levels of detail in the element buffer
+	Lods []LodLocation
+	// The bounds of the mesh in model space
+	Bounds AABB
+	Sphere Sphere
+	// The largest dimension of the bounds, the errors of the levels of detail are relative to it
+	Extent float32
+}
+
+type LodLocation struct {
+	BaseIndex uint32
+	Indices   uint32
+	Error     float32
 }
 
 type MaterialSlice struct {
@@ -44,8 +69,18 @@ type InstanceAttributes struct {
 }
 
 type MeshInstance struct {
-	MeshIndex      int
+	Handle    InstanceHandle
+	MeshIndex int
+	// The slot of the attributes in AttributesBuffer, the base instance of the command
 	AttributeIndex int
+	Attributes     InstanceAttributes
+	// The world space bounds of the mesh, derived from the model matrix
+	Bounds AABB
+	Sphere Sphere
+	// 0 is the mesh itself and i the level of detail i-1, see SelectLods
+	Lod int
+	// Outside of the view frustum, see CullInstances
+	Culled bool
 }
 
 type DrawElementsIndirectCommand struct {
@@ -56,9 +91,32 @@ type DrawElementsIndirectCommand struct {
 	BaseInstance  uint32
 }
 
+// The format of the vertices in the vertex buffer of a RenderBatch
+type VertexLayout int
+
+const (
+	// Vertex
+	VertexLayoutFloat VertexLayout = iota
+	// CompactVertex, the vertex shader has to be compiled with COMPACT_VERTICES like the pbr_compact pipeline
+	VertexLayoutCompact
+)
+
+func (layout VertexLayout) VertexSize() int {
+	if layout == VertexLayoutCompact {
+		return CompactVertexSize
+	}
+	return VertexSize
+}
+
 func NewRenderBatch() *RenderBatch {
+	return NewRenderBatchWithLayout(VertexLayoutFloat)
+}
+
+func NewRenderBatchWithLayout(layout VertexLayout) *RenderBatch {
+	vertexSize := layout.VertexSize()
 	vertices := libgl.NewBuffer()
-	vertices.AllocateEmpty(8*1_000_000*VertexSize, gl.DYNAMIC_STORAGE_BIT)
+	// mapped by Upload for meshes with VertexStreams
+	vertices.AllocateEmpty(8*1_000_000*vertexSize, gl.DYNAMIC_STORAGE_BIT|gl.MAP_WRITE_BIT)
 
 	elements := libgl.NewBuffer()
 	elements.AllocateEmpty(8*1_000_000*ElementIndexSize, gl.DYNAMIC_STORAGE_BIT)
@@ -67,19 +125,36 @@ func NewRenderBatch() *RenderBatch {
 	attributes.AllocateEmpty(InstanceAttributesSize*1024, gl.DYNAMIC_STORAGE_BIT)
 
 	vao := libgl.NewVertexArray()
-	vao.Layout(0, 0, 3, gl.FLOAT, false, int(unsafe.Offsetof(Vertex{}.Position)))
-	vao.Layout(0, 1, 2, gl.FLOAT, false, int(unsafe.Offsetof(Vertex{}.Uv)))
-	vao.Layout(0, 2, 3, gl.FLOAT, false, int(unsafe.Offsetof(Vertex{}.Normal)))
-	vao.Layout(0, 3, 3, gl.FLOAT, false, int(unsafe.Offsetof(Vertex{}.Bitangent)))
-	vao.Layout(0, 4, 3, gl.FLOAT, false, int(unsafe.Offsetof(Vertex{}.Tangent)))
-
-	vao.Layout(1, 5, 4, gl.FLOAT, false, 0*int(unsafe.Sizeof(mgl32.Vec4{})))
-	vao.Layout(1, 6, 4, gl.FLOAT, false, 1*int(unsafe.Sizeof(mgl32.Vec4{})))
-	vao.Layout(1, 7, 4, gl.FLOAT, false, 2*int(unsafe.Sizeof(mgl32.Vec4{})))
-	vao.Layout(1, 8, 4, gl.FLOAT, false, 3*int(unsafe.Sizeof(mgl32.Vec4{})))
+	var quantizations libgl.UnboundBuffer
+	switch layout {
+	case VertexLayoutFloat:
+		vao.Layout(0, 0, 3, gl.FLOAT, false, int(unsafe.Offsetof(Vertex{}.Position)))
+		vao.Layout(0, 1, 2, gl.FLOAT, false, int(unsafe.Offsetof(Vertex{}.Uv)))
+		vao.Layout(0, 2, 3, gl.FLOAT, false, int(unsafe.Offsetof(Vertex{}.Normal)))
+		vao.Layout(0, 3, 4, gl.FLOAT, false, int(unsafe.Offsetof(Vertex{}.Tangent)))
+	case VertexLayoutCompact:
+		vao.Layout(0, 0, 4, gl.SHORT, true, int(unsafe.Offsetof(CompactVertex{}.Position)))
+		vao.Layout(0, 1, 2, gl.HALF_FLOAT, false, int(unsafe.Offsetof(CompactVertex{}.Uv)))
+		vao.Layout(0, 2, 2, gl.SHORT, true, int(unsafe.Offsetof(CompactVertex{}.Normal)))
+		vao.Layout(0, 3, 2, gl.SHORT, true, int(unsafe.Offsetof(CompactVertex{}.Tangent)))
+
+		quantizations = libgl.NewBuffer()
+		quantizations.AllocateEmpty(VertexQuantizationSize*1024, gl.DYNAMIC_STORAGE_BIT)
+		vao.Layout(2, 8, 3, gl.FLOAT, false, int(unsafe.Offsetof(VertexQuantization{}.Offset)))
+		vao.Layout(2, 9, 3, gl.FLOAT, false, int(unsafe.Offsetof(VertexQuantization{}.Scale)))
+		vao.AttribDivisor(2, 1)
+		vao.BindBuffer(2, quantizations, 0, VertexQuantizationSize)
+	default:
+		log.Panicf("Unknown vertex layout %d", layout)
+	}
+
+	vao.Layout(1, 4, 4, gl.FLOAT, false, 0*int(unsafe.Sizeof(mgl32.Vec4{})))
+	vao.Layout(1, 5, 4, gl.FLOAT, false, 1*int(unsafe.Sizeof(mgl32.Vec4{})))
+	vao.Layout(1, 6, 4, gl.FLOAT, false, 2*int(unsafe.Sizeof(mgl32.Vec4{})))
+	vao.Layout(1, 7, 4, gl.FLOAT, false, 3*int(unsafe.Sizeof(mgl32.Vec4{})))
 	vao.AttribDivisor(1, 1)
 
-	vao.BindBuffer(0, vertices, 0, VertexSize)
+	vao.BindBuffer(0, vertices, 0, vertexSize)
 	vao.BindBuffer(1, attributes, 0, InstanceAttributesSize)
 	vao.BindElementBuffer(elements)
 
@@ -87,46 +162,78 @@ func NewRenderBatch() *RenderBatch {
 	commands.AllocateEmpty(DrawCommandSize*4096, gl.DYNAMIC_STORAGE_BIT)
 
 	return &RenderBatch{
-		VertexBuffer:     vertices,
-		ElementBuffer:    elements,
-		AttributesBuffer: attributes,
-		VertexArray:      vao,
-		materials:        []MaterialSlice{},
-		materialIndex:    map[string]int{},
-		meshLocations:    []MeshLocation{},
-		meshIndex:        map[string]int{},
-		CommandBuffer:    commands,
+		Layout:             layout,
+		VertexBuffer:       vertices,
+		ElementBuffer:      elements,
+		AttributesBuffer:   attributes,
+		QuantizationBuffer: quantizations,
+		VertexArray:        vao,
+		instanceSet:        newInstanceSet(),
+		materialIndex:      map[string]int{},
+		meshLocations:      []MeshLocation{},
+		meshIndex:          map[string]int{},
+		CommandBuffer:      commands,
 	}
 }
 
+// Writes the vertices and indices of the mesh to the buffers of the batch. The VertexStreams of a mesh decoded
+// by DecodeMeshView are interleaved straight into the mapped vertex buffer, its indices are written from the file.
 func (batch *RenderBatch) Upload(mesh *Mesh) {
 	if _, ok := batch.meshIndex[mesh.Name]; ok {
 		return
 	}
 
-	verticesSize := len(mesh.Vertices) * VertexSize
+	vertexSize := batch.Layout.VertexSize()
+	vertexCount := mesh.VertexCount()
+	verticesSize := vertexCount * vertexSize
 	if batch.VertexBuffer.Grow(batch.vertexPosition + verticesSize) {
-		batch.VertexArray.BindBuffer(0, batch.VertexBuffer, 0, verticesSize)
+		batch.VertexArray.BindBuffer(0, batch.VertexBuffer, 0, vertexSize)
 	}
-	batch.VertexBuffer.Write(batch.vertexPosition, mesh.Vertices)
 	location := MeshLocation{
-		BaseVertex: int32(batch.vertexPosition / VertexSize),
+		BaseVertex: int32(batch.vertexPosition / vertexSize),
+	}
+	switch {
+	case batch.Layout == VertexLayoutCompact:
+		var vertices []CompactVertex
+		vertices, location.Quantization = EncodeCompactVertices(mesh.vertices())
+		batch.VertexBuffer.Write(batch.vertexPosition, vertices)
+	case mesh.Streams != nil && vertexCount > 0:
+		mapped := batch.VertexBuffer.MapRange(batch.vertexPosition, verticesSize, gl.MAP_WRITE_BIT|gl.MAP_INVALIDATE_RANGE_BIT)
+		mesh.Streams.Interleave(unsafe.Slice((*Vertex)(unsafe.Pointer(unsafe.SliceData(mapped))), vertexCount))
+		batch.VertexBuffer.Unmap()
+	case mesh.Streams == nil:
+		batch.VertexBuffer.Write(batch.vertexPosition, mesh.Vertices)
 	}
 	batch.vertexPosition += verticesSize
 
-	indicesSize := len(mesh.Indices) * ElementIndexSize
-	if batch.ElementBuffer.Grow(batch.elementPosition + indicesSize) {
-		batch.VertexArray.BindElementBuffer(batch.ElementBuffer)
+	location.BaseIndex, location.Indices = batch.uploadIndices(mesh.Indices)
+	for _, lod := range mesh.Lods {
+		baseIndex, indices := batch.uploadIndices(lod.Indices)
+		location.Lods = append(location.Lods, LodLocation{BaseIndex: baseIndex, Indices: indices, Error: lod.Error})
 	}
-	batch.ElementBuffer.Write(batch.elementPosition, mesh.Indices)
-	location.BaseIndex = uint32(batch.elementPosition)
-	location.Indices = uint32(len(mesh.Indices))
-	batch.elementPosition += indicesSize
+	// computed instead of taken from the mesh, whose bounds are empty unless UpdateBounds was called
+	location.Bounds = mesh.indexedBounds(mesh.Indices)
+	size := location.Bounds.Size()
+	location.Sphere = location.Bounds.BoundingSphere()
+	location.Extent = math32.Max(size[0], math32.Max(size[1], size[2]))
 
 	batch.meshLocations = append(batch.meshLocations, location)
 	batch.meshIndex[mesh.Name] = len(batch.meshLocations) - 1
 }
 
+// Appends the indices to the element buffer and returns their first index and count
+func (batch *RenderBatch) uploadIndices(indices []uint32) (uint32, uint32) {
+	indicesSize := len(indices) * ElementIndexSize
+	if batch.ElementBuffer.Grow(batch.elementPosition + indicesSize) {
+		batch.VertexArray.BindElementBuffer(batch.ElementBuffer)
+	}
+	batch.ElementBuffer.Write(batch.elementPosition, indices)
+	// the commands count in indices instead of bytes
+	baseIndex := uint32(batch.elementPosition / ElementIndexSize)
+	batch.elementPosition += indicesSize
+	return baseIndex, uint32(len(indices))
+}
+
 func (batch *RenderBatch) AddMaterial(material *Material) {
 	if _, ok := batch.materialIndex[material.Name]; ok {
 		return
@@ -141,57 +248,209 @@ func (batch *RenderBatch) AddMaterial(material *Material) {
 	batch.materialIndex[material.Name] = len(batch.materials) - 1
 }
 
-func (batch *RenderBatch) Add(mesh, material string, attributes InstanceAttributes) {
+// Adds an instance of the mesh, its attributes are uploaded with the next draw commands
+func (batch *RenderBatch) Add(mesh, material string, attributes InstanceAttributes) InstanceHandle {
 	if _, ok := batch.meshIndex[mesh]; !ok {
 		log.Panicf("Mesh %q is not contained in this batch", mesh)
 	}
 	if _, ok := batch.materialIndex[material]; !ok {
 		log.Printf("Material %q is not contained in this batch\n", material)
 	}
-	vbo := batch.AttributesBuffer
-	if vbo.Grow(batch.attributesPosition + InstanceAttributesSize) {
-		batch.VertexArray.BindBuffer(1, vbo, 0, InstanceAttributesSize)
+	instance := batch.add(batch.materialIndex[material], MeshInstance{MeshIndex: batch.meshIndex[mesh]})
+	for len(batch.attributes) < batch.slots {
+		batch.attributes = append(batch.attributes, InstanceAttributes{})
+		if batch.Layout == VertexLayoutCompact {
+			batch.quantizations = append(batch.quantizations, VertexQuantization{})
+		}
+	}
+	batch.setAttributes(instance, attributes)
+	return instance.Handle
+}
+
+// A copy of the instance
+func (batch *RenderBatch) Instance(handle InstanceHandle) MeshInstance {
+	return *batch.instance(handle)
+}
+
+// Replaces the attributes of the instance like its model matrix, they are uploaded with the next draw commands
+func (batch *RenderBatch) Update(handle InstanceHandle, attributes InstanceAttributes) {
+	batch.setAttributes(batch.instance(handle), attributes)
+}
+
+// Moves the instance to the slice of the material
+func (batch *RenderBatch) SetMaterial(handle InstanceHandle, material string) {
+	if _, ok := batch.materialIndex[material]; !ok {
+		log.Panicf("Material %q is not contained in this batch", material)
+	}
+	batch.setMaterial(handle, batch.materialIndex[material])
+}
+
+// Removes the instance, its handle becomes invalid and its attribute slot is reused by the next Add
+func (batch *RenderBatch) Remove(handle InstanceHandle) {
+	batch.remove(handle)
+}
+
+// Sets the attributes and the world bounds of the instance and marks its slot for the upload
+func (batch *RenderBatch) setAttributes(instance *MeshInstance, attributes InstanceAttributes) {
+	location := batch.meshLocations[instance.MeshIndex]
+	instance.Attributes = attributes
+	instance.Bounds = location.Bounds.Transform(attributes.ModelMatrix)
+	instance.Sphere = location.Sphere.Transform(attributes.ModelMatrix)
+	batch.attributes[instance.AttributeIndex] = attributes
+	if batch.Layout == VertexLayoutCompact {
+		// the quantizations are read with the same base instance as the attributes
+		batch.quantizations[instance.AttributeIndex] = location.Quantization
 	}
-	vbo.Write(batch.attributesPosition, []InstanceAttributes{attributes})
-	mBatch := batch.ByMaterial(material)
-	mBatch.instances = append(mBatch.instances, MeshInstance{
-		MeshIndex:      batch.meshIndex[mesh],
-		AttributeIndex: batch.attributesPosition / InstanceAttributesSize,
-	})
+	batch.attributesDirty.mark(instance.AttributeIndex)
+}
 
-	batch.attributesPosition += InstanceAttributesSize
+// Writes the slots changed since the last upload
+func (batch *RenderBatch) uploadAttributes() {
+	if batch.attributesDirty.empty() {
+		return
+	}
+	if batch.AttributesBuffer.Grow(len(batch.attributes) * InstanceAttributesSize) {
+		batch.VertexArray.BindBuffer(1, batch.AttributesBuffer, 0, InstanceAttributesSize)
+	}
+	writeDirty(batch.AttributesBuffer, batch.attributes, batch.attributesDirty, InstanceAttributesSize)
+	if batch.Layout == VertexLayoutCompact {
+		if batch.QuantizationBuffer.Grow(len(batch.quantizations) * VertexQuantizationSize) {
+			batch.VertexArray.BindBuffer(2, batch.QuantizationBuffer, 0, VertexQuantizationSize)
+		}
+		writeDirty(batch.QuantizationBuffer, batch.quantizations, batch.attributesDirty, VertexQuantizationSize)
+	}
+	batch.attributesDirty.reset()
 }
 
 func (batch *RenderBatch) ByMaterial(material string) *MaterialSlice {
 	return &batch.materials[batch.materialIndex[material]]
 }
 
+// Uploads the changed attributes and the commands of the instances that are not culled, only the range of commands
+// that differs from the last call is written to CommandBuffer
 func (batch *RenderBatch) GenerateDrawCommands() []MaterialSlice {
-	if batch.commands == nil {
-		batch.commands = []DrawElementsIndirectCommand{}
+	batch.uploadAttributes()
+
+	count := 0
+	for i := range batch.materials {
+		slice := &batch.materials[i]
+		slice.ElementOffset = count * DrawCommandSize
+		for j := range slice.instances {
+			if slice.instances[j].Culled {
+				continue
+			}
+			setDirty(&batch.commands, count, batch.instanceCommand(&slice.instances[j]), &batch.commandsDirty)
+			count++
+		}
+		slice.ElementCount = count - slice.ElementOffset/DrawCommandSize
 	}
+	batch.commands = batch.commands[:count]
+
+	if !batch.commandsDirty.empty() {
+		batch.CommandBuffer.Grow(count * DrawCommandSize)
+		writeDirty(batch.CommandBuffer, batch.commands, batch.commandsDirty, DrawCommandSize)
+		batch.commandsDirty.reset()
+	}
+	batch.TotatCommandRange = [2]int{0, count}
+
+	return batch.materials
+}
+
+// Lays out a range of commands for each material slice with room for all of its instances and returns a CullInstance
+// for each instance. GpuCuller and CullCommands compact the commands of the visible instances into these ranges,
+// ElementCount is the size of the range and the draw count is written separately.
+func (batch *RenderBatch) GenerateCullInstances() ([]CullInstance, []MaterialSlice) {
+	batch.uploadAttributes()
+	// the commands are written by the culler, GenerateDrawCommands has to upload all of them again
 	batch.commands = batch.commands[:0]
 
+	batch.cullInstances = batch.cullInstances[:0]
+	commands := 0
 	for i := range batch.materials {
 		slice := &batch.materials[i]
-		slice.ElementOffset = len(batch.commands) * DrawCommandSize
+		slice.ElementOffset = commands * DrawCommandSize
 		slice.ElementCount = len(slice.instances)
-		for _, instance := range slice.instances {
+		for j := range slice.instances {
+			instance := &slice.instances[j]
+			batch.cullInstances = append(batch.cullInstances, CullInstance{
+				Sphere:       instance.Sphere.Center.Vec4(instance.Sphere.Radius),
+				Min:          instance.Bounds.Min,
+				Slice:        uint32(i),
+				Max:          instance.Bounds.Max,
+				FirstCommand: uint32(commands),
+				Command:      batch.instanceCommand(instance),
+			})
+		}
+		commands += len(slice.instances)
+	}
+	return batch.cullInstances, batch.materials
+}
+
+// The command drawing the selected level of detail of the instance
+func (batch *RenderBatch) instanceCommand(instance *MeshInstance) DrawElementsIndirectCommand {
+	loc := batch.meshLocations[instance.MeshIndex]
+	firstIndex, count := loc.BaseIndex, loc.Indices
+	if instance.Lod > 0 {
+		lod := loc.Lods[instance.Lod-1]
+		firstIndex, count = lod.BaseIndex, lod.Indices
+	}
+	return DrawElementsIndirectCommand{
+		Count:         count,
+		InstanceCount: 1,
+		FirstIndex:    firstIndex,
+		BaseVertex:    loc.BaseVertex,
+		BaseInstance:  uint32(instance.AttributeIndex),
+	}
+}
+
+// Chooses the coarsest level of detail of each instance whose error is at most pixelError pixels on the screen of the camera.
+// The error is projected at the point of the bounding sphere closest to the camera.
+func (batch *RenderBatch) SelectLods(cam *Camera, pixelError float32) {
+	// pixels per unit at a distance of 1
+	projectionScale := cam.ViewportDimension[1] / (2 * math32.Tan(mgl32.DegToRad(cam.VerticalFov)/2))
+	for i := range batch.materials {
+		for j := range batch.materials[i].instances {
+			instance := &batch.materials[i].instances[j]
 			loc := batch.meshLocations[instance.MeshIndex]
-			cmd := DrawElementsIndirectCommand{
-				Count:         loc.Indices,
-				InstanceCount: 1,
-				FirstIndex:    loc.BaseIndex,
-				BaseVertex:    int32(loc.BaseVertex),
-				BaseInstance:  uint32(instance.AttributeIndex),
+			instance.Lod = 0
+
+			distance := instance.Sphere.Center.Sub(cam.Position).Len() - instance.Sphere.Radius
+			if distance <= 0 || loc.Sphere.Radius == 0 {
+				continue
+			}
+			scale := instance.Sphere.Radius / loc.Sphere.Radius
+			for lod := len(loc.Lods); lod > 0; lod-- {
+				if loc.Lods[lod-1].Error*loc.Extent*scale/distance*projectionScale <= pixelError {
+					instance.Lod = lod
+					break
+				}
 			}
-			batch.commands = append(batch.commands, cmd)
 		}
 	}
+}
 
-	batch.CommandBuffer.Grow(len(batch.commands) * DrawCommandSize)
-	batch.CommandBuffer.Write(0, batch.commands)
-	batch.TotatCommandRange = [2]int{0, len(batch.commands)}
+// Marks the instances whose bounds are outside of the frustum, GenerateDrawCommands skips them.
+// GpuCuller does the same on the GPU and ignores the marks.
+func (batch *RenderBatch) CullInstances(frustum Frustum) {
+	for i := range batch.materials {
+		for j := range batch.materials[i].instances {
+			instance := &batch.materials[i].instances[j]
+			// the sphere is cheaper and rejects most instances outside, the box is tighter
+			instance.Culled = !frustum.IntersectsSphere(instance.Sphere) || !frustum.IntersectsAABB(instance.Bounds)
+		}
+	}
+}
 
-	return batch.materials
+// Uploads the models of a scene and adds an instance for each of its nodes, placed by transform
+func (batch *RenderBatch) AddScene(scene *Scene, transform mgl32.Mat4) {
+	for _, model := range scene.Models {
+		batch.Upload(model.Mesh)
+		batch.AddMaterial(model.Material)
+	}
+	for _, instance := range scene.Instances {
+		model := scene.Models[instance.Model]
+		batch.Add(model.Mesh.Name, model.Material.Name, InstanceAttributes{
+			ModelMatrix: transform.Mul4(instance.Transform),
+		})
+	}
 }
@@ -0,0 +1,111 @@
+package libscn
+
+import (
+	"github.com/chewxy/math32"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+type Sphere struct {
+	Center mgl32.Vec3
+	Radius float32
+}
+
+func (box AABB) Center() mgl32.Vec3 {
+	return box.Min.Add(box.Max).Mul(0.5)
+}
+
+func (box AABB) Size() mgl32.Vec3 {
+	return box.Max.Sub(box.Min)
+}
+
+// The sphere around the box, not the smallest sphere around the vertices
+func (box AABB) BoundingSphere() Sphere {
+	return Sphere{Center: box.Center(), Radius: box.Size().Len() / 2}
+}
+
+// The box around the transformed box
+func (box AABB) Transform(m mgl32.Mat4) AABB {
+	center := m.Mul4x1(box.Center().Vec4(1)).Vec3()
+	halfSize := box.Size().Mul(0.5)
+	// the extent along each axis is the sum of the absolute projections of the half size
+	extent := mgl32.Vec3{}
+	for row := 0; row < 3; row++ {
+		for col := 0; col < 3; col++ {
+			extent[row] += math32.Abs(m.At(row, col)) * halfSize[col]
+		}
+	}
+	return AABB{Min: center.Sub(extent), Max: center.Add(extent)}
+}
+
+// The sphere around the transformed sphere, non-uniform scales use the largest scale
+func (sphere Sphere) Transform(m mgl32.Mat4) Sphere {
+	scale := math32.Max(m.Col(0).Vec3().Len(), math32.Max(m.Col(1).Vec3().Len(), m.Col(2).Vec3().Len()))
+	return Sphere{Center: m.Mul4x1(sphere.Center.Vec4(1)).Vec3(), Radius: sphere.Radius * scale}
+}
+
+// The points p with Normal·p + Distance >= 0 are in front of the plane
+type Plane struct {
+	Normal   mgl32.Vec3
+	Distance float32
+}
+
+// The signed distance of p, positive in front of the plane
+func (plane Plane) SignedDistance(p mgl32.Vec3) float32 {
+	return plane.Normal.Dot(p) + plane.Distance
+}
+
+// The planes of the view volume facing inward, left, right, bottom, top, near and far
+type Frustum [6]Plane
+
+// Extracts the planes of the clip space of OpenGL, -w <= x, y, z <= w, from the view projection matrix
+// like Gribb and Hartmann. The planes are in the space the matrix transforms from, usually world space.
+func NewFrustum(viewProjection mgl32.Mat4) Frustum {
+	row := func(i int) mgl32.Vec4 { return viewProjection.Row(i) }
+	coefficients := [6]mgl32.Vec4{
+		row(3).Add(row(0)), row(3).Sub(row(0)),
+		row(3).Add(row(1)), row(3).Sub(row(1)),
+		row(3).Add(row(2)), row(3).Sub(row(2)),
+	}
+	frustum := Frustum{}
+	for i, c := range coefficients {
+		length := c.Vec3().Len()
+		frustum[i] = Plane{Normal: c.Vec3().Mul(1 / length), Distance: c[3] / length}
+	}
+	return frustum
+}
+
+func (frustum *Frustum) ContainsPoint(p mgl32.Vec3) bool {
+	for _, plane := range frustum {
+		if plane.SignedDistance(p) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// False if the sphere is completely behind one of the planes. Spheres outside of the corners of the
+// frustum may be reported as intersecting, which is conservative for culling.
+func (frustum *Frustum) IntersectsSphere(sphere Sphere) bool {
+	for _, plane := range frustum {
+		if plane.SignedDistance(sphere.Center) < -sphere.Radius {
+			return false
+		}
+	}
+	return true
+}
+
+// False if the box is completely behind one of the planes, tested with the corner furthest along the plane normal
+func (frustum *Frustum) IntersectsAABB(box AABB) bool {
+	for _, plane := range frustum {
+		corner := box.Min
+		for c := 0; c < 3; c++ {
+			if plane.Normal[c] > 0 {
+				corner[c] = box.Max[c]
+			}
+		}
+		if plane.SignedDistance(corner) < 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package libscn_test
+
+import (
+	"advanced-gl/Project03/libscn"
+	"testing"
+
+	"github.com/chewxy/math32"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// A camera at z=10 looking at the origin with a 90° fov, the near plane at 1 and the far plane at 100
+func testViewProjection() mgl32.Mat4 {
+	projection := mgl32.Perspective(mgl32.DegToRad(90), 1, 1, 100)
+	view := mgl32.LookAtV(mgl32.Vec3{0, 0, 10}, mgl32.Vec3{}, mgl32.Vec3{0, 1, 0})
+	return projection.Mul4(view)
+}
+
+func testFrustum() libscn.Frustum {
+	return libscn.NewFrustum(testViewProjection())
+}
+
+func TestNewFrustum(t *testing.T) {
+	frustum := testFrustum()
+	expected := libscn.Frustum{
+		{Normal: mgl32.Vec3{math32.Sqrt2 / 2, 0, -math32.Sqrt2 / 2}, Distance: 10 * math32.Sqrt2 / 2},
+		{Normal: mgl32.Vec3{-math32.Sqrt2 / 2, 0, -math32.Sqrt2 / 2}, Distance: 10 * math32.Sqrt2 / 2},
+		{Normal: mgl32.Vec3{0, math32.Sqrt2 / 2, -math32.Sqrt2 / 2}, Distance: 10 * math32.Sqrt2 / 2},
+		{Normal: mgl32.Vec3{0, -math32.Sqrt2 / 2, -math32.Sqrt2 / 2}, Distance: 10 * math32.Sqrt2 / 2},
+		{Normal: mgl32.Vec3{0, 0, -1}, Distance: 9},
+		{Normal: mgl32.Vec3{0, 0, 1}, Distance: 90},
+	}
+	for i, plane := range frustum {
+		if !plane.Normal.ApproxEqualThreshold(expected[i].Normal, 1e-4) || math32.Abs(plane.Distance-expected[i].Distance) > 1e-3 {
+			t.Errorf("plane %d should be %v but was %v", i, expected[i], plane)
+		}
+	}
+
+	inside := []mgl32.Vec3{{0, 0, 0}, {0, 0, 8.9}, {0, 0, -89}, {4.9, 0, 5}, {0, -4.9, 5}, {50, 50, -50}}
+	outside := []mgl32.Vec3{{0, 0, 9.1}, {0, 0, 11}, {0, 0, -91}, {5.1, 0, 5}, {0, -5.1, 5}, {100, 0, 0}}
+	for _, p := range inside {
+		if !frustum.ContainsPoint(p) {
+			t.Errorf("%v should be inside of the frustum", p)
+		}
+	}
+	for _, p := range outside {
+		if frustum.ContainsPoint(p) {
+			t.Errorf("%v should be outside of the frustum", p)
+		}
+	}
+}
+
+func TestFrustumCulling(t *testing.T) {
+	frustum := testFrustum()
+	spheres := []struct {
+		sphere  libscn.Sphere
+		visible bool
+	}{
+		{libscn.Sphere{Center: mgl32.Vec3{0, 0, 0}, Radius: 1}, true},
+		{libscn.Sphere{Center: mgl32.Vec3{0, 0, 12}, Radius: 1}, false},
+		{libscn.Sphere{Center: mgl32.Vec3{0, 0, 12}, Radius: 3}, true},
+		{libscn.Sphere{Center: mgl32.Vec3{20, 0, 0}, Radius: 1}, false},
+		{libscn.Sphere{Center: mgl32.Vec3{0, 0, -95}, Radius: 4}, false},
+		{libscn.Sphere{Center: mgl32.Vec3{0, 0, -95}, Radius: 6}, true},
+	}
+	for _, s := range spheres {
+		if frustum.IntersectsSphere(s.sphere) != s.visible {
+			t.Errorf("the visibility of %v should be %v", s.sphere, s.visible)
+		}
+	}
+
+	boxes := []struct {
+		box     libscn.AABB
+		visible bool
+	}{
+		{libscn.AABB{Min: mgl32.Vec3{-1, -1, -1}, Max: mgl32.Vec3{1, 1, 1}}, true},
+		{libscn.AABB{Min: mgl32.Vec3{-100, -100, -1}, Max: mgl32.Vec3{100, 100, 1}}, true},
+		{libscn.AABB{Min: mgl32.Vec3{12, -1, -1}, Max: mgl32.Vec3{14, 1, 1}}, false},
+		{libscn.AABB{Min: mgl32.Vec3{-1, -1, 9.5}, Max: mgl32.Vec3{1, 1, 20}}, false},
+		{libscn.AABB{Min: mgl32.Vec3{-1, -1, 8}, Max: mgl32.Vec3{1, 1, 20}}, true},
+	}
+	for _, b := range boxes {
+		if frustum.IntersectsAABB(b.box) != b.visible {
+			t.Errorf("the visibility of %v should be %v", b.box, b.visible)
+		}
+	}
+
+	// the sphere around this thin box reaches into the frustum, only the box test rejects it
+	thin := libscn.AABB{Min: mgl32.Vec3{6.5, -10, 4}, Max: mgl32.Vec3{7, 10, 4.5}}
+	if !frustum.IntersectsSphere(thin.BoundingSphere()) || frustum.IntersectsAABB(thin) {
+		t.Errorf("the box %v should only be rejected by the box test", thin)
+	}
+}
+
+func TestTransformBounds(t *testing.T) {
+	box := libscn.AABB{Min: mgl32.Vec3{-1, 0, 2}, Max: mgl32.Vec3{3, 1, 4}}
+	model := mgl32.Translate3D(5, -2, 1).Mul4(mgl32.HomogRotate3D(0.7, mgl32.Vec3{1, 2, 3}.Normalize())).Mul4(mgl32.Scale3D(2, 1, 0.5))
+
+	expected := libscn.AABB{
+		Min: mgl32.Vec3{math32.MaxFloat32, math32.MaxFloat32, math32.MaxFloat32},
+		Max: mgl32.Vec3{-math32.MaxFloat32, -math32.MaxFloat32, -math32.MaxFloat32},
+	}
+	for i := 0; i < 8; i++ {
+		corner := box.Min
+		for c := 0; c < 3; c++ {
+			if i&(1<<c) != 0 {
+				corner[c] = box.Max[c]
+			}
+		}
+		p := model.Mul4x1(corner.Vec4(1)).Vec3()
+		for c := 0; c < 3; c++ {
+			expected.Min[c] = math32.Min(expected.Min[c], p[c])
+			expected.Max[c] = math32.Max(expected.Max[c], p[c])
+		}
+	}
+	result := box.Transform(model)
+	if !result.Min.ApproxEqualThreshold(expected.Min, 1e-4) || !result.Max.ApproxEqualThreshold(expected.Max, 1e-4) {
+		t.Errorf("the transformed box should be %v but was %v", expected, result)
+	}
+
+	sphere := box.BoundingSphere().Transform(model)
+	for i := 0; i < 8; i++ {
+		corner := box.Min
+		for c := 0; c < 3; c++ {
+			if i&(1<<c) != 0 {
+				corner[c] = box.Max[c]
+			}
+		}
+		if p := model.Mul4x1(corner.Vec4(1)).Vec3(); p.Sub(sphere.Center).Len() > sphere.Radius+1e-4 {
+			t.Errorf("the transformed sphere %v should contain the corner %v", sphere, p)
+		}
+	}
+}
@@ -34,6 +34,11 @@ func (cam *Camera) UpdateProjectionMatrix() {
 	cam.ProjectionMatrix = mgl32.Perspective(mgl32.DegToRad(cam.VerticalFov), w/h, n, f)
 }
 
+// The view frustum in world space, the matrices have to be updated
+func (cam *Camera) Frustum() Frustum {
+	return NewFrustum(cam.ProjectionMatrix.Mul4(cam.ViewMatrix))
+}
+
 func (cam *Camera) Quaternion() mgl32.Quat {
 	// Note the rotation order is Z, Y, X
 	return mgl32.AnglesToQuat(cam.Orientation[2]*libutil.Deg2Rad, cam.Orientation[1]*libutil.Deg2Rad, cam.Orientation[0]*libutil.Deg2Rad, mgl32.ZYX)
@@ -0,0 +1,80 @@
+package libscn
+
+import (
+	"advanced-gl/Project03/libio"
+
+	"github.com/chewxy/math32"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// A quantized Vertex of 20 instead of 48 bytes, see EncodeCompactVertices
+type CompactVertex struct {
+	// snorm16 relative to the bounding box of the vertices, w is the handedness of the tangent
+	Position [4]int16
+	// Octahedral snorm16 unit vectors
+	Normal  [2]int16
+	Tangent [2]int16
+	// Half precision floats
+	Uv [2]uint16
+}
+
+// Restores the positions of compact vertices, the snorm16 components are scaled by Scale and moved by Offset
+type VertexQuantization struct {
+	Offset mgl32.Vec3
+	Scale  mgl32.Vec3
+}
+
+// The quantization which maps the bounding box onto [-1, 1]³
+func NewVertexQuantization(bounds AABB) VertexQuantization {
+	return VertexQuantization{
+		Offset: bounds.Min.Add(bounds.Max).Mul(0.5),
+		Scale:  bounds.Max.Sub(bounds.Min).Mul(0.5),
+	}
+}
+
+// Quantizes the vertices relative to their bounding box.
+// The positions are within half a step of a 65534th of the box size, the normals and tangents within 0.003 degrees
+// and the uvs have 11 significant bits.
+func EncodeCompactVertices(vertices []Vertex) ([]CompactVertex, VertexQuantization) {
+	bounds := AABB{}
+	for i, v := range vertices {
+		if i == 0 {
+			bounds = AABB{Min: v.Position, Max: v.Position}
+		}
+		for c := range v.Position {
+			bounds.Min[c] = math32.Min(bounds.Min[c], v.Position[c])
+			bounds.Max[c] = math32.Max(bounds.Max[c], v.Position[c])
+		}
+	}
+	quantization := NewVertexQuantization(bounds)
+
+	compact := make([]CompactVertex, len(vertices))
+	for i, v := range vertices {
+		c := &compact[i]
+		for j := 0; j < 3; j++ {
+			if quantization.Scale[j] > 0 {
+				c.Position[j] = EncodeSnorm16((v.Position[j] - quantization.Offset[j]) / quantization.Scale[j])
+			}
+		}
+		c.Position[3] = EncodeSnorm16(signNotZero(v.Tangent[3]))
+		c.Normal = EncodeOctahedral16(v.Normal)
+		c.Tangent = EncodeOctahedral16(v.Tangent.Vec3())
+		c.Uv = [2]uint16{libio.Float16Bits(v.Uv[0]), libio.Float16Bits(v.Uv[1])}
+	}
+	return compact, quantization
+}
+
+// The inverse of EncodeCompactVertices
+func DecodeCompactVertices(compact []CompactVertex, quantization VertexQuantization) []Vertex {
+	vertices := make([]Vertex, len(compact))
+	for i, c := range compact {
+		v := &vertices[i]
+		for j := 0; j < 3; j++ {
+			v.Position[j] = quantization.Offset[j] + DecodeSnorm16(c.Position[j])*quantization.Scale[j]
+		}
+		v.Normal = DecodeOctahedral16(c.Normal)
+		v.Tangent = DecodeOctahedral16(c.Tangent).Vec4(signNotZero(DecodeSnorm16(c.Position[3])))
+		v.Uv = mgl32.Vec2{libio.Float16FromBits(c.Uv[0]), libio.Float16FromBits(c.Uv[1])}
+	}
+	return vertices
+}
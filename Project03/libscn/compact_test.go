@@ -0,0 +1,68 @@
+package libscn_test
+
+import (
+	"advanced-gl/Project03/libscn"
+	"testing"
+
+	"github.com/chewxy/math32"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func TestCompactVertices(t *testing.T) {
+	mesh := attributeMesh()
+	// move the cylinder away from the origin and stretch it to get a box which is not centered and not a cube
+	for i := range mesh.Vertices {
+		p := &mesh.Vertices[i].Position
+		*p = mgl32.Vec3{p[0]*20 + 100, p[1]*3 - 7, p[2] * 0.5}
+		mesh.Vertices[i].Uv = mesh.Vertices[i].Uv.Mul(8)
+	}
+	mesh.UpdateBounds()
+
+	compact, quantization := libscn.EncodeCompactVertices(mesh.Vertices)
+	if quantization.Offset.Sub(mgl32.Vec3{100, -5.5, 0}).Len() > 1e-5 || quantization.Scale.Sub(mgl32.Vec3{20, 1.5, 0.5}).Len() > 1e-5 {
+		t.Errorf("the quantization should map the bounds %v onto [-1, 1] but was %v", mesh.Bounds, quantization)
+	}
+	if size := libscn.CompactVertexSize; size != 20 {
+		t.Errorf("compact vertices should be 20 bytes but were %d", size)
+	}
+
+	result := libscn.DecodeCompactVertices(compact, quantization)
+	for i, v := range result {
+		expected := mesh.Vertices[i]
+		for c := 0; c < 3; c++ {
+			// half a step plus the float error of the offset
+			if d := math32.Abs(v.Position[c] - expected.Position[c]); d > quantization.Scale[c]/0x7fff*0.5+1e-5 {
+				t.Errorf("vertex %d position %v should be within half a step of %v", i, v.Position, expected.Position)
+			}
+		}
+		if angle := math32.Asin(v.Normal.Cross(expected.Normal).Len()); angle > mgl32.DegToRad(0.003) {
+			t.Errorf("vertex %d normal %v should be within 0.003 degrees of %v", i, v.Normal, expected.Normal)
+		}
+		if angle := math32.Asin(v.Tangent.Vec3().Cross(expected.Tangent.Vec3()).Len()); angle > mgl32.DegToRad(0.003) || v.Tangent[3] != expected.Tangent[3] {
+			t.Errorf("vertex %d tangent %v should be within 0.003 degrees of %v", i, v.Tangent, expected.Tangent)
+		}
+		if !v.Uv.ApproxEqualThreshold(expected.Uv, 1.0/2048) {
+			t.Errorf("vertex %d uv %v should be close to %v", i, v.Uv, expected.Uv)
+		}
+	}
+}
+
+func TestCompactVerticesMirrored(t *testing.T) {
+	// a flat mesh has no extent along z, its handedness is stored in the w component of the position
+	vertices, indices := planeMesh(
+		[]mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {2, 0, 0}, {0, 1, 0}, {1, 1, 0}, {2, 1, 0}},
+		[]mgl32.Vec2{{0, 0}, {1, 0}, {0, 0}, {0, 1}, {1, 1}, {0, 1}},
+		[]uint32{0, 1, 4, 0, 4, 3, 1, 2, 5, 1, 5, 4},
+	)
+	vertices = libscn.GenerateTangents(vertices, indices)
+	result := libscn.DecodeCompactVertices(libscn.EncodeCompactVertices(vertices))
+	for i, v := range result {
+		if v.Position != vertices[i].Position || v.Tangent != vertices[i].Tangent || v.Normal != vertices[i].Normal {
+			t.Errorf("vertex %d on the grid should be exact but was %v instead of %v", i, v, vertices[i])
+		}
+	}
+
+	if result := libscn.DecodeCompactVertices(libscn.EncodeCompactVertices(nil)); len(result) != 0 {
+		t.Errorf("no vertices should stay empty")
+	}
+}
@@ -0,0 +1,181 @@
+package libscn
+
+import (
+	"github.com/chewxy/math32"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// An instance as read by the culling shader of GpuCuller, laid out for std430
+type CullInstance struct {
+	// The world space bounding sphere, xyz is the center and w the radius
+	Sphere mgl32.Vec4
+	Min    mgl32.Vec3
+	// The material slice whose draw count is incremented if the instance is visible
+	Slice uint32
+	Max   mgl32.Vec3
+	// The first command of the range of the material slice
+	FirstCommand uint32
+	// Appended to the range of the material slice if the instance is visible
+	Command DrawElementsIndirectCommand
+	_       [3]uint32
+}
+
+// What the instances are culled against
+type CullView struct {
+	Frustum        Frustum
+	ViewProjection mgl32.Mat4
+	// The depth pyramid of a previous frame for occlusion culling, nil disables it
+	Pyramid *DepthPyramid
+}
+
+func NewCullView(viewProjection mgl32.Mat4, pyramid *DepthPyramid) *CullView {
+	return &CullView{
+		Frustum:        NewFrustum(viewProjection),
+		ViewProjection: viewProjection,
+		Pyramid:        pyramid,
+	}
+}
+
+// The test of the culling shader, the sphere and the box have to intersect the frustum and the box must not be occluded
+func (view *CullView) Visible(instance *CullInstance) bool {
+	sphere := Sphere{Center: instance.Sphere.Vec3(), Radius: instance.Sphere[3]}
+	box := AABB{Min: instance.Min, Max: instance.Max}
+	if !view.Frustum.IntersectsSphere(sphere) || !view.Frustum.IntersectsAABB(box) {
+		return false
+	}
+	return view.Pyramid == nil || !view.Pyramid.Occludes(box, view.ViewProjection)
+}
+
+// Emulates the culling shader of GpuCuller. The commands of the visible instances are compacted into the range of
+// their slice starting at FirstCommand and counts holds the number of commands of each slice.
+// The shader appends the commands of a slice in any order, this function in the order of the instances.
+func CullCommands(instances []CullInstance, view *CullView, commands []DrawElementsIndirectCommand, counts []uint32) {
+	for i := range counts {
+		counts[i] = 0
+	}
+	for i := range instances {
+		instance := &instances[i]
+		if !view.Visible(instance) {
+			continue
+		}
+		commands[instance.FirstCommand+counts[instance.Slice]] = instance.Command
+		counts[instance.Slice]++
+	}
+}
+
+// A hierarchical depth buffer with the levels of an OpenGL mipmap, each level halves the size of the previous one
+// rounded down until it is 1x1
+type DepthPyramid struct {
+	Width, Height int
+	// Levels[0] is the depth buffer with the first row at the bottom and each texel of a level is the farthest depth
+	// of the 2x2 texels it covers in the previous level. The last row and column also cover the rest of an odd size.
+	Levels [][]float32
+}
+
+// The number of levels of a DepthPyramid of the size
+func DepthPyramidLevels(width, height int) int {
+	levels := 1
+	for width > 1 || height > 1 {
+		width, height = width/2, height/2
+		levels++
+	}
+	return levels
+}
+
+func NewDepthPyramid(depth []float32, width, height int) *DepthPyramid {
+	pyramid := &DepthPyramid{Width: width, Height: height}
+	pyramid.Levels = make([][]float32, DepthPyramidLevels(width, height))
+	pyramid.Levels[0] = depth
+	for level := 1; level < len(pyramid.Levels); level++ {
+		src := pyramid.Levels[level-1]
+		srcWidth, srcHeight := pyramid.LevelSize(level - 1)
+		w, h := pyramid.LevelSize(level)
+		dst := make([]float32, w*h)
+		for y := 0; y < h; y++ {
+			y0, y1 := coveredTexels(y, h, srcHeight)
+			for x := 0; x < w; x++ {
+				x0, x1 := coveredTexels(x, w, srcWidth)
+				farthest := float32(0)
+				for sy := y0; sy <= y1; sy++ {
+					for sx := x0; sx <= x1; sx++ {
+						farthest = math32.Max(farthest, src[sy*srcWidth+sx])
+					}
+				}
+				dst[y*w+x] = farthest
+			}
+		}
+		pyramid.Levels[level] = dst
+	}
+	return pyramid
+}
+
+// The first and last texel of the previous level of size srcSize covered by texel i of a level of size size
+func coveredTexels(i, size, srcSize int) (int, int) {
+	if i == size-1 {
+		return 2 * i, srcSize - 1
+	}
+	return 2 * i, 2*i + 1
+}
+
+func (pyramid *DepthPyramid) LevelSize(level int) (int, int) {
+	w, h := pyramid.Width>>level, pyramid.Height>>level
+	if w == 0 {
+		w = 1
+	}
+	if h == 0 {
+		h = 1
+	}
+	return w, h
+}
+
+// True if the box is behind the depth of the pyramid everywhere it covers on the screen. The rectangle of the
+// projected box is tested in the level where it covers at most 2x2 texels, like the culling shader does.
+// A pixel p is covered by texel p>>level of a level, or the last texel if that is outside.
+func (pyramid *DepthPyramid) Occludes(box AABB, viewProjection mgl32.Mat4) bool {
+	ndcMin := mgl32.Vec3{math32.MaxFloat32, math32.MaxFloat32, math32.MaxFloat32}
+	ndcMax := mgl32.Vec3{-math32.MaxFloat32, -math32.MaxFloat32, -math32.MaxFloat32}
+	for i := 0; i < 8; i++ {
+		corner := box.Min
+		for c := 0; c < 3; c++ {
+			if i&(1<<c) != 0 {
+				corner[c] = box.Max[c]
+			}
+		}
+		clip := viewProjection.Mul4x1(corner.Vec4(1))
+		// the box reaches behind the camera
+		if clip[3] <= 0 {
+			return false
+		}
+		ndc := clip.Vec3().Mul(1 / clip[3])
+		for c := 0; c < 3; c++ {
+			ndcMin[c] = math32.Min(ndcMin[c], ndc[c])
+			ndcMax[c] = math32.Max(ndcMax[c], ndc[c])
+		}
+	}
+	uvMin := mgl32.Vec2{mgl32.Clamp(ndcMin[0]*0.5+0.5, 0, 1), mgl32.Clamp(ndcMin[1]*0.5+0.5, 0, 1)}
+	uvMax := mgl32.Vec2{mgl32.Clamp(ndcMax[0]*0.5+0.5, 0, 1), mgl32.Clamp(ndcMax[1]*0.5+0.5, 0, 1)}
+	depth := ndcMin[2]*0.5 + 0.5
+
+	extent := math32.Max((uvMax[0]-uvMin[0])*float32(pyramid.Width), (uvMax[1]-uvMin[1])*float32(pyramid.Height))
+	level := clampInt(int(math32.Ceil(math32.Log2(math32.Max(extent, 1)))), 0, len(pyramid.Levels)-1)
+	w, h := pyramid.LevelSize(level)
+	x0 := clampInt(int(uvMin[0]*float32(pyramid.Width))>>level, 0, w-1)
+	y0 := clampInt(int(uvMin[1]*float32(pyramid.Height))>>level, 0, h-1)
+	x1 := clampInt(int(uvMax[0]*float32(pyramid.Width))>>level, 0, w-1)
+	y1 := clampInt(int(uvMax[1]*float32(pyramid.Height))>>level, 0, h-1)
+	texels := pyramid.Levels[level]
+	farthest := math32.Max(
+		math32.Max(texels[y0*w+x0], texels[y0*w+x1]),
+		math32.Max(texels[y1*w+x0], texels[y1*w+x1]))
+	return depth > farthest
+}
+
+func clampInt(v, lower, upper int) int {
+	if v < lower {
+		return lower
+	}
+	if v > upper {
+		return upper
+	}
+	return v
+}
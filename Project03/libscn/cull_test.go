@@ -0,0 +1,148 @@
+package libscn_test
+
+import (
+	"advanced-gl/Project03/libscn"
+	"math/rand"
+	"testing"
+
+	"github.com/chewxy/math32"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// An instance of slice with the bounds of a unit cube at p, its command is identified by BaseInstance
+func cullInstance(slice, firstCommand, id int, p mgl32.Vec3) libscn.CullInstance {
+	box := libscn.AABB{Min: p.Sub(mgl32.Vec3{0.5, 0.5, 0.5}), Max: p.Add(mgl32.Vec3{0.5, 0.5, 0.5})}
+	sphere := box.BoundingSphere()
+	return libscn.CullInstance{
+		Sphere:       sphere.Center.Vec4(sphere.Radius),
+		Min:          box.Min,
+		Slice:        uint32(slice),
+		Max:          box.Max,
+		FirstCommand: uint32(firstCommand),
+		Command:      libscn.DrawElementsIndirectCommand{Count: 36, InstanceCount: 1, BaseInstance: uint32(id)},
+	}
+}
+
+func TestCullCommands(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	frustum := testFrustum()
+	// two slices of 100 instances each, spread around the frustum
+	instances := []libscn.CullInstance{}
+	for i := 0; i < 200; i++ {
+		p := mgl32.Vec3{rng.Float32()*40 - 20, rng.Float32()*40 - 20, rng.Float32()*40 - 25}
+		instances = append(instances, cullInstance(i/100, i/100*100, i, p))
+	}
+
+	commands := make([]libscn.DrawElementsIndirectCommand, len(instances))
+	counts := []uint32{7, 7}
+	libscn.CullCommands(instances, libscn.NewCullView(testViewProjection(), nil), commands, counts)
+
+	for slice := 0; slice < 2; slice++ {
+		expected := []uint32{}
+		for i := slice * 100; i < slice*100+100; i++ {
+			sphere := libscn.Sphere{Center: instances[i].Sphere.Vec3(), Radius: instances[i].Sphere[3]}
+			box := libscn.AABB{Min: instances[i].Min, Max: instances[i].Max}
+			if frustum.IntersectsSphere(sphere) && frustum.IntersectsAABB(box) {
+				expected = append(expected, uint32(i))
+			}
+		}
+		if len(expected) == 0 || len(expected) == 100 {
+			t.Fatalf("slice %d should have visible and culled instances but %d were visible", slice, len(expected))
+		}
+		if int(counts[slice]) != len(expected) {
+			t.Errorf("slice %d should have %d commands but had %d", slice, len(expected), counts[slice])
+			continue
+		}
+		for j, id := range expected {
+			if cmd := commands[slice*100+j]; cmd.BaseInstance != id || cmd.Count != 36 {
+				t.Errorf("command %d of slice %d should draw instance %d but was %v", j, slice, id, cmd)
+			}
+		}
+	}
+}
+
+func TestDepthPyramid(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	width, height := 13, 6
+	depth := make([]float32, width*height)
+	for i := range depth {
+		depth[i] = rng.Float32()
+	}
+	pyramid := libscn.NewDepthPyramid(depth, width, height)
+
+	sizes := [][2]int{{13, 6}, {6, 3}, {3, 1}, {1, 1}}
+	if len(pyramid.Levels) != len(sizes) || libscn.DepthPyramidLevels(width, height) != len(sizes) {
+		t.Fatalf("the pyramid should have %d levels but had %d", len(sizes), len(pyramid.Levels))
+	}
+	for level, size := range sizes {
+		if w, h := pyramid.LevelSize(level); w != size[0] || h != size[1] || len(pyramid.Levels[level]) != w*h {
+			t.Errorf("level %d should have the size %v but had %dx%d and %d texels", level, size, w, h, len(pyramid.Levels[level]))
+			continue
+		}
+		// every texel is the farthest depth of the pixels it covers, the last ones cover the rest
+		for y := 0; y < size[1]; y++ {
+			for x := 0; x < size[0]; x++ {
+				endX, endY := (x+1)<<level, (y+1)<<level
+				if x == size[0]-1 {
+					endX = width
+				}
+				if y == size[1]-1 {
+					endY = height
+				}
+				farthest := float32(0)
+				for py := y << level; py < endY; py++ {
+					for px := x << level; px < endX; px++ {
+						farthest = math32.Max(farthest, depth[py*width+px])
+					}
+				}
+				if texel := pyramid.Levels[level][y*size[0]+x]; texel != farthest {
+					t.Errorf("texel %d, %d of level %d should be %v but was %v", x, y, level, farthest, texel)
+				}
+			}
+		}
+	}
+}
+
+func TestOcclusionCulling(t *testing.T) {
+	viewProjection := testViewProjection()
+	// a wall at z=0 in front of the left half of the screen, the camera is at z=10
+	clip := viewProjection.Mul4x1(mgl32.Vec4{0, 0, 0, 1})
+	wall := clip[2]/clip[3]*0.5 + 0.5
+	width, height := 64, 64
+	depth := make([]float32, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			depth[y*width+x] = 1
+			if x < width/2 {
+				depth[y*width+x] = wall
+			}
+		}
+	}
+	view := libscn.NewCullView(viewProjection, libscn.NewDepthPyramid(depth, width, height))
+
+	tests := []struct {
+		name    string
+		p       mgl32.Vec3
+		visible bool
+	}{
+		{"behind the wall", mgl32.Vec3{-3, 0, -5}, false},
+		{"far behind the wall", mgl32.Vec3{-30, 10, -60}, false},
+		{"in front of the wall", mgl32.Vec3{-3, 0, 5}, true},
+		{"beside the wall", mgl32.Vec3{3, 0, -5}, true},
+		{"partly behind the wall", mgl32.Vec3{0, 0, -5}, true},
+		{"intersecting the wall", mgl32.Vec3{-3, 0, 0}, true},
+		{"reaching behind the camera", mgl32.Vec3{0, 0, 9.2}, true},
+	}
+	for i, test := range tests {
+		instance := cullInstance(0, 0, i, test.p)
+		if view.Visible(&instance) != test.visible {
+			t.Errorf("the instance %s should have the visibility %v", test.name, test.visible)
+		}
+	}
+
+	// the frustum test comes first
+	instance := cullInstance(0, 0, 0, mgl32.Vec3{30, 0, 5})
+	if view.Visible(&instance) {
+		t.Errorf("the instance outside of the frustum should not be visible")
+	}
+}
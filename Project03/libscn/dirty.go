@@ -0,0 +1,47 @@
+package libscn
+
+import "advanced-gl/Project03/libgl"
+
+// The elements [first, end) of a buffer that changed since its last upload
+type dirtyRange struct {
+	first, end int
+}
+
+func (dirty *dirtyRange) mark(i int) {
+	if dirty.empty() {
+		dirty.first, dirty.end = i, i+1
+		return
+	}
+	if i < dirty.first {
+		dirty.first = i
+	}
+	if i >= dirty.end {
+		dirty.end = i + 1
+	}
+}
+
+func (dirty *dirtyRange) empty() bool {
+	return dirty.first == dirty.end
+}
+
+func (dirty *dirtyRange) reset() {
+	dirty.first, dirty.end = 0, 0
+}
+
+// Sets element i of values to v and marks it if it changed, i may be the length to append v
+func setDirty[T comparable](values *[]T, i int, v T, dirty *dirtyRange) {
+	if i < len(*values) {
+		if (*values)[i] == v {
+			return
+		}
+		(*values)[i] = v
+	} else {
+		*values = append(*values, v)
+	}
+	dirty.mark(i)
+}
+
+// Writes the dirty range of values to the buffer holding all values with elements of the size
+func writeDirty[T any](buffer libgl.UnboundBuffer, values []T, dirty dirtyRange, size int) {
+	buffer.Write(dirty.first*size, values[dirty.first:dirty.end])
+}
@@ -0,0 +1,40 @@
+package libscn_test
+
+import (
+	"advanced-gl/Project03/libscn"
+	"testing"
+)
+
+func TestSetDirty(t *testing.T) {
+	commands := []libscn.DrawElementsIndirectCommand{}
+	dirty := libscn.DirtyRange{}
+	generate := func(counts ...uint32) {
+		for i, count := range counts {
+			libscn.SetDirtyCommand(&commands, i, libscn.DrawElementsIndirectCommand{Count: count, InstanceCount: 1}, &dirty)
+		}
+		commands = commands[:len(counts)]
+	}
+	check := func(name string, first, end int) {
+		t.Helper()
+		if f, e := dirty.Range(); f != first || e != end {
+			t.Errorf("%s should mark the commands [%d, %d) but marked [%d, %d)", name, first, end, f, e)
+		}
+		dirty.Reset()
+	}
+
+	generate(1, 2, 3, 4, 5)
+	check("the first commands", 0, 5)
+	generate(1, 2, 3, 4, 5)
+	check("the same commands", 0, 0)
+	generate(1, 2, 7, 4, 8)
+	check("changed commands", 2, 5)
+	generate(1, 2, 7)
+	check("removed commands", 0, 0)
+	generate(1, 2, 7, 4, 8, 9)
+	check("appended commands", 3, 6)
+	generate(6, 2, 7, 4, 8, 9)
+	check("the first changed command", 0, 1)
+	if commands[0].Count != 6 || commands[5].Count != 9 {
+		t.Errorf("the commands should be updated but were %v", commands)
+	}
+}
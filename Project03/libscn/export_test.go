@@ -0,0 +1,52 @@
+package libscn
+
+// these functions are only exported when running tests
+
+type DirtyRange = dirtyRange
+
+func (dirty *dirtyRange) Range() (int, int) {
+	return dirty.first, dirty.end
+}
+
+func (dirty *dirtyRange) Reset() {
+	dirty.reset()
+}
+
+var SetDirtyCommand = setDirty[DrawElementsIndirectCommand]
+
+type InstanceSet = instanceSet
+
+// A set with empty slices for the number of materials
+func NewInstanceSet(materials int) *InstanceSet {
+	set := newInstanceSet()
+	set.materials = make([]MaterialSlice, materials)
+	return &set
+}
+
+func (set *instanceSet) Add(material, mesh int) InstanceHandle {
+	return set.add(material, MeshInstance{MeshIndex: mesh}).Handle
+}
+
+func (set *instanceSet) Instance(handle InstanceHandle) MeshInstance {
+	return *set.instance(handle)
+}
+
+func (set *instanceSet) SetMaterial(handle InstanceHandle, material int) {
+	set.setMaterial(handle, material)
+}
+
+func (set *instanceSet) Remove(handle InstanceHandle) {
+	set.remove(handle)
+}
+
+func (set *instanceSet) Instances(material int) []MeshInstance {
+	return set.materials[material].instances
+}
+
+func (set *instanceSet) Slots() int {
+	return set.slots
+}
+
+func (mesh *Mesh) GenerateTangents() {
+	mesh.generateTangents()
+}
@@ -0,0 +1,792 @@
+package libscn
+
+import (
+	"advanced-gl/Project03/libio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unsafe"
+
+	"github.com/chewxy/math32"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/pierrec/lz4/v4"
+)
+
+// The successor of the .geo format, the header starts with a GeoVersion
+const MagicNumberGEO2 = 0xc9dae18d
+
+type GeoVersion uint32
+
+const (
+	// The format of MagicNumberGEO without a version field, position, normal and uv of a single object
+	GeoVersion1_000_000 = GeoVersion(1_000_000)
+	// Optional attributes, submeshes with material slots, bounds, levels of detail and quantized or compressed streams
+	GeoVersion2_000_000 = GeoVersion(2_000_000)
+)
+
+type GeoAttributes uint32
+
+const (
+	GeoAttributePosition = GeoAttributes(1 << iota)
+	GeoAttributeNormal
+	// xyz and the handedness in w, generated when missing
+	GeoAttributeTangent
+	GeoAttributeUv0
+	GeoAttributeUv1
+	// Linear rgba
+	GeoAttributeColor
+	// Four joint indices, always together with the weights
+	GeoAttributeJoints
+	GeoAttributeWeights
+)
+
+type GeoFormat uint8
+
+const (
+	GeoFormatFloat32 = GeoFormat(iota)
+	// IEEE 754 half precision floats
+	GeoFormatFloat16
+	// Positions relative to the bounds of the mesh, anything else in [0, 1]
+	GeoFormatUnorm16
+	// Values in [-1, 1]
+	GeoFormatSnorm16
+	// Unit vectors as the two snorm16 of their octahedral mapping
+	GeoFormatOctahedral16
+	// Values in [0, 1]
+	GeoFormatUnorm8
+	GeoFormatUint8
+	GeoFormatUint16
+	GeoFormatUint32
+)
+
+func (format GeoFormat) String() string {
+	names := []string{"float32", "float16", "unorm16", "snorm16", "octahedral16", "unorm8", "uint8", "uint16", "uint32"}
+	if int(format) < len(names) {
+		return names[format]
+	}
+	return fmt.Sprintf("GeoFormat(%d)", uint8(format))
+}
+
+// The size of an element of the given number of components
+func (format GeoFormat) elementSize(components int) int {
+	switch format {
+	case GeoFormatFloat32, GeoFormatUint32:
+		return 4 * components
+	case GeoFormatFloat16, GeoFormatUnorm16, GeoFormatSnorm16, GeoFormatUint16:
+		return 2 * components
+	case GeoFormatOctahedral16:
+		return 4
+	case GeoFormatUnorm8, GeoFormatUint8:
+		return components
+	}
+	return 0
+}
+
+type GeoCompression uint8
+
+const (
+	GeoCompressionNone = GeoCompression(iota)
+	// Every stream is compressed on its own
+	GeoCompressionLz4
+)
+
+// Follows the magic number and the GeoVersion
+type GeoHeader struct {
+	Attributes   GeoAttributes
+	VertexCount  uint32
+	IndexCount   uint32
+	SubmeshCount uint32
+	Compression  GeoCompression
+	// The levels of detail which follow the attribute streams
+	LodCount uint8
+	Unused   [2]uint8
+	Bounds   AABB
+}
+
+type geoSubmeshHeader struct {
+	FirstIndex uint32
+	IndexCount uint32
+	Bounds     AABB
+}
+
+// Is followed by the range of each submesh in its indices and the index stream
+type geoLodHeader struct {
+	Error      float32
+	IndexCount uint32
+}
+
+type geoStreamHeader struct {
+	Format GeoFormat
+	Unused [3]uint8
+	// The number of bytes which follow, without the padding to 4 bytes
+	Size uint32
+}
+
+// The streams of the attributes in the order of the file
+var geoStreams = []struct {
+	attribute  GeoAttributes
+	name       string
+	components int
+	formats    []GeoFormat
+}{
+	{GeoAttributePosition, "position", 3, []GeoFormat{GeoFormatFloat32, GeoFormatUnorm16}},
+	{GeoAttributeNormal, "normal", 3, []GeoFormat{GeoFormatFloat32, GeoFormatOctahedral16}},
+	{GeoAttributeTangent, "tangent", 4, []GeoFormat{GeoFormatFloat32, GeoFormatSnorm16}},
+	{GeoAttributeUv0, "uv0", 2, []GeoFormat{GeoFormatFloat32, GeoFormatFloat16}},
+	{GeoAttributeUv1, "uv1", 2, []GeoFormat{GeoFormatFloat32, GeoFormatFloat16}},
+	{GeoAttributeColor, "color", 4, []GeoFormat{GeoFormatFloat32, GeoFormatFloat16, GeoFormatUnorm8, GeoFormatUnorm16}},
+	{GeoAttributeJoints, "joints", 4, []GeoFormat{GeoFormatUint16, GeoFormatUint8}},
+	{GeoAttributeWeights, "weights", 4, []GeoFormat{GeoFormatFloat32, GeoFormatUnorm8, GeoFormatUnorm16}},
+}
+
+var geoIndexFormats = []GeoFormat{GeoFormatUint16, GeoFormatUint32}
+
+// With views the uint32 indices and float32 attributes of uncompressed streams are read with libio.ReadSlice
+func decodeMeshV2(br *libio.BinaryReader, views bool) (*Mesh, error) {
+	// the magic number was read already
+	var version GeoVersion
+	if !br.ReadRef(&version) {
+		return nil, br.Errorf("expected mesh version")
+	}
+	if version != GeoVersion2_000_000 {
+		return nil, br.Errorf("mesh version %d unsupported", version)
+	}
+	header := GeoHeader{}
+	if !br.ReadRef(&header) {
+		return nil, br.Errorf("expected mesh header")
+	}
+
+	if header.Attributes&GeoAttributePosition == 0 {
+		return nil, br.Errorf("mesh has no positions")
+	}
+	if (header.Attributes&GeoAttributeJoints == 0) != (header.Attributes&GeoAttributeWeights == 0) {
+		return nil, br.Errorf("mesh joints and weights must be used together")
+	}
+	if header.Compression > GeoCompressionLz4 {
+		return nil, br.Errorf("mesh compression %d unsupported", header.Compression)
+	}
+	if header.IndexCount%3 != 0 {
+		return nil, br.Errorf("mesh index count %d is not a multiple of 3", header.IndexCount)
+	}
+	if !br.CheckAlloc(VertexSize, int(header.VertexCount)) || !br.CheckAlloc(ElementIndexSize, int(header.IndexCount)) || !br.CheckAlloc(int(unsafe.Sizeof(Submesh{})), int(header.SubmeshCount)) {
+		return nil, br.Errorf("mesh header is invalid")
+	}
+
+	name, ok := readGeoString(br)
+	if !ok {
+		return nil, br.Errorf("expected mesh name")
+	}
+
+	mesh := &Mesh{Name: name, Bounds: header.Bounds}
+	for i := 0; i < int(header.SubmeshCount); i++ {
+		sub := geoSubmeshHeader{}
+		if !br.ReadRef(&sub) {
+			return nil, br.Errorf("expected submesh %d; name %q", i, name)
+		}
+		material, ok := readGeoString(br)
+		if !ok {
+			return nil, br.Errorf("expected submesh %d material; name %q", i, name)
+		}
+		if sub.FirstIndex%3 != 0 || sub.IndexCount%3 != 0 || uint64(sub.FirstIndex)+uint64(sub.IndexCount) > uint64(header.IndexCount) {
+			return nil, br.Errorf("submesh %d indices %d+%d are out of range for %d indices; name %q", i, sub.FirstIndex, sub.IndexCount, header.IndexCount, name)
+		}
+		mesh.Submeshes = append(mesh.Submeshes, Submesh{
+			Material:   material,
+			FirstIndex: int(sub.FirstIndex),
+			IndexCount: int(sub.IndexCount),
+			Bounds:     sub.Bounds,
+		})
+	}
+
+	if mesh.Indices, ok = readGeoIndices(br, header, int(header.IndexCount), views); !ok {
+		return nil, br.Errorf("expected %d mesh indices; name %q", header.IndexCount, name)
+	}
+
+	count := int(header.VertexCount)
+	formats := map[GeoAttributes]GeoFormat{}
+	values := map[GeoAttributes][]float32{}
+	for _, stream := range geoStreams {
+		if header.Attributes&stream.attribute == 0 {
+			continue
+		}
+		streamHeader, ok := readGeoStreamHeader(br, header.Compression, stream.formats, stream.components, count)
+		if ok && views && header.Compression == GeoCompressionNone && streamHeader.Format == GeoFormatFloat32 {
+			values[stream.attribute], ok = readGeoSlice[float32](br, streamHeader, count*stream.components)
+		} else if ok {
+			var data []byte
+			if data, ok = readGeoStreamData(br, header.Compression, streamHeader, count*streamHeader.Format.elementSize(stream.components)); ok {
+				values[stream.attribute] = decodeGeoValues(streamHeader.Format, stream.components, data, count)
+			}
+		}
+		if !ok {
+			return nil, br.Errorf("expected %d mesh %s; name %q", count, stream.name, name)
+		}
+		formats[stream.attribute] = streamHeader.Format
+	}
+
+	streamed := GeoAttributePosition | GeoAttributeUv0 | GeoAttributeNormal | GeoAttributeTangent
+	if views && header.Compression == GeoCompressionNone && header.Attributes&streamed == streamed &&
+		formats[GeoAttributePosition] == GeoFormatFloat32 && formats[GeoAttributeUv0] == GeoFormatFloat32 &&
+		formats[GeoAttributeNormal] == GeoFormatFloat32 && formats[GeoAttributeTangent] == GeoFormatFloat32 {
+		mesh.Streams = &VertexStreams{
+			Positions: castGeoValues[mgl32.Vec3](values[GeoAttributePosition]),
+			Uvs:       castGeoValues[mgl32.Vec2](values[GeoAttributeUv0]),
+			Normals:   castGeoValues[mgl32.Vec3](values[GeoAttributeNormal]),
+			Tangents:  castGeoValues[mgl32.Vec4](values[GeoAttributeTangent]),
+		}
+	} else {
+		mesh.Vertices = make([]Vertex, count)
+		streamed = 0
+	}
+	for _, stream := range geoStreams {
+		if header.Attributes&stream.attribute != 0 && streamed&stream.attribute == 0 {
+			mesh.setAttribute(stream.attribute, formats[stream.attribute], values[stream.attribute])
+		}
+	}
+
+	for i := 0; i < int(header.LodCount); i++ {
+		lodHeader := geoLodHeader{}
+		if !br.ReadRef(&lodHeader) || !br.CheckAlloc(ElementIndexSize, int(lodHeader.IndexCount)) {
+			return nil, br.Errorf("expected mesh lod %d; name %q", i, name)
+		}
+		if lodHeader.IndexCount%3 != 0 {
+			return nil, br.Errorf("mesh lod %d index count %d is not a multiple of 3; name %q", i, lodHeader.IndexCount, name)
+		}
+		lod := MeshLod{Error: lodHeader.Error}
+		for j, sub := range mesh.Submeshes {
+			var r [2]uint32
+			if !br.ReadRef(&r) {
+				return nil, br.Errorf("expected mesh lod %d submesh %d; name %q", i, j, name)
+			}
+			if r[0]%3 != 0 || r[1]%3 != 0 || uint64(r[0])+uint64(r[1]) > uint64(lodHeader.IndexCount) {
+				return nil, br.Errorf("mesh lod %d submesh %d indices %d+%d are out of range for %d indices; name %q", i, j, r[0], r[1], lodHeader.IndexCount, name)
+			}
+			sub.FirstIndex, sub.IndexCount = int(r[0]), int(r[1])
+			lod.Submeshes = append(lod.Submeshes, sub)
+		}
+		if lod.Indices, ok = readGeoIndices(br, header, int(lodHeader.IndexCount), views); !ok {
+			return nil, br.Errorf("expected %d mesh lod %d indices; name %q", lodHeader.IndexCount, i, name)
+		}
+		mesh.Lods = append(mesh.Lods, lod)
+	}
+
+	if header.Attributes&GeoAttributeTangent == 0 {
+		mesh.generateTangents()
+	}
+
+	return mesh, nil
+}
+
+// Reads an index stream and checks the indices against the vertex count.
+// With views uncompressed uint32 indices are read with libio.ReadSlice.
+func readGeoIndices(br *libio.BinaryReader, header GeoHeader, count int, views bool) ([]uint32, bool) {
+	streamHeader, ok := readGeoStreamHeader(br, header.Compression, geoIndexFormats, 1, count)
+	if !ok {
+		return nil, false
+	}
+	var indices []uint32
+	if views && header.Compression == GeoCompressionNone && streamHeader.Format == GeoFormatUint32 {
+		if indices, ok = readGeoSlice[uint32](br, streamHeader, count); !ok {
+			return nil, false
+		}
+	} else {
+		data, ok := readGeoStreamData(br, header.Compression, streamHeader, count*streamHeader.Format.elementSize(1))
+		if !ok {
+			return nil, false
+		}
+		indices = make([]uint32, count)
+		for i := range indices {
+			if streamHeader.Format == GeoFormatUint16 {
+				indices[i] = uint32(binary.LittleEndian.Uint16(data[i*2:]))
+			} else {
+				indices[i] = binary.LittleEndian.Uint32(data[i*4:])
+			}
+		}
+	}
+	for i := range indices {
+		if indices[i] >= header.VertexCount {
+			br.Err = fmt.Errorf("index %d at %d is out of range for %d vertices", indices[i], i, header.VertexCount)
+			return nil, false
+		}
+	}
+	return indices, true
+}
+
+// Sets the decoded values of an attribute, positions of unorm formats are relative to the bounds
+func (mesh *Mesh) setAttribute(attribute GeoAttributes, format GeoFormat, values []float32) {
+	count := mesh.VertexCount()
+	vec2 := func(i int) mgl32.Vec2 { return mgl32.Vec2{values[i*2], values[i*2+1]} }
+	vec4 := func(i int) mgl32.Vec4 { return mgl32.Vec4{values[i*4], values[i*4+1], values[i*4+2], values[i*4+3]} }
+
+	switch attribute {
+	case GeoAttributePosition:
+		size := mesh.Bounds.Max.Sub(mesh.Bounds.Min)
+		for i := range mesh.Vertices {
+			p := mgl32.Vec3{values[i*3], values[i*3+1], values[i*3+2]}
+			if format == GeoFormatUnorm16 {
+				p = mesh.Bounds.Min.Add(mgl32.Vec3{p[0] * size[0], p[1] * size[1], p[2] * size[2]})
+			}
+			mesh.Vertices[i].Position = p
+		}
+	case GeoAttributeNormal:
+		for i := range mesh.Vertices {
+			mesh.Vertices[i].Normal = mgl32.Vec3{values[i*3], values[i*3+1], values[i*3+2]}
+		}
+	case GeoAttributeTangent:
+		for i := range mesh.Vertices {
+			mesh.Vertices[i].Tangent = vec4(i)
+		}
+	case GeoAttributeUv0:
+		for i := range mesh.Vertices {
+			mesh.Vertices[i].Uv = vec2(i)
+		}
+	case GeoAttributeUv1:
+		mesh.Uv1 = make([]mgl32.Vec2, count)
+		for i := range mesh.Uv1 {
+			mesh.Uv1[i] = vec2(i)
+		}
+	case GeoAttributeColor:
+		mesh.Colors = make([]mgl32.Vec4, count)
+		for i := range mesh.Colors {
+			mesh.Colors[i] = vec4(i)
+		}
+	case GeoAttributeJoints:
+		mesh.Joints = make([][4]uint16, count)
+		for i := range mesh.Joints {
+			for c := 0; c < 4; c++ {
+				mesh.Joints[i][c] = uint16(values[i*4+c])
+			}
+		}
+	case GeoAttributeWeights:
+		mesh.Weights = make([]mgl32.Vec4, count)
+		for i := range mesh.Weights {
+			mesh.Weights[i] = vec4(i)
+		}
+	}
+}
+
+// Returns the values of an attribute with their components, positions of unorm formats are made relative to the bounds
+func (mesh *Mesh) attribute(attribute GeoAttributes, format GeoFormat) []float32 {
+	values := []float32{}
+	switch attribute {
+	case GeoAttributePosition:
+		size := mesh.Bounds.Max.Sub(mesh.Bounds.Min)
+		for _, v := range mesh.Vertices {
+			p := v.Position
+			if format == GeoFormatUnorm16 {
+				p = p.Sub(mesh.Bounds.Min)
+				for c := range p {
+					if size[c] > 0 {
+						p[c] /= size[c]
+					} else {
+						p[c] = 0
+					}
+				}
+			}
+			values = append(values, p[:]...)
+		}
+	case GeoAttributeNormal:
+		for _, v := range mesh.Vertices {
+			values = append(values, v.Normal[:]...)
+		}
+	case GeoAttributeTangent:
+		for _, v := range mesh.Vertices {
+			values = append(values, v.Tangent[:]...)
+		}
+	case GeoAttributeUv0:
+		for _, v := range mesh.Vertices {
+			values = append(values, v.Uv[:]...)
+		}
+	case GeoAttributeUv1:
+		for _, uv := range mesh.Uv1 {
+			values = append(values, uv[:]...)
+		}
+	case GeoAttributeColor:
+		for _, c := range mesh.Colors {
+			values = append(values, c[:]...)
+		}
+	case GeoAttributeJoints:
+		for _, j := range mesh.Joints {
+			values = append(values, float32(j[0]), float32(j[1]), float32(j[2]), float32(j[3]))
+		}
+	case GeoAttributeWeights:
+		for _, w := range mesh.Weights {
+			values = append(values, w[:]...)
+		}
+	}
+	return values
+}
+
+// Generates the tangents and extends the optional attributes to the vertices which were split.
+// The levels of detail are remapped to the split vertices of their handedness.
+func (mesh *Mesh) generateTangents() {
+	lods := make([][]uint32, len(mesh.Lods))
+	for i, lod := range mesh.Lods {
+		lods[i] = lod.Indices
+	}
+	mesh.Vertices = generateTangents(mesh.Vertices, mesh.Indices, func(source int) {
+		if mesh.Uv1 != nil {
+			mesh.Uv1 = append(mesh.Uv1, mesh.Uv1[source])
+		}
+		if mesh.Colors != nil {
+			mesh.Colors = append(mesh.Colors, mesh.Colors[source])
+		}
+		if mesh.Joints != nil {
+			mesh.Joints = append(mesh.Joints, mesh.Joints[source])
+			mesh.Weights = append(mesh.Weights, mesh.Weights[source])
+		}
+	}, lods...)
+}
+
+// Reads a string with its uint32 length, padded to 4 bytes
+func readGeoString(br *libio.BinaryReader) (string, bool) {
+	var length int
+	if !br.ReadUInt32(&length) || !br.CheckAlloc(1, length) {
+		return "", false
+	}
+	data, ok := br.ReadView(length)
+	if !ok || !br.ReadBytes(padding4(length)) {
+		return "", false
+	}
+	return string(data), true
+}
+
+// Reads the header of a stream of count elements in one of the formats, uncompressed streams have to match their size
+func readGeoStreamHeader(br *libio.BinaryReader, compression GeoCompression, formats []GeoFormat, components, count int) (geoStreamHeader, bool) {
+	header := geoStreamHeader{}
+	if !br.ReadRef(&header) {
+		return header, false
+	}
+	supported := false
+	for _, f := range formats {
+		supported = supported || f == header.Format
+	}
+	if !supported {
+		br.Err = fmt.Errorf("format %v unsupported", header.Format)
+		return header, false
+	}
+	size := header.Format.elementSize(components) * count
+	if !br.CheckAlloc(1, size) || !br.CheckAlloc(1, int(header.Size)) {
+		return header, false
+	}
+	if compression == GeoCompressionNone && int(header.Size) != size {
+		br.Err = fmt.Errorf("stream has %d bytes instead of %d", header.Size, size)
+		return header, false
+	}
+	return header, true
+}
+
+// Reads the data of a stream after its header and returns it uncompressed with the given size
+func readGeoStreamData(br *libio.BinaryReader, compression GeoCompression, header geoStreamHeader, size int) ([]byte, bool) {
+	stored, ok := br.ReadView(int(header.Size))
+	if !ok || !br.ReadBytes(padding4(int(header.Size))) {
+		return nil, false
+	}
+	if compression == GeoCompressionNone {
+		return stored, true
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(lz4.NewReader(bytes.NewReader(stored)), data); err != nil {
+		br.Err = err
+		return nil, false
+	}
+	return data, true
+}
+
+// Reads the count elements of an uncompressed stream after its header, they reference the file when it is mapped
+func readGeoSlice[E any](br *libio.BinaryReader, header geoStreamHeader, count int) ([]E, bool) {
+	s, ok := libio.ReadSlice[E](br, count)
+	if !ok || !br.ReadBytes(padding4(int(header.Size))) {
+		return nil, false
+	}
+	return s, true
+}
+
+// Reinterprets float components as vectors of them
+func castGeoValues[E any](values []float32) []E {
+	var zero E
+	count := len(values) * 4 / int(unsafe.Sizeof(zero))
+	if count == 0 {
+		return []E{}
+	}
+	return unsafe.Slice((*E)(unsafe.Pointer(unsafe.SliceData(values))), count)
+}
+
+func padding4(size int) int {
+	return (4 - size%4) % 4
+}
+
+// Converts the stored elements to float components
+func decodeGeoValues(format GeoFormat, components int, data []byte, count int) []float32 {
+	values := make([]float32, count*components)
+	le := binary.LittleEndian
+	for i := range values {
+		switch format {
+		case GeoFormatFloat32:
+			values[i] = math32.Float32frombits(le.Uint32(data[i*4:]))
+		case GeoFormatFloat16:
+			values[i] = libio.Float16FromBits(le.Uint16(data[i*2:]))
+		case GeoFormatUnorm16:
+			values[i] = DecodeUnorm(uint32(le.Uint16(data[i*2:])), 16)
+		case GeoFormatSnorm16:
+			values[i] = DecodeSnorm16(int16(le.Uint16(data[i*2:])))
+		case GeoFormatUnorm8:
+			values[i] = DecodeUnorm(uint32(data[i]), 8)
+		case GeoFormatUint8:
+			values[i] = float32(data[i])
+		case GeoFormatUint16:
+			values[i] = float32(le.Uint16(data[i*2:]))
+		case GeoFormatUint32:
+			values[i] = float32(le.Uint32(data[i*4:]))
+		case GeoFormatOctahedral16:
+			if i%3 == 0 {
+				e := i / 3
+				n := DecodeOctahedral16([2]int16{int16(le.Uint16(data[e*4:])), int16(le.Uint16(data[e*4+2:]))})
+				copy(values[i:], n[:])
+			}
+		}
+	}
+	return values
+}
+
+// Converts float components to the stored elements
+func encodeGeoValues(format GeoFormat, components int, values []float32) []byte {
+	count := len(values) / components
+	data := make([]byte, count*format.elementSize(components))
+	le := binary.LittleEndian
+	for i, v := range values {
+		switch format {
+		case GeoFormatFloat32:
+			le.PutUint32(data[i*4:], math32.Float32bits(v))
+		case GeoFormatFloat16:
+			le.PutUint16(data[i*2:], libio.Float16Bits(v))
+		case GeoFormatUnorm16:
+			le.PutUint16(data[i*2:], uint16(EncodeUnorm(v, 16)))
+		case GeoFormatSnorm16:
+			le.PutUint16(data[i*2:], uint16(EncodeSnorm16(v)))
+		case GeoFormatUnorm8:
+			data[i] = uint8(EncodeUnorm(v, 8))
+		case GeoFormatUint8:
+			data[i] = uint8(v)
+		case GeoFormatUint16:
+			le.PutUint16(data[i*2:], uint16(v))
+		case GeoFormatUint32:
+			le.PutUint32(data[i*4:], uint32(v))
+		case GeoFormatOctahedral16:
+			if i%3 == 0 {
+				e := i / 3
+				q := EncodeOctahedral16(mgl32.Vec3{values[i], values[i+1], values[i+2]})
+				le.PutUint16(data[e*4:], uint16(q[0]))
+				le.PutUint16(data[e*4+2:], uint16(q[1]))
+			}
+		}
+	}
+	return data
+}
+
+type MeshEncodeContext struct {
+	Version     GeoVersion
+	Compression GeoCompression
+	// The formats of the attributes, others are float32
+	Formats map[GeoAttributes]GeoFormat
+	level   lz4.CompressionLevel
+}
+
+type MeshEncodeOption func(ctx *MeshEncodeContext) error
+
+// Writes the original format instead, without tangents, optional attributes, submeshes and bounds
+func OptGeoVersion1() MeshEncodeOption {
+	return func(ctx *MeshEncodeContext) error {
+		ctx.Version = GeoVersion1_000_000
+		return nil
+	}
+}
+
+// Positions as unorm16 within the bounds, octahedral normals, snorm16 tangents, half float uvs,
+// unorm8 colors and unorm16 weights. The error of positions is at most 1/131070 of the bounds.
+func OptGeoQuantize() MeshEncodeOption {
+	return func(ctx *MeshEncodeContext) error {
+		ctx.Formats = map[GeoAttributes]GeoFormat{
+			GeoAttributePosition: GeoFormatUnorm16,
+			GeoAttributeNormal:   GeoFormatOctahedral16,
+			GeoAttributeTangent:  GeoFormatSnorm16,
+			GeoAttributeUv0:      GeoFormatFloat16,
+			GeoAttributeUv1:      GeoFormatFloat16,
+			GeoAttributeColor:    GeoFormatUnorm8,
+			GeoAttributeWeights:  GeoFormatUnorm16,
+		}
+		return nil
+	}
+}
+
+// Compresses every stream with lz4, level is in [0, 9] and 0 is the fast mode
+func OptGeoCompress(level int) MeshEncodeOption {
+	levels := []lz4.CompressionLevel{lz4.Fast, lz4.Level1, lz4.Level2, lz4.Level3, lz4.Level4, lz4.Level5, lz4.Level6, lz4.Level7, lz4.Level8, lz4.Level9}
+	if level < 0 {
+		return nil
+	}
+
+	if level >= len(levels) {
+		level = len(levels) - 1
+	}
+
+	return func(ctx *MeshEncodeContext) error {
+		ctx.Compression = GeoCompressionLz4
+		ctx.level = levels[level]
+		return nil
+	}
+}
+
+func encodeMeshV2(bw *libio.BinaryWriter, mesh *Mesh, ctx *MeshEncodeContext) error {
+	header := GeoHeader{
+		Attributes:   GeoAttributePosition | GeoAttributeNormal | GeoAttributeTangent | GeoAttributeUv0,
+		VertexCount:  uint32(len(mesh.Vertices)),
+		IndexCount:   uint32(len(mesh.Indices)),
+		SubmeshCount: uint32(len(mesh.Submeshes)),
+		Compression:  ctx.Compression,
+		LodCount:     uint8(len(mesh.Lods)),
+		Bounds:       mesh.Bounds,
+	}
+	optional := []struct {
+		attribute GeoAttributes
+		name      string
+		count     int
+	}{
+		{GeoAttributeUv1, "uv1", len(mesh.Uv1)},
+		{GeoAttributeColor, "color", len(mesh.Colors)},
+		{GeoAttributeJoints, "joints", len(mesh.Joints)},
+		{GeoAttributeWeights, "weights", len(mesh.Weights)},
+	}
+	for _, attr := range optional {
+		if attr.count == 0 {
+			continue
+		}
+		if attr.count != len(mesh.Vertices) {
+			return fmt.Errorf("mesh has %d %s for %d vertices; name %q", attr.count, attr.name, len(mesh.Vertices), mesh.Name)
+		}
+		header.Attributes |= attr.attribute
+	}
+	if (header.Attributes&GeoAttributeJoints == 0) != (header.Attributes&GeoAttributeWeights == 0) {
+		return fmt.Errorf("mesh joints and weights must be used together; name %q", mesh.Name)
+	}
+	for i, sub := range mesh.Submeshes {
+		if sub.FirstIndex%3 != 0 || sub.IndexCount%3 != 0 || sub.FirstIndex < 0 || sub.IndexCount < 0 || sub.FirstIndex+sub.IndexCount > len(mesh.Indices) {
+			return fmt.Errorf("submesh %d indices %d+%d are out of range for %d indices; name %q", i, sub.FirstIndex, sub.IndexCount, len(mesh.Indices), mesh.Name)
+		}
+	}
+	if len(mesh.Lods) > 0xff {
+		return fmt.Errorf("mesh has %d lods, at most 255 are supported; name %q", len(mesh.Lods), mesh.Name)
+	}
+	for i, lod := range mesh.Lods {
+		if len(lod.Indices)%3 != 0 || len(lod.Submeshes) != len(mesh.Submeshes) {
+			return fmt.Errorf("mesh lod %d has %d indices and %d submeshes for %d submeshes; name %q", i, len(lod.Indices), len(lod.Submeshes), len(mesh.Submeshes), mesh.Name)
+		}
+		for j, sub := range lod.Submeshes {
+			if sub.FirstIndex%3 != 0 || sub.IndexCount%3 != 0 || sub.FirstIndex < 0 || sub.IndexCount < 0 || sub.FirstIndex+sub.IndexCount > len(lod.Indices) {
+				return fmt.Errorf("mesh lod %d submesh %d indices %d+%d are out of range for %d indices; name %q", i, j, sub.FirstIndex, sub.IndexCount, len(lod.Indices), mesh.Name)
+			}
+		}
+		for j, index := range lod.Indices {
+			if int(index) >= len(mesh.Vertices) {
+				return fmt.Errorf("mesh lod %d index %d at %d is out of range for %d vertices; name %q", i, index, j, len(mesh.Vertices), mesh.Name)
+			}
+		}
+	}
+
+	bw.WriteRef([]uint32{MagicNumberGEO2, uint32(GeoVersion2_000_000)})
+	bw.WriteRef(header)
+	writeGeoString(bw, mesh.Name)
+	for _, sub := range mesh.Submeshes {
+		bw.WriteRef(geoSubmeshHeader{FirstIndex: uint32(sub.FirstIndex), IndexCount: uint32(sub.IndexCount), Bounds: sub.Bounds})
+		writeGeoString(bw, sub.Material)
+	}
+	if bw.Err != nil {
+		return fmt.Errorf("could not write mesh header: %w", bw.Err)
+	}
+
+	if err := writeGeoIndices(bw, ctx, mesh.Indices); err != nil {
+		return fmt.Errorf("could not write mesh indices: %w", err)
+	}
+
+	for _, stream := range geoStreams {
+		if header.Attributes&stream.attribute == 0 {
+			continue
+		}
+		format, ok := ctx.Formats[stream.attribute]
+		if !ok {
+			format = stream.formats[0]
+		}
+		if stream.attribute == GeoAttributeJoints && ctx.Formats != nil && maxJoint(mesh.Joints) <= 0xff {
+			format = GeoFormatUint8
+		}
+		values := mesh.attribute(stream.attribute, format)
+		if err := writeGeoStream(bw, ctx, format, encodeGeoValues(format, stream.components, values)); err != nil {
+			return fmt.Errorf("could not write mesh %s: %w", stream.name, err)
+		}
+	}
+
+	for i, lod := range mesh.Lods {
+		bw.WriteRef(geoLodHeader{Error: lod.Error, IndexCount: uint32(len(lod.Indices))})
+		for _, sub := range lod.Submeshes {
+			bw.WriteRef([2]uint32{uint32(sub.FirstIndex), uint32(sub.IndexCount)})
+		}
+		if err := writeGeoIndices(bw, ctx, lod.Indices); err != nil {
+			return fmt.Errorf("could not write mesh lod %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Writes an index stream of 16 bit indices if they fit
+func writeGeoIndices(bw *libio.BinaryWriter, ctx *MeshEncodeContext, indices []uint32) error {
+	format := GeoFormatUint16
+	values := make([]float32, len(indices))
+	for i, index := range indices {
+		if index > 0xffff {
+			format = GeoFormatUint32
+		}
+		// exact for up to 2^24 vertices, more than the batches hold
+		values[i] = float32(index)
+	}
+	return writeGeoStream(bw, ctx, format, encodeGeoValues(format, 1, values))
+}
+
+func maxJoint(joints [][4]uint16) uint16 {
+	var result uint16
+	for _, j := range joints {
+		for _, v := range j {
+			if v > result {
+				result = v
+			}
+		}
+	}
+	return result
+}
+
+func writeGeoString(bw *libio.BinaryWriter, s string) {
+	bw.WriteUInt32(uint32(len(s)))
+	bw.WriteBytes([]byte(s))
+	bw.WriteBytes(make([]byte, padding4(len(s))))
+}
+
+func writeGeoStream(bw *libio.BinaryWriter, ctx *MeshEncodeContext, format GeoFormat, data []byte) error {
+	if ctx.Compression == GeoCompressionLz4 {
+		buf := new(bytes.Buffer)
+		lzw := lz4.NewWriter(buf)
+		if err := lzw.Apply(lz4.CompressionLevelOption(ctx.level)); err != nil {
+			return err
+		}
+		if _, err := lzw.Write(data); err != nil {
+			return err
+		}
+		if err := lzw.Close(); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+	bw.WriteRef(geoStreamHeader{Format: format, Size: uint32(len(data))})
+	bw.WriteBytes(data)
+	bw.WriteBytes(make([]byte, padding4(len(data))))
+	return bw.Err
+}
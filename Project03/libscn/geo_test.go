@@ -0,0 +1,139 @@
+package libscn_test
+
+import (
+	"advanced-gl/Project03/libio"
+	"advanced-gl/Project03/libscn"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/chewxy/math32"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// A cylinder with every optional attribute and a submesh for its two halves
+func attributeMesh() *libscn.Mesh {
+	vertices, indices := cylinderMesh(16)
+	mesh := &libscn.Mesh{Name: "cylinder", Vertices: libscn.GenerateTangents(vertices, indices), Indices: indices}
+	for i, v := range mesh.Vertices {
+		mesh.Uv1 = append(mesh.Uv1, v.Uv.Mul(0.5))
+		mesh.Colors = append(mesh.Colors, mgl32.Vec4{v.Uv[0], v.Uv[1], 0.25, 1})
+		mesh.Joints = append(mesh.Joints, [4]uint16{uint16(i % 3), 7, 0, 0})
+		mesh.Weights = append(mesh.Weights, mgl32.Vec4{v.Uv[1], 1 - v.Uv[1], 0, 0})
+	}
+	half := len(indices) / 6 * 3
+	mesh.Submeshes = []libscn.Submesh{
+		{Material: "front", FirstIndex: 0, IndexCount: half},
+		{Material: "back", FirstIndex: half, IndexCount: len(indices) - half},
+	}
+	mesh.UpdateBounds()
+	return mesh
+}
+
+func encodeMesh(t *testing.T, mesh *libscn.Mesh, options ...libscn.MeshEncodeOption) []byte {
+	buf := new(bytes.Buffer)
+	if err := libscn.EncodeMesh(buf, mesh, options...); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeMeshV2(t *testing.T) {
+	mesh := attributeMesh()
+	// the front half is at negative z
+	if front := mesh.Submeshes[0].Bounds; front.Min[2] != -1 || front.Max[2] > 1e-6 || mesh.Bounds.Min != (mgl32.Vec3{-1, 0, -1}) || mesh.Bounds.Max != (mgl32.Vec3{1, 1, 1}) {
+		t.Errorf("the bounds should contain the cylinder and its front half but were %v and %v", mesh.Bounds, front)
+	}
+
+	for _, compress := range []int{-1, 0, 9} {
+		result, err := libscn.DecodeMesh(bytes.NewReader(encodeMesh(t, mesh, libscn.OptGeoCompress(compress))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(result, mesh) {
+			t.Errorf("the mesh decoded with compression level %d should be equal to the encoded one", compress)
+		}
+	}
+
+	// the original format keeps the vertices and indices
+	v1, err := libscn.DecodeMesh(bytes.NewReader(encodeMesh(t, mesh, libscn.OptGeoVersion1())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v1.Vertices, mesh.Vertices) || !reflect.DeepEqual(v1.Indices, mesh.Indices) || v1.Submeshes != nil || v1.Colors != nil {
+		t.Errorf("version 1 should only keep the vertices and indices")
+	}
+}
+
+func TestDecodeMeshV2Quantized(t *testing.T) {
+	mesh := attributeMesh()
+	data := encodeMesh(t, mesh, libscn.OptGeoQuantize(), libscn.OptGeoCompress(0))
+	if uncompressed := encodeMesh(t, mesh); len(data) >= len(uncompressed)/2 {
+		t.Errorf("the quantized mesh should be less than half the size but was %d of %d bytes", len(data), len(uncompressed))
+	}
+	result, err := libscn.DecodeMesh(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Indices, mesh.Indices) || !reflect.DeepEqual(result.Joints, mesh.Joints) || !reflect.DeepEqual(result.Submeshes, mesh.Submeshes) {
+		t.Fatalf("indices, joints and submeshes should be lossless")
+	}
+
+	size := mesh.Bounds.Max.Sub(mesh.Bounds.Min)
+	for i, v := range result.Vertices {
+		expected := mesh.Vertices[i]
+		for c := 0; c < 3; c++ {
+			if d := math32.Abs(v.Position[c] - expected.Position[c]); d > size[c]/65535*0.5001 {
+				t.Errorf("vertex %d position %v should be within half a step of %v", i, v.Position, expected.Position)
+			}
+		}
+		// octahedral snorm16 normals are within 0.003 degrees, the cross product is precise for small angles
+		if angle := math32.Asin(v.Normal.Cross(expected.Normal).Len()); angle > mgl32.DegToRad(0.003) || math32.Abs(v.Normal.Len()-1) > 1e-6 {
+			t.Errorf("vertex %d normal %v should be within 0.003 degrees of %v", i, v.Normal, expected.Normal)
+		}
+		if v.Tangent.Sub(expected.Tangent).Len() > 1.0/0x7fff || v.Tangent[3] != expected.Tangent[3] {
+			t.Errorf("vertex %d tangent %v should be close to %v", i, v.Tangent, expected.Tangent)
+		}
+		// half floats have 11 significant bits
+		if !v.Uv.ApproxEqualThreshold(expected.Uv, 1.0/2048) || !result.Uv1[i].ApproxEqualThreshold(mesh.Uv1[i], 1.0/2048) {
+			t.Errorf("vertex %d uvs %v and %v should be close to %v and %v", i, v.Uv, result.Uv1[i], expected.Uv, mesh.Uv1[i])
+		}
+		if !result.Colors[i].ApproxEqualThreshold(mesh.Colors[i], 0.5/255) || !result.Weights[i].ApproxEqualThreshold(mesh.Weights[i], 0.5/65535) {
+			t.Errorf("vertex %d color %v and weights %v should be close to %v and %v", i, result.Colors[i], result.Weights[i], mesh.Colors[i], mesh.Weights[i])
+		}
+	}
+}
+
+func TestDecodeMeshV2Invalid(t *testing.T) {
+	mesh := attributeMesh()
+	data := encodeMesh(t, mesh)
+
+	// the index count of the first submesh follows the magic number, version, header, name and first index
+	invalid := append([]byte{}, data...)
+	binary.LittleEndian.PutUint32(invalid[8+44+4+8+4:], 3000)
+	_, err := libscn.DecodeMesh(bytes.NewReader(invalid))
+	var decodeErr *libio.DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Errorf("a submesh out of range should be a DecodeError but got: %v", err)
+	}
+
+	for _, size := range []int{20, 200, len(data) - 1} {
+		if _, err := libscn.DecodeMesh(bytes.NewReader(data[:size])); !errors.As(err, &decodeErr) || !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("a mesh cut at %d bytes should be an unexpected EOF but got: %v", size, err)
+		}
+	}
+
+	version := append([]byte{}, data...)
+	binary.LittleEndian.PutUint32(version[4:], 3_000_000)
+	if _, err := libscn.DecodeMesh(bytes.NewReader(version)); err == nil {
+		t.Errorf("unknown versions should be rejected")
+	}
+
+	mesh.Weights = nil
+	if err := libscn.EncodeMesh(new(bytes.Buffer), mesh); err == nil {
+		t.Errorf("joints without weights should be rejected")
+	}
+}
@@ -0,0 +1,733 @@
+package libscn
+
+import (
+	"advanced-gl/Project03/libio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"net/url"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	MagicNumberGLB   = 0x46546c67 // "glTF"
+	glbChunkJson     = 0x4e4f534a // "JSON"
+	glbChunkBin      = 0x004e4942 // "BIN\0"
+	gltfModeTriangle = 4
+)
+
+// A glTF 2.0 scene converted to the meshes of this module
+type GltfScene struct {
+	Meshes    []GltfMesh
+	Materials []GltfMaterial
+	// The nodes of the default scene which reference a mesh
+	Nodes []GltfNode
+}
+
+type GltfMesh struct {
+	Name string
+	// Each primitive is a separate mesh, as it can have a different material
+	Primitives []GltfPrimitive
+}
+
+type GltfPrimitive struct {
+	Mesh *Mesh
+	// The index into GltfScene.Materials, -1 for the default material
+	Material int
+}
+
+type GltfNode struct {
+	Name string
+	// The index into GltfScene.Meshes
+	Mesh int
+	// The model matrix of the node, including the transforms of its parents
+	Transform mgl32.Mat4
+}
+
+// The metallic roughness material of glTF, the textures are nil when they are not set
+type GltfMaterial struct {
+	Name            string
+	BaseColorFactor mgl32.Vec4
+	MetallicFactor  float32
+	RoughnessFactor float32
+	Albedo          *GltfImage
+	Normal          *GltfImage
+	// The metallic roughness texture, glTF stores roughness in green and metallic in blue like ORM textures
+	ORM *GltfImage
+}
+
+// An image is either a file relative to the glTF file, or embedded data
+type GltfImage struct {
+	URI      string
+	MimeType string
+	Data     []byte
+}
+
+type gltfDocument struct {
+	Asset struct {
+		Version string `json:"version"`
+	} `json:"asset"`
+	Scene  *int `json:"scene"`
+	Scenes []struct {
+		Nodes []int `json:"nodes"`
+	} `json:"scenes"`
+	Nodes []struct {
+		Name        string       `json:"name"`
+		Mesh        *int         `json:"mesh"`
+		Children    []int        `json:"children"`
+		Matrix      *[16]float32 `json:"matrix"`
+		Translation *[3]float32  `json:"translation"`
+		Rotation    *[4]float32  `json:"rotation"`
+		Scale       *[3]float32  `json:"scale"`
+	} `json:"nodes"`
+	Meshes []struct {
+		Name       string `json:"name"`
+		Primitives []struct {
+			Attributes map[string]int `json:"attributes"`
+			Indices    *int           `json:"indices"`
+			Material   *int           `json:"material"`
+			Mode       *int           `json:"mode"`
+		} `json:"primitives"`
+	} `json:"meshes"`
+	Accessors []struct {
+		BufferView    *int            `json:"bufferView"`
+		ByteOffset    int             `json:"byteOffset"`
+		ComponentType int             `json:"componentType"`
+		Normalized    bool            `json:"normalized"`
+		Count         int             `json:"count"`
+		Type          string          `json:"type"`
+		Sparse        json.RawMessage `json:"sparse"`
+	} `json:"accessors"`
+	BufferViews []struct {
+		Buffer     int `json:"buffer"`
+		ByteOffset int `json:"byteOffset"`
+		ByteLength int `json:"byteLength"`
+		ByteStride int `json:"byteStride"`
+	} `json:"bufferViews"`
+	Buffers []struct {
+		URI        string `json:"uri"`
+		ByteLength int    `json:"byteLength"`
+	} `json:"buffers"`
+	Materials []struct {
+		Name                 string `json:"name"`
+		PbrMetallicRoughness struct {
+			BaseColorFactor          *[4]float32      `json:"baseColorFactor"`
+			BaseColorTexture         *gltfTextureInfo `json:"baseColorTexture"`
+			MetallicFactor           *float32         `json:"metallicFactor"`
+			RoughnessFactor          *float32         `json:"roughnessFactor"`
+			MetallicRoughnessTexture *gltfTextureInfo `json:"metallicRoughnessTexture"`
+		} `json:"pbrMetallicRoughness"`
+		NormalTexture *gltfTextureInfo `json:"normalTexture"`
+	} `json:"materials"`
+	Textures []struct {
+		Source *int `json:"source"`
+	} `json:"textures"`
+	Images []struct {
+		URI        string `json:"uri"`
+		MimeType   string `json:"mimeType"`
+		BufferView *int   `json:"bufferView"`
+	} `json:"images"`
+}
+
+type gltfTextureInfo struct {
+	Index    int `json:"index"`
+	TexCoord int `json:"texCoord"`
+}
+
+// The number of components of the accessor types
+var gltfTypeComponents = map[string]int{
+	"SCALAR": 1,
+	"VEC2":   2,
+	"VEC3":   3,
+	"VEC4":   4,
+	"MAT4":   16,
+}
+
+// The size in bytes of the accessor component types
+var gltfComponentSizes = map[int]int{
+	5120: 1, // BYTE
+	5121: 1, // UNSIGNED_BYTE
+	5122: 2, // SHORT
+	5123: 2, // UNSIGNED_SHORT
+	5125: 4, // UNSIGNED_INT
+	5126: 4, // FLOAT
+}
+
+// Decodes a .gltf or .glb file, external buffers are read from fsys
+func DecodeGltf(r io.Reader, fsys fs.FS, options ...ImportOption) (scene *GltfScene, err error) {
+	ctx, err := newImportContext(options)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var bin []byte
+	if len(data) >= 4 && binary.LittleEndian.Uint32(data) == MagicNumberGLB {
+		data, bin, err = decodeGlb(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	doc := &gltfDocument{}
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("could not unmarshal gltf: %w", err)
+	}
+	if !strings.HasPrefix(doc.Asset.Version, "2.") {
+		return nil, fmt.Errorf("gltf version %q unsupported", doc.Asset.Version)
+	}
+
+	buffers := make([][]byte, len(doc.Buffers))
+	for i, buffer := range doc.Buffers {
+		if buffer.URI == "" {
+			if i != 0 || bin == nil {
+				return nil, fmt.Errorf("gltf buffer %d has no uri", i)
+			}
+			buffers[i] = bin
+		} else {
+			buffers[i], _, err = readGltfUri(buffer.URI, fsys)
+			if err != nil {
+				return nil, fmt.Errorf("could not read gltf buffer %d: %w", i, err)
+			}
+		}
+		if len(buffers[i]) < buffer.ByteLength {
+			return nil, fmt.Errorf("gltf buffer %d should have %d bytes but has %d", i, buffer.ByteLength, len(buffers[i]))
+		}
+	}
+
+	dec := &gltfDecoder{doc: doc, buffers: buffers}
+	scene = &GltfScene{}
+
+	for i := range doc.Meshes {
+		mesh, err := dec.mesh(i)
+		if err != nil {
+			return nil, err
+		}
+		for _, primitive := range mesh.Primitives {
+			ctx.process(primitive.Mesh)
+		}
+		scene.Meshes = append(scene.Meshes, mesh)
+	}
+	for i := range doc.Materials {
+		material, err := dec.material(i)
+		if err != nil {
+			return nil, err
+		}
+		scene.Materials = append(scene.Materials, material)
+	}
+	scene.Nodes, err = dec.nodes()
+	if err != nil {
+		return nil, err
+	}
+
+	return scene, nil
+}
+
+// Returns the json and binary chunk of a glb container
+func decodeGlb(data []byte) (jsonChunk []byte, binChunk []byte, err error) {
+	br := &libio.BinaryReader{
+		Src:   bytes.NewReader(data),
+		Order: binary.LittleEndian,
+	}
+
+	header := struct {
+		Check   uint32
+		Version uint32
+		Length  uint32
+	}{}
+	if !br.ReadRef(&header) {
+		return nil, nil, br.Errorf("expected glb header")
+	}
+	if header.Version != 2 {
+		return nil, nil, br.Errorf("glb version %d unsupported", header.Version)
+	}
+	if int(header.Length) > len(data) {
+		return nil, nil, br.Errorf("glb length %d exceeds the %d bytes of the file", header.Length, len(data))
+	}
+
+	for br.Index < int(header.Length) {
+		chunk := struct {
+			Length uint32
+			Type   uint32
+		}{}
+		if !br.ReadRef(&chunk) {
+			return nil, nil, br.Errorf("expected glb chunk header")
+		}
+		content, ok := br.ReadView(int(chunk.Length))
+		if !ok {
+			return nil, nil, br.Errorf("expected %d bytes of glb chunk 0x%08x", chunk.Length, chunk.Type)
+		}
+		switch {
+		case chunk.Type == glbChunkJson && jsonChunk == nil:
+			jsonChunk = content
+		case chunk.Type == glbChunkBin && binChunk == nil:
+			binChunk = content
+		}
+		// other chunks are extensions and must be ignored
+	}
+	if jsonChunk == nil {
+		return nil, nil, libio.NewDecodeError(br.Index, nil, "glb has no json chunk")
+	}
+	return jsonChunk, binChunk, nil
+}
+
+// Reads a data uri or a file of fsys
+func readGltfUri(uri string, fsys fs.FS) (data []byte, mimeType string, err error) {
+	if rest, ok := strings.CutPrefix(uri, "data:"); ok {
+		meta, payload, ok := strings.Cut(rest, ",")
+		if !ok || !strings.HasSuffix(meta, ";base64") {
+			return nil, "", fmt.Errorf("data uri is not base64 encoded")
+		}
+		data, err = base64.StdEncoding.DecodeString(payload)
+		return data, strings.TrimSuffix(meta, ";base64"), err
+	}
+
+	name, err := url.PathUnescape(uri)
+	if err != nil {
+		return nil, "", err
+	}
+	if fsys == nil {
+		return nil, "", fmt.Errorf("external file %q cannot be read", name)
+	}
+	data, err = fs.ReadFile(fsys, name)
+	return data, "", err
+}
+
+type gltfDecoder struct {
+	doc     *gltfDocument
+	buffers [][]byte
+}
+
+func (dec *gltfDecoder) mesh(index int) (GltfMesh, error) {
+	desc := dec.doc.Meshes[index]
+	mesh := GltfMesh{Name: desc.Name}
+	if mesh.Name == "" {
+		mesh.Name = fmt.Sprintf("mesh%d", index)
+	}
+
+	for i, prim := range desc.Primitives {
+		name := mesh.Name
+		if len(desc.Primitives) > 1 {
+			name = fmt.Sprintf("%s.%d", mesh.Name, i)
+		}
+		if prim.Mode != nil && *prim.Mode != gltfModeTriangle {
+			return mesh, fmt.Errorf("gltf mesh %q uses primitive mode %d, only triangles are supported", name, *prim.Mode)
+		}
+
+		positionAccessor, ok := prim.Attributes["POSITION"]
+		if !ok {
+			return mesh, fmt.Errorf("gltf mesh %q has no positions", name)
+		}
+		positions, err := dec.floats(positionAccessor, 3)
+		if err != nil {
+			return mesh, fmt.Errorf("gltf mesh %q positions: %w", name, err)
+		}
+		count := len(positions) / 3
+
+		vertices := make([]Vertex, count)
+		for v := range vertices {
+			vertices[v].Position = mgl32.Vec3{positions[v*3+0], positions[v*3+1], positions[v*3+2]}
+		}
+
+		if accessor, ok := prim.Attributes["NORMAL"]; ok {
+			normals, err := dec.floats(accessor, 3)
+			if err != nil || len(normals) != count*3 {
+				return mesh, fmt.Errorf("gltf mesh %q normals do not match the positions: %v", name, err)
+			}
+			for v := range vertices {
+				vertices[v].Normal = mgl32.Vec3{normals[v*3+0], normals[v*3+1], normals[v*3+2]}
+			}
+		}
+		if accessor, ok := prim.Attributes["TEXCOORD_0"]; ok {
+			uvs, err := dec.floats(accessor, 2)
+			if err != nil || len(uvs) != count*2 {
+				return mesh, fmt.Errorf("gltf mesh %q uvs do not match the positions: %v", name, err)
+			}
+			for v := range vertices {
+				// glTF has the origin of uvs at the top left, the textures of this module are flipped
+				vertices[v].Uv = mgl32.Vec2{uvs[v*2+0], 1 - uvs[v*2+1]}
+			}
+		}
+
+		var indices []uint32
+		if prim.Indices != nil {
+			indices, err = dec.indices(*prim.Indices)
+			if err != nil {
+				return mesh, fmt.Errorf("gltf mesh %q indices: %w", name, err)
+			}
+		} else {
+			indices = make([]uint32, count)
+			for v := range indices {
+				indices[v] = uint32(v)
+			}
+		}
+		if len(indices)%3 != 0 {
+			return mesh, fmt.Errorf("gltf mesh %q index count %d is not a multiple of 3", name, len(indices))
+		}
+		for _, index := range indices {
+			if int(index) >= count {
+				return mesh, fmt.Errorf("gltf mesh %q index %d is out of range for %d vertices", name, index, count)
+			}
+		}
+
+		if accessor, ok := prim.Attributes["TANGENT"]; ok {
+			tangents, err := dec.floats(accessor, 4)
+			if err != nil || len(tangents) != count*4 {
+				return mesh, fmt.Errorf("gltf mesh %q tangents do not match the positions: %v", name, err)
+			}
+			for v := range vertices {
+				// w is the handedness like in this module, the bitangent points along v of the flipped uvs like the normal maps of glTF
+				vertices[v].Tangent = mgl32.Vec4{tangents[v*4+0], tangents[v*4+1], tangents[v*4+2], tangents[v*4+3]}
+			}
+		} else {
+			// glTF asks for MikkTSpace tangents when they are missing
+			vertices = GenerateTangents(vertices, indices)
+		}
+
+		material := -1
+		if prim.Material != nil {
+			material = *prim.Material
+			if material < 0 || material >= len(dec.doc.Materials) {
+				return mesh, fmt.Errorf("gltf mesh %q references undefined material %d", name, material)
+			}
+		}
+
+		primitive := &Mesh{
+			Name:     name,
+			Vertices: vertices,
+			Indices:  indices,
+		}
+		primitive.UpdateBounds()
+		mesh.Primitives = append(mesh.Primitives, GltfPrimitive{
+			Mesh:     primitive,
+			Material: material,
+		})
+	}
+
+	return mesh, nil
+}
+
+// Returns the elements of an accessor, with components of a vector type
+func (dec *gltfDecoder) accessor(index int, components int) (data []byte, stride int, componentType int, count int, err error) {
+	if index < 0 || index >= len(dec.doc.Accessors) {
+		return nil, 0, 0, 0, fmt.Errorf("undefined accessor %d", index)
+	}
+	acc := dec.doc.Accessors[index]
+	if acc.Sparse != nil {
+		return nil, 0, 0, 0, fmt.Errorf("sparse accessor %d unsupported", index)
+	}
+	if n, ok := gltfTypeComponents[acc.Type]; !ok || n != components {
+		return nil, 0, 0, 0, fmt.Errorf("accessor %d has type %q but should have %d components", index, acc.Type, components)
+	}
+	size, ok := gltfComponentSizes[acc.ComponentType]
+	if !ok {
+		return nil, 0, 0, 0, fmt.Errorf("accessor %d has unknown component type %d", index, acc.ComponentType)
+	}
+	elementSize := size * components
+	if acc.Count < 0 || acc.Count > libio.DefaultMaxAlloc/elementSize {
+		return nil, 0, 0, 0, fmt.Errorf("accessor %d has an invalid count %d", index, acc.Count)
+	}
+	if acc.BufferView == nil {
+		// initialized with zeros
+		return make([]byte, acc.Count*elementSize), elementSize, acc.ComponentType, acc.Count, nil
+	}
+
+	if *acc.BufferView < 0 || *acc.BufferView >= len(dec.doc.BufferViews) {
+		return nil, 0, 0, 0, fmt.Errorf("accessor %d references undefined buffer view %d", index, *acc.BufferView)
+	}
+	view := dec.doc.BufferViews[*acc.BufferView]
+	if view.Buffer < 0 || view.Buffer >= len(dec.buffers) {
+		return nil, 0, 0, 0, fmt.Errorf("buffer view %d references undefined buffer %d", *acc.BufferView, view.Buffer)
+	}
+	buffer := dec.buffers[view.Buffer]
+	if view.ByteOffset < 0 || view.ByteLength < 0 || view.ByteOffset+view.ByteLength > len(buffer) {
+		return nil, 0, 0, 0, fmt.Errorf("buffer view %d is out of range", *acc.BufferView)
+	}
+	data = buffer[view.ByteOffset : view.ByteOffset+view.ByteLength]
+
+	stride = elementSize
+	if view.ByteStride != 0 {
+		stride = view.ByteStride
+	}
+	if acc.ByteOffset < 0 || acc.ByteOffset > len(data) || (acc.Count > 0 && acc.ByteOffset+(acc.Count-1)*stride+elementSize > len(data)) {
+		return nil, 0, 0, 0, fmt.Errorf("accessor %d is out of range of buffer view %d", index, *acc.BufferView)
+	}
+	return data[acc.ByteOffset:], stride, acc.ComponentType, acc.Count, nil
+}
+
+// Reads an accessor as floats, normalized integers are converted to [0, 1] or [-1, 1]
+func (dec *gltfDecoder) floats(index int, components int) ([]float32, error) {
+	data, stride, componentType, count, err := dec.accessor(index, components)
+	if err != nil {
+		return nil, err
+	}
+	normalized := dec.doc.Accessors[index].Normalized
+	size := gltfComponentSizes[componentType]
+
+	result := make([]float32, count*components)
+	for i := 0; i < count; i++ {
+		for c := 0; c < components; c++ {
+			p := data[i*stride+c*size:]
+			var v float32
+			switch componentType {
+			case 5120:
+				v = float32(int8(p[0]))
+				if normalized {
+					v = float32(math.Max(float64(v)/127, -1))
+				}
+			case 5121:
+				v = float32(p[0])
+				if normalized {
+					v /= 0xff
+				}
+			case 5122:
+				v = float32(int16(binary.LittleEndian.Uint16(p)))
+				if normalized {
+					v = float32(math.Max(float64(v)/32767, -1))
+				}
+			case 5123:
+				v = float32(binary.LittleEndian.Uint16(p))
+				if normalized {
+					v /= 0xffff
+				}
+			case 5125:
+				v = float32(binary.LittleEndian.Uint32(p))
+			case 5126:
+				v = math.Float32frombits(binary.LittleEndian.Uint32(p))
+			}
+			result[i*components+c] = v
+		}
+	}
+	return result, nil
+}
+
+func (dec *gltfDecoder) indices(index int) ([]uint32, error) {
+	data, stride, componentType, count, err := dec.accessor(index, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]uint32, count)
+	for i := range result {
+		p := data[i*stride:]
+		switch componentType {
+		case 5121:
+			result[i] = uint32(p[0])
+		case 5123:
+			result[i] = uint32(binary.LittleEndian.Uint16(p))
+		case 5125:
+			result[i] = binary.LittleEndian.Uint32(p)
+		default:
+			return nil, fmt.Errorf("index accessor %d has component type %d", index, componentType)
+		}
+	}
+	return result, nil
+}
+
+func (dec *gltfDecoder) material(index int) (GltfMaterial, error) {
+	desc := dec.doc.Materials[index]
+	pbr := desc.PbrMetallicRoughness
+	material := GltfMaterial{
+		Name:            desc.Name,
+		BaseColorFactor: mgl32.Vec4{1, 1, 1, 1},
+		MetallicFactor:  1,
+		RoughnessFactor: 1,
+	}
+	if material.Name == "" {
+		material.Name = fmt.Sprintf("material%d", index)
+	}
+	if pbr.BaseColorFactor != nil {
+		material.BaseColorFactor = *pbr.BaseColorFactor
+	}
+	if pbr.MetallicFactor != nil {
+		material.MetallicFactor = *pbr.MetallicFactor
+	}
+	if pbr.RoughnessFactor != nil {
+		material.RoughnessFactor = *pbr.RoughnessFactor
+	}
+
+	var err error
+	if material.Albedo, err = dec.image(pbr.BaseColorTexture); err != nil {
+		return material, fmt.Errorf("gltf material %q base color: %w", material.Name, err)
+	}
+	if material.Normal, err = dec.image(desc.NormalTexture); err != nil {
+		return material, fmt.Errorf("gltf material %q normal: %w", material.Name, err)
+	}
+	if material.ORM, err = dec.image(pbr.MetallicRoughnessTexture); err != nil {
+		return material, fmt.Errorf("gltf material %q metallic roughness: %w", material.Name, err)
+	}
+	return material, nil
+}
+
+func (dec *gltfDecoder) image(info *gltfTextureInfo) (*GltfImage, error) {
+	if info == nil {
+		return nil, nil
+	}
+	if info.TexCoord != 0 {
+		return nil, fmt.Errorf("texture coordinates %d unsupported", info.TexCoord)
+	}
+	if info.Index < 0 || info.Index >= len(dec.doc.Textures) || dec.doc.Textures[info.Index].Source == nil {
+		return nil, fmt.Errorf("undefined texture %d", info.Index)
+	}
+	source := *dec.doc.Textures[info.Index].Source
+	if source < 0 || source >= len(dec.doc.Images) {
+		return nil, fmt.Errorf("texture %d references undefined image %d", info.Index, source)
+	}
+	desc := dec.doc.Images[source]
+
+	img := &GltfImage{MimeType: desc.MimeType}
+	switch {
+	case desc.BufferView != nil:
+		viewIndex := *desc.BufferView
+		if viewIndex < 0 || viewIndex >= len(dec.doc.BufferViews) {
+			return nil, fmt.Errorf("image %d references undefined buffer view %d", source, viewIndex)
+		}
+		view := dec.doc.BufferViews[viewIndex]
+		if view.Buffer < 0 || view.Buffer >= len(dec.buffers) || view.ByteOffset < 0 || view.ByteLength < 0 || view.ByteOffset+view.ByteLength > len(dec.buffers[view.Buffer]) {
+			return nil, fmt.Errorf("buffer view %d of image %d is out of range", viewIndex, source)
+		}
+		img.Data = dec.buffers[view.Buffer][view.ByteOffset : view.ByteOffset+view.ByteLength]
+	case strings.HasPrefix(desc.URI, "data:"):
+		data, mimeType, err := readGltfUri(desc.URI, nil)
+		if err != nil {
+			return nil, fmt.Errorf("image %d: %w", source, err)
+		}
+		img.Data, img.MimeType = data, mimeType
+	default:
+		uri, err := url.PathUnescape(desc.URI)
+		if err != nil {
+			return nil, fmt.Errorf("image %d: %w", source, err)
+		}
+		img.URI = uri
+	}
+	return img, nil
+}
+
+// Returns the nodes with meshes of the default scene, or of all root nodes when there are no scenes
+func (dec *gltfDecoder) nodes() ([]GltfNode, error) {
+	nodes := dec.doc.Nodes
+	var roots []int
+	if len(dec.doc.Scenes) > 0 {
+		scene := 0
+		if dec.doc.Scene != nil {
+			scene = *dec.doc.Scene
+		}
+		if scene < 0 || scene >= len(dec.doc.Scenes) {
+			return nil, fmt.Errorf("gltf scene %d is undefined", scene)
+		}
+		roots = dec.doc.Scenes[scene].Nodes
+	} else {
+		isChild := make([]bool, len(nodes))
+		for _, node := range nodes {
+			for _, child := range node.Children {
+				if child >= 0 && child < len(nodes) {
+					isChild[child] = true
+				}
+			}
+		}
+		for i := range nodes {
+			if !isChild[i] {
+				roots = append(roots, i)
+			}
+		}
+	}
+
+	result := []GltfNode{}
+	visited := make([]bool, len(nodes))
+	var visit func(index int, parent mgl32.Mat4) error
+	visit = func(index int, parent mgl32.Mat4) error {
+		if index < 0 || index >= len(nodes) {
+			return fmt.Errorf("gltf node %d is undefined", index)
+		}
+		if visited[index] {
+			// the node hierarchy must be a forest
+			return fmt.Errorf("gltf node %d has more than one parent", index)
+		}
+		visited[index] = true
+
+		node := nodes[index]
+		local := mgl32.Ident4()
+		if node.Matrix != nil {
+			local = mgl32.Mat4(*node.Matrix)
+		} else {
+			if node.Translation != nil {
+				t := *node.Translation
+				local = mgl32.Translate3D(t[0], t[1], t[2])
+			}
+			if node.Rotation != nil {
+				r := *node.Rotation
+				local = local.Mul4(mgl32.Quat{W: r[3], V: mgl32.Vec3{r[0], r[1], r[2]}}.Normalize().Mat4())
+			}
+			if node.Scale != nil {
+				s := *node.Scale
+				local = local.Mul4(mgl32.Scale3D(s[0], s[1], s[2]))
+			}
+		}
+		transform := parent.Mul4(local)
+
+		if node.Mesh != nil {
+			if *node.Mesh < 0 || *node.Mesh >= len(dec.doc.Meshes) {
+				return fmt.Errorf("gltf node %d references undefined mesh %d", index, *node.Mesh)
+			}
+			name := node.Name
+			if name == "" {
+				name = fmt.Sprintf("node%d", index)
+			}
+			result = append(result, GltfNode{Name: name, Mesh: *node.Mesh, Transform: transform})
+		}
+		for _, child := range node.Children {
+			if err := visit(child, transform); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, root := range roots {
+		if err := visit(root, mgl32.Ident4()); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// Merges the primitives of all nodes into a single mesh in world space, ignoring their materials
+func (scene *GltfScene) Flatten(name string) *Mesh {
+	result := &Mesh{Name: name}
+	for _, node := range scene.Nodes {
+		normalMatrix := node.Transform.Mat3().Inv().Transpose()
+		// mirroring transforms flip the handedness
+		handedness := float32(1)
+		if node.Transform.Mat3().Det() < 0 {
+			handedness = -1
+		}
+		for _, prim := range scene.Meshes[node.Mesh].Primitives {
+			base := uint32(len(result.Vertices))
+			for _, v := range prim.Mesh.Vertices {
+				v.Position = node.Transform.Mul4x1(v.Position.Vec4(1)).Vec3()
+				if v.Normal = normalMatrix.Mul3x1(v.Normal); v.Normal.Len() > 0 {
+					v.Normal = v.Normal.Normalize()
+				}
+				if tangent := node.Transform.Mat3().Mul3x1(v.Tangent.Vec3()); tangent.Len() > 0 {
+					v.Tangent = tangent.Normalize().Vec4(v.Tangent[3] * handedness)
+				}
+				result.Vertices = append(result.Vertices, v)
+			}
+			for _, index := range prim.Mesh.Indices {
+				result.Indices = append(result.Indices, base+index)
+			}
+		}
+	}
+	result.UpdateBounds()
+	return result
+}
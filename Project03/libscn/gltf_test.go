@@ -0,0 +1,156 @@
+package libscn_test
+
+import (
+	"advanced-gl/Project03/libscn"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// The binary buffer of a quad in the xy plane with normals, uvs, tangents and 16 bit indices
+func gltfQuadBuffer() []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}})
+	binary.Write(buf, binary.LittleEndian, []mgl32.Vec3{{0, 0, 1}, {0, 0, 1}, {0, 0, 1}, {0, 0, 1}})
+	// glTF uvs start at the top left
+	binary.Write(buf, binary.LittleEndian, []mgl32.Vec2{{0, 1}, {1, 1}, {1, 0}, {0, 0}})
+	binary.Write(buf, binary.LittleEndian, []mgl32.Vec4{{1, 0, 0, 1}, {1, 0, 0, 1}, {1, 0, 0, 1}, {1, 0, 0, 1}})
+	binary.Write(buf, binary.LittleEndian, []uint16{0, 1, 2, 0, 2, 3})
+	return buf.Bytes()
+}
+
+func gltfQuadDocument(bufferUri string, withTangents bool) map[string]any {
+	attributes := map[string]any{"POSITION": 0, "NORMAL": 1, "TEXCOORD_0": 2}
+	if withTangents {
+		attributes["TANGENT"] = 3
+	}
+	buffer := map[string]any{"byteLength": 4*12 + 4*12 + 4*8 + 4*16 + 6*2}
+	if bufferUri != "" {
+		buffer["uri"] = bufferUri
+	}
+	return map[string]any{
+		"asset":  map[string]any{"version": "2.0"},
+		"scene":  0,
+		"scenes": []any{map[string]any{"nodes": []int{0}}},
+		"nodes": []any{
+			map[string]any{"name": "parent", "translation": []float32{10, 0, 0}, "children": []int{1}},
+			map[string]any{"name": "child", "mesh": 0, "scale": []float32{2, 2, 2}, "rotation": []float32{0, 0.7071068, 0, 0.7071068}},
+		},
+		"meshes": []any{map[string]any{
+			"name":       "quad",
+			"primitives": []any{map[string]any{"attributes": attributes, "indices": 4, "material": 0}},
+		}},
+		"materials": []any{map[string]any{
+			"name":                 "paint",
+			"pbrMetallicRoughness": map[string]any{"baseColorFactor": []float32{1, 0, 0, 1}, "metallicFactor": 0, "roughnessFactor": 0.5},
+		}},
+		"accessors": []any{
+			map[string]any{"bufferView": 0, "componentType": 5126, "count": 4, "type": "VEC3"},
+			map[string]any{"bufferView": 0, "byteOffset": 48, "componentType": 5126, "count": 4, "type": "VEC3"},
+			map[string]any{"bufferView": 0, "byteOffset": 96, "componentType": 5126, "count": 4, "type": "VEC2"},
+			map[string]any{"bufferView": 0, "byteOffset": 128, "componentType": 5126, "count": 4, "type": "VEC4"},
+			map[string]any{"bufferView": 1, "componentType": 5123, "count": 6, "type": "SCALAR"},
+		},
+		"bufferViews": []any{
+			map[string]any{"buffer": 0, "byteLength": 192},
+			map[string]any{"buffer": 0, "byteOffset": 192, "byteLength": 12},
+		},
+		"buffers": []any{buffer},
+	}
+}
+
+func encodeGlb(doc map[string]any, bin []byte) []byte {
+	jsonChunk, _ := json.Marshal(doc)
+	for len(jsonChunk)%4 != 0 {
+		jsonChunk = append(jsonChunk, ' ')
+	}
+	for len(bin)%4 != 0 {
+		bin = append(bin, 0)
+	}
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, []uint32{libscn.MagicNumberGLB, 2, uint32(12 + 8 + len(jsonChunk) + 8 + len(bin))})
+	binary.Write(buf, binary.LittleEndian, []uint32{uint32(len(jsonChunk)), 0x4e4f534a})
+	buf.Write(jsonChunk)
+	binary.Write(buf, binary.LittleEndian, []uint32{uint32(len(bin)), 0x004e4942})
+	buf.Write(bin)
+	return buf.Bytes()
+}
+
+func checkGltfQuad(t *testing.T, scene *libscn.GltfScene) {
+	if len(scene.Meshes) != 1 || len(scene.Meshes[0].Primitives) != 1 || len(scene.Nodes) != 1 {
+		t.Fatalf("the scene should have one mesh with one primitive and one node but was %+v", scene)
+	}
+	prim := scene.Meshes[0].Primitives[0]
+	mesh := prim.Mesh
+	if mesh.Name != "quad" || len(mesh.Vertices) != 4 || len(mesh.Indices) != 6 || prim.Material != 0 {
+		t.Fatalf("the quad should have 4 vertices, 6 indices and material 0 but %q had %d, %d and %d", mesh.Name, len(mesh.Vertices), len(mesh.Indices), prim.Material)
+	}
+
+	v := mesh.Vertices[1]
+	if v.Position != (mgl32.Vec3{1, 0, 0}) || v.Normal != (mgl32.Vec3{0, 0, 1}) {
+		t.Errorf("vertex 1 should be at 1,0,0 facing z but was %v facing %v", v.Position, v.Normal)
+	}
+	if v.Uv != (mgl32.Vec2{1, 0}) {
+		t.Errorf("uvs should be flipped to start at the bottom left but vertex 1 had %v", v.Uv)
+	}
+	// u along x and v along y, after flipping the uvs
+	if tan, bitan := v.Tangent.Vec3(), v.Normal.Cross(v.Tangent.Vec3()).Mul(v.Tangent[3]); !tan.ApproxEqual(mgl32.Vec3{1, 0, 0}) || !bitan.ApproxEqual(mgl32.Vec3{0, 1, 0}) {
+		t.Errorf("the tangent frame should follow x and y but was %v and %v", tan, bitan)
+	}
+
+	node := scene.Nodes[0]
+	// the child is rotated by 90 degrees around y, scaled by 2 and then moved by its parent
+	if p := node.Transform.Mul4x1(mgl32.Vec4{1, 0, 0, 1}).Vec3(); !p.ApproxEqualThreshold(mgl32.Vec3{10, 0, -2}, 1e-5) {
+		t.Errorf("the node transform should map 1,0,0 to 10,0,-2 but mapped it to %v", p)
+	}
+
+	material := scene.Materials[0]
+	if material.Name != "paint" || material.BaseColorFactor != (mgl32.Vec4{1, 0, 0, 1}) || material.RoughnessFactor != 0.5 || material.MetallicFactor != 0 || material.Albedo != nil {
+		t.Errorf("the material should be a red paint without textures but was %+v", material)
+	}
+}
+
+func TestDecodeGltf(t *testing.T) {
+	bin := gltfQuadBuffer()
+	for _, withTangents := range []bool{true, false} {
+		data, _ := json.Marshal(gltfQuadDocument("data:application/octet-stream;base64,"+base64.StdEncoding.EncodeToString(bin), withTangents))
+		scene, err := libscn.DecodeGltf(bytes.NewReader(data), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkGltfQuad(t, scene)
+	}
+}
+
+func TestDecodeGlb(t *testing.T) {
+	scene, err := libscn.DecodeGltf(bytes.NewReader(encodeGlb(gltfQuadDocument("", true), gltfQuadBuffer())), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGltfQuad(t, scene)
+
+	mesh := scene.Flatten("quad")
+	if p := mesh.Vertices[1].Position; !p.ApproxEqualThreshold(mgl32.Vec3{10, 0, -2}, 1e-5) {
+		t.Errorf("flattened vertices should be in world space but vertex 1 was at %v", p)
+	}
+}
+
+func TestDecodeGltfInvalid(t *testing.T) {
+	bin := gltfQuadBuffer()
+	// an index out of range
+	bin[len(bin)-2] = 9
+	data, _ := json.Marshal(gltfQuadDocument("data:application/octet-stream;base64,"+base64.StdEncoding.EncodeToString(bin), true))
+	if _, err := libscn.DecodeGltf(bytes.NewReader(data), nil); err == nil {
+		t.Errorf("indices out of range should be rejected")
+	}
+
+	doc := gltfQuadDocument("", true)
+	doc["accessors"].([]any)[0].(map[string]any)["count"] = 100
+	if _, err := libscn.DecodeGltf(bytes.NewReader(encodeGlb(doc, gltfQuadBuffer())), nil); err == nil {
+		t.Errorf("accessors out of range of their buffer view should be rejected")
+	}
+}
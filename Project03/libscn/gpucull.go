@@ -0,0 +1,184 @@
+package libscn
+
+import (
+	"advanced-gl/Project03/libgl"
+	"advanced-gl/Project03/libutil"
+	_ "embed"
+	"errors"
+
+	"github.com/go-gl/gl/v4.5-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+//go:embed cull.comp
+var glslCullSrc string
+
+//go:embed depth_pyramid.comp
+var glslDepthPyramidSrc string
+
+// the local work group sizes of cull.comp and depth_pyramid.comp
+const cullWorkGroupSize = 64
+const depthPyramidWorkGroupSize = 8
+
+// Culls the instances of a RenderBatch in a compute shader and compacts the commands of the visible ones into
+// the CommandBuffer of the batch. The draw counts are written to CountBuffer, so the material slices are drawn with
+// glMultiDrawElementsIndirectCount (GL_ARB_indirect_parameters) and the CPU never reads the result.
+type GpuCuller struct {
+	// A CullInstance for each instance of the batch
+	InstanceBuffer libgl.UnboundBuffer
+	// A uint32 draw count for each material slice, the GL_PARAMETER_BUFFER of the draw
+	CountBuffer libgl.UnboundBuffer
+	// The r32f depth pyramid of the last UpdatePyramid for occlusion culling, nil before it
+	Pyramid       libgl.UnboundTexture
+	pyramidSize   [2]int
+	pyramidLevels int
+	shader        libgl.UnboundShaderPipeline
+	pyramidShader libgl.UnboundShaderPipeline
+	// The contents of InstanceBuffer
+	instances      []CullInstance
+	instancesDirty dirtyRange
+}
+
+// Returns an error when the context does not support GL_ARB_indirect_parameters
+func NewGpuCuller() (culler *GpuCuller, err error) {
+	if !libgl.HasExtension("GL_ARB_indirect_parameters") {
+		return nil, errors.New("gpu culling requires GL_ARB_indirect_parameters")
+	}
+
+	cleanup := []libutil.Deleter{}
+	defer func() {
+		if err != nil {
+			for _, v := range cleanup {
+				v.Delete()
+			}
+		}
+	}()
+
+	shader := libgl.NewPipeline()
+	cleanup = append(cleanup, shader)
+	csh := libgl.NewShader(glslCullSrc, gl.COMPUTE_SHADER)
+	cleanup = append(cleanup, csh)
+	if err := csh.Compile(); err != nil {
+		return nil, err
+	}
+	shader.Attach(csh, gl.COMPUTE_SHADER_BIT)
+
+	pyramidShader := libgl.NewPipeline()
+	cleanup = append(cleanup, pyramidShader)
+	psh := libgl.NewShader(glslDepthPyramidSrc, gl.COMPUTE_SHADER)
+	cleanup = append(cleanup, psh)
+	if err := psh.Compile(); err != nil {
+		return nil, err
+	}
+	pyramidShader.Attach(psh, gl.COMPUTE_SHADER_BIT)
+
+	instances := libgl.NewBuffer()
+	instances.AllocateEmpty(CullInstanceSize*1024, gl.DYNAMIC_STORAGE_BIT)
+	counts := libgl.NewBuffer()
+	counts.AllocateEmpty(4*1024, gl.DYNAMIC_STORAGE_BIT)
+
+	return &GpuCuller{
+		InstanceBuffer: instances,
+		CountBuffer:    counts,
+		shader:         shader,
+		pyramidShader:  pyramidShader,
+	}, nil
+}
+
+// Uploads the changed instances of the batch and culls them against the view projection, with occlusion culling against
+// the pyramid if there is one. The commands of slice i are drawn with
+//
+//	gl.MultiDrawElementsIndirectCountARB(gl.TRIANGLES, gl.UNSIGNED_INT, gl.PtrOffset(slice.ElementOffset), i*4, int32(slice.ElementCount), 0)
+//
+// while CommandBuffer is bound to GL_DRAW_INDIRECT_BUFFER and CountBuffer to GL_PARAMETER_BUFFER.
+func (culler *GpuCuller) Cull(batch *RenderBatch, viewProjection mgl32.Mat4, occlusion bool) []MaterialSlice {
+	instances, materials := batch.GenerateCullInstances()
+	commandCount := 0
+	for _, slice := range materials {
+		commandCount += slice.ElementCount
+	}
+	batch.CommandBuffer.Grow(commandCount * DrawCommandSize)
+	batch.TotatCommandRange = [2]int{0, commandCount}
+	culler.CountBuffer.Grow(len(materials) * 4)
+	gl.ClearNamedBufferSubData(culler.CountBuffer.Id(), gl.R32UI, 0, len(materials)*4, gl.RED_INTEGER, gl.UNSIGNED_INT, nil)
+	if len(instances) == 0 {
+		return materials
+	}
+	// only the instances that changed since the last call are uploaded
+	for i := range instances {
+		setDirty(&culler.instances, i, instances[i], &culler.instancesDirty)
+	}
+	culler.instances = culler.instances[:len(instances)]
+	if !culler.instancesDirty.empty() {
+		culler.InstanceBuffer.Grow(len(instances) * CullInstanceSize)
+		writeDirty(culler.InstanceBuffer, culler.instances, culler.instancesDirty, CullInstanceSize)
+		culler.instancesDirty.reset()
+	}
+
+	culler.shader.Bind()
+	culler.InstanceBuffer.BindBase(gl.SHADER_STORAGE_BUFFER, 0)
+	batch.CommandBuffer.BindBase(gl.SHADER_STORAGE_BUFFER, 1)
+	culler.CountBuffer.BindBase(gl.SHADER_STORAGE_BUFFER, 2)
+	stage := culler.shader.ComputeStage()
+	stage.SetUniform("u_instance_count", len(instances))
+	for i, plane := range NewFrustum(viewProjection) {
+		stage.SetUniformIndexed("u_frustum", i, plane.Normal.Vec4(plane.Distance))
+	}
+	stage.SetUniform("u_view_projection_mat", viewProjection)
+	if occlusion && culler.Pyramid != nil {
+		culler.Pyramid.Bind(0)
+		stage.SetUniform("u_occlusion", 1)
+	} else {
+		stage.SetUniform("u_occlusion", 0)
+	}
+	gl.DispatchCompute(uint32((len(instances)+cullWorkGroupSize-1)/cullWorkGroupSize), 1, 1)
+	// the commands and counts are read by the draw
+	gl.MemoryBarrier(gl.COMMAND_BARRIER_BIT)
+
+	return materials
+}
+
+// Builds the depth pyramid used by the next Cull from a depth texture of the size, usually the depth
+// attachment of the frame that was just rendered
+func (culler *GpuCuller) UpdatePyramid(depth libgl.UnboundTexture, width, height int) {
+	if culler.pyramidSize != [2]int{width, height} {
+		if culler.Pyramid != nil {
+			culler.Pyramid.Delete()
+		}
+		culler.pyramidLevels = DepthPyramidLevels(width, height)
+		culler.Pyramid = libgl.NewTexture(gl.TEXTURE_2D)
+		culler.Pyramid.SetDebugLabel("depth_pyramid")
+		culler.Pyramid.Allocate(culler.pyramidLevels, gl.R32F, width, height, 0)
+		culler.pyramidSize = [2]int{width, height}
+	}
+
+	culler.pyramidShader.Bind()
+	depth.Bind(0)
+	stage := culler.pyramidShader.ComputeStage()
+	w, h := width, height
+	for level := 0; level < culler.pyramidLevels; level++ {
+		if level > 0 {
+			culler.Pyramid.BindImage(0, level-1, false, 0, gl.READ_ONLY, gl.R32F)
+			w, h = libutil.MaxI(w/2, 1), libutil.MaxI(h/2, 1)
+		}
+		culler.Pyramid.BindImage(1, level, false, 0, gl.WRITE_ONLY, gl.R32F)
+		stage.SetUniform("u_level", level)
+		gl.DispatchCompute(uint32((w+depthPyramidWorkGroupSize-1)/depthPyramidWorkGroupSize), uint32((h+depthPyramidWorkGroupSize-1)/depthPyramidWorkGroupSize), 1)
+		// the next level loads this one
+		gl.MemoryBarrier(gl.SHADER_IMAGE_ACCESS_BARRIER_BIT)
+	}
+	// the culling shader fetches the pyramid
+	gl.MemoryBarrier(gl.TEXTURE_FETCH_BARRIER_BIT)
+}
+
+func (culler *GpuCuller) Delete() {
+	culler.shader.ComputeStage().Delete()
+	culler.shader.Delete()
+	culler.pyramidShader.ComputeStage().Delete()
+	culler.pyramidShader.Delete()
+	culler.InstanceBuffer.Delete()
+	culler.CountBuffer.Delete()
+	if culler.Pyramid != nil {
+		culler.Pyramid.Delete()
+	}
+}
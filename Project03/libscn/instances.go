@@ -0,0 +1,91 @@
+package libscn
+
+import "log"
+
+// The instances of a RenderBatch by material, with stable handles and reusable attribute slots.
+// It holds no GL objects, the batch mirrors the slots in its buffers.
+type instanceSet struct {
+	materials  []MaterialSlice
+	index      map[InstanceHandle]instanceRef
+	nextHandle InstanceHandle
+	freeSlots  []int
+	// The number of slots handed out so far, including the free ones
+	slots int
+}
+
+// Identifies an instance of a RenderBatch until it is removed
+type InstanceHandle uint32
+
+// The position of an instance in the material slices
+type instanceRef struct {
+	material int
+	index    int
+}
+
+func newInstanceSet() instanceSet {
+	return instanceSet{
+		materials: []MaterialSlice{},
+		index:     map[InstanceHandle]instanceRef{},
+	}
+}
+
+// Assigns a handle and an attribute slot to the instance and appends it to the slice of the material.
+// The returned pointer is valid until the next change of the set.
+func (set *instanceSet) add(material int, instance MeshInstance) *MeshInstance {
+	instance.Handle = set.nextHandle
+	instance.AttributeIndex = set.allocateSlot()
+	set.nextHandle++
+	set.insert(material, instance)
+	return set.instance(instance.Handle)
+}
+
+func (set *instanceSet) instance(handle InstanceHandle) *MeshInstance {
+	ref, ok := set.index[handle]
+	if !ok {
+		log.Panicf("Instance %d is not contained in this batch", handle)
+	}
+	return &set.materials[ref.material].instances[ref.index]
+}
+
+// Moves the instance to the slice of the material, it keeps its handle and slot
+func (set *instanceSet) setMaterial(handle InstanceHandle, material int) {
+	set.insert(material, set.detach(handle))
+}
+
+// Removes the instance, its handle becomes invalid and its slot is reused by the next add
+func (set *instanceSet) remove(handle InstanceHandle) MeshInstance {
+	instance := set.detach(handle)
+	set.freeSlots = append(set.freeSlots, instance.AttributeIndex)
+	return instance
+}
+
+func (set *instanceSet) insert(material int, instance MeshInstance) {
+	slice := &set.materials[material]
+	slice.instances = append(slice.instances, instance)
+	set.index[instance.Handle] = instanceRef{material: material, index: len(slice.instances) - 1}
+}
+
+// Removes the instance from its material slice by moving the last instance of the slice into its place
+func (set *instanceSet) detach(handle InstanceHandle) MeshInstance {
+	instance := *set.instance(handle)
+	ref := set.index[handle]
+	slice := &set.materials[ref.material]
+	last := len(slice.instances) - 1
+	if ref.index != last {
+		slice.instances[ref.index] = slice.instances[last]
+		set.index[slice.instances[ref.index].Handle] = ref
+	}
+	slice.instances = slice.instances[:last]
+	delete(set.index, handle)
+	return instance
+}
+
+func (set *instanceSet) allocateSlot() int {
+	if n := len(set.freeSlots); n > 0 {
+		slot := set.freeSlots[n-1]
+		set.freeSlots = set.freeSlots[:n-1]
+		return slot
+	}
+	set.slots++
+	return set.slots - 1
+}
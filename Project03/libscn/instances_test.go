@@ -0,0 +1,159 @@
+package libscn_test
+
+import (
+	"advanced-gl/Project03/libscn"
+	"testing"
+)
+
+// Checks that every instance of the material slices is found by its handle and that no slot is used twice
+func checkInstanceSet(t *testing.T, set *libscn.InstanceSet, materials int) {
+	t.Helper()
+	slots := map[int]libscn.InstanceHandle{}
+	for m := 0; m < materials; m++ {
+		for i, instance := range set.Instances(m) {
+			if found := set.Instance(instance.Handle); found != instance {
+				t.Errorf("instance %d of material %d should be found by handle %d but was %+v", i, m, instance.Handle, found)
+			}
+			if other, ok := slots[instance.AttributeIndex]; ok {
+				t.Errorf("instances %d and %d should not share slot %d", other, instance.Handle, instance.AttributeIndex)
+			}
+			slots[instance.AttributeIndex] = instance.Handle
+		}
+	}
+}
+
+// The meshes of the instances of the material in slice order
+func instanceMeshes(set *libscn.InstanceSet, material int) []int {
+	meshes := []int{}
+	for _, instance := range set.Instances(material) {
+		meshes = append(meshes, instance.MeshIndex)
+	}
+	return meshes
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestInstanceSetRemove(t *testing.T) {
+	set := libscn.NewInstanceSet(1)
+	handles := []libscn.InstanceHandle{}
+	for mesh := 0; mesh < 4; mesh++ {
+		handles = append(handles, set.Add(0, mesh))
+	}
+
+	// the last instance takes the place of the removed one
+	set.Remove(handles[1])
+	if meshes := instanceMeshes(set, 0); !equalInts(meshes, []int{0, 3, 2}) {
+		t.Errorf("removing the second instance should leave the meshes [0 3 2] but left %v", meshes)
+	}
+	if set.Instance(handles[3]).MeshIndex != 3 {
+		t.Errorf("the moved instance should still be found by its handle")
+	}
+	checkInstanceSet(t, set, 1)
+
+	set.Remove(handles[2])
+	if meshes := instanceMeshes(set, 0); !equalInts(meshes, []int{0, 3}) {
+		t.Errorf("removing the last instance should leave the meshes [0 3] but left %v", meshes)
+	}
+	checkInstanceSet(t, set, 1)
+
+	set.Remove(handles[0])
+	set.Remove(handles[3])
+	if n := len(set.Instances(0)); n != 0 {
+		t.Errorf("removing all instances should leave none but left %d", n)
+	}
+}
+
+func TestInstanceSetSetMaterial(t *testing.T) {
+	set := libscn.NewInstanceSet(2)
+	a := set.Add(0, 0)
+	b := set.Add(0, 1)
+	c := set.Add(1, 2)
+	slot := set.Instance(a).AttributeIndex
+
+	set.SetMaterial(a, 1)
+	if meshes := instanceMeshes(set, 0); !equalInts(meshes, []int{1}) {
+		t.Errorf("the old material should keep the mesh [1] but kept %v", meshes)
+	}
+	if meshes := instanceMeshes(set, 1); !equalInts(meshes, []int{2, 0}) {
+		t.Errorf("the new material should have the meshes [2 0] but had %v", meshes)
+	}
+	if instance := set.Instance(a); instance.MeshIndex != 0 || instance.AttributeIndex != slot {
+		t.Errorf("the moved instance should keep its mesh 0 and slot %d but was %+v", slot, instance)
+	}
+	checkInstanceSet(t, set, 2)
+
+	// moving to the same material keeps it in the slice
+	set.SetMaterial(c, 1)
+	if meshes := instanceMeshes(set, 1); !equalInts(meshes, []int{0, 2}) {
+		t.Errorf("the material should have the meshes [0 2] but had %v", meshes)
+	}
+	set.SetMaterial(b, 1)
+	if n := len(set.Instances(0)); n != 0 {
+		t.Errorf("the old material should be empty but had %d instances", n)
+	}
+	checkInstanceSet(t, set, 2)
+}
+
+func TestInstanceSetSlotReuse(t *testing.T) {
+	set := libscn.NewInstanceSet(1)
+	a := set.Add(0, 0)
+	b := set.Add(0, 0)
+	set.Add(0, 0)
+	slot := set.Instance(b).AttributeIndex
+
+	set.Remove(b)
+	d := set.Add(0, 1)
+	if set.Instance(d).AttributeIndex != slot {
+		t.Errorf("the new instance should reuse the freed slot %d but got %d", slot, set.Instance(d).AttributeIndex)
+	}
+	if d == b {
+		t.Errorf("the new instance should not reuse the handle %d", b)
+	}
+	if set.Slots() != 3 {
+		t.Errorf("reusing a slot should not allocate one but there are %d slots", set.Slots())
+	}
+
+	set.Add(0, 2)
+	if set.Slots() != 4 {
+		t.Errorf("without free slots a new one should be allocated but there are %d slots", set.Slots())
+	}
+	set.Remove(a)
+	checkInstanceSet(t, set, 1)
+}
+
+func TestInstanceSetRemovedHandle(t *testing.T) {
+	set := libscn.NewInstanceSet(2)
+	handle := set.Add(0, 0)
+	set.Add(0, 1)
+	set.Remove(handle)
+
+	uses := map[string]func(){
+		"Instance":    func() { set.Instance(handle) },
+		"SetMaterial": func() { set.SetMaterial(handle, 1) },
+		"Remove":      func() { set.Remove(handle) },
+	}
+	for name, use := range uses {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s with a removed handle should panic", name)
+				}
+			}()
+			use()
+		}()
+	}
+	if n := len(set.Instances(0)) + len(set.Instances(1)); n != 1 {
+		t.Errorf("using a removed handle should not change the instances but there were %d", n)
+	}
+	checkInstanceSet(t, set, 2)
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"unsafe"
 
+	"github.com/chewxy/math32"
 	"github.com/go-gl/mathgl/mgl32"
 )
 
@@ -17,22 +18,115 @@ type Mesh struct {
 	Vertices     []Vertex
 	Indices      []uint32
 	ShortIndices bool
+	// The vertices as separate attributes instead of Vertices, only set by DecodeMeshView
+	Streams *VertexStreams
+	// Optional attributes which are not part of the vertices, nil or one for each vertex
+	Uv1     []mgl32.Vec2
+	Colors  []mgl32.Vec4
+	Joints  [][4]uint16
+	Weights []mgl32.Vec4
+	// Ranges of the indices with their own material slot, nil when the whole mesh uses one material
+	Submeshes []Submesh
+	Bounds    AABB
+	// Coarser versions of the mesh from fine to coarse, see GenerateLods
+	Lods []MeshLod
+}
+
+// A level of detail of a mesh, it uses the vertices of the mesh
+type MeshLod struct {
+	// How far the surface may be moved, relative to the largest dimension of the bounds of the mesh
+	Error   float32
+	Indices []uint32
+	// The submeshes of the mesh with their ranges in Indices
+	Submeshes []Submesh
+}
+
+type Submesh struct {
+	// The name of the material slot
+	Material   string
+	FirstIndex int
+	IndexCount int
+	Bounds     AABB
+}
+
+// An axis aligned bounding box
+type AABB struct {
+	Min, Max mgl32.Vec3
 }
 
 type Vertex struct {
-	Position  mgl32.Vec3
-	Uv        mgl32.Vec2
-	Normal    mgl32.Vec3
-	Bitangent mgl32.Vec3
-	Tangent   mgl32.Vec3
+	Position mgl32.Vec3
+	Uv       mgl32.Vec2
+	Normal   mgl32.Vec3
+	Tangent  mgl32.Vec4
+}
+
+// The attributes of Vertex in the float32 streams of a .geo file, they reference the file when it is mapped
+type VertexStreams struct {
+	Positions []mgl32.Vec3
+	Uvs       []mgl32.Vec2
+	Normals   []mgl32.Vec3
+	Tangents  []mgl32.Vec4
+}
+
+// Writes the attributes into the vertices, which must have the length of the streams
+func (streams *VertexStreams) Interleave(vertices []Vertex) {
+	for i := range vertices {
+		vertices[i] = Vertex{
+			Position: streams.Positions[i],
+			Uv:       streams.Uvs[i],
+			Normal:   streams.Normals[i],
+			Tangent:  streams.Tangents[i],
+		}
+	}
+}
+
+func (mesh *Mesh) VertexCount() int {
+	if mesh.Streams != nil {
+		return len(mesh.Streams.Positions)
+	}
+	return len(mesh.Vertices)
+}
+
+// Returns Vertices, or a copy of the streams interleaved
+func (mesh *Mesh) vertices() []Vertex {
+	if mesh.Streams == nil {
+		return mesh.Vertices
+	}
+	vertices := make([]Vertex, len(mesh.Streams.Positions))
+	mesh.Streams.Interleave(vertices)
+	return vertices
+}
+
+func (mesh *Mesh) position(index uint32) mgl32.Vec3 {
+	if mesh.Streams != nil {
+		return mesh.Streams.Positions[index]
+	}
+	return mesh.Vertices[index].Position
 }
 
 const ElementIndexSize = int(unsafe.Sizeof(uint32(0)))
 const InstanceAttributesSize = int(unsafe.Sizeof(InstanceAttributes{}))
 const VertexSize = int(unsafe.Sizeof(Vertex{}))
+const CompactVertexSize = int(unsafe.Sizeof(CompactVertex{}))
+const VertexQuantizationSize = int(unsafe.Sizeof(VertexQuantization{}))
 const DrawCommandSize = int(unsafe.Sizeof(DrawElementsIndirectCommand{}))
+const CullInstanceSize = int(unsafe.Sizeof(CullInstance{}))
 
+// Decodes a .geo mesh of either version into Vertices, the result never references the reader
 func DecodeMesh(r io.Reader) (mesh *Mesh, err error) {
+	return decodeMesh(r, false)
+}
+
+// Like DecodeMesh, but the uint32 indices and the float32 attribute streams of uncompressed version 2 files
+// reference the reader when it is the reader of a MappedFile. When the position, uv, normal and tangent streams
+// are all float32 they are returned in Streams instead of Vertices, RenderBatch.Upload writes them to its
+// vertex buffer directly. The mesh is only valid until the file is closed, see DirPack.UploadMesh.
+func DecodeMeshView(r io.Reader) (mesh *Mesh, err error) {
+	return decodeMesh(r, true)
+}
+
+func decodeMesh(r io.Reader, views bool) (mesh *Mesh, err error) {
 	var br *libio.BinaryReader
 	var ok bool
 
@@ -43,33 +137,48 @@ func DecodeMesh(r io.Reader) (mesh *Mesh, err error) {
 		}
 
 		defer func() {
-			if br.Err != nil {
-				if err == nil {
-					err = br.Err
-				} else {
-					err = fmt.Errorf("%v: %w", err, br.Err)
-				}
+			// errors of the reader are part of the DecodeErrors, unless the decoder did not check them
+			if err == nil && br.Err != nil {
+				err = br.Err
 			}
 		}()
 	}
 
+	var check int
+	if !br.ReadUInt32(&check) {
+		return nil, br.Errorf("expected mesh header")
+	}
+
+	switch uint32(check) {
+	case MagicNumberGEO:
+		return decodeMeshV1(br)
+	case MagicNumberGEO2:
+		return decodeMeshV2(br, views)
+	}
+	return nil, br.Errorf("mesh header is corrupt")
+}
+
+// Decodes the original format of the blender exporter, after the magic number
+func decodeMeshV1(br *libio.BinaryReader) (*Mesh, error) {
 	header := struct {
-		Check       uint32
 		NameLength  uint32
 		VertexCount uint32
 		IndexCount  uint32
 	}{}
 	if !br.ReadRef(&header) {
-		return nil, fmt.Errorf("expected mesh header; byte 0x%08x", br.LastIndex)
+		return nil, br.Errorf("expected mesh header")
 	}
 
-	if header.Check != MagicNumberGEO {
-		return nil, fmt.Errorf("mesh header is corrupt; byte 0x%08x", br.LastIndex)
+	if header.IndexCount%3 != 0 {
+		return nil, br.Errorf("mesh index count %d is not a multiple of 3", header.IndexCount)
+	}
+	if !br.CheckAlloc(1, int(header.NameLength)) || !br.CheckAlloc(VertexSize, int(header.VertexCount)) || !br.CheckAlloc(ElementIndexSize, int(header.IndexCount)) {
+		return nil, br.Errorf("mesh header is invalid")
 	}
 
-	name := make([]byte, header.NameLength)
-	if !br.ReadRef(&name) {
-		return nil, fmt.Errorf("expected %d bytes for object name; byte 0x%08x", header.NameLength, br.LastIndex)
+	name, ok := br.ReadView(int(header.NameLength))
+	if !ok {
+		return nil, br.Errorf("expected %d bytes for object name", header.NameLength)
 	}
 
 	type fileVertex struct {
@@ -78,85 +187,152 @@ func DecodeMesh(r io.Reader) (mesh *Mesh, err error) {
 		Uv       mgl32.Vec2
 	}
 
-	fileVertices := make([]fileVertex, header.VertexCount)
-	if !br.ReadRef(&fileVertices) {
-		return nil, fmt.Errorf("expected %d mesh vertices; name %q, byte 0x%08x", header.VertexCount, name, br.LastIndex)
-	}
-	indexShorts := header.IndexCount
-	shortIndices := header.IndexCount < 0xffff
-	if !shortIndices {
-		indexShorts *= 2
-	}
-	indices := make([]uint16, indexShorts)
-	if !br.ReadRef(&indices) {
-		return nil, fmt.Errorf("expected %d mesh indices; name %q, byte 0x%08x", header.IndexCount, name, br.LastIndex)
-	}
-	if shortIndices && header.IndexCount%2 == 1 {
-		if !br.ReadBytes(2) {
-			return nil, fmt.Errorf("expected index padding; name %q, byte 0x%08x", name, br.LastIndex)
-		}
+	// the vertex and index blocks reference the file when it is mapped, they are converted below
+	fileVertices, ok := libio.ReadSlice[fileVertex](br, int(header.VertexCount))
+	if !ok {
+		return nil, br.Errorf("expected %d mesh vertices; name %q", header.VertexCount, name)
 	}
 
-	var intIndices []uint32
+	intIndices := make([]uint32, header.IndexCount)
+	shortIndices := header.IndexCount < 0xffff
 	if shortIndices {
-		intIndices = make([]uint32, header.IndexCount)
+		indices, ok := libio.ReadSlice[uint16](br, int(header.IndexCount))
+		if !ok {
+			return nil, br.Errorf("expected %d mesh indices; name %q", header.IndexCount, name)
+		}
 		for i, v := range indices {
 			intIndices[i] = uint32(v)
 		}
+		if header.IndexCount%2 == 1 && !br.ReadBytes(2) {
+			return nil, br.Errorf("expected index padding; name %q", name)
+		}
 	} else {
-		first := (*uint32)(unsafe.Pointer(&indices[0]))
-		intIndices = unsafe.Slice(first, header.IndexCount)
+		indices, ok := libio.ReadSlice[uint32](br, int(header.IndexCount))
+		if !ok {
+			return nil, br.Errorf("expected %d mesh indices; name %q", header.IndexCount, name)
+		}
+		copy(intIndices, indices)
+	}
+	for i, index := range intIndices {
+		if index >= header.VertexCount {
+			return nil, br.Errorf("mesh index %d at %d is out of range for %d vertices; name %q", index, i, header.VertexCount, name)
+		}
 	}
 
 	vertices := make([]Vertex, len(fileVertices))
+	for i, v := range fileVertices {
+		vertices[i].Position = v.Position
+		vertices[i].Uv = v.Uv
+		vertices[i].Normal = v.Normal
+	}
+	mesh := &Mesh{
+		Name:     string(name),
+		Vertices: vertices,
+		Indices:  intIndices,
+	}
+	mesh.generateTangents()
+	mesh.UpdateBounds()
+	return mesh, nil
+}
 
-	for i := 0; i < len(intIndices); i += 3 {
-		i0, i1, i2 := intIndices[i+0], intIndices[i+1], intIndices[i+2]
-		v0, v1, v2 := fileVertices[i0], fileVertices[i1], fileVertices[i2]
+// Calculates the bounds of the mesh and its submeshes
+func (mesh *Mesh) UpdateBounds() {
+	mesh.Bounds = mesh.indexedBounds(mesh.Indices)
+	for i, sub := range mesh.Submeshes {
+		mesh.Submeshes[i].Bounds = mesh.indexedBounds(mesh.Indices[sub.FirstIndex : sub.FirstIndex+sub.IndexCount])
+	}
+}
 
-		dPos01, dPos02 := v1.Position.Sub(v0.Position), v2.Position.Sub(v0.Position)
-		dUV01, dUV02 := v1.Uv.Sub(v0.Uv), v2.Uv.Sub(v0.Uv)
+// The bounds of the vertices used by the indices
+func (mesh *Mesh) indexedBounds(indices []uint32) AABB {
+	if len(indices) == 0 {
+		return AABB{}
+	}
+	result := AABB{Min: mesh.position(indices[0]), Max: mesh.position(indices[0])}
+	for _, index := range indices {
+		p := mesh.position(index)
+		for c := range p {
+			result.Min[c] = math32.Min(result.Min[c], p[c])
+			result.Max[c] = math32.Max(result.Max[c], p[c])
+		}
+	}
+	return result
+}
 
-		det := dUV01[0]*dUV02[1] - dUV02[0]*dUV01[1]
-		f := 1 / det
+// Encodes the mesh in the .geo format, version 2 unless OptGeoVersion1 is given.
+// The bounds of the mesh are stored as they are, see UpdateBounds.
+func EncodeMesh(w io.Writer, mesh *Mesh, options ...MeshEncodeOption) (err error) {
+	var bw *libio.BinaryWriter
+	var ok bool
 
-		tan := mgl32.Vec3{
-			f * (dUV02[1]*dPos01[0] - dUV01[1]*dPos02[0]),
-			f * (dUV02[1]*dPos01[1] - dUV01[1]*dPos02[1]),
-			f * (dUV02[1]*dPos01[2] - dUV01[1]*dPos02[2]),
+	if bw, ok = w.(*libio.BinaryWriter); !ok {
+		bw = &libio.BinaryWriter{
+			Dst:   w,
+			Order: binary.LittleEndian,
 		}
+	}
 
-		bitan := mgl32.Vec3{
-			f * (-dUV02[0]*dPos01[0] + dUV01[0]*dPos02[0]),
-			f * (-dUV02[0]*dPos01[1] + dUV01[0]*dPos02[1]),
-			f * (-dUV02[0]*dPos01[2] + dUV01[0]*dPos02[2]),
+	ctx := MeshEncodeContext{
+		Version: GeoVersion2_000_000,
+	}
+	for _, opt := range options {
+		if opt != nil {
+			err = opt(&ctx)
+			if err != nil {
+				return err
+			}
 		}
+	}
 
-		vertices[i0].Position = v0.Position
-		vertices[i0].Uv = v0.Uv
-		vertices[i0].Normal = v0.Normal
-		// 'average' the tanget vectors
-		vertices[i0].Bitangent = vertices[i0].Bitangent.Add(bitan)
-		vertices[i0].Tangent = vertices[i0].Tangent.Add(tan)
-
-		vertices[i1].Position = v1.Position
-		vertices[i1].Uv = v1.Uv
-		vertices[i1].Normal = v1.Normal
-		// 'average' the tanget vectors
-		vertices[i1].Bitangent = vertices[i1].Bitangent.Add(bitan)
-		vertices[i1].Tangent = vertices[i1].Tangent.Add(tan)
-
-		vertices[i2].Position = v2.Position
-		vertices[i2].Uv = v2.Uv
-		vertices[i2].Normal = v2.Normal
-		// 'average' the tanget vectors
-		vertices[i2].Bitangent = vertices[i2].Bitangent.Add(bitan)
-		vertices[i2].Tangent = vertices[i2].Tangent.Add(tan)
-	}
-
-	return &Mesh{
-		Name:     string(name),
-		Vertices: vertices,
-		Indices:  intIndices,
-	}, nil
+	for i, index := range mesh.Indices {
+		if int(index) >= len(mesh.Vertices) {
+			return fmt.Errorf("mesh index %d at %d is out of range for %d vertices; name %q", index, i, len(mesh.Vertices), mesh.Name)
+		}
+	}
+
+	if ctx.Version == GeoVersion1_000_000 {
+		return encodeMeshV1(bw, mesh)
+	}
+	return encodeMeshV2(bw, mesh, &ctx)
+}
+
+// Encodes the original format of the blender exporter, only positions, normals, uvs and indices are stored
+func encodeMeshV1(bw *libio.BinaryWriter, mesh *Mesh) error {
+	shortIndices := len(mesh.Indices) < 0xffff
+	for i, index := range mesh.Indices {
+		if shortIndices && index > 0xffff {
+			// the index size depends on the number of indices
+			return fmt.Errorf("mesh index %d at %d does not fit the 16 bit indices of %d indices; name %q", index, i, len(mesh.Indices), mesh.Name)
+		}
+	}
+
+	bw.WriteRef([]uint32{MagicNumberGEO, uint32(len(mesh.Name)), uint32(len(mesh.Vertices)), uint32(len(mesh.Indices))})
+	bw.WriteBytes([]byte(mesh.Name))
+
+	type fileVertex struct {
+		Position mgl32.Vec3
+		Normal   mgl32.Vec3
+		Uv       mgl32.Vec2
+	}
+	vertices := make([]fileVertex, len(mesh.Vertices))
+	for i, v := range mesh.Vertices {
+		vertices[i] = fileVertex{Position: v.Position, Normal: v.Normal, Uv: v.Uv}
+	}
+	bw.WriteRef(vertices)
+
+	if shortIndices {
+		indices := make([]uint16, len(mesh.Indices), len(mesh.Indices)+1)
+		for i, index := range mesh.Indices {
+			indices[i] = uint16(index)
+		}
+		if len(indices)%2 == 1 {
+			// padding to 4 bytes
+			indices = append(indices, 0)
+		}
+		bw.WriteRef(indices)
+	} else {
+		bw.WriteRef(mesh.Indices)
+	}
+
+	return bw.Err
 }
@@ -0,0 +1,248 @@
+package libscn_test
+
+import (
+	"advanced-gl/Project03/libio"
+	"advanced-gl/Project03/libscn"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"unsafe"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Writes a .geo mesh with the vertex layout of the blender exporter, position, normal and uv
+func writeGeo(name string, positions []mgl32.Vec3, uvs []mgl32.Vec2, indices []uint16) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, []uint32{libscn.MagicNumberGEO, uint32(len(name)), uint32(len(positions)), uint32(len(indices))})
+	buf.WriteString(name)
+	for i, pos := range positions {
+		binary.Write(buf, binary.LittleEndian, pos)
+		binary.Write(buf, binary.LittleEndian, mgl32.Vec3{0, 0, 1})
+		binary.Write(buf, binary.LittleEndian, uvs[i])
+	}
+	binary.Write(buf, binary.LittleEndian, indices)
+	if len(indices)%2 == 1 {
+		binary.Write(buf, binary.LittleEndian, uint16(0))
+	}
+	return buf.Bytes()
+}
+
+var quadGeo = writeGeo("quad",
+	[]mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}},
+	[]mgl32.Vec2{{0, 0}, {1, 0}, {1, 1}, {0, 1}},
+	[]uint16{0, 1, 2, 0, 2, 3},
+)
+
+func TestDecodeMesh(t *testing.T) {
+	mesh, err := libscn.DecodeMesh(bytes.NewReader(quadGeo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mesh.Name != "quad" || len(mesh.Vertices) != 4 || len(mesh.Indices) != 6 {
+		t.Fatalf("the quad should have 4 vertices and 6 indices but %q had %d and %d", mesh.Name, len(mesh.Vertices), len(mesh.Indices))
+	}
+	if tan := mesh.Vertices[0].Tangent; !tan.ApproxEqual(mgl32.Vec4{1, 0, 0, 1}) {
+		t.Errorf("the tangent should follow u along x but was %v", tan)
+	}
+
+	triangle := writeGeo("triangle", []mgl32.Vec3{{}, {}, {}}, []mgl32.Vec2{{}, {}, {}}, []uint16{0, 1, 3})
+	_, err = libscn.DecodeMesh(bytes.NewReader(triangle))
+	var decodeErr *libio.DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Errorf("an index out of range should be a DecodeError but got: %v", err)
+	}
+
+	huge := append([]byte{}, quadGeo...)
+	binary.LittleEndian.PutUint32(huge[8:], 0xfffffff0)
+	if _, err = libscn.DecodeMesh(bytes.NewReader(huge)); !errors.Is(err, libio.ErrAllocLimit) {
+		t.Errorf("a huge vertex count should exceed the allocation limit but got: %v", err)
+	}
+}
+
+func FuzzDecodeMesh(f *testing.F) {
+	f.Add(quadGeo)
+	f.Add(writeGeo("", []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}}, []mgl32.Vec2{{0, 0}, {1, 0}, {0, 1}}, []uint16{0, 1, 2}))
+	for _, options := range [][]libscn.MeshEncodeOption{nil, {libscn.OptGeoQuantize(), libscn.OptGeoCompress(0)}} {
+		buf := new(bytes.Buffer)
+		libscn.EncodeMesh(buf, attributeMesh(), options...)
+		f.Add(buf.Bytes())
+	}
+	lods := attributeMesh()
+	lods.GenerateLods(2, 0.1)
+	buf := new(bytes.Buffer)
+	libscn.EncodeMesh(buf, lods)
+	f.Add(buf.Bytes())
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		mesh, err := libscn.DecodeMesh(&libio.BinaryReader{Src: bytes.NewReader(data), Order: binary.LittleEndian, MaxAlloc: 1 << 20})
+		if err != nil {
+			var decodeErr *libio.DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Errorf("errors should be DecodeErrors but got: %v", err)
+			}
+			return
+		}
+		for _, index := range mesh.Indices {
+			if int(index) >= len(mesh.Vertices) {
+				t.Fatalf("index %d is out of range for %d vertices", index, len(mesh.Vertices))
+			}
+		}
+		for _, lod := range mesh.Lods {
+			for _, index := range lod.Indices {
+				if int(index) >= len(mesh.Vertices) {
+					t.Fatalf("lod index %d is out of range for %d vertices", index, len(mesh.Vertices))
+				}
+			}
+		}
+	})
+}
+
+// A grid of size x size quads with 32 bit indices
+func gridGeo(size int) []byte {
+	positions := []mgl32.Vec3{}
+	uvs := []mgl32.Vec2{}
+	for y := 0; y <= size; y++ {
+		for x := 0; x <= size; x++ {
+			positions = append(positions, mgl32.Vec3{float32(x), float32(y), 0})
+			uvs = append(uvs, mgl32.Vec2{float32(x) / float32(size), float32(y) / float32(size)})
+		}
+	}
+	indices := []uint32{}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			i := uint32(y*(size+1) + x)
+			j := i + uint32(size+1)
+			indices = append(indices, i, i+1, j+1, i, j+1, j)
+		}
+	}
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, []uint32{libscn.MagicNumberGEO, 4, uint32(len(positions)), uint32(len(indices))})
+	buf.WriteString("grid")
+	for i, pos := range positions {
+		binary.Write(buf, binary.LittleEndian, pos)
+		binary.Write(buf, binary.LittleEndian, mgl32.Vec3{0, 0, 1})
+		binary.Write(buf, binary.LittleEndian, uvs[i])
+	}
+	binary.Write(buf, binary.LittleEndian, indices)
+	return buf.Bytes()
+}
+
+func writeGeoFile(tb testing.TB, data []byte) string {
+	name := filepath.Join(tb.TempDir(), "mesh.geo")
+	if err := os.WriteFile(name, data, 0666); err != nil {
+		tb.Fatal(err)
+	}
+	return name
+}
+
+func TestDecodeMeshMapped(t *testing.T) {
+	data := gridGeo(300)
+	expected, err := libscn.DecodeMesh(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := libio.MapFile(writeGeoFile(t, data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mesh, err := libscn.DecodeMesh(file.Reader())
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the mesh must not reference the closed mapping
+	if !reflect.DeepEqual(mesh, expected) {
+		t.Errorf("the mapped mesh should be equal to the one read")
+	}
+}
+
+func TestDecodeMeshView(t *testing.T) {
+	// more than 65535 vertices, so the indices are stored as uint32
+	vertices, indices := gridMesh(260, 1000)
+	mesh := &libscn.Mesh{Name: "grid", Vertices: vertices, Indices: indices}
+	mesh.UpdateBounds()
+
+	for _, compress := range []bool{false, true} {
+		var options []libscn.MeshEncodeOption
+		if compress {
+			options = append(options, libscn.OptGeoCompress(0))
+		}
+		file, err := libio.MapFile(writeGeoFile(t, encodeMesh(t, mesh, options...)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := libscn.DecodeMeshView(file.Reader())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data := file.Bytes()
+		inFile := func(p unsafe.Pointer) bool {
+			start := uintptr(unsafe.Pointer(unsafe.SliceData(data)))
+			return uintptr(p) >= start && uintptr(p) < start+uintptr(len(data))
+		}
+		if compress {
+			if result.Streams != nil || !reflect.DeepEqual(result.Vertices, mesh.Vertices) || inFile(unsafe.Pointer(unsafe.SliceData(result.Indices))) {
+				t.Errorf("the compressed mesh should be decoded into new vertices and indices")
+			}
+		} else {
+			if result.Streams == nil || result.Vertices != nil {
+				t.Fatalf("the uncompressed float32 mesh should be decoded into streams")
+			}
+			if !inFile(unsafe.Pointer(unsafe.SliceData(result.Indices))) || !inFile(unsafe.Pointer(unsafe.SliceData(result.Streams.Positions))) {
+				t.Errorf("the indices and streams should reference the mapped file")
+			}
+			streamed := make([]libscn.Vertex, result.VertexCount())
+			result.Streams.Interleave(streamed)
+			if !reflect.DeepEqual(streamed, mesh.Vertices) {
+				t.Errorf("the streams should hold the vertices of the mesh")
+			}
+		}
+		if !reflect.DeepEqual(result.Indices, mesh.Indices) {
+			t.Errorf("the indices should be equal to the ones of the mesh")
+		}
+		file.Close()
+	}
+}
+
+func benchmarkDecodeMesh(b *testing.B, mapped bool) {
+	name := writeGeoFile(b, gridGeo(500))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if mapped {
+			file, err := libio.MapFile(name)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err = libscn.DecodeMesh(file.Reader()); err != nil {
+				b.Fatal(err)
+			}
+			file.Close()
+		} else {
+			file, err := os.Open(name)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err = libscn.DecodeMesh(file); err != nil {
+				b.Fatal(err)
+			}
+			file.Close()
+		}
+	}
+}
+
+func BenchmarkDecodeMeshReader(b *testing.B) {
+	benchmarkDecodeMesh(b, false)
+}
+
+func BenchmarkDecodeMeshMapped(b *testing.B) {
+	benchmarkDecodeMesh(b, true)
+}
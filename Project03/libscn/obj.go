@@ -0,0 +1,405 @@
+package libscn
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// A Wavefront OBJ file converted to the meshes of this module
+type ObjScene struct {
+	Meshes []ObjMesh
+	// The materials of all referenced MTL files
+	Materials []ObjMaterial
+}
+
+type ObjMesh struct {
+	Mesh *Mesh
+	// The name of the material set by usemtl, may be empty
+	Material string
+}
+
+// The maps of a MTL material, relative to the directory of the MTL file
+type ObjMaterial struct {
+	Name         string
+	DiffuseColor mgl32.Vec3
+	// map_Kd
+	Albedo string
+	// norm, or map_Bump and bump which most exporters use for normal maps too
+	Normal string
+	// map_ao, map_Pr and map_Pm of the PBR extension
+	Occlusion string
+	Roughness string
+	Metallic  string
+}
+
+// Returns the material description, its paths are relative to the MTL file.
+// The ORM texture is only set when the occlusion, roughness and metallic maps which are present are the same packed texture.
+func (mat *ObjMaterial) Desc() MaterialDesc {
+	desc := MaterialDesc{
+		Albedo: mat.Albedo,
+		Normal: mat.Normal,
+	}
+	for _, m := range []string{mat.Occlusion, mat.Roughness, mat.Metallic} {
+		if m == "" {
+			continue
+		}
+		if desc.ORM != "" && desc.ORM != m {
+			return MaterialDesc{Albedo: mat.Albedo, Normal: mat.Normal}
+		}
+		desc.ORM = m
+	}
+	return desc
+}
+
+// Decodes an OBJ file, polygons are triangulated as fans so they must be convex.
+// Each object is split into a mesh per material. MTL files are read from fsys, they are skipped when it is nil.
+func DecodeObj(r io.Reader, fsys fs.FS, options ...ImportOption) (scene *ObjScene, err error) {
+	ctx, err := newImportContext(options)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		positions []mgl32.Vec3
+		uvs       []mgl32.Vec2
+		normals   []mgl32.Vec3
+		object    string
+		material  string
+	)
+	scene = &ObjScene{}
+
+	type groupKey struct{ object, material string }
+	type group struct {
+		vertices []Vertex
+		indices  []uint32
+		index    map[[8]float32]uint32
+	}
+	groups := map[groupKey]*group{}
+	order := []groupKey{}
+	materialCount := map[string]int{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		keyword, rest, fields := splitObjStatement(scanner.Text())
+
+		switch keyword {
+		case "v":
+			v, err := parseObjFloats(fields, 3)
+			if err != nil {
+				return nil, fmt.Errorf("obj line %d: %w", line, err)
+			}
+			positions = append(positions, mgl32.Vec3{v[0], v[1], v[2]})
+		case "vt":
+			v, err := parseObjFloats(fields, 1)
+			if err != nil {
+				return nil, fmt.Errorf("obj line %d: %w", line, err)
+			}
+			uvs = append(uvs, mgl32.Vec2{v[0], v[1]})
+		case "vn":
+			v, err := parseObjFloats(fields, 3)
+			if err != nil {
+				return nil, fmt.Errorf("obj line %d: %w", line, err)
+			}
+			normals = append(normals, mgl32.Vec3{v[0], v[1], v[2]})
+		case "o", "g":
+			object = rest
+		case "usemtl":
+			material = rest
+		case "mtllib":
+			if fsys == nil {
+				continue
+			}
+			// the file name may contain spaces
+			materials, err := readMtlFile(fsys, rest)
+			if err != nil {
+				return nil, fmt.Errorf("obj line %d: %w", line, err)
+			}
+			scene.Materials = append(scene.Materials, materials...)
+		case "f":
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("obj line %d: a face needs at least 3 vertices", line)
+			}
+			key := groupKey{object, material}
+			g, ok := groups[key]
+			if !ok {
+				g = &group{index: map[[8]float32]uint32{}}
+				groups[key] = g
+				order = append(order, key)
+				materialCount[object]++
+			}
+
+			corners := make([]objCorner, len(fields))
+			hasNormals := true
+			for i, field := range fields {
+				corners[i], err = parseObjCorner(field, len(positions), len(uvs), len(normals))
+				if err != nil {
+					return nil, fmt.Errorf("obj line %d: %w", line, err)
+				}
+				hasNormals = hasNormals && corners[i].normal >= 0
+			}
+
+			var faceNormal mgl32.Vec3
+			if !hasNormals {
+				// flat shading for faces without normals, by the newell method which handles any polygon
+				for i := range corners {
+					a, b := positions[corners[i].position], positions[corners[(i+1)%len(corners)].position]
+					faceNormal = faceNormal.Add(mgl32.Vec3{
+						(a[1] - b[1]) * (a[2] + b[2]),
+						(a[2] - b[2]) * (a[0] + b[0]),
+						(a[0] - b[0]) * (a[1] + b[1]),
+					})
+				}
+				if faceNormal.Len() > 0 {
+					faceNormal = faceNormal.Normalize()
+				}
+			}
+
+			indices := make([]uint32, len(corners))
+			for i, corner := range corners {
+				vertex := Vertex{Position: positions[corner.position], Normal: faceNormal}
+				if corner.uv >= 0 {
+					vertex.Uv = uvs[corner.uv]
+				}
+				if corner.normal >= 0 {
+					vertex.Normal = normals[corner.normal]
+				}
+				// vertices are shared by their values, like the blender exporter does
+				key := [8]float32{
+					vertex.Position[0], vertex.Position[1], vertex.Position[2],
+					vertex.Normal[0], vertex.Normal[1], vertex.Normal[2],
+					vertex.Uv[0], vertex.Uv[1],
+				}
+				index, ok := g.index[key]
+				if !ok {
+					index = uint32(len(g.vertices))
+					g.vertices = append(g.vertices, vertex)
+					g.index[key] = index
+				}
+				indices[i] = index
+			}
+			for i := 1; i+1 < len(indices); i++ {
+				g.indices = append(g.indices, indices[0], indices[i], indices[i+1])
+			}
+		}
+		// other statements like s, l and p are ignored
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, key := range order {
+		g := groups[key]
+		name := key.object
+		if name == "" {
+			name = "default"
+		}
+		if materialCount[key.object] > 1 && key.material != "" {
+			name += "." + key.material
+		}
+		mesh := &Mesh{Name: name, Vertices: GenerateTangents(g.vertices, g.indices), Indices: g.indices}
+		mesh.UpdateBounds()
+		ctx.process(mesh)
+		scene.Meshes = append(scene.Meshes, ObjMesh{
+			Mesh:     mesh,
+			Material: key.material,
+		})
+	}
+	return scene, nil
+}
+
+// Returns the keyword, the rest of the line and its fields, the keyword is empty for blank lines
+func splitObjStatement(line string) (keyword, rest string, fields []string) {
+	fields = strings.Fields(line)
+	if len(fields) == 0 {
+		return "", "", nil
+	}
+	keyword = fields[0]
+	rest = strings.TrimSpace(strings.TrimSpace(line)[len(keyword):])
+	return keyword, rest, fields[1:]
+}
+
+// The zero based attribute indices of the corner of a face
+type objCorner struct {
+	position, uv, normal int
+}
+
+func parseObjFloats(fields []string, required int) ([]float32, error) {
+	if len(fields) < required {
+		return nil, fmt.Errorf("expected %d numbers but got %d", required, len(fields))
+	}
+	// missing optional components are 0, like the v of a 1D texture coordinate
+	result := make([]float32, 3)
+	for i := 0; i < len(fields) && i < len(result); i++ {
+		v, err := strconv.ParseFloat(fields[i], 32)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = float32(v)
+	}
+	return result, nil
+}
+
+// Parses a v, v/vt, v//vn or v/vt/vn corner into zero based indices, -1 for missing attributes
+func parseObjCorner(field string, positions, uvs, normals int) (objCorner, error) {
+	key := objCorner{uv: -1, normal: -1}
+	parts := strings.Split(field, "/")
+	if len(parts) > 3 {
+		return key, fmt.Errorf("invalid face vertex %q", field)
+	}
+	targets := []*int{&key.position, &key.uv, &key.normal}
+	counts := []int{positions, uvs, normals}
+	for i, part := range parts {
+		if part == "" {
+			if i == 0 {
+				return key, fmt.Errorf("face vertex %q has no position", field)
+			}
+			continue
+		}
+		index, err := strconv.Atoi(part)
+		if err != nil {
+			return key, fmt.Errorf("invalid face vertex %q: %w", field, err)
+		}
+		// negative indices are relative to the end of the list
+		if index < 0 {
+			index += counts[i]
+		} else {
+			index--
+		}
+		if index < 0 || index >= counts[i] {
+			return key, fmt.Errorf("face vertex %q references an undefined element", field)
+		}
+		*targets[i] = index
+	}
+	return key, nil
+}
+
+func readMtlFile(fsys fs.FS, name string) ([]ObjMaterial, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not open mtl file %q: %w", name, err)
+	}
+	defer file.Close()
+
+	materials, err := DecodeMtl(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode mtl file %q: %w", name, err)
+	}
+	// the maps are relative to the mtl file
+	dir := path.Dir(name)
+	for i := range materials {
+		mat := &materials[i]
+		for _, m := range []*string{&mat.Albedo, &mat.Normal, &mat.Occlusion, &mat.Roughness, &mat.Metallic} {
+			if *m != "" {
+				*m = path.Join(dir, *m)
+			}
+		}
+	}
+	return materials, nil
+}
+
+// The number of arguments of the texture map options, -o, -s and -t take up to 3
+var mtlMapOptions = map[string]int{
+	"-blendu": 1, "-blendv": 1, "-bm": 1, "-boost": 1, "-cc": 1, "-clamp": 1,
+	"-imfchan": 1, "-mm": 2, "-o": 3, "-s": 3, "-t": 3, "-texres": 1, "-type": 1,
+}
+
+// Decodes the materials of a MTL file
+func DecodeMtl(r io.Reader) ([]ObjMaterial, error) {
+	materials := []ObjMaterial{}
+	var current *ObjMaterial
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		keyword, rest, fields := splitObjStatement(scanner.Text())
+		if keyword == "newmtl" {
+			materials = append(materials, ObjMaterial{Name: rest, DiffuseColor: mgl32.Vec3{1, 1, 1}})
+			current = &materials[len(materials)-1]
+			continue
+		}
+		if current == nil || keyword == "" || strings.HasPrefix(keyword, "#") {
+			continue
+		}
+
+		var target *string
+		switch strings.ToLower(keyword) {
+		case "kd":
+			v, err := parseObjFloats(fields, 3)
+			if err != nil {
+				return nil, fmt.Errorf("mtl line %d: %w", line, err)
+			}
+			current.DiffuseColor = mgl32.Vec3{v[0], v[1], v[2]}
+		case "map_kd":
+			target = &current.Albedo
+		case "norm", "map_bump", "bump":
+			target = &current.Normal
+		case "map_ao":
+			target = &current.Occlusion
+		case "map_pr":
+			target = &current.Roughness
+		case "map_pm":
+			target = &current.Metallic
+		}
+		if target != nil {
+			filename, err := parseMtlMap(rest)
+			if err != nil {
+				return nil, fmt.Errorf("mtl line %d: %w", line, err)
+			}
+			*target = filename
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return materials, nil
+}
+
+// Returns the file name of a texture map statement after its options
+func parseMtlMap(statement string) (string, error) {
+	fields := strings.Fields(statement)
+	i := 0
+	for i < len(fields) {
+		args, ok := mtlMapOptions[fields[i]]
+		if !ok {
+			break
+		}
+		i++
+		for n := 0; n < args && i < len(fields)-1; n++ {
+			if _, err := strconv.ParseFloat(fields[i], 32); err != nil && args == 3 && n > 0 {
+				// the optional components of -o, -s and -t
+				break
+			}
+			i++
+		}
+	}
+	if i >= len(fields) {
+		return "", fmt.Errorf("texture map %q has no file name", statement)
+	}
+	// the file name may contain spaces
+	return strings.Join(fields[i:], " "), nil
+}
+
+// Merges all meshes into one with a submesh for each of them, named like their material
+func (scene *ObjScene) Flatten(name string) *Mesh {
+	result := &Mesh{Name: name}
+	for _, mesh := range scene.Meshes {
+		base := uint32(len(result.Vertices))
+		result.Submeshes = append(result.Submeshes, Submesh{
+			Material:   mesh.Material,
+			FirstIndex: len(result.Indices),
+			IndexCount: len(mesh.Mesh.Indices),
+		})
+		result.Vertices = append(result.Vertices, mesh.Mesh.Vertices...)
+		for _, index := range mesh.Mesh.Indices {
+			result.Indices = append(result.Indices, base+index)
+		}
+	}
+	result.UpdateBounds()
+	return result
+}
@@ -0,0 +1,130 @@
+package libscn_test
+
+import (
+	"advanced-gl/Project03/libscn"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const testObj = `# a quad and a triangle with different materials
+mtllib materials/test.mtl
+o shape
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+vt 0 0
+vt 1 0
+vt 1 1
+vt 0 1
+vn 0 0 1
+usemtl paint
+f 1/1/1 2/2/1 3/3/1 4/4/1
+usemtl metal
+f -4/-4 -3/-3 -2/-2
+`
+
+const testMtl = `newmtl paint
+Kd 1 0 0
+map_Kd paint_albedo.png
+map_Bump -bm 0.5 paint normal.png
+map_Pr paint_orm.png
+map_Pm paint_orm.png
+
+newmtl metal
+map_Pr -s 2 2 metal_roughness.png
+map_Pm metal_metallic.png
+`
+
+func TestDecodeObj(t *testing.T) {
+	fsys := fstest.MapFS{"materials/test.mtl": {Data: []byte(testMtl)}}
+	scene, err := libscn.DecodeObj(strings.NewReader(testObj), fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scene.Meshes) != 2 {
+		t.Fatalf("the object should be split into a mesh per material but had %d meshes", len(scene.Meshes))
+	}
+
+	quad, triangle := scene.Meshes[0], scene.Meshes[1]
+	if quad.Mesh.Name != "shape.paint" || quad.Material != "paint" || triangle.Material != "metal" {
+		t.Errorf("the meshes should be named after the object and material but were %q with %q and %q with %q", quad.Mesh.Name, quad.Material, triangle.Mesh.Name, triangle.Material)
+	}
+	if len(quad.Mesh.Vertices) != 4 || len(quad.Mesh.Indices) != 6 {
+		t.Errorf("the quad should be triangulated into 2 triangles of 4 vertices but had %d indices of %d vertices", len(quad.Mesh.Indices), len(quad.Mesh.Vertices))
+	}
+	if tan := quad.Mesh.Vertices[0].Tangent; !tan.ApproxEqual(mgl32.Vec4{1, 0, 0, 1}) {
+		t.Errorf("the tangent should follow u along x but was %v", tan)
+	}
+
+	// the triangle has no normals, it gets its face normal
+	for _, v := range triangle.Mesh.Vertices {
+		if !v.Normal.ApproxEqual(mgl32.Vec3{0, 0, 1}) {
+			t.Errorf("the generated normal should face z but was %v", v.Normal)
+		}
+	}
+
+	paint, metal := scene.Materials[0], scene.Materials[1]
+	expected := libscn.MaterialDesc{Albedo: "materials/paint_albedo.png", Normal: "materials/paint normal.png", ORM: "materials/paint_orm.png"}
+	if desc := paint.Desc(); desc != expected || paint.DiffuseColor != (mgl32.Vec3{1, 0, 0}) {
+		t.Errorf("the paint material should be %+v but was %+v", expected, desc)
+	}
+	if desc := metal.Desc(); desc.ORM != "" || metal.Roughness != "materials/metal_roughness.png" {
+		t.Errorf("separate roughness and metallic maps should not be an orm texture but were %q and %+v", metal.Roughness, desc)
+	}
+}
+
+func TestDecodeObjInvalid(t *testing.T) {
+	for _, obj := range []string{
+		"v 0 0 0\nf 1 2 3\n",
+		"v 0 0 0\nv 0 1 0\nf 1 2\n",
+		"v 0 0 x\n",
+	} {
+		if _, err := libscn.DecodeObj(strings.NewReader(obj), nil); err == nil {
+			t.Errorf("%q should be rejected", obj)
+		}
+	}
+}
+
+func TestDecodeObjOptimize(t *testing.T) {
+	scene, err := libscn.DecodeObj(strings.NewReader(testObj), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	optimized, err := libscn.DecodeObj(strings.NewReader(testObj), nil, libscn.OptImportOptimize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, mesh := range scene.Meshes {
+		mesh.Mesh.Optimize()
+		if !reflect.DeepEqual(optimized.Meshes[i].Mesh, mesh.Mesh) {
+			t.Errorf("mesh %q should be optimized when it is imported", mesh.Mesh.Name)
+		}
+	}
+}
+
+func TestEncodeMesh(t *testing.T) {
+	scene, err := libscn.DecodeObj(strings.NewReader(testObj), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mesh := scene.Flatten("shape")
+
+	buf := new(bytes.Buffer)
+	if err := libscn.EncodeMesh(buf, mesh); err != nil {
+		t.Fatal(err)
+	}
+	result, err := libscn.DecodeMesh(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the tangents are calculated the same way
+	if !reflect.DeepEqual(result, mesh) {
+		t.Errorf("the decoded mesh should be equal to the encoded one")
+	}
+}
@@ -0,0 +1,195 @@
+package libscn_test
+
+import (
+	"advanced-gl/Project03/libscn"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// A grid of size² quads with its triangles in random order
+func shuffledGridMesh(size int) *libscn.Mesh {
+	mesh := &libscn.Mesh{Name: "grid"}
+	for y := 0; y <= size; y++ {
+		for x := 0; x <= size; x++ {
+			mesh.Vertices = append(mesh.Vertices, libscn.Vertex{
+				Position: mgl32.Vec3{float32(x), float32(y), 0},
+				Normal:   mgl32.Vec3{0, 0, 1},
+				Tangent:  mgl32.Vec4{1, 0, 0, 1},
+			})
+		}
+	}
+	triangles := [][3]uint32{}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			a := uint32(y*(size+1) + x)
+			b, c, d := a+1, a+uint32(size)+2, a+uint32(size)+1
+			triangles = append(triangles, [3]uint32{a, b, c}, [3]uint32{a, c, d})
+		}
+	}
+	r := rand.New(rand.NewSource(1))
+	r.Shuffle(len(triangles), func(i, j int) { triangles[i], triangles[j] = triangles[j], triangles[i] })
+	for _, tri := range triangles {
+		mesh.Indices = append(mesh.Indices, tri[:]...)
+	}
+	return mesh
+}
+
+// Counts the triangles by the values of their vertices, independent of the first corner and the vertex order
+func triangleSet(vertices []libscn.Vertex, indices []uint32) map[[3]libscn.Vertex]int {
+	set := map[[3]libscn.Vertex]int{}
+	for t := 0; t+2 < len(indices); t += 3 {
+		tri := [3]libscn.Vertex{vertices[indices[t]], vertices[indices[t+1]], vertices[indices[t+2]]}
+		// the rotation starting at the smallest position
+		for tri[0].Position[0] > tri[1].Position[0] || tri[0].Position[0] > tri[2].Position[0] ||
+			(tri[0].Position[0] == tri[1].Position[0] && tri[0].Position[1] > tri[1].Position[1]) ||
+			(tri[0].Position[0] == tri[2].Position[0] && tri[0].Position[1] > tri[2].Position[1]) {
+			tri = [3]libscn.Vertex{tri[1], tri[2], tri[0]}
+		}
+		set[tri]++
+	}
+	return set
+}
+
+func TestAnalyzeVertexCache(t *testing.T) {
+	stats := libscn.AnalyzeVertexCache([]uint32{0, 1, 2, 0, 2, 3}, 4, libscn.VertexCacheSize)
+	if stats != (libscn.VertexCacheStatistics{VerticesTransformed: 4, ACMR: 2, ATVR: 1}) {
+		t.Errorf("a quad should transform each of its 4 vertices once but was %+v", stats)
+	}
+	// the first vertex is evicted by the 3 following ones
+	stats = libscn.AnalyzeVertexCache([]uint32{0, 1, 2, 3, 4, 0}, 5, 4)
+	if stats.VerticesTransformed != 6 || stats.ATVR != 1.2 {
+		t.Errorf("the first vertex should be transformed again but was %+v", stats)
+	}
+}
+
+func TestOptimizeVertexCache(t *testing.T) {
+	mesh := shuffledGridMesh(32)
+	before := libscn.AnalyzeVertexCache(mesh.Indices, len(mesh.Vertices), libscn.VertexCacheSize)
+	expected := triangleSet(mesh.Vertices, mesh.Indices)
+
+	libscn.OptimizeVertexCache(mesh.Indices, len(mesh.Vertices))
+	after := libscn.AnalyzeVertexCache(mesh.Indices, len(mesh.Vertices), libscn.VertexCacheSize)
+	if !reflect.DeepEqual(triangleSet(mesh.Vertices, mesh.Indices), expected) {
+		t.Fatalf("the triangles should only be reordered")
+	}
+	// a strip order has an ACMR of 1, the optimized order reuses the vertices of the last rows
+	if after.ACMR > 0.8 || after.ATVR > 1.5 {
+		t.Errorf("the ACMR and ATVR of the grid should be below 0.8 and 1.5 but were %+v, shuffled %+v", after, before)
+	}
+
+	degenerate := []uint32{0, 0, 1, 1, 2, 3, 3, 3, 3}
+	libscn.OptimizeVertexCache(degenerate, 4)
+	if len(degenerate) != 9 {
+		t.Errorf("degenerate triangles should be kept")
+	}
+}
+
+// A cube of 6 faces with separate vertices, facing outward
+func cubeMesh(size float32) ([]libscn.Vertex, []uint32) {
+	vertices, indices := []libscn.Vertex{}, []uint32{}
+	for axis := 0; axis < 3; axis++ {
+		for _, sign := range []float32{-1, 1} {
+			n := mgl32.Vec3{}
+			n[axis] = sign
+			u, v := mgl32.Vec3{}, mgl32.Vec3{}
+			u[(axis+1)%3], v[(axis+2)%3] = size, size*sign
+			base := uint32(len(vertices))
+			center := n.Mul(size)
+			for _, p := range []mgl32.Vec3{center.Sub(u).Sub(v), center.Add(u).Sub(v), center.Add(u).Add(v), center.Sub(u).Add(v)} {
+				vertices = append(vertices, libscn.Vertex{Position: p, Normal: n})
+			}
+			indices = append(indices, base, base+1, base+2, base, base+2, base+3)
+		}
+	}
+	return vertices, indices
+}
+
+func TestOptimizeOverdraw(t *testing.T) {
+	// the inner cube is drawn first, so the outer one cannot occlude it
+	inner, innerIndices := cubeMesh(0.5)
+	outer, outerIndices := cubeMesh(1)
+	vertices := append(inner, outer...)
+	indices := append([]uint32{}, innerIndices...)
+	for _, index := range outerIndices {
+		indices = append(indices, index+uint32(len(inner)))
+	}
+	expected := triangleSet(vertices, indices)
+
+	libscn.OptimizeOverdraw(indices, vertices, 1.05)
+	if !reflect.DeepEqual(triangleSet(vertices, indices), expected) {
+		t.Fatalf("the triangles should only be reordered")
+	}
+	for i, index := range indices {
+		if isOuter := int(index) >= len(inner); isOuter != (i < len(outerIndices)) {
+			t.Fatalf("the outer cube should be drawn before the inner one but index %d was %d", i, index)
+		}
+	}
+}
+
+func TestWeldVertices(t *testing.T) {
+	shared, sharedIndices := cylinderMesh(16)
+	mesh := &libscn.Mesh{}
+	for _, index := range sharedIndices {
+		mesh.Indices = append(mesh.Indices, uint32(len(mesh.Vertices)))
+		mesh.Vertices = append(mesh.Vertices, shared[index])
+		mesh.Colors = append(mesh.Colors, mgl32.Vec4{0, 0, 0, 1})
+	}
+	// the same position with a different color is kept apart
+	mesh.Colors[0] = mgl32.Vec4{1, 0, 0, 1}
+	expected := triangleSet(mesh.Vertices, mesh.Indices)
+
+	if removed := mesh.WeldVertices(); removed != len(sharedIndices)-len(shared)-1 || len(mesh.Vertices) != len(shared)+1 || len(mesh.Colors) != len(mesh.Vertices) {
+		t.Errorf("the corners should be welded into %d vertices but there were %d", len(shared)+1, len(mesh.Vertices))
+	}
+	if !reflect.DeepEqual(triangleSet(mesh.Vertices, mesh.Indices), expected) || mesh.Colors[mesh.Indices[0]] != (mgl32.Vec4{1, 0, 0, 1}) {
+		t.Errorf("the triangles and their colors should not be changed")
+	}
+}
+
+func TestOptimizeVertexFetch(t *testing.T) {
+	mesh := &libscn.Mesh{
+		Vertices: []libscn.Vertex{{Uv: mgl32.Vec2{0, 0}}, {Uv: mgl32.Vec2{1, 0}}, {Uv: mgl32.Vec2{2, 0}}, {Uv: mgl32.Vec2{3, 0}}},
+		Indices:  []uint32{3, 1, 0, 0, 1, 3},
+		Uv1:      []mgl32.Vec2{{0, 1}, {1, 1}, {2, 1}, {3, 1}},
+	}
+	mesh.OptimizeVertexFetch()
+	if !reflect.DeepEqual(mesh.Indices, []uint32{0, 1, 2, 2, 1, 0}) {
+		t.Errorf("the vertices should be in the order of their first use but the indices were %v", mesh.Indices)
+	}
+	if len(mesh.Vertices) != 3 || mesh.Vertices[0].Uv[0] != 3 || mesh.Uv1[0][0] != 3 || mesh.Vertices[2].Uv[0] != 0 || len(mesh.Uv1) != 3 {
+		t.Errorf("the unused vertex should be removed and the optional attributes should follow the vertices")
+	}
+}
+
+func TestOptimizeMesh(t *testing.T) {
+	mesh := attributeMesh()
+	submeshes := make([]map[[3]libscn.Vertex]int, len(mesh.Submeshes))
+	for i, sub := range mesh.Submeshes {
+		submeshes[i] = triangleSet(mesh.Vertices, mesh.Indices[sub.FirstIndex:sub.FirstIndex+sub.IndexCount])
+	}
+	bounds := mesh.Bounds
+
+	mesh.Optimize()
+	for i, sub := range mesh.Submeshes {
+		if !reflect.DeepEqual(triangleSet(mesh.Vertices, mesh.Indices[sub.FirstIndex:sub.FirstIndex+sub.IndexCount]), submeshes[i]) {
+			t.Errorf("the triangles of submesh %d should stay in it", i)
+		}
+	}
+	if len(mesh.Uv1) != len(mesh.Vertices) || len(mesh.Colors) != len(mesh.Vertices) || len(mesh.Joints) != len(mesh.Vertices) || len(mesh.Weights) != len(mesh.Vertices) {
+		t.Errorf("the optional attributes should have one value for each vertex")
+	}
+	mesh.UpdateBounds()
+	if mesh.Bounds != bounds {
+		t.Errorf("the bounds should not be changed")
+	}
+
+	grid := shuffledGridMesh(32)
+	grid.Optimize()
+	stats := libscn.AnalyzeVertexCache(grid.Indices, len(grid.Vertices), libscn.VertexCacheSize)
+	if stats.ACMR > 0.8 {
+		t.Errorf("the overdraw order should keep most of the vertex cache efficiency but the ACMR was %v", stats.ACMR)
+	}
+}
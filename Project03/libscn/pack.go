@@ -8,13 +8,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
 
+	"github.com/chewxy/math32"
 	"github.com/go-gl/gl/v4.5-core/gl"
 	"github.com/go-gl/glfw/v3.3/glfw"
+	"github.com/go-gl/mathgl/mgl32"
 	"github.com/pierrec/lz4/v4"
 )
 
@@ -25,6 +28,7 @@ type AssetIndex struct {
 	Models    []string `json:"models"`
 	Shaders   []string `json:"shaders"`
 	Hdris     []string `json:"hdris"`
+	Scenes    []string `json:"scenes"`
 }
 
 type ModelDesc struct {
@@ -66,6 +70,9 @@ type DirPack struct {
 	TextureIndex  map[string]string
 	ShaderIndex   map[string]string
 	HdriIndex     map[string]string
+	SceneIndex    map[string]string
+	// Used for the meshes of glTF and obj files, like OptImportOptimize
+	ImportOptions []ImportOption
 	init          bool
 }
 
@@ -97,6 +104,7 @@ func (pack *DirPack) AddIndex(r io.Reader, root string) error {
 		pack.ShaderIndex = map[string]string{}
 		pack.HdriIndex = map[string]string{}
 		pack.TextureIndex = map[string]string{}
+		pack.SceneIndex = map[string]string{}
 		pack.init = true
 	}
 
@@ -125,6 +133,10 @@ func (pack *DirPack) AddIndex(r io.Reader, root string) error {
 	if err != nil {
 		return err
 	}
+	err = pack.addAllMatches(root, index.Scenes, pack.SceneIndex)
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -191,6 +203,8 @@ func (pack *DirPack) LoadModel(name string) (*Model, error) {
 type ShaderPipelineDesc struct {
 	Vertex   string `json:"vertex"`
 	Fragment string `json:"fragment"`
+	// Passed to both stages, see ShaderProgram.CompileWith
+	Defines map[string]string `json:"defines"`
 }
 
 func (pack *DirPack) LoadShaderPipeline(name string) (libgl.UnboundShaderPipeline, error) {
@@ -222,14 +236,14 @@ func (pack *DirPack) LoadShaderPipeline(name string) (libgl.UnboundShaderPipelin
 	if err != nil {
 		return nil, fmt.Errorf("could not load vertex shader %q for shader pipeline %q: %w", shaderDesc.Vertex, filename, err)
 	}
-	if err = vertexSh.Compile(); err != nil {
+	if err = vertexSh.CompileWith(shaderDesc.Defines); err != nil {
 		return nil, fmt.Errorf("could not compile vertex shader %q for shader pipeline %q: %w", shaderDesc.Vertex, filename, err)
 	}
 	fragmentSh, err := pack.LoadShader(path.Join(root, shaderDesc.Fragment), gl.FRAGMENT_SHADER)
 	if err != nil {
 		return nil, fmt.Errorf("could not load fragment shader %q for shader pipeline %q: %w", shaderDesc.Fragment, filename, err)
 	}
-	if err = fragmentSh.Compile(); err != nil {
+	if err = fragmentSh.CompileWith(shaderDesc.Defines); err != nil {
 		return nil, fmt.Errorf("could not compile fragment shader %q for shader pipeline %q: %w", shaderDesc.Fragment, filename, err)
 	}
 
@@ -263,6 +277,8 @@ type Material struct {
 	Albedo libgl.UnboundTexture
 	Normal libgl.UnboundTexture
 	ORM    libgl.UnboundTexture
+	// The normal texture only stores x and y, like BC5, the shader reconstructs z
+	TwoChannelNormal bool
 }
 
 func (mat *Material) Delete() {
@@ -298,45 +314,160 @@ func (pack *DirPack) LoadMaterial(name string) (*Material, error) {
 
 	root := path.Dir(filename)
 
-	albedo, err := pack.LoadTextureImage(path.Join(root, materialDesc.Albedo))
+	albeoTexture, err := pack.loadMaterialTexture(path.Join(root, materialDesc.Albedo), gl.SRGB8)
 	if err != nil {
 		return nil, fmt.Errorf("could not load 'albedo' texture image %q for material %q: %w", materialDesc.Albedo, filename, err)
 	}
 
-	normal, err := pack.LoadTextureImage(path.Join(root, materialDesc.Normal))
+	normalTexture, err := pack.loadMaterialTexture(path.Join(root, materialDesc.Normal), gl.RGB8)
 	if err != nil {
+		albeoTexture.Delete()
 		return nil, fmt.Errorf("could not load 'normal' texture image %q for material %q: %w", materialDesc.Normal, filename, err)
 	}
 
-	orm, err := pack.LoadTextureImage(path.Join(root, materialDesc.ORM))
+	ormTexture, err := pack.loadMaterialTexture(path.Join(root, materialDesc.ORM), gl.RGB8)
 	if err != nil {
+		albeoTexture.Delete()
+		normalTexture.Delete()
 		return nil, fmt.Errorf("could not load 'orm' texture image %q for material %q: %w", materialDesc.ORM, filename, err)
 	}
 
-	albeoTexture := libgl.NewTexture(gl.TEXTURE_2D)
-	albeoTexture.SetDebugLabel(materialDesc.Albedo)
-	albeoTexture.Allocate(0, gl.SRGB8, albedo.Width, albedo.Height, 0)
-	albeoTexture.Load(0, albedo.Width, albedo.Height, 0, gl.RGBA, albedo.Pix)
-	albeoTexture.GenerateMipmap()
+	return &Material{
+		Name:             name,
+		Albedo:           albeoTexture,
+		Normal:           normalTexture,
+		ORM:              ormTexture,
+		TwoChannelNormal: isTwoChannelTexture(normalTexture),
+	}, nil
+}
 
-	normalTexture := libgl.NewTexture(gl.TEXTURE_2D)
-	normalTexture.SetDebugLabel(materialDesc.Normal)
-	normalTexture.Allocate(0, gl.RGB8, normal.Width, normal.Height, 0)
-	normalTexture.Load(0, normal.Width, normal.Height, 0, gl.RGBA, normal.Pix)
-	normalTexture.GenerateMipmap()
+// Reports whether the storage of the texture has only red and green channels
+func isTwoChannelTexture(texture libgl.UnboundTexture) bool {
+	var format int32
+	gl.GetTextureLevelParameteriv(texture.Id(), 0, gl.TEXTURE_INTERNAL_FORMAT, &format)
+	switch uint32(format) {
+	case gl.COMPRESSED_RG_RGTC2, gl.RG8:
+		return true
+	}
+	return false
+}
 
-	ormTexture := libgl.NewTexture(gl.TEXTURE_2D)
-	ormTexture.SetDebugLabel(materialDesc.ORM)
-	ormTexture.Allocate(0, gl.RGB8, orm.Width, orm.Height, 0)
-	ormTexture.Load(0, orm.Width, orm.Height, 0, gl.RGBA, orm.Pix)
-	ormTexture.GenerateMipmap()
+// The OpenGL formats of the block compressed dds formats
+var dxgiGlFormats = map[libio.DxgiFormat]uint32{
+	libio.DxgiFormatBC1Unorm: gl.COMPRESSED_RGBA_S3TC_DXT1_EXT,
+	// GL_EXT_texture_sRGB, not part of the core profile bindings
+	libio.DxgiFormatBC1UnormSrgb: 0x8C4D,
+	libio.DxgiFormatBC3Unorm:     gl.COMPRESSED_RGBA_S3TC_DXT5_EXT,
+	libio.DxgiFormatBC3UnormSrgb: 0x8C4F,
+	libio.DxgiFormatBC4Unorm:     gl.COMPRESSED_RED_RGTC1,
+	libio.DxgiFormatBC5Unorm:     gl.COMPRESSED_RG_RGTC2,
+	libio.DxgiFormatBC7Unorm:     gl.COMPRESSED_RGBA_BPTC_UNORM,
+	libio.DxgiFormatBC7UnormSrgb: gl.COMPRESSED_SRGB_ALPHA_BPTC_UNORM,
+}
 
-	return &Material{
-		Name:   name,
-		Albedo: albeoTexture,
-		Normal: normalTexture,
-		ORM:    ormTexture,
-	}, nil
+// Loads and uploads a material texture.
+// Block compressed dds files are uploaded as they are, other images use internalFormat and get generated mipmaps.
+func (pack *DirPack) loadMaterialTexture(filename string, internalFormat uint32) (libgl.UnboundTexture, error) {
+	if strings.HasSuffix(filename, ".dds") {
+		return pack.loadDdsTexture(filename)
+	}
+	if strings.HasSuffix(filename, ".ktx2") {
+		texture, err := pack.loadKtx2BlockTexture(filename)
+		if texture != nil || err != nil {
+			return texture, err
+		}
+	}
+
+	img, err := pack.LoadTextureImage(filename)
+	if err != nil {
+		return nil, err
+	}
+	return newImageTexture(path.Base(filename), internalFormat, img), nil
+}
+
+// Uploads an image with 4 channels and generates its mipmaps
+func newImageTexture(label string, internalFormat uint32, img *libio.IntImage) libgl.UnboundTexture {
+	texture := libgl.NewTexture(gl.TEXTURE_2D)
+	texture.SetDebugLabel(label)
+	texture.Allocate(0, internalFormat, img.Width, img.Height, 0)
+	texture.Load(0, img.Width, img.Height, 0, gl.RGBA, img.Pix)
+	texture.GenerateMipmap()
+	return texture
+}
+
+func (pack *DirPack) loadDdsTexture(filename string) (libgl.UnboundTexture, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not open texture image file %q: %w", filename, err)
+	}
+	defer file.Close()
+
+	dds, err := libio.DecodeDds(file)
+	if err != nil {
+		return nil, err
+	}
+	if dds.Depth != 1 || dds.Layers != 1 || dds.Faces != 1 {
+		return nil, fmt.Errorf("dds texture %q is not a 2D texture", filename)
+	}
+	glFormat, ok := dxgiGlFormats[dds.Format]
+	if !ok {
+		return nil, fmt.Errorf("dds format %v of %q unsupported", dds.Format, filename)
+	}
+	// the blocks are flipped instead of the uvs, like the other images
+	if err := dds.FlipVertically(); err != nil {
+		return nil, fmt.Errorf("could not flip dds texture %q: %w", filename, err)
+	}
+
+	return newCompressedTexture(filename, glFormat, dds.Width, dds.Height, dds.Levels), nil
+}
+
+// Loads a block compressed ktx2 texture with its mip levels, returns nil without an error for other formats
+func (pack *DirPack) loadKtx2BlockTexture(filename string) (libgl.UnboundTexture, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not open texture image file %q: %w", filename, err)
+	}
+	defer file.Close()
+
+	ktx, err := libio.DecodeKtx2(file)
+	if err != nil {
+		return nil, err
+	}
+	blockFormat := ktx.Format.BlockFormat()
+	if blockFormat == libio.DxgiFormatUnknown {
+		return nil, nil
+	}
+	if ktx.Depth != 1 || ktx.Layers != 1 || ktx.Faces != 1 {
+		return nil, fmt.Errorf("ktx2 texture %q is not a 2D texture", filename)
+	}
+	glFormat, ok := dxgiGlFormats[blockFormat]
+	if !ok {
+		return nil, fmt.Errorf("ktx2 format %v of %q unsupported", blockFormat, filename)
+	}
+	if ktx.OrientationY() == 'd' {
+		if err := ktx.FlipVertically(); err != nil {
+			return nil, fmt.Errorf("could not flip ktx2 texture %q: %w", filename, err)
+		}
+	}
+
+	return newCompressedTexture(filename, glFormat, ktx.Width, ktx.Height, ktx.Levels), nil
+}
+
+func newCompressedTexture(filename string, glFormat uint32, width, height int, levels [][]byte) libgl.UnboundTexture {
+	texture := libgl.NewTexture(gl.TEXTURE_2D)
+	texture.SetDebugLabel(path.Base(filename))
+	texture.Allocate(len(levels), glFormat, width, height, 0)
+	for lvl, level := range levels {
+		w, h := width>>lvl, height>>lvl
+		if w < 1 {
+			w = 1
+		}
+		if h < 1 {
+			h = 1
+		}
+		texture.LoadCompressed(lvl, w, h, 0, glFormat, level)
+	}
+	return texture
 }
 
 func (pack *DirPack) LoadTexture(name string) (*libio.IntImage, error) {
@@ -355,6 +486,45 @@ func (pack *DirPack) LoadTextureFloat(name string) (*libio.FloatImage, error) {
 	return pack.LoadTextureImageFloat(filename)
 }
 
+// The pixel formats of images by their number of channels
+var channelGlFormats = [...]uint32{1: gl.RED, 2: gl.RG, 3: gl.RGB, 4: gl.RGBA}
+
+// Loads a float texture and uploads its pixels directly from the mapped file, without keeping a copy in memory
+func (pack *DirPack) LoadFloatTexture(name string, internalFormat uint32) (libgl.UnboundTexture, error) {
+	filename, ok := pack.TextureIndex[name]
+	if !ok {
+		return nil, fmt.Errorf("texture %q is not registered in this pack", name)
+	}
+	if !strings.HasSuffix(filename, ".f32") {
+		img, err := pack.LoadTextureImageFloat(filename)
+		if err != nil {
+			return nil, err
+		}
+		return newFloatTexture(filename, internalFormat, img), nil
+	}
+
+	file, err := libio.MapFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not open texture image file %q: %w", filename, err)
+	}
+	defer file.Close()
+
+	img, err := libio.DecodeFloatImage(file.Reader())
+	if err != nil {
+		return nil, fmt.Errorf("could not decode texture image file %q: %w", filename, err)
+	}
+	// the pixels reference the mapping until the file is closed
+	return newFloatTexture(filename, internalFormat, img), nil
+}
+
+func newFloatTexture(filename string, internalFormat uint32, img *libio.FloatImage) libgl.UnboundTexture {
+	texture := libgl.NewTexture(gl.TEXTURE_2D)
+	texture.SetDebugLabel(path.Base(filename))
+	texture.Allocate(1, internalFormat, img.Width, img.Height, 0)
+	texture.Load(0, img.Width, img.Height, 0, channelGlFormats[img.Channels], img.Pix)
+	return texture
+}
+
 func (pack *DirPack) LoadTextureImage(filename string) (*libio.IntImage, error) {
 	file, err := os.Open(filename)
 	if err != nil {
@@ -370,6 +540,17 @@ func (pack *DirPack) LoadTextureImage(filename string) (*libio.IntImage, error)
 			return nil, err
 		}
 		return libio.NewIntImage(img.Pix, 4, img.Rect.Dx(), img.Rect.Dy()), nil
+	} else if strings.HasSuffix(filename, ".ktx2") {
+		ktx, err := libio.DecodeKtx2(file)
+		if err != nil {
+			return nil, err
+		}
+		tex, err := ktx.ToIntTexture()
+		if err != nil {
+			return nil, err
+		}
+		// only the base level, like the other formats
+		return tex.Image(0, 0, 0).ToChannels(4, 0, 0, 0, 0xff), nil
 	} else {
 		return nil, fmt.Errorf("unsupported int image file type %q", filename)
 	}
@@ -384,6 +565,16 @@ func (pack *DirPack) LoadTextureImageFloat(filename string) (*libio.FloatImage,
 
 	if strings.HasSuffix(filename, ".f32") {
 		return libio.DecodeFloatImage(file)
+	} else if strings.HasSuffix(filename, ".ktx2") {
+		ktx, err := libio.DecodeKtx2(file)
+		if err != nil {
+			return nil, err
+		}
+		tex, err := ktx.ToFloatTexture()
+		if err != nil {
+			return nil, err
+		}
+		return tex.Image(0, 0, 0), nil
 	} else {
 		return nil, fmt.Errorf("unsupported float image file type %q", filename)
 	}
@@ -394,15 +585,31 @@ func (pack *DirPack) LoadMesh(name string) (*Mesh, error) {
 	if !ok {
 		return nil, fmt.Errorf("mesh %q is not registered in this pack", name)
 	}
-	file, err := os.Open(filename)
+	file, err := libio.MapFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("could not open mesh file %q: %w", filename, err)
 	}
 	defer file.Close()
 
-	var src io.Reader = file
+	var src io.Reader = file.Reader()
 	if strings.HasSuffix(filename, ".lz4") {
-		src = lz4.NewReader(file)
+		src = lz4.NewReader(src)
+	}
+
+	if isGltf(filename) {
+		scene, err := pack.decodeGltfFile(src, filename)
+		if err != nil {
+			return nil, err
+		}
+		// the nodes are merged, use LoadScene to keep them apart
+		return scene.Flatten(name), nil
+	}
+	if strings.HasSuffix(filename, ".obj") {
+		scene, err := DecodeObj(src, nil, pack.ImportOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode obj file %q: %w", filename, err)
+		}
+		return scene.Flatten(name), nil
 	}
 
 	mesh, err := DecodeMesh(src)
@@ -413,21 +620,203 @@ func (pack *DirPack) LoadMesh(name string) (*Mesh, error) {
 	return mesh, nil
 }
 
+// Uploads a mesh to the batch and returns its name in the batch.
+// Uncompressed .geo files are written to the buffers of the batch from the mapped file, see DecodeMeshView.
+func (pack *DirPack) UploadMesh(batch *RenderBatch, name string) (string, error) {
+	filename, ok := pack.MeshIndex[name]
+	if !ok {
+		return "", fmt.Errorf("mesh %q is not registered in this pack", name)
+	}
+	if !strings.HasSuffix(filename, ".geo") {
+		mesh, err := pack.LoadMesh(name)
+		if err != nil {
+			return "", err
+		}
+		batch.Upload(mesh)
+		return mesh.Name, nil
+	}
+
+	file, err := libio.MapFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("could not open mesh file %q: %w", filename, err)
+	}
+	// the mesh references the mapping until it is uploaded
+	defer file.Close()
+
+	mesh, err := DecodeMeshView(file.Reader())
+	if err != nil {
+		return "", fmt.Errorf("could not decode mesh file %q: %w", filename, err)
+	}
+	batch.Upload(mesh)
+	return mesh.Name, nil
+}
+
+func isGltf(filename string) bool {
+	return strings.HasSuffix(filename, ".gltf") || strings.HasSuffix(filename, ".glb")
+}
+
+// Decodes a glTF file, its external buffers are resolved relative to it
+func (pack *DirPack) decodeGltfFile(r io.Reader, filename string) (*GltfScene, error) {
+	scene, err := DecodeGltf(r, os.DirFS(path.Dir(filename)), pack.ImportOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode gltf file %q: %w", filename, err)
+	}
+	return scene, nil
+}
+
+// The models of a glTF file and their instances
+type Scene struct {
+	Name      string
+	Models    []*Model
+	Instances []SceneInstance
+}
+
+type SceneInstance struct {
+	// The index into Scene.Models
+	Model     int
+	Transform mgl32.Mat4
+}
+
+// Loads a glTF file with its materials.
+// The names of its meshes and materials are prefixed with the name of the scene so they do not collide in a RenderBatch.
+func (pack *DirPack) LoadScene(name string) (*Scene, error) {
+	filename, ok := pack.SceneIndex[name]
+	if !ok {
+		return nil, fmt.Errorf("scene %q is not registered in this pack", name)
+	}
+	file, err := libio.MapFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not open scene file %q: %w", filename, err)
+	}
+	defer file.Close()
+
+	gltf, err := pack.decodeGltfFile(file.Reader(), filename)
+	if err != nil {
+		return nil, err
+	}
+
+	scene := &Scene{Name: name}
+	materials := make([]*Material, len(gltf.Materials))
+	var defaultMaterial *Material
+	// each primitive of a mesh is a model
+	modelIndex := make([][]int, len(gltf.Meshes))
+
+	for i, mesh := range gltf.Meshes {
+		for _, prim := range mesh.Primitives {
+			var material *Material
+			if prim.Material < 0 {
+				if defaultMaterial == nil {
+					defaultMaterial = pack.loadGltfMaterial(name+"/default", path.Dir(filename), GltfMaterial{
+						BaseColorFactor: mgl32.Vec4{1, 1, 1, 1},
+						MetallicFactor:  1,
+						RoughnessFactor: 1,
+					})
+				}
+				material = defaultMaterial
+			} else {
+				if materials[prim.Material] == nil {
+					desc := gltf.Materials[prim.Material]
+					materials[prim.Material] = pack.loadGltfMaterial(name+"/"+desc.Name, path.Dir(filename), desc)
+				}
+				material = materials[prim.Material]
+			}
+
+			prim.Mesh.Name = name + "/" + prim.Mesh.Name
+			scene.Models = append(scene.Models, &Model{Mesh: prim.Mesh, Material: material})
+			modelIndex[i] = append(modelIndex[i], len(scene.Models)-1)
+		}
+	}
+
+	for _, node := range gltf.Nodes {
+		for _, model := range modelIndex[node.Mesh] {
+			scene.Instances = append(scene.Instances, SceneInstance{Model: model, Transform: node.Transform})
+		}
+	}
+
+	return scene, nil
+}
+
+// Uploads the textures of a glTF material.
+// Textures which are missing or cannot be loaded are replaced by a single texel of the material factors,
+// the factors are not applied to textures.
+func (pack *DirPack) loadGltfMaterial(name string, root string, desc GltfMaterial) *Material {
+	albedo := desc.BaseColorFactor
+	for i := 0; i < 3; i++ {
+		albedo[i] = libio.LinearToSrgb(albedo[i])
+	}
+	normal := pack.loadGltfTexture(name+".normal", root, desc.Normal, gl.RGB8, mgl32.Vec4{0.5, 0.5, 1, 1})
+	return &Material{
+		Name:             name,
+		Albedo:           pack.loadGltfTexture(name+".albedo", root, desc.Albedo, gl.SRGB8, albedo),
+		Normal:           normal,
+		ORM:              pack.loadGltfTexture(name+".orm", root, desc.ORM, gl.RGB8, mgl32.Vec4{1, desc.RoughnessFactor, desc.MetallicFactor, 1}),
+		TwoChannelNormal: isTwoChannelTexture(normal),
+	}
+}
+
+func (pack *DirPack) loadGltfTexture(label string, root string, img *GltfImage, internalFormat uint32, fallback mgl32.Vec4) libgl.UnboundTexture {
+	var err error
+	switch {
+	case img == nil:
+	case img.Data != nil:
+		stbi.Default.FlipVertically = true
+		stbi.Default.CopyData = true
+		var decoded *stbi.RgbaLdr
+		if decoded, err = stbi.LoadBytes(img.Data); err == nil {
+			return newImageTexture(label, internalFormat, libio.NewIntImage(decoded.Pix, 4, decoded.Rect.Dx(), decoded.Rect.Dy()))
+		}
+	default:
+		var texture libgl.UnboundTexture
+		if texture, err = pack.loadMaterialTexture(path.Join(root, img.URI), internalFormat); err == nil {
+			return texture
+		}
+	}
+	if err != nil {
+		log.Printf("Could not load texture %q, using its factor: %v\n", label, err)
+	}
+
+	texel := make([]uint8, 4)
+	for i := range texel {
+		texel[i] = uint8(math32.Round(mgl32.Clamp(fallback[i], 0, 1) * 0xff))
+	}
+	return newImageTexture(label, internalFormat, libio.NewIntImage(texel, 4, 1, 1))
+}
+
 func (pack *DirPack) LoadHdri(name string) (*ibl.IblEnv, error) {
 	filename, ok := pack.HdriIndex[name]
 	if !ok {
 		return nil, fmt.Errorf("hdri %q is not registered in this pack", name)
 	}
-	file, err := os.Open(filename)
+	file, err := libio.MapFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("could not open hdri file %q: %w", filename, err)
 	}
 	defer file.Close()
 
-	mesh, err := ibl.DecodeIblEnv(file)
+	if strings.HasSuffix(filename, ".ktx2") {
+		return loadKtx2Hdri(file.Reader(), filename)
+	}
+
+	mesh, err := ibl.DecodeIblEnv(file.Reader())
 	if err != nil {
 		return nil, fmt.Errorf("could not decode hdri file %q: %w", filename, err)
 	}
 
 	return mesh, nil
 }
+
+func loadKtx2Hdri(r io.Reader, filename string) (*ibl.IblEnv, error) {
+	ktx, err := libio.DecodeKtx2(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode hdri file %q: %w", filename, err)
+	}
+	tex, err := ktx.ToFloatTexture()
+	if err != nil {
+		return nil, fmt.Errorf("could not decode hdri file %q: %w", filename, err)
+	}
+	env, err := ibl.NewIblEnvFromTexture(tex)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode hdri file %q: %w", filename, err)
+	}
+	return env, nil
+}
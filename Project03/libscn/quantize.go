@@ -0,0 +1,90 @@
+package libscn
+
+import (
+	"github.com/chewxy/math32"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Quantizes v in [-1, 1] to a signed normalized 16 bit integer, values outside are clamped
+func EncodeSnorm16(v float32) int16 {
+	v = mgl32.Clamp(v, -1, 1)
+	return int16(math32.Round(v * 0x7fff))
+}
+
+// The inverse of EncodeSnorm16, -0x8000 is -1 like in OpenGL
+func DecodeSnorm16(v int16) float32 {
+	return math32.Max(float32(v)/0x7fff, -1)
+}
+
+// Quantizes v in [0, 1] to an unsigned normalized integer of the given number of bits, values outside are clamped
+func EncodeUnorm(v float32, bits int) uint32 {
+	scale := float32(uint32(1)<<bits - 1)
+	if !(v > 0) {
+		// also catches NaN
+		return 0
+	}
+	if v > 1 {
+		v = 1
+	}
+	return uint32(math32.Round(v * scale))
+}
+
+func DecodeUnorm(v uint32, bits int) float32 {
+	return float32(v) / float32(uint32(1)<<bits-1)
+}
+
+// Maps a unit vector onto the octahedron unfolded into [-1, 1]², which has a much more even precision than xyz components
+func EncodeOctahedral(n mgl32.Vec3) mgl32.Vec2 {
+	l1 := math32.Abs(n[0]) + math32.Abs(n[1]) + math32.Abs(n[2])
+	if l1 == 0 {
+		return mgl32.Vec2{0, 0}
+	}
+	p := mgl32.Vec2{n[0] / l1, n[1] / l1}
+	if n[2] < 0 {
+		// the lower half is folded over the diagonals
+		p = mgl32.Vec2{
+			(1 - math32.Abs(p[1])) * signNotZero(p[0]),
+			(1 - math32.Abs(p[0])) * signNotZero(p[1]),
+		}
+	}
+	return p
+}
+
+// The inverse of EncodeOctahedral, returns a unit vector
+func DecodeOctahedral(p mgl32.Vec2) mgl32.Vec3 {
+	n := mgl32.Vec3{p[0], p[1], 1 - math32.Abs(p[0]) - math32.Abs(p[1])}
+	if n[2] < 0 {
+		n[0], n[1] = (1-math32.Abs(p[1]))*signNotZero(p[0]), (1-math32.Abs(p[0]))*signNotZero(p[1])
+	}
+	return n.Normalize()
+}
+
+// Encodes a unit vector into two snorm16, choosing the rounding of both components with the smallest error
+func EncodeOctahedral16(n mgl32.Vec3) [2]int16 {
+	p := EncodeOctahedral(n)
+	best, bestErr := [2]int16{}, float32(2)
+	for _, fx := range [2]func(float32) float32{math32.Floor, math32.Ceil} {
+		for _, fy := range [2]func(float32) float32{math32.Floor, math32.Ceil} {
+			q := [2]int16{
+				int16(mgl32.Clamp(fx(p[0]*0x7fff), -0x7fff, 0x7fff)),
+				int16(mgl32.Clamp(fy(p[1]*0x7fff), -0x7fff, 0x7fff)),
+			}
+			// the sine of the angle, the dot product of such close vectors is 1 in float32
+			if e := DecodeOctahedral16(q).Cross(n).Len(); e < bestErr {
+				best, bestErr = q, e
+			}
+		}
+	}
+	return best
+}
+
+func DecodeOctahedral16(q [2]int16) mgl32.Vec3 {
+	return DecodeOctahedral(mgl32.Vec2{DecodeSnorm16(q[0]), DecodeSnorm16(q[1])})
+}
+
+func signNotZero(v float32) float32 {
+	if v < 0 {
+		return -1
+	}
+	return 1
+}
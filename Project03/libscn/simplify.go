@@ -0,0 +1,477 @@
+package libscn
+
+import (
+	"sort"
+
+	"github.com/chewxy/math32"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Where a vertex can be collapsed to during the simplification
+type simplifyKind uint8
+
+const (
+	// Inside a closed surface, can be collapsed to any neighbor
+	simplifyManifold simplifyKind = iota
+	// On an open edge of the mesh, can only be collapsed along it
+	simplifyBorder
+	// One of the two vertices at the same position with different uvs or normals, both are collapsed together along the seam
+	simplifySeam
+	// Is never collapsed, like the vertices between submeshes
+	simplifyLocked
+)
+
+// The open edges of borders and seams are weighted more than the faces so their shape is preserved
+const simplifyEdgeWeight = 10
+
+// A quadric of the squared distances to planes, area weighted
+type quadric struct {
+	a00, a11, a22, a01, a02, a12 float32
+	b0, b1, b2, c                float32
+	w                            float32
+}
+
+func planeQuadric(n mgl32.Vec3, p mgl32.Vec3, w float32) quadric {
+	d := -n.Dot(p)
+	return quadric{
+		a00: w * n[0] * n[0], a11: w * n[1] * n[1], a22: w * n[2] * n[2],
+		a01: w * n[0] * n[1], a02: w * n[0] * n[2], a12: w * n[1] * n[2],
+		b0: w * n[0] * d, b1: w * n[1] * d, b2: w * n[2] * d, c: w * d * d,
+		w: w,
+	}
+}
+
+func (q quadric) add(o quadric) quadric {
+	return quadric{
+		q.a00 + o.a00, q.a11 + o.a11, q.a22 + o.a22, q.a01 + o.a01, q.a02 + o.a02, q.a12 + o.a12,
+		q.b0 + o.b0, q.b1 + o.b1, q.b2 + o.b2, q.c + o.c,
+		q.w + o.w,
+	}
+}
+
+// The weighted average of the squared distances of p to the planes
+func (q quadric) error(p mgl32.Vec3) float32 {
+	if q.w == 0 {
+		return 0
+	}
+	x, y, z := p[0], p[1], p[2]
+	r := q.a00*x*x + q.a11*y*y + q.a22*z*z + 2*(q.a01*x*y+q.a02*x*z+q.a12*y*z) + 2*(q.b0*x+q.b1*y+q.b2*z) + q.c
+	return math32.Abs(r) / q.w
+}
+
+// Reduces the triangles with quadric error metric edge collapses, like meshoptimizer, until at most targetIndexCount
+// indices are left or the next collapse would move the surface by more than targetError. The errors are relative to
+// the largest dimension of the bounds of the triangles, the largest error of the result is returned.
+//
+// Vertices are only collapsed onto other vertices so the result uses the same vertex buffer. Vertices on borders and
+// uv or normal seams are only collapsed along them, the seams are kept intact and the normals of the triangles
+// are not flipped.
+func Simplify(vertices []Vertex, indices []uint32, targetIndexCount int, targetError float32) ([]uint32, float32) {
+	result, _, err := simplify(vertices, indices, nil, targetIndexCount, targetError)
+	return result, err
+}
+
+// Simplifies triangles which belong to groups, vertices used by several groups are locked.
+// The groups of the remaining triangles are returned with them.
+func simplify(vertices []Vertex, indices []uint32, groups []int, targetIndexCount int, targetError float32) ([]uint32, []int, float32) {
+	triangleCount := len(indices) / 3
+	result := append([]uint32{}, indices[:triangleCount*3]...)
+	if groups == nil {
+		groups = make([]int, triangleCount)
+	}
+	resultGroups := append([]int{}, groups[:triangleCount]...)
+	if len(result) <= targetIndexCount {
+		return result, resultGroups, 0
+	}
+
+	// the vertices at the same position form a ring of wedges
+	posRemap := make([]uint32, len(vertices))
+	wedge := make([]uint32, len(vertices))
+	firstAt := make(map[mgl32.Vec3]uint32, len(vertices))
+	for i, v := range vertices {
+		if first, ok := firstAt[v.Position]; ok {
+			posRemap[i] = first
+			wedge[i], wedge[first] = wedge[first], uint32(i)
+		} else {
+			firstAt[v.Position] = uint32(i)
+			posRemap[i] = uint32(i)
+			wedge[i] = uint32(i)
+		}
+	}
+
+	// the positions are scaled into the unit cube so the errors are relative
+	referenced := make([]bool, len(vertices))
+	bounds := AABB{Min: vertices[result[0]].Position, Max: vertices[result[0]].Position}
+	for _, index := range result {
+		referenced[index] = true
+		for c, v := range vertices[index].Position {
+			bounds.Min[c] = math32.Min(bounds.Min[c], v)
+			bounds.Max[c] = math32.Max(bounds.Max[c], v)
+		}
+	}
+	size := bounds.Max.Sub(bounds.Min)
+	extent := math32.Max(size[0], math32.Max(size[1], size[2]))
+	if extent == 0 {
+		return result, resultGroups, 0
+	}
+	positions := make([]mgl32.Vec3, len(vertices))
+	for i, v := range vertices {
+		positions[i] = v.Position.Sub(bounds.Min).Mul(1 / extent)
+	}
+
+	kinds, loop, loopback := classifySimplifyVertices(result, resultGroups, referenced, posRemap, wedge)
+
+	quadrics := make([]quadric, len(vertices))
+	for t := 0; t < triangleCount; t++ {
+		tri := result[t*3 : t*3+3]
+		p0, p1, p2 := positions[tri[0]], positions[tri[1]], positions[tri[2]]
+		normal := p1.Sub(p0).Cross(p2.Sub(p0))
+		area := normal.Len()
+		if area == 0 {
+			continue
+		}
+		normal = normal.Mul(1 / area)
+		q := planeQuadric(normal, p0, area)
+		for _, index := range tri {
+			quadrics[posRemap[index]] = quadrics[posRemap[index]].add(q)
+		}
+
+		for c := 0; c < 3; c++ {
+			i0, i1 := tri[c], tri[(c+1)%3]
+			if (kinds[i0] != simplifyBorder && kinds[i0] != simplifySeam) || loop[i0] != i1 {
+				continue
+			}
+			// a plane through the open edge perpendicular to the triangle
+			edge := positions[i1].Sub(positions[i0])
+			length := edge.Len()
+			if length == 0 {
+				continue
+			}
+			q := planeQuadric(edge.Cross(normal).Normalize(), positions[i0], length*length*simplifyEdgeWeight)
+			quadrics[posRemap[i0]] = quadrics[posRemap[i0]].add(q)
+			quadrics[posRemap[i1]] = quadrics[posRemap[i1]].add(q)
+		}
+	}
+
+	type collapse struct {
+		source, target uint32
+		error          float32
+	}
+	canCollapse := func(source, target uint32) bool {
+		switch kinds[source] {
+		case simplifyManifold:
+			return true
+		case simplifyBorder:
+			return kinds[target] == simplifyBorder && (loop[source] == target || loopback[source] == target)
+		case simplifySeam:
+			if kinds[target] != simplifySeam || (loop[source] != target && loopback[source] != target) {
+				return false
+			}
+			// the other wedges have to be neighbors on the other side of the seam
+			s0, s1 := wedge[source], wedge[target]
+			return loop[s0] == s1 || loopback[s0] == s1
+		}
+		return false
+	}
+
+	maxError := float32(0)
+	limit := targetError * targetError
+	collapseRemap := make([]uint32, len(vertices))
+	lockedPositions := make([]bool, len(vertices))
+	for len(result) > targetIndexCount {
+		triangleCount = len(result) / 3
+		adjacency := newTriangleAdjacency(result, len(vertices))
+
+		collapses := []collapse{}
+		for t := 0; t < triangleCount; t++ {
+			for c := 0; c < 3; c++ {
+				i0, i1 := result[t*3+c], result[t*3+(c+1)%3]
+				if posRemap[i0] == posRemap[i1] {
+					continue
+				}
+				q := quadrics[posRemap[i0]].add(quadrics[posRemap[i1]])
+				if canCollapse(i0, i1) {
+					collapses = append(collapses, collapse{i0, i1, q.error(positions[i1])})
+				}
+				if canCollapse(i1, i0) {
+					collapses = append(collapses, collapse{i1, i0, q.error(positions[i0])})
+				}
+			}
+		}
+		sort.Slice(collapses, func(i, j int) bool {
+			return collapses[i].error < collapses[j].error
+		})
+
+		for i := range collapseRemap {
+			collapseRemap[i] = uint32(i)
+			lockedPositions[i] = false
+		}
+		// a collapse removes two triangles of a closed surface and one at a border
+		goal := (len(result) - targetIndexCount) / 3
+		removed, performed := 0, 0
+		for _, col := range collapses {
+			if removed >= goal || col.error > limit {
+				break
+			}
+			r0, r1 := posRemap[col.source], posRemap[col.target]
+			if lockedPositions[r0] || lockedPositions[r1] {
+				continue
+			}
+			if flipsTriangles(result, adjacency, positions, posRemap, col.source, col.target) {
+				continue
+			}
+			collapseRemap[col.source] = col.target
+			if kinds[col.source] == simplifySeam {
+				s0, s1 := wedge[col.source], wedge[col.target]
+				if flipsTriangles(result, adjacency, positions, posRemap, s0, s1) {
+					collapseRemap[col.source] = col.source
+					continue
+				}
+				collapseRemap[s0] = s1
+			}
+			quadrics[r1] = quadrics[r1].add(quadrics[r0])
+			// the flips of the other collapses in this pass are checked against the unchanged triangles
+			for _, v := range []uint32{col.source, wedge[col.source]} {
+				for _, t := range adjacency.of(v) {
+					for _, index := range result[t*3 : t*3+3] {
+						lockedPositions[posRemap[index]] = true
+					}
+				}
+			}
+			maxError = math32.Max(maxError, col.error)
+			performed++
+			if kinds[col.source] == simplifyBorder {
+				removed++
+			} else {
+				removed += 2
+			}
+		}
+		if performed == 0 {
+			break
+		}
+
+		// triangles with two corners at the same position are dropped
+		kept := 0
+		for t := 0; t < triangleCount; t++ {
+			a, b, c := collapseRemap[result[t*3]], collapseRemap[result[t*3+1]], collapseRemap[result[t*3+2]]
+			ra, rb, rc := posRemap[a], posRemap[b], posRemap[c]
+			if ra == rb || ra == rc || rb == rc {
+				continue
+			}
+			result[kept*3], result[kept*3+1], result[kept*3+2] = a, b, c
+			resultGroups[kept] = resultGroups[t]
+			kept++
+		}
+		result, resultGroups = result[:kept*3], resultGroups[:kept]
+
+		// the loops skip the collapsed vertices
+		for i := range loop {
+			for _, l := range []*uint32{&loop[i], &loopback[i]} {
+				if *l == ^uint32(0) {
+					continue
+				}
+				r := collapseRemap[*l]
+				if r == uint32(i) {
+					// the edge to the vertex was collapsed onto it, the loop continues after it
+					if l == &loop[i] {
+						r = loop[*l]
+					} else {
+						r = loopback[*l]
+					}
+				}
+				*l = r
+			}
+		}
+	}
+
+	return result, resultGroups, math32.Sqrt(maxError)
+}
+
+// Classifies the vertices by their open edges, returns the next and previous vertex along the open edges
+func classifySimplifyVertices(indices []uint32, groups []int, referenced []bool, posRemap, wedge []uint32) (kinds []simplifyKind, loop, loopback []uint32) {
+	count := len(posRemap)
+	edges := make(map[[2]uint32]bool, len(indices))
+	for t := 0; t < len(indices)/3; t++ {
+		for c := 0; c < 3; c++ {
+			edges[[2]uint32{indices[t*3+c], indices[t*3+(c+1)%3]}] = true
+		}
+	}
+
+	kinds = make([]simplifyKind, count)
+	loop = make([]uint32, count)
+	loopback = make([]uint32, count)
+	openOut := make([]int, count)
+	openIn := make([]int, count)
+	for i := range loop {
+		loop[i], loopback[i] = ^uint32(0), ^uint32(0)
+	}
+	for edge := range edges {
+		if edges[[2]uint32{edge[1], edge[0]}] {
+			continue
+		}
+		loop[edge[0]], loopback[edge[1]] = edge[1], edge[0]
+		openOut[edge[0]]++
+		openIn[edge[1]]++
+	}
+
+	// vertices shared by groups keep the boundaries between the groups
+	group := make([]int, count)
+	for i := range group {
+		group[i] = -1
+	}
+	for t := 0; t < len(indices)/3; t++ {
+		for _, index := range indices[t*3 : t*3+3] {
+			if group[index] >= 0 && group[index] != groups[t] {
+				kinds[index] = simplifyLocked
+			}
+			group[index] = groups[t]
+		}
+	}
+
+	for i := range kinds {
+		if !referenced[i] || kinds[i] == simplifyLocked {
+			kinds[i] = simplifyLocked
+			continue
+		}
+		wedges := 0
+		for w := uint32(i); ; {
+			if referenced[w] {
+				wedges++
+			}
+			if w = wedge[w]; w == uint32(i) {
+				break
+			}
+		}
+		single := openOut[i] == 1 && openIn[i] == 1
+		switch {
+		case wedges == 1 && openOut[i] == 0 && openIn[i] == 0:
+			kinds[i] = simplifyManifold
+		case wedges == 1 && single:
+			kinds[i] = simplifyBorder
+		case wedges == 2 && wedge[wedge[i]] == uint32(i) && single:
+			// the open edges of both wedges lie on top of each other in opposite directions
+			s := wedge[i]
+			if openOut[s] == 1 && openIn[s] == 1 && posRemap[loop[i]] == posRemap[loopback[s]] && posRemap[loopback[i]] == posRemap[loop[s]] {
+				kinds[i] = simplifySeam
+			} else {
+				kinds[i] = simplifyLocked
+			}
+		default:
+			kinds[i] = simplifyLocked
+		}
+	}
+	// both wedges of a seam have to be collapsed
+	for i, kind := range kinds {
+		if kind == simplifySeam && kinds[wedge[i]] != simplifySeam {
+			kinds[i] = simplifyLocked
+		}
+	}
+	return kinds, loop, loopback
+}
+
+// The triangles of each vertex in a compressed list
+type triangleAdjacency struct {
+	offsets   []int
+	triangles []int
+}
+
+func newTriangleAdjacency(indices []uint32, vertexCount int) triangleAdjacency {
+	adjacency := triangleAdjacency{offsets: make([]int, vertexCount+1), triangles: make([]int, len(indices)/3*3)}
+	for _, index := range indices[:len(adjacency.triangles)] {
+		adjacency.offsets[index+1]++
+	}
+	for v := 0; v < vertexCount; v++ {
+		adjacency.offsets[v+1] += adjacency.offsets[v]
+	}
+	filled := make([]int, vertexCount)
+	for t := 0; t < len(indices)/3; t++ {
+		for _, index := range indices[t*3 : t*3+3] {
+			adjacency.triangles[adjacency.offsets[index]+filled[index]] = t
+			filled[index]++
+		}
+	}
+	return adjacency
+}
+
+func (adjacency triangleAdjacency) of(vertex uint32) []int {
+	return adjacency.triangles[adjacency.offsets[vertex]:adjacency.offsets[vertex+1]]
+}
+
+// Whether moving source to the position of target turns any of its triangles by more than 75 degrees
+func flipsTriangles(indices []uint32, adjacency triangleAdjacency, positions []mgl32.Vec3, posRemap []uint32, source, target uint32) bool {
+	for _, t := range adjacency.of(source) {
+		tri := indices[t*3 : t*3+3]
+		corners := [3]mgl32.Vec3{}
+		collapsed := false
+		for c, index := range tri {
+			corners[c] = positions[index]
+			if index == source {
+				corners[c] = positions[target]
+			} else if posRemap[index] == posRemap[target] {
+				// the triangle is removed by the collapse
+				collapsed = true
+			}
+		}
+		if collapsed {
+			continue
+		}
+		p0, p1, p2 := positions[tri[0]], positions[tri[1]], positions[tri[2]]
+		before := p1.Sub(p0).Cross(p2.Sub(p0))
+		after := corners[1].Sub(corners[0]).Cross(corners[2].Sub(corners[0]))
+		if before.Len() > 0 && before.Dot(after) <= 0.25*before.Len()*after.Len() {
+			return true
+		}
+	}
+	return false
+}
+
+// Generates a chain of up to levels coarser versions of the mesh, each with about half the triangles of the previous one.
+// The chain ends when the error would exceed maxError, relative to the largest dimension of the bounds, or the
+// triangles can not be reduced any further. The triangles stay within their submeshes.
+func (mesh *Mesh) GenerateLods(levels int, maxError float32) {
+	mesh.Lods = nil
+	ranges := indexRanges(mesh.Indices, mesh.Submeshes)
+	// triangles which are not part of a submesh are kept in a group after them
+	covered := make([]bool, len(mesh.Indices)/3)
+	indices, groups := []uint32{}, []int{}
+	for g, r := range ranges {
+		indices = append(indices, mesh.Indices[r[0]:r[1]]...)
+		for t := r[0] / 3; t < r[1]/3; t++ {
+			groups = append(groups, g)
+			covered[t] = true
+		}
+	}
+	for t, ok := range covered {
+		if !ok {
+			indices = append(indices, mesh.Indices[t*3:t*3+3]...)
+			groups = append(groups, len(ranges))
+		}
+	}
+
+	previous := len(indices)
+	for level := 1; level <= levels; level++ {
+		target := len(indices) >> level / 3 * 3
+		result, resultGroups, err := simplify(mesh.Vertices, indices, groups, target, maxError)
+		// the error and draw calls of another level are not worth less than a fifth of the triangles
+		if len(result) == 0 || len(result) > previous*4/5 {
+			break
+		}
+		previous = len(result)
+
+		lod := MeshLod{Error: err, Indices: make([]uint32, 0, len(result))}
+		for g := 0; g <= len(ranges); g++ {
+			first := len(lod.Indices)
+			for t, group := range resultGroups {
+				if group == g {
+					lod.Indices = append(lod.Indices, result[t*3:t*3+3]...)
+				}
+			}
+			if g < len(mesh.Submeshes) {
+				sub := mesh.Submeshes[g]
+				sub.FirstIndex, sub.IndexCount = first, len(lod.Indices)-first
+				lod.Submeshes = append(lod.Submeshes, sub)
+			}
+		}
+		mesh.Lods = append(mesh.Lods, lod)
+	}
+}
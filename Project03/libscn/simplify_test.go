@@ -0,0 +1,163 @@
+package libscn_test
+
+import (
+	"advanced-gl/Project03/libscn"
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/chewxy/math32"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// A flat grid of size² quads facing z, the uvs of the vertices right of seam are moved by 10 so they are split there
+func gridMesh(size, seam int) ([]libscn.Vertex, []uint32) {
+	vertices, indices := []libscn.Vertex{}, []uint32{}
+	index := map[[2]int]uint32{}
+	vertex := func(x, y int, right bool) uint32 {
+		key := [2]int{x, y}
+		uv := mgl32.Vec2{float32(x), float32(y)}
+		if right && x >= seam {
+			key[0] += 1000
+			uv[0] += 10
+		}
+		if i, ok := index[key]; ok {
+			return i
+		}
+		index[key] = uint32(len(vertices))
+		vertices = append(vertices, libscn.Vertex{
+			Position: mgl32.Vec3{float32(x), float32(y), 0},
+			Normal:   mgl32.Vec3{0, 0, 1},
+			Tangent:  mgl32.Vec4{1, 0, 0, 1},
+			Uv:       uv,
+		})
+		return index[key]
+	}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			right := x >= seam
+			a, b, c, d := vertex(x, y, right), vertex(x+1, y, right), vertex(x+1, y+1, right), vertex(x, y+1, right)
+			indices = append(indices, a, b, c, a, c, d)
+		}
+	}
+	return vertices, indices
+}
+
+// The area and normals of the triangles, which should be kept by simplifying a flat mesh
+func checkFlat(t *testing.T, vertices []libscn.Vertex, indices []uint32, area float32) {
+	t.Helper()
+	sum := float32(0)
+	for i := 0; i < len(indices); i += 3 {
+		p0, p1, p2 := vertices[indices[i]].Position, vertices[indices[i+1]].Position, vertices[indices[i+2]].Position
+		normal := p1.Sub(p0).Cross(p2.Sub(p0))
+		if normal[2] <= 0 {
+			t.Errorf("triangle %d should face z but its normal was %v", i/3, normal)
+		}
+		sum += normal.Len() / 2
+	}
+	if math32.Abs(sum-area) > 1e-3 {
+		t.Errorf("the triangles should cover the area %v but covered %v", area, sum)
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	vertices, indices := gridMesh(16, 16)
+	result, err := libscn.Simplify(vertices, indices, len(indices)/10, 0.01)
+	if len(result) > len(indices)/10 || err > 1e-4 {
+		t.Errorf("a plane should be simplified to a tenth of its %d indices without an error but had %d indices and the error %v", len(indices), len(result), err)
+	}
+	checkFlat(t, vertices, result, 16*16)
+
+	// the cylinder has no flat part, its error is limited
+	cylinder, cylinderIndices := cylinderMesh(64)
+	result, err = libscn.Simplify(cylinder, cylinderIndices, 0, 0.05)
+	if len(result) >= len(cylinderIndices)/2 || err > 0.05 || err == 0 {
+		t.Errorf("the cylinder should be simplified within the error 0.05 but had %d of %d indices and the error %v", len(result), len(cylinderIndices), err)
+	}
+	if again, _ := libscn.Simplify(cylinder, cylinderIndices, 0, 0.01); len(again) <= len(result) {
+		t.Errorf("a smaller error should keep more triangles but kept %d instead of %d indices", len(again), len(result))
+	}
+}
+
+func TestSimplifySeam(t *testing.T) {
+	vertices, indices := gridMesh(16, 8)
+	result, _ := libscn.Simplify(vertices, indices, 0, 0.01)
+	if len(result) >= len(indices)/4 {
+		t.Errorf("the plane should be simplified on both sides of the seam but had %d of %d indices", len(result), len(indices))
+	}
+	checkFlat(t, vertices, result, 16*16)
+	for i := 0; i < len(result); i += 3 {
+		left, right := 0, 0
+		for _, index := range result[i : i+3] {
+			v := vertices[index]
+			if v.Position[0] < 8 || (v.Position[0] == 8 && v.Uv[0] < 10) {
+				left++
+			}
+			if v.Position[0] > 8 || (v.Position[0] == 8 && v.Uv[0] >= 10) {
+				right++
+			}
+		}
+		if left != 3 && right != 3 {
+			t.Errorf("triangle %d should stay on one side of the seam with its uvs", i/3)
+		}
+	}
+}
+
+func TestGenerateLods(t *testing.T) {
+	vertices, indices := gridMesh(32, 32)
+	mesh := &libscn.Mesh{Name: "grid", Vertices: vertices, Indices: indices}
+	// the bottom and top half share the vertices of the middle row
+	half := len(indices) / 2
+	mesh.Submeshes = []libscn.Submesh{
+		{Material: "bottom", FirstIndex: 0, IndexCount: half},
+		{Material: "top", FirstIndex: half, IndexCount: half},
+	}
+	mesh.UpdateBounds()
+	mesh.GenerateLods(8, 0.01)
+
+	if len(mesh.Lods) < 3 {
+		t.Fatalf("the grid should have at least 3 levels of detail but had %d", len(mesh.Lods))
+	}
+	previous := len(mesh.Indices)
+	for i, lod := range mesh.Lods {
+		if len(lod.Indices) > previous*4/5 || lod.Error > 0.01 || len(lod.Submeshes) != 2 {
+			t.Errorf("lod %d should have less indices than %d and the error at most 0.01 but had %d indices and the error %v", i, previous, len(lod.Indices), lod.Error)
+		}
+		previous = len(lod.Indices)
+		checkFlat(t, mesh.Vertices, lod.Indices, 32*32)
+		for s, sub := range lod.Submeshes {
+			for _, index := range lod.Indices[sub.FirstIndex : sub.FirstIndex+sub.IndexCount] {
+				if y := mesh.Vertices[index].Position[1]; (s == 0 && y > 16) || (s == 1 && y < 16) {
+					t.Errorf("lod %d submesh %d should stay in its half but used a vertex at %v", i, s, y)
+				}
+			}
+			if sub.Material != mesh.Submeshes[s].Material || sub.FirstIndex+sub.IndexCount > len(lod.Indices) {
+				t.Errorf("lod %d submesh %d should be a range of the lod indices", i, s)
+			}
+		}
+	}
+
+	lods := make([]map[[3]libscn.Vertex]int, len(mesh.Lods))
+	for i, lod := range mesh.Lods {
+		lods[i] = triangleSet(mesh.Vertices, lod.Indices)
+	}
+	mesh.Optimize()
+	for i, lod := range mesh.Lods {
+		if !reflect.DeepEqual(triangleSet(mesh.Vertices, lod.Indices), lods[i]) {
+			t.Errorf("the triangles of lod %d should be kept by the optimization", i)
+		}
+	}
+
+	result, err := libscn.DecodeMesh(bytes.NewReader(encodeMesh(t, mesh, libscn.OptGeoCompress(0))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, mesh) {
+		t.Errorf("the levels of detail should be decoded like they were encoded")
+	}
+
+	mesh.Lods[0].Indices[0] = uint32(len(mesh.Vertices))
+	if err := libscn.EncodeMesh(new(bytes.Buffer), mesh); err == nil {
+		t.Errorf("lod indices out of range should be rejected")
+	}
+}
@@ -0,0 +1,200 @@
+package libscn
+
+import (
+	"github.com/chewxy/math32"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Generates tangents the way MikkTSpace does, so normal maps baked by blender, substance or xNormal match.
+// The tangent of each triangle follows u and is projected onto the vertex normals, the triangles at a
+// vertex are weighted by their angle in the plane of the normal and triangles with degenerate uvs or
+// positions only take the tangents of their neighbors. The handedness is stored in w, the bitangent is w * cross(normal, tangent).
+//
+// Vertices are shared by their values instead of their index, vertices at mirrored uvs are split into one
+// for each handedness. The split vertices are appended and indices are updated in place.
+// Unlike MikkTSpace triangles at a vertex are not split further by their connectivity.
+func GenerateTangents(vertices []Vertex, indices []uint32) []Vertex {
+	return generateTangents(vertices, indices, nil)
+}
+
+// Calls split with the index of the source for each appended vertex.
+// The indices of the lods reference the same vertices and are remapped to the split vertices of their handedness,
+// they only add tangents for a vertex and handedness which the triangles of indices do not have.
+func generateTangents(vertices []Vertex, indices []uint32, split func(source int), lods ...[]uint32) []Vertex {
+	// the vertices which share a tangent space, by value
+	shared := make([]int, len(vertices))
+	index := make(map[[8]float32]int, len(vertices))
+	for i, v := range vertices {
+		key := [8]float32{
+			v.Position[0], v.Position[1], v.Position[2],
+			v.Normal[0], v.Normal[1], v.Normal[2],
+			v.Uv[0], v.Uv[1],
+		}
+		if first, ok := index[key]; ok {
+			shared[i] = first
+		} else {
+			index[key] = i
+			shared[i] = i
+		}
+	}
+
+	// the accumulated tangents for both handedness, left handed at [1]
+	tangents := make([][2]mgl32.Vec3, len(vertices))
+	used := make([][2]bool, len(vertices))
+	orientation := accumulateTangents(vertices, indices, shared, tangents, used)
+	voteOrientations(indices, shared, used, orientation)
+
+	lodOrientations := make([][]int, len(lods))
+	if len(lods) > 0 {
+		lodTangents := make([][2]mgl32.Vec3, len(vertices))
+		lodUsed := make([][2]bool, len(vertices))
+		for i, lod := range lods {
+			lodOrientations[i] = accumulateTangents(vertices, lod, shared, lodTangents, lodUsed)
+		}
+		for s := range tangents {
+			for o := 0; o < 2; o++ {
+				if !used[s][o] && lodUsed[s][o] {
+					tangents[s][o], used[s][o] = lodTangents[s][o], true
+				}
+			}
+		}
+		for i, lod := range lods {
+			voteOrientations(lod, shared, used, lodOrientations[i])
+		}
+	}
+
+	// each vertex keeps the first handedness it is used with, the other one is a copy
+	copies := make([][2]int, len(vertices))
+	for i := range copies {
+		copies[i] = [2]int{-1, -1}
+	}
+	result := vertices
+	assign := func(indices []uint32, orientation []int) {
+		for t := range orientation {
+			o := orientation[t]
+			for c := t * 3; c < t*3+3; c++ {
+				i := indices[c]
+				if copies[i][o] >= 0 {
+					indices[c] = uint32(copies[i][o])
+					continue
+				}
+
+				target := int(i)
+				if copies[i][1-o] >= 0 {
+					target = len(result)
+					result = append(result, vertices[i])
+					if split != nil {
+						split(int(i))
+					}
+				}
+				copies[i][o] = target
+				indices[c] = uint32(target)
+
+				v := &result[target]
+				tan := tangents[shared[i]][o]
+				if tan.Len() > 0 {
+					tan = tan.Normalize()
+				} else {
+					tan = perpendicular(v.Normal)
+				}
+				sign := float32(1)
+				if o == 1 {
+					sign = -1
+				}
+				v.Tangent = tan.Vec4(sign)
+			}
+		}
+	}
+	assign(indices, orientation)
+	for i, lod := range lods {
+		assign(lod, lodOrientations[i])
+	}
+	// vertices without triangles still get a valid frame
+	for i := range vertices {
+		if copies[i] == [2]int{-1, -1} {
+			result[i].Tangent = perpendicular(result[i].Normal).Vec4(1)
+		}
+	}
+
+	return result
+}
+
+// Adds the tangents of the triangles to the vertices they share and returns the handedness of each triangle,
+// -1 for triangles with degenerate uvs or positions
+func accumulateTangents(vertices []Vertex, indices []uint32, shared []int, tangents [][2]mgl32.Vec3, used [][2]bool) []int {
+	triangleCount := len(indices) / 3
+	orientation := make([]int, triangleCount)
+	for t := 0; t < triangleCount; t++ {
+		tri := indices[t*3 : t*3+3]
+		v0, v1, v2 := vertices[tri[0]], vertices[tri[1]], vertices[tri[2]]
+
+		dPos01, dPos02 := v1.Position.Sub(v0.Position), v2.Position.Sub(v0.Position)
+		dUV01, dUV02 := v1.Uv.Sub(v0.Uv), v2.Uv.Sub(v0.Uv)
+
+		area := dUV01[0]*dUV02[1] - dUV01[1]*dUV02[0]
+		tan := dPos01.Mul(dUV02[1]).Sub(dPos02.Mul(dUV01[1]))
+		if area < 0 {
+			orientation[t] = 1
+			tan = tan.Mul(-1)
+		}
+		if area == 0 || tan.Len() == 0 || dPos01.Cross(dPos02).Len() == 0 {
+			orientation[t] = -1
+			continue
+		}
+		tan = tan.Normalize()
+
+		for c := 0; c < 3; c++ {
+			v := vertices[tri[c]]
+			// the corner of the triangle in the plane of the normal weights its tangent
+			e1, e2 := vertices[tri[(c+1)%3]].Position.Sub(v.Position), vertices[tri[(c+2)%3]].Position.Sub(v.Position)
+			e1, e2 = e1.Sub(v.Normal.Mul(v.Normal.Dot(e1))), e2.Sub(v.Normal.Mul(v.Normal.Dot(e2)))
+			if e1.Len() == 0 || e2.Len() == 0 {
+				continue
+			}
+			angle := math32.Acos(mgl32.Clamp(e1.Normalize().Dot(e2.Normalize()), -1, 1))
+
+			projected := tan.Sub(v.Normal.Mul(v.Normal.Dot(tan)))
+			if projected.Len() == 0 {
+				continue
+			}
+			s := shared[tri[c]]
+			tangents[s][orientation[t]] = tangents[s][orientation[t]].Add(projected.Normalize().Mul(angle))
+			used[s][orientation[t]] = true
+		}
+	}
+	return orientation
+}
+
+// Triangles with degenerate uvs join the handedness of their neighbors
+func voteOrientations(indices []uint32, shared []int, used [][2]bool, orientation []int) {
+	for t := range orientation {
+		if orientation[t] >= 0 {
+			continue
+		}
+		votes := 0
+		for _, i := range indices[t*3 : t*3+3] {
+			s := shared[i]
+			if used[s][1] && !used[s][0] {
+				votes++
+			} else if used[s][0] && !used[s][1] {
+				votes--
+			}
+		}
+		orientation[t] = 0
+		if votes > 0 {
+			orientation[t] = 1
+		}
+	}
+}
+
+// Any unit vector perpendicular to n, or x for a zero n
+func perpendicular(n mgl32.Vec3) mgl32.Vec3 {
+	if n.Len() == 0 {
+		return mgl32.Vec3{1, 0, 0}
+	}
+	axis := mgl32.Vec3{1, 0, 0}
+	if math32.Abs(n[0]) > math32.Abs(n[1]) {
+		axis = mgl32.Vec3{0, 1, 0}
+	}
+	return axis.Sub(n.Mul(n.Dot(axis) / n.Dot(n))).Normalize()
+}
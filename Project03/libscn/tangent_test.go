@@ -0,0 +1,272 @@
+package libscn_test
+
+import (
+	"advanced-gl/Project03/libscn"
+	"testing"
+
+	"github.com/chewxy/math32"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// A grid in the xy plane facing z with the uvs given for each position
+func planeMesh(positions []mgl32.Vec3, uvs []mgl32.Vec2, indices []uint32) ([]libscn.Vertex, []uint32) {
+	vertices := make([]libscn.Vertex, len(positions))
+	for i := range positions {
+		vertices[i] = libscn.Vertex{Position: positions[i], Normal: mgl32.Vec3{0, 0, 1}, Uv: uvs[i]}
+	}
+	return vertices, indices
+}
+
+// A smooth cylinder around y with u around and v up, the seam has separate vertices for u 0 and 1
+func cylinderMesh(segments int) ([]libscn.Vertex, []uint32) {
+	vertices := []libscn.Vertex{}
+	for i := 0; i <= segments; i++ {
+		u := float32(i) / float32(segments)
+		sin, cos := math32.Sincos(u * 2 * math32.Pi)
+		normal := mgl32.Vec3{cos, 0, -sin}
+		vertices = append(vertices,
+			libscn.Vertex{Position: normal, Normal: normal, Uv: mgl32.Vec2{u, 0}},
+			libscn.Vertex{Position: normal.Add(mgl32.Vec3{0, 1, 0}), Normal: normal, Uv: mgl32.Vec2{u, 1}},
+		)
+	}
+	indices := []uint32{}
+	for i := 0; i < segments; i++ {
+		a := uint32(i * 2)
+		indices = append(indices, a, a+2, a+3, a, a+3, a+1)
+	}
+	return vertices, indices
+}
+
+// The bitangent of the MikkTSpace frame
+func bitangent(v libscn.Vertex) mgl32.Vec3 {
+	return v.Normal.Cross(v.Tangent.Vec3()).Mul(v.Tangent[3])
+}
+
+func TestGenerateTangents(t *testing.T) {
+	square := []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}}
+	quad := []uint32{0, 1, 2, 0, 2, 3}
+
+	tests := []struct {
+		name      string
+		uvs       []mgl32.Vec2
+		tangent   mgl32.Vec4
+		bitangent mgl32.Vec3
+	}{
+		{"quad", []mgl32.Vec2{{0, 0}, {1, 0}, {1, 1}, {0, 1}}, mgl32.Vec4{1, 0, 0, 1}, mgl32.Vec3{0, 1, 0}},
+		{"scaled", []mgl32.Vec2{{0, 0}, {4, 0}, {4, 0.5}, {0, 0.5}}, mgl32.Vec4{1, 0, 0, 1}, mgl32.Vec3{0, 1, 0}},
+		{"mirrored u", []mgl32.Vec2{{1, 0}, {0, 0}, {0, 1}, {1, 1}}, mgl32.Vec4{-1, 0, 0, -1}, mgl32.Vec3{0, 1, 0}},
+		{"mirrored v", []mgl32.Vec2{{0, 1}, {1, 1}, {1, 0}, {0, 0}}, mgl32.Vec4{1, 0, 0, -1}, mgl32.Vec3{0, -1, 0}},
+		{"rotated", []mgl32.Vec2{{0, 0}, {0, -1}, {1, -1}, {1, 0}}, mgl32.Vec4{0, 1, 0, 1}, mgl32.Vec3{-1, 0, 0}},
+	}
+	for _, test := range tests {
+		vertices, indices := planeMesh(square, test.uvs, append([]uint32{}, quad...))
+		vertices = libscn.GenerateTangents(vertices, indices)
+		if len(vertices) != 4 {
+			t.Errorf("%s: the vertices should not be split but were %d", test.name, len(vertices))
+		}
+		for i, v := range vertices {
+			if !v.Tangent.ApproxEqual(test.tangent) || !bitangent(v).ApproxEqual(test.bitangent) {
+				t.Errorf("%s: vertex %d should have the tangent %v and bitangent %v but had %v and %v", test.name, i, test.tangent, test.bitangent, v.Tangent, bitangent(v))
+			}
+		}
+	}
+}
+
+func TestGenerateTangentsMirrorSeam(t *testing.T) {
+	// two quads with u mirrored at x = 1, like the halves of a symmetric model sharing one texture
+	vertices, indices := planeMesh(
+		[]mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {2, 0, 0}, {0, 1, 0}, {1, 1, 0}, {2, 1, 0}},
+		[]mgl32.Vec2{{0, 0}, {1, 0}, {0, 0}, {0, 1}, {1, 1}, {0, 1}},
+		[]uint32{0, 1, 4, 0, 4, 3, 1, 2, 5, 1, 5, 4},
+	)
+	vertices = libscn.GenerateTangents(vertices, indices)
+	if len(vertices) != 8 {
+		t.Fatalf("the 2 vertices at the seam should be split for each handedness but there were %d vertices", len(vertices))
+	}
+	for i, index := range indices {
+		v := vertices[index]
+		expected := mgl32.Vec4{1, 0, 0, 1}
+		if i >= 6 {
+			expected = mgl32.Vec4{-1, 0, 0, -1}
+		}
+		if !v.Tangent.ApproxEqual(expected) || !bitangent(v).ApproxEqual(mgl32.Vec3{0, 1, 0}) {
+			t.Errorf("corner %d should have the tangent %v but had %v", i, expected, v.Tangent)
+		}
+	}
+}
+
+// A curved grid with u mirrored at x = 0 and normals which are not perpendicular to the faces.
+// The reference tangents were evaluated with the equations of InitTriInfo and EvalTspace in
+// mikktspace.c in double precision, for each grid vertex and handedness.
+func TestGenerateTangentsReference(t *testing.T) {
+	grid := []libscn.Vertex{}
+	for j := -1; j <= 1; j++ {
+		for i := -1; i <= 1; i++ {
+			x, y := float32(i), float32(j)
+			grid = append(grid, libscn.Vertex{
+				Position: mgl32.Vec3{x, y, 0.5*(1-x*x) + 0.2*y*y + 0.1*math32.Abs(x)*y},
+				Normal:   mgl32.Vec3{0.8 * x, -0.3 * y, 1}.Normalize(),
+				Uv:       mgl32.Vec2{0.5*math32.Abs(x) + 0.1*y + 0.05*math32.Abs(x)*y*y, 0.5 + 0.4*y + 0.05*math32.Abs(x)},
+			})
+		}
+	}
+	indices := []uint32{}
+	for j := uint32(0); j < 2; j++ {
+		for i := uint32(0); i < 2; i++ {
+			a := j*3 + i
+			indices = append(indices, a, a+1, a+4, a, a+4, a+3)
+		}
+	}
+	reference := []struct {
+		vertex  int
+		tangent mgl32.Vec4
+	}{
+		{0, mgl32.Vec4{-0.7934397, -0.1474180, -0.5905264, -1}},
+		{1, mgl32.Vec4{0.9994677, 0.0312494, -0.0093748, 1}},
+		{1, mgl32.Vec4{-0.9989666, 0.0435329, -0.0130599, -1}},
+		{2, mgl32.Vec4{0.7930494, -0.1340453, -0.5942259, 1}},
+		{3, mgl32.Vec4{-0.7757199, -0.1146480, -0.6205759, -1}},
+		{4, mgl32.Vec4{0.9922779, -0.1240347, 0.0000000, 1}},
+		{4, mgl32.Vec4{-0.9922779, -0.1240347, 0.0000000, -1}},
+		{5, mgl32.Vec4{0.7760133, -0.1113445, -0.6208106, 1}},
+		{6, mgl32.Vec4{-0.7720120, -0.0526994, -0.6334194, -1}},
+		{7, mgl32.Vec4{0.9719775, -0.2251599, -0.0675480, 1}},
+		{7, mgl32.Vec4{-0.9683638, -0.2390185, -0.0717056, -1}},
+		{8, mgl32.Vec4{0.7709104, -0.0584315, -0.6342578, 1}},
+	}
+
+	vertices := libscn.GenerateTangents(append([]libscn.Vertex{}, grid...), indices)
+	if len(vertices) != len(reference) {
+		t.Fatalf("the 3 vertices at the seam should be split for each handedness but there were %d vertices", len(vertices))
+	}
+	for c, index := range indices {
+		v := vertices[index]
+		source := -1
+		for i := range grid {
+			if grid[i].Position == v.Position {
+				source = i
+			}
+		}
+		// the cells at x < 0 are mirrored
+		sign := float32(1)
+		if (c/6)%2 == 0 {
+			sign = -1
+		}
+		for _, ref := range reference {
+			if ref.vertex != source || ref.tangent[3] != sign {
+				continue
+			}
+			if v.Tangent.Sub(ref.tangent).Len() > 1e-5 {
+				t.Errorf("corner %d at %v should have the reference tangent %v but had %v", c, v.Position, ref.tangent, v.Tangent)
+			}
+		}
+	}
+}
+
+func TestGenerateTangentsLods(t *testing.T) {
+	// the mirrored quad only exists in the level of detail, like after the simplification of a detailed half
+	vertices, indices := planeMesh(
+		[]mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {2, 0, 0}, {0, 1, 0}, {1, 1, 0}, {2, 1, 0}},
+		[]mgl32.Vec2{{0, 0}, {1, 0}, {0, 0}, {0, 1}, {1, 1}, {0, 1}},
+		[]uint32{0, 1, 4, 0, 4, 3},
+	)
+	mesh := &libscn.Mesh{
+		Vertices: vertices,
+		Indices:  indices,
+		Colors:   make([]mgl32.Vec4, len(vertices)),
+		Lods:     []libscn.MeshLod{{Indices: []uint32{0, 1, 4, 0, 4, 3, 1, 2, 5, 1, 5, 4}}},
+	}
+	mesh.Colors[4] = mgl32.Vec4{1, 0, 0, 1}
+	mesh.GenerateTangents()
+
+	if len(mesh.Vertices) != 8 || len(mesh.Colors) != 8 {
+		t.Fatalf("the 2 vertices at the seam should be split for the level of detail but there were %d vertices and %d colors", len(mesh.Vertices), len(mesh.Colors))
+	}
+	check := func(name string, indices []uint32, mirrored int) {
+		for i, index := range indices {
+			expected := mgl32.Vec4{1, 0, 0, 1}
+			if i >= mirrored {
+				expected = mgl32.Vec4{-1, 0, 0, -1}
+			}
+			if v := mesh.Vertices[index]; !v.Tangent.ApproxEqual(expected) {
+				t.Errorf("%s corner %d should have the tangent %v but had %v", name, i, expected, v.Tangent)
+			}
+		}
+	}
+	check("mesh", mesh.Indices, 6)
+	check("lod", mesh.Lods[0].Indices, 6)
+	for i, index := range mesh.Lods[0].Indices[:6] {
+		if index != mesh.Indices[i] {
+			t.Errorf("lod corner %d should share vertex %d with the mesh but used %d", i, mesh.Indices[i], index)
+		}
+	}
+	if split := mesh.Lods[0].Indices[11]; split == 4 || mesh.Colors[split] != mesh.Colors[4] {
+		t.Errorf("the split vertex %d should be a copy of vertex 4 with its color", split)
+	}
+}
+
+func TestGenerateTangentsSmooth(t *testing.T) {
+	vertices, indices := cylinderMesh(16)
+	vertices = libscn.GenerateTangents(vertices, indices)
+	for i, v := range vertices {
+		// the tangents follow u around the cylinder
+		expected := mgl32.Vec3{0, 1, 0}.Cross(v.Normal)
+		if v.Tangent.Vec3().Sub(expected).Len() > 1e-5 || v.Tangent[3] != 1 {
+			t.Errorf("vertex %d at %v should have the tangent %v but had %v", i, v.Position, expected, v.Tangent)
+		}
+	}
+
+	// the same cylinder without shared vertices, like an unindexed glTF primitive
+	shared, sharedIndices := cylinderMesh(16)
+	shared = libscn.GenerateTangents(shared, sharedIndices)
+	unshared := []libscn.Vertex{}
+	unsharedIndices := []uint32{}
+	for _, index := range sharedIndices {
+		unsharedIndices = append(unsharedIndices, uint32(len(unshared)))
+		unshared = append(unshared, libscn.Vertex{Position: shared[index].Position, Normal: shared[index].Normal, Uv: shared[index].Uv})
+	}
+	unshared = libscn.GenerateTangents(unshared, unsharedIndices)
+	for i, index := range sharedIndices {
+		if unshared[i].Tangent != shared[index].Tangent {
+			t.Errorf("vertices with equal values should share their tangent but corner %d had %v instead of %v", i, unshared[i].Tangent, shared[index].Tangent)
+		}
+	}
+}
+
+func TestGenerateTangentsOrthogonal(t *testing.T) {
+	// normals which are not perpendicular to the faces, the tangents are projected onto them
+	vertices, indices := planeMesh(
+		[]mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}},
+		[]mgl32.Vec2{{0, 0}, {1, 0}, {1, 1}, {0, 1}},
+		[]uint32{0, 1, 2, 0, 2, 3},
+	)
+	for i := range vertices {
+		vertices[i].Normal = mgl32.Vec3{0.5, 0.2, 1}.Normalize()
+	}
+	vertices = libscn.GenerateTangents(vertices, indices)
+	for i, v := range vertices {
+		if tan := v.Tangent.Vec3(); math32.Abs(tan.Dot(v.Normal)) > 1e-6 || math32.Abs(tan.Len()-1) > 1e-6 {
+			t.Errorf("vertex %d should have a unit tangent perpendicular to its normal but had %v", i, tan)
+		}
+	}
+}
+
+func TestGenerateTangentsDegenerate(t *testing.T) {
+	vertices, indices := planeMesh(
+		[]mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}, {2, 0, 0}, {2, 0, 0}},
+		// the second triangle has no uv area and the third no area at all
+		[]mgl32.Vec2{{0, 0}, {1, 0}, {1, 1}, {1, 1}, {2, 0}, {2, 1}},
+		[]uint32{0, 1, 2, 0, 2, 3, 1, 4, 5},
+	)
+	vertices = libscn.GenerateTangents(vertices, indices)
+	for i, v := range vertices {
+		tan := v.Tangent.Vec3()
+		if math32.IsNaN(tan.Len()) || math32.Abs(tan.Len()-1) > 1e-6 || math32.Abs(tan.Dot(v.Normal)) > 1e-6 {
+			t.Errorf("vertex %d should have a valid tangent but had %v", i, v.Tangent)
+		}
+	}
+	// the triangles without uv area take the tangents of their neighbors
+	if !vertices[0].Tangent.ApproxEqual(mgl32.Vec4{1, 0, 0, 1}) || !vertices[1].Tangent.ApproxEqual(mgl32.Vec4{1, 0, 0, 1}) {
+		t.Errorf("the tangents of the valid triangle should not be changed but were %v and %v", vertices[0].Tangent, vertices[1].Tangent)
+	}
+}
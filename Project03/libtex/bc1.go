@@ -0,0 +1,219 @@
+package libtex
+
+import "encoding/binary"
+
+// The interpolation weights of the bc1 palette entries, for four and three color blocks
+var (
+	bc1Weights4 = [4]float32{0, 1, 1.0 / 3, 2.0 / 3}
+	bc1Weights3 = [4]float32{0, 1, 0.5, 0}
+)
+
+func pack565(c point) uint16 {
+	return uint16(quantize(c[0], 31)<<11 | quantize(c[1], 63)<<5 | quantize(c[2], 31))
+}
+
+func unpack565(c uint16) (rgb [3]int) {
+	r, g, b := int(c>>11)&0x1f, int(c>>5)&0x3f, int(c)&0x1f
+	return [3]int{r<<3 | r>>2, g<<2 | g>>4, b<<3 | b>>2}
+}
+
+// Returns the palette like the decoder calculates it
+func bc1Palette(c0, c1 uint16, fourColors bool) (palette [4][3]int) {
+	palette[0], palette[1] = unpack565(c0), unpack565(c1)
+	for k := 0; k < 3; k++ {
+		a, b := palette[0][k], palette[1][k]
+		if fourColors {
+			palette[2][k] = (2*a + b + 1) / 3
+			palette[3][k] = (a + 2*b + 1) / 3
+		} else {
+			palette[2][k] = (a + b + 1) / 2
+		}
+	}
+	return palette
+}
+
+// Encodes 16 rgba texels into an 8 byte bc1 block.
+// With punchThrough texels with an alpha below 128 become transparent, otherwise alpha is ignored like in bc3.
+func encodeBC1Block(texels *[16][4]uint8, dst []byte, punchThrough bool) {
+	points := make([]point, 0, 16)
+	opaque := [16]bool{}
+	for i, t := range texels {
+		if !punchThrough || t[3] >= 128 {
+			points = append(points, point{float32(t[0]), float32(t[1]), float32(t[2])})
+			opaque[i] = true
+		}
+	}
+	if len(points) == 0 {
+		// three color mode with every texel transparent
+		binary.LittleEndian.PutUint16(dst[0:], 0)
+		binary.LittleEndian.PutUint16(dst[2:], 0)
+		binary.LittleEndian.PutUint32(dst[4:], 0xffffffff)
+		return
+	}
+	fourColors := len(points) == 16
+
+	a, b := boundingEndpoints(points, 3)
+	bestErr := -1
+	var bestC0, bestC1 uint16
+	var bestIndices uint32
+
+	for iter := 0; iter < 3; iter++ {
+		c0, c1 := pack565(a), pack565(b)
+		// the order of the endpoints selects the mode
+		if (fourColors && c0 < c1) || (!fourColors && c0 > c1) {
+			c0, c1 = c1, c0
+			a, b = b, a
+		}
+		if fourColors && c0 == c1 && punchThrough {
+			// equal endpoints only select three color mode, which is fine as long as index 3 is not used
+			fourColors = false
+		}
+		palette := bc1Palette(c0, c1, fourColors || !punchThrough)
+		entries := 4
+		if !fourColors && punchThrough {
+			entries = 3
+		}
+
+		var indices uint32
+		err := 0
+		weights := make([]float32, 0, 16)
+		for i, t := range texels {
+			if !opaque[i] {
+				indices |= 3 << (2 * i)
+				continue
+			}
+			best, bestDist := 0, -1
+			for k := 0; k < entries; k++ {
+				dist := 0
+				for ch := 0; ch < 3; ch++ {
+					d := palette[k][ch] - int(t[ch])
+					dist += d * d
+				}
+				if bestDist < 0 || dist < bestDist {
+					best, bestDist = k, dist
+				}
+			}
+			indices |= uint32(best) << (2 * i)
+			err += bestDist
+			if entries == 4 {
+				weights = append(weights, bc1Weights4[best])
+			} else {
+				weights = append(weights, bc1Weights3[best])
+			}
+		}
+
+		if bestErr < 0 || err < bestErr {
+			bestErr, bestC0, bestC1, bestIndices = err, c0, c1, indices
+		}
+		if err == 0 {
+			break
+		}
+
+		var ok bool
+		a, b, ok = leastSquares(points, weights, 3)
+		if !ok {
+			break
+		}
+	}
+
+	binary.LittleEndian.PutUint16(dst[0:], bestC0)
+	binary.LittleEndian.PutUint16(dst[2:], bestC1)
+	binary.LittleEndian.PutUint32(dst[4:], bestIndices)
+}
+
+// Encodes 16 values into an 8 byte bc4 block, trying both the eight and the six value mode
+func encodeBC4Block(values *[16]uint8, dst []byte) {
+	lo, hi := 255, 0
+	// the range without the values the six value mode stores exactly
+	innerLo, innerHi := 255, 0
+	for _, v := range values {
+		x := int(v)
+		if x < lo {
+			lo = x
+		}
+		if x > hi {
+			hi = x
+		}
+		if x != 0 && x != 255 {
+			if x < innerLo {
+				innerLo = x
+			}
+			if x > innerHi {
+				innerHi = x
+			}
+		}
+	}
+	if innerLo > innerHi {
+		innerLo, innerHi = 0, 0
+	}
+
+	var best [8]byte
+	bestErr := -1
+	try := func(a, b int) {
+		var block [8]byte
+		err := encodeBC4Indices(values, a, b, block[:])
+		if bestErr < 0 || err < bestErr {
+			best, bestErr = block, err
+		}
+	}
+	if hi > lo {
+		try(hi, lo)
+	}
+	try(innerLo, innerHi)
+	copy(dst, best[:])
+}
+
+// Writes the block for the endpoints a and b, a > b selects the eight value mode
+func encodeBC4Indices(values *[16]uint8, a, b int, block []byte) (err int) {
+	var palette [8]int
+	palette[0], palette[1] = a, b
+	if a > b {
+		for k := 1; k < 7; k++ {
+			palette[k+1] = ((7-k)*a + k*b + 3) / 7
+		}
+	} else {
+		for k := 1; k < 5; k++ {
+			palette[k+1] = ((5-k)*a + k*b + 2) / 5
+		}
+		palette[6], palette[7] = 0, 255
+	}
+
+	var indices uint64
+	for i, v := range values {
+		best, bestDist := 0, -1
+		for k, p := range palette {
+			d := (p - int(v)) * (p - int(v))
+			if bestDist < 0 || d < bestDist {
+				best, bestDist = k, d
+			}
+		}
+		indices |= uint64(best) << (3 * i)
+		err += bestDist
+	}
+
+	block[0], block[1] = byte(a), byte(b)
+	for k := 0; k < 6; k++ {
+		block[2+k] = byte(indices >> (8 * k))
+	}
+	return err
+}
+
+// Encodes 16 rgba texels into a 16 byte bc3 block
+func encodeBC3Block(texels *[16][4]uint8, dst []byte) {
+	var alpha [16]uint8
+	for i, t := range texels {
+		alpha[i] = t[3]
+	}
+	encodeBC4Block(&alpha, dst[0:8])
+	encodeBC1Block(texels, dst[8:16], false)
+}
+
+// Encodes the first two channels of 16 texels into a 16 byte bc5 block
+func encodeBC5Block(texels *[16][4]uint8, dst []byte) {
+	var red, green [16]uint8
+	for i, t := range texels {
+		red[i], green[i] = t[0], t[1]
+	}
+	encodeBC4Block(&red, dst[0:8])
+	encodeBC4Block(&green, dst[8:16])
+}
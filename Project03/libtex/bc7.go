@@ -0,0 +1,265 @@
+package libtex
+
+import (
+	"advanced-gl/Project03/libio"
+	"sort"
+)
+
+// The number of two subset partitions which are fully encoded, after ranking all of them by how well lines fit their subsets
+const bc7PartitionCandidates = 4
+
+// Writes bits into a block starting at the least significant bit
+type bitWriter struct {
+	block [16]byte
+	pos   int
+}
+
+func (bw *bitWriter) write(v, n int) {
+	for i := 0; i < n; i++ {
+		bw.block[bw.pos>>3] |= byte((v>>i)&1) << (bw.pos & 7)
+		bw.pos++
+	}
+}
+
+// The endpoints and indices of one subset
+type bc7SubsetFit struct {
+	// quantized endpoints without the p bits
+	endpoints [2][4]int
+	pBits     [2]int
+	// the indices of the subset's texels, in texel order
+	indices []int
+	err     int
+}
+
+// Fits the endpoints of a subset with colorBits for rgb and alphaBits for alpha, the alpha is 255 when alphaBits is 0.
+// With sharedPBit both endpoints use the same p bit.
+func fitBC7Subset(texels []*[4]uint8, colorBits, alphaBits int, sharedPBit bool, indexBits int) bc7SubsetFit {
+	channels := 3
+	if alphaBits > 0 {
+		channels = 4
+	}
+	points := make([]point, len(texels))
+	for i, t := range texels {
+		points[i] = point{float32(t[0]), float32(t[1]), float32(t[2]), float32(t[3])}
+	}
+
+	pCombinations := [][2]int{{0, 0}, {0, 1}, {1, 0}, {1, 1}}
+	if sharedPBit {
+		pCombinations = [][2]int{{0, 0}, {1, 1}}
+	}
+
+	a, b := boundingEndpoints(points, channels)
+	best := bc7SubsetFit{err: -1}
+	weights := make([]float32, len(points))
+	for iter := 0; iter < 3; iter++ {
+		improved := false
+		for _, p := range pCombinations {
+			fit := bc7SubsetFit{pBits: p, indices: make([]int, len(texels))}
+			var decoded [2][4]int
+			for e, endpoint := range [2]point{a, b} {
+				for ch := 0; ch < 4; ch++ {
+					bits := colorBits
+					if ch == 3 {
+						bits = alphaBits
+					}
+					if bits == 0 {
+						decoded[e][ch] = 255
+						continue
+					}
+					// the p bit is the lowest bit of the bits+1 bit value
+					full := endpoint[ch] * float32(int(1)<<(bits+1)-1) / 255
+					q := int((full-float32(p[e]))/2 + 0.5)
+					if q < 0 {
+						q = 0
+					} else if q > 1<<bits-1 {
+						q = 1<<bits - 1
+					}
+					fit.endpoints[e][ch] = q
+					decoded[e][ch] = expandBits(q<<1|p[e], bits+1)
+				}
+			}
+			fit.err = assignBC7Indices(texels, decoded, indexBits, fit.indices)
+			if best.err < 0 || fit.err < best.err {
+				best = fit
+				improved = true
+			}
+		}
+		if best.err == 0 || !improved {
+			break
+		}
+
+		for i, index := range best.indices {
+			weights[i] = float32(libio.BC7Weight(indexBits, index)) / 64
+		}
+		var ok bool
+		a, b, ok = leastSquares(points, weights, channels)
+		if !ok {
+			break
+		}
+	}
+	return best
+}
+
+// Chooses the closest palette entry for each texel and returns the squared error
+func assignBC7Indices(texels []*[4]uint8, endpoints [2][4]int, indexBits int, indices []int) (err int) {
+	var palette [16][4]int
+	for k := 0; k < 1<<indexBits; k++ {
+		w := libio.BC7Weight(indexBits, k)
+		for ch := 0; ch < 4; ch++ {
+			palette[k][ch] = ((64-w)*endpoints[0][ch] + w*endpoints[1][ch] + 32) >> 6
+		}
+	}
+	for i, t := range texels {
+		best, bestDist := 0, -1
+		for k := 0; k < 1<<indexBits; k++ {
+			dist := 0
+			for ch := 0; ch < 4; ch++ {
+				d := palette[k][ch] - int(t[ch])
+				dist += d * d
+			}
+			if bestDist < 0 || dist < bestDist {
+				best, bestDist = k, dist
+			}
+		}
+		indices[i] = best
+		err += bestDist
+	}
+	return err
+}
+
+// Swaps the endpoints when the anchor index has its highest bit set, the anchor index is stored without it
+func (fit *bc7SubsetFit) fixAnchor(anchor, indexBits int) {
+	if fit.indices[anchor] < 1<<(indexBits-1) {
+		return
+	}
+	fit.endpoints[0], fit.endpoints[1] = fit.endpoints[1], fit.endpoints[0]
+	fit.pBits[0], fit.pBits[1] = fit.pBits[1], fit.pBits[0]
+	for i := range fit.indices {
+		fit.indices[i] = 1<<indexBits - 1 - fit.indices[i]
+	}
+}
+
+func expandBits(v, bits int) int {
+	v <<= 8 - bits
+	return v | v>>bits
+}
+
+// Encodes 16 rgba texels into a 16 byte bc7 block.
+// Mode 6 is used for every block, opaque blocks also try the best two subset partitions of mode 1.
+func encodeBC7Block(texels *[16][4]uint8, dst []byte) {
+	all := make([]*[4]uint8, 16)
+	opaque := true
+	for i := range texels {
+		all[i] = &texels[i]
+		if texels[i][3] != 255 {
+			opaque = false
+		}
+	}
+
+	bestErr, best := encodeBC7Mode6(all)
+	if opaque && bestErr > 0 {
+		for _, partition := range rankBC7Partitions(texels) {
+			err, block := encodeBC7Mode1(all, partition)
+			if err < bestErr {
+				bestErr, best = err, block
+			}
+		}
+	}
+	copy(dst, best[:])
+}
+
+// One subset with 7 bit rgba endpoints, a p bit per endpoint and 4 bit indices
+func encodeBC7Mode6(texels []*[4]uint8) (int, [16]byte) {
+	fit := fitBC7Subset(texels, 7, 7, false, 4)
+	fit.fixAnchor(0, 4)
+
+	bw := &bitWriter{}
+	bw.write(1<<6, 7)
+	for ch := 0; ch < 4; ch++ {
+		bw.write(fit.endpoints[0][ch], 7)
+		bw.write(fit.endpoints[1][ch], 7)
+	}
+	bw.write(fit.pBits[0], 1)
+	bw.write(fit.pBits[1], 1)
+	for i, index := range fit.indices {
+		if i == 0 {
+			bw.write(index, 3)
+		} else {
+			bw.write(index, 4)
+		}
+	}
+	return fit.err, bw.block
+}
+
+// Two subsets with 6 bit rgb endpoints, a shared p bit per subset and 3 bit indices
+func encodeBC7Mode1(texels []*[4]uint8, partition int) (int, [16]byte) {
+	var subsets [2][]*[4]uint8
+	var anchors [2]int
+	for i := 0; i < 16; i++ {
+		s, anchor := libio.BC7Subset(2, partition, i)
+		if anchor {
+			anchors[s] = len(subsets[s])
+		}
+		subsets[s] = append(subsets[s], texels[i])
+	}
+
+	var fits [2]bc7SubsetFit
+	err := 0
+	for s := range fits {
+		fits[s] = fitBC7Subset(subsets[s], 6, 0, true, 3)
+		fits[s].fixAnchor(anchors[s], 3)
+		err += fits[s].err
+	}
+
+	bw := &bitWriter{}
+	bw.write(1<<1, 2)
+	bw.write(partition, 6)
+	for ch := 0; ch < 3; ch++ {
+		for s := range fits {
+			bw.write(fits[s].endpoints[0][ch], 6)
+			bw.write(fits[s].endpoints[1][ch], 6)
+		}
+	}
+	bw.write(fits[0].pBits[0], 1)
+	bw.write(fits[1].pBits[0], 1)
+
+	var next [2]int
+	for i := 0; i < 16; i++ {
+		s, anchor := libio.BC7Subset(2, partition, i)
+		index := fits[s].indices[next[s]]
+		next[s]++
+		if anchor {
+			bw.write(index, 2)
+		} else {
+			bw.write(index, 3)
+		}
+	}
+	return err, bw.block
+}
+
+// Returns the two subset partitions whose subsets are closest to lines through rgb space, best first
+func rankBC7Partitions(texels *[16][4]uint8) []int {
+	type ranked struct {
+		partition int
+		err       float32
+	}
+	ranking := make([]ranked, 64)
+	subsets := [2][]point{make([]point, 0, 16), make([]point, 0, 16)}
+	for partition := range ranking {
+		subsets[0], subsets[1] = subsets[0][:0], subsets[1][:0]
+		for i, t := range texels {
+			s, _ := libio.BC7Subset(2, partition, i)
+			subsets[s] = append(subsets[s], point{float32(t[0]), float32(t[1]), float32(t[2])})
+		}
+		ranking[partition] = ranked{partition, lineError(subsets[0], 3) + lineError(subsets[1], 3)}
+	}
+	sort.SliceStable(ranking, func(i, j int) bool {
+		return ranking[i].err < ranking[j].err
+	})
+
+	result := make([]int, bc7PartitionCandidates)
+	for i := range result {
+		result[i] = ranking[i].partition
+	}
+	return result
+}
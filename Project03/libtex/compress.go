@@ -0,0 +1,105 @@
+package libtex
+
+import (
+	"advanced-gl/Project03/libio"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// Compresses a 2D image into blocks of the given format.
+// The rows are encoded in the order they are stored, blocks at the edges repeat the last row and column.
+// Missing channels are 0, a missing alpha channel is 255.
+func CompressImage(img *libio.IntImage, format libio.DxgiFormat) ([]byte, error) {
+	if !format.IsBlockCompressed() {
+		return nil, fmt.Errorf("format %v is not block compressed", format)
+	}
+	if img.Width < 1 || img.Height < 1 {
+		return nil, fmt.Errorf("invalid image size %dx%d", img.Width, img.Height)
+	}
+
+	blocksX, blocksY := (img.Width+3)/4, (img.Height+3)/4
+	blockBytes := format.BlockBytes()
+	result := make([]byte, blocksX*blocksY*blockBytes)
+
+	rows := make(chan int, blocksY)
+	for by := 0; by < blocksY; by++ {
+		rows <- by
+	}
+	close(rows)
+
+	wg := sync.WaitGroup{}
+	for worker := 0; worker < runtime.NumCPU(); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var texels [16][4]uint8
+			for by := range rows {
+				for bx := 0; bx < blocksX; bx++ {
+					gatherBlock(img, bx, by, &texels)
+					dst := result[(by*blocksX+bx)*blockBytes:]
+					encodeBlock(format, &texels, dst)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return result, nil
+}
+
+// Compresses every level, layer and slice of the texture.
+// The levels are laid out like the levels of libio.Ktx2Texture and libio.DdsTexture.
+func Compress(tex *libio.IntTexture, format libio.DxgiFormat) ([][]byte, error) {
+	levels := make([][]byte, tex.Levels)
+	for lvl := range levels {
+		_, _, d := tex.Size(lvl)
+		for layer := 0; layer < tex.Layers; layer++ {
+			for z := 0; z < d; z++ {
+				blocks, err := CompressImage(tex.Image(lvl, layer, z), format)
+				if err != nil {
+					return nil, err
+				}
+				levels[lvl] = append(levels[lvl], blocks...)
+			}
+		}
+	}
+	return levels, nil
+}
+
+func encodeBlock(format libio.DxgiFormat, texels *[16][4]uint8, dst []byte) {
+	switch format {
+	case libio.DxgiFormatBC1Unorm, libio.DxgiFormatBC1UnormSrgb:
+		encodeBC1Block(texels, dst, true)
+	case libio.DxgiFormatBC3Unorm, libio.DxgiFormatBC3UnormSrgb:
+		encodeBC3Block(texels, dst)
+	case libio.DxgiFormatBC4Unorm:
+		var values [16]uint8
+		for i, t := range texels {
+			values[i] = t[0]
+		}
+		encodeBC4Block(&values, dst)
+	case libio.DxgiFormatBC5Unorm:
+		encodeBC5Block(texels, dst)
+	case libio.DxgiFormatBC7Unorm, libio.DxgiFormatBC7UnormSrgb:
+		encodeBC7Block(texels, dst)
+	}
+}
+
+func gatherBlock(img *libio.IntImage, bx, by int, texels *[16][4]uint8) {
+	for y := 0; y < 4; y++ {
+		sy := by*4 + y
+		if sy >= img.Height {
+			sy = img.Height - 1
+		}
+		for x := 0; x < 4; x++ {
+			sx := bx*4 + x
+			if sx >= img.Width {
+				sx = img.Width - 1
+			}
+			texel := &texels[y*4+x]
+			*texel = [4]uint8{0, 0, 0, 255}
+			copy(texel[:], img.Pix[img.Index(sx, sy):img.Index(sx, sy)+img.Channels])
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package libtex_test
+
+import (
+	"advanced-gl/Project03/libio"
+	"advanced-gl/Project03/libtex"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// A smooth gradient with some noise and an alpha ramp, like a typical texture
+func testImage(width, height int, noise float64) *libio.IntImage {
+	rng := rand.New(rand.NewSource(0))
+	img := libio.NewIntImage(make([]uint8, width*height*4), 4, width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := img.Index(x, y)
+			fx, fy := float64(x)/float64(width), float64(y)/float64(height)
+			values := []float64{
+				200*fx + 30,
+				120*math.Sin(fy*5) + 128,
+				80*fx*fy + 60,
+				255 * fy,
+			}
+			for ch, v := range values {
+				v += rng.NormFloat64() * noise
+				img.Pix[i+ch] = uint8(math.Max(0, math.Min(255, v)))
+			}
+		}
+	}
+	return img
+}
+
+// Sets the alpha channel to 255
+func opaque(img *libio.IntImage) *libio.IntImage {
+	result := libio.NewIntImage(append([]uint8(nil), img.Pix...), 4, img.Width, img.Height)
+	for i := 3; i < len(result.Pix); i += 4 {
+		result.Pix[i] = 255
+	}
+	return result
+}
+
+func compressAndDecode(t *testing.T, img *libio.IntImage, format libio.DxgiFormat) *libio.IntImage {
+	blocks, err := libtex.CompressImage(img, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pix, err := libio.DecodeBlocks(format, img.Width, img.Height, blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return libio.NewIntImage(pix, format.Channels(), img.Width, img.Height)
+}
+
+func TestCompressQuality(t *testing.T) {
+	img := testImage(37, 29, 2)
+
+	tests := []struct {
+		format   libio.DxgiFormat
+		img      *libio.IntImage
+		channels int
+		minPsnr  float64
+	}{
+		// the alpha ramp would be punched through
+		{libio.DxgiFormatBC1Unorm, opaque(img), 3, 35},
+		{libio.DxgiFormatBC3Unorm, img, 4, 35},
+		{libio.DxgiFormatBC4Unorm, img, 1, 40},
+		{libio.DxgiFormatBC5Unorm, img, 2, 38},
+		{libio.DxgiFormatBC7Unorm, img, 4, 36},
+		{libio.DxgiFormatBC7Unorm, opaque(img), 3, 40},
+	}
+	for _, test := range tests {
+		decoded := compressAndDecode(t, test.img, test.format)
+		psnr := libtex.PSNR(test.img, decoded, test.channels)
+		if psnr < test.minPsnr {
+			t.Errorf("%v psnr should be at least %g dB but was %.2f dB", test.format, test.minPsnr, psnr)
+		}
+	}
+}
+
+func TestCompressBC7Noise(t *testing.T) {
+	// noise stresses the partitions and the anchor index handling of every subset
+	img := opaque(testImage(64, 64, 40))
+
+	bc1 := libtex.PSNR(img, compressAndDecode(t, img, libio.DxgiFormatBC1Unorm), 3)
+	bc7 := libtex.PSNR(img, compressAndDecode(t, img, libio.DxgiFormatBC7Unorm), 3)
+	if bc7 < bc1+2 {
+		t.Errorf("bc7 should be clearly better than bc1 but had %.2f dB to %.2f dB", bc7, bc1)
+	}
+}
+
+func TestCompressConstant(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for k := 0; k < 32; k++ {
+		color := []uint8{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256))}
+		img := libio.NewIntImage(make([]uint8, 8*8*4), 4, 8, 8)
+		for i := range img.Pix {
+			img.Pix[i] = color[i%4]
+		}
+
+		// bc4 can represent every 8 bit value exactly
+		for _, format := range []libio.DxgiFormat{libio.DxgiFormatBC4Unorm, libio.DxgiFormatBC5Unorm} {
+			decoded := compressAndDecode(t, img, format)
+			if psnr := libtex.PSNR(img, decoded, format.Channels()); !math.IsInf(psnr, 1) {
+				t.Fatalf("%v should encode %v exactly but had a psnr of %.2f dB", format, color, psnr)
+			}
+		}
+
+		// the p bit is shared by all channels of a bc7 endpoint, so channels may be off by one
+		decoded := compressAndDecode(t, img, libio.DxgiFormatBC7Unorm)
+		for i, v := range decoded.Pix {
+			if d := int(v) - int(img.Pix[i]); d < -1 || d > 1 {
+				t.Fatalf("bc7 should encode %v with an error of at most 1 but decoded %v", color, decoded.Pix[i&^3:i&^3+4])
+			}
+		}
+	}
+}
+
+func TestCompressPunchThrough(t *testing.T) {
+	img := testImage(8, 8, 0)
+	for i := 3; i < len(img.Pix); i += 4 {
+		if i%8 == 3 {
+			img.Pix[i] = 0
+		} else {
+			img.Pix[i] = 255
+		}
+	}
+
+	decoded := compressAndDecode(t, img, libio.DxgiFormatBC1Unorm)
+	for i := 0; i < img.Count(); i++ {
+		transparent := img.Pix[i*4+3] == 0
+		if (decoded.Pix[i*4+3] == 0) != transparent {
+			t.Fatalf("texel %d should have an alpha of %d but had %d", i, img.Pix[i*4+3], decoded.Pix[i*4+3])
+		}
+	}
+}
+
+func TestCompressTexture(t *testing.T) {
+	img := testImage(16, 8, 0)
+	tex, err := libtex.GenerateMips(img, libtex.TextureKindColor, 0, libio.MipFilterBox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	levels, err := libtex.Compress(tex, libio.DxgiFormatBC7UnormSrgb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 8 blocks, 2 blocks and then single blocks down to 1x1
+	expected := []int{8, 2, 1, 1, 1}
+	if len(levels) != len(expected) {
+		t.Fatalf("texture should have %d levels but has %d", len(expected), len(levels))
+	}
+	for lvl, blocks := range expected {
+		if len(levels[lvl]) != blocks*16 {
+			t.Errorf("level %d should be %d bytes but is %d", lvl, blocks*16, len(levels[lvl]))
+		}
+	}
+}
+
+func TestGenerateMipsSrgb(t *testing.T) {
+	// black and white average to 50% linear light, which is about 188 in sRGB
+	img := libio.NewIntImage([]uint8{0, 0, 0, 255, 255, 255, 255, 255}, 4, 2, 1)
+	tex, err := libtex.GenerateMips(img, libtex.TextureKindColor, 2, libio.MipFilterBox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	level := tex.Level(1)
+	if level[0] != 188 || level[3] != 255 {
+		t.Errorf("level 1 should be [188 188 188 255] but was %v", level)
+	}
+
+	tex, err = libtex.GenerateMips(img, libtex.TextureKindLinear, 2, libio.MipFilterBox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level := tex.Level(1); level[0] != 128 {
+		t.Errorf("linear level 1 should be 128 but was %d", level[0])
+	}
+}
+
+func TestGenerateMipsNormal(t *testing.T) {
+	// two opposing normals tilted along x average to a normal pointing along z
+	img := libio.NewIntImage([]uint8{218, 128, 218, 255, 37, 128, 218, 255}, 4, 2, 1)
+	tex, err := libtex.GenerateMips(img, libtex.TextureKindNormal, 2, libio.MipFilterBox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level := tex.Level(1); level[2] != 255 {
+		t.Errorf("the averaged normal should be renormalized to [128 128 255] but was %v", level[:3])
+	}
+}
+
+func TestChooseFormat(t *testing.T) {
+	opaque := testImage(4, 4, 0)
+	for i := 3; i < len(opaque.Pix); i += 4 {
+		opaque.Pix[i] = 255
+	}
+	transparent := testImage(4, 4, 0)
+
+	tests := []struct {
+		filename string
+		img      *libio.IntImage
+		format   libio.DxgiFormat
+	}{
+		{"textures/brick_albedo.png", opaque, libio.DxgiFormatBC1UnormSrgb},
+		{"textures/leaves.png", transparent, libio.DxgiFormatBC3UnormSrgb},
+		{"textures/brick_normal.png", opaque, libio.DxgiFormatBC5Unorm},
+		{"textures/brick_ORM.jpg", opaque, libio.DxgiFormatBC7Unorm},
+		{"textures/brick_roughness.png", opaque, libio.DxgiFormatBC4Unorm},
+	}
+	for _, test := range tests {
+		format := libtex.ChooseFormat(libtex.KindFromFilename(test.filename), test.img)
+		if format != test.format {
+			t.Errorf("%q should be compressed as %v but was %v", test.filename, test.format, format)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package libtex
+
+import "github.com/chewxy/math32"
+
+// A texel with channels in [0, 255]
+type point = [4]float32
+
+// Calculates the mean and the normalized direction of the largest variance of the first n channels.
+// The axis is zero when all points are equal.
+func principalAxis(points []point, n int) (mean, axis point) {
+	if len(points) == 0 {
+		return
+	}
+	for _, p := range points {
+		for i := 0; i < n; i++ {
+			mean[i] += p[i]
+		}
+	}
+	for i := 0; i < n; i++ {
+		mean[i] /= float32(len(points))
+	}
+
+	var cov [4][4]float32
+	for _, p := range points {
+		for i := 0; i < n; i++ {
+			for j := i; j < n; j++ {
+				cov[i][j] += (p[i] - mean[i]) * (p[j] - mean[j])
+			}
+		}
+	}
+	for i := 0; i < n; i++ {
+		for j := 0; j < i; j++ {
+			cov[i][j] = cov[j][i]
+		}
+	}
+
+	// power iteration, starting with the column of the largest variance which is never orthogonal to the result
+	largest := 0
+	for i := 1; i < n; i++ {
+		if cov[i][i] > cov[largest][largest] {
+			largest = i
+		}
+	}
+	if cov[largest][largest] < 1e-6 {
+		return mean, point{}
+	}
+	for i := 0; i < n; i++ {
+		axis[i] = cov[i][largest]
+	}
+	for iter := 0; iter < 8; iter++ {
+		var next point
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				next[i] += cov[i][j] * axis[j]
+			}
+		}
+		length := length(next, n)
+		if length < 1e-12 {
+			return mean, point{}
+		}
+		for i := 0; i < n; i++ {
+			axis[i] = next[i] / length
+		}
+	}
+	return mean, axis
+}
+
+// Returns the sum of squared distances of the points to the line through their mean along the principal axis
+func lineError(points []point, n int) float32 {
+	mean, axis := principalAxis(points, n)
+	var sum float32
+	for _, p := range points {
+		var d point
+		for i := 0; i < n; i++ {
+			d[i] = p[i] - mean[i]
+		}
+		t := dot(d, axis, n)
+		sum += dot(d, d, n) - t*t
+	}
+	return sum
+}
+
+// Returns the endpoints of the segment along the principal axis which covers all points
+func boundingEndpoints(points []point, n int) (a, b point) {
+	mean, axis := principalAxis(points, n)
+	tmin, tmax := math32.Inf(1), math32.Inf(-1)
+	for _, p := range points {
+		var d point
+		for i := 0; i < n; i++ {
+			d[i] = p[i] - mean[i]
+		}
+		t := dot(d, axis, n)
+		if t < tmin {
+			tmin = t
+		}
+		if t > tmax {
+			tmax = t
+		}
+	}
+	for i := 0; i < n; i++ {
+		a[i] = clamp255(mean[i] + axis[i]*tmin)
+		b[i] = clamp255(mean[i] + axis[i]*tmax)
+	}
+	return a, b
+}
+
+// Finds the endpoints which minimize the squared error when each point is interpolated with its weight in [0, 1].
+// Returns false when the system is singular, for example when all weights are equal.
+func leastSquares(points []point, weights []float32, n int) (a, b point, ok bool) {
+	var aa, ab, bb float32
+	var ax, bx point
+	for k, p := range points {
+		w := weights[k]
+		u := 1 - w
+		aa += u * u
+		ab += u * w
+		bb += w * w
+		for i := 0; i < n; i++ {
+			ax[i] += u * p[i]
+			bx[i] += w * p[i]
+		}
+	}
+	det := aa*bb - ab*ab
+	if math32.Abs(det) < 1e-6 {
+		return a, b, false
+	}
+	for i := 0; i < n; i++ {
+		a[i] = clamp255((bb*ax[i] - ab*bx[i]) / det)
+		b[i] = clamp255((aa*bx[i] - ab*ax[i]) / det)
+	}
+	return a, b, true
+}
+
+func dot(a, b point, n int) float32 {
+	var sum float32
+	for i := 0; i < n; i++ {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func length(v point, n int) float32 {
+	return math32.Sqrt(dot(v, v, n))
+}
+
+func clamp255(v float32) float32 {
+	if v < 0 {
+		return 0
+	} else if v > 255 {
+		return 255
+	}
+	return v
+}
+
+// Rounds v in [0, 255] to an integer in [0, max]
+func quantize(v float32, max int) int {
+	q := int(v*float32(max)/255 + 0.5)
+	if q < 0 {
+		return 0
+	} else if q > max {
+		return max
+	}
+	return q
+}
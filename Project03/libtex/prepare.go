@@ -0,0 +1,158 @@
+package libtex
+
+import (
+	"advanced-gl/Project03/libio"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/chewxy/math32"
+)
+
+// What a texture holds, which decides its format and how its mips are filtered
+type TextureKind int
+
+const (
+	// sRGB encoded colors, filtered in linear space
+	TextureKindColor = TextureKind(iota)
+	// Linear data like the packed occlusion, roughness and metallic (ORM) maps
+	TextureKindLinear
+	// Single channel linear data like separate roughness or occlusion maps
+	TextureKindMask
+	// Tangent space normals, renormalized after filtering and stored in two channels
+	TextureKindNormal
+)
+
+func (kind TextureKind) String() string {
+	switch kind {
+	case TextureKindColor:
+		return "color"
+	case TextureKindLinear:
+		return "linear"
+	case TextureKindMask:
+		return "mask"
+	case TextureKindNormal:
+		return "normal"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(kind))
+	}
+}
+
+func ParseTextureKind(name string) (TextureKind, error) {
+	for _, kind := range []TextureKind{TextureKindColor, TextureKindLinear, TextureKindMask, TextureKindNormal} {
+		if strings.EqualFold(name, kind.String()) {
+			return kind, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown texture kind %q", name)
+}
+
+// Guesses the kind of a texture from the suffix of its filename, like 'brick_normal.png'
+func KindFromFilename(filename string) TextureKind {
+	name := strings.ToLower(strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)))
+	suffix := name[strings.LastIndex(name, "_")+1:]
+	switch suffix {
+	case "normal", "nrm":
+		return TextureKindNormal
+	case "orm":
+		return TextureKindLinear
+	case "occlusion", "ao", "roughness", "metallic", "height", "mask":
+		return TextureKindMask
+	default:
+		return TextureKindColor
+	}
+}
+
+// Chooses the block format for a texture kind:
+// bc5 for normals, bc7 for linear data like ORM maps, bc4 for masks and bc1 or bc3 for colors depending on the alpha channel.
+func ChooseFormat(kind TextureKind, img *libio.IntImage) libio.DxgiFormat {
+	switch kind {
+	case TextureKindNormal:
+		return libio.DxgiFormatBC5Unorm
+	case TextureKindLinear:
+		return libio.DxgiFormatBC7Unorm
+	case TextureKindMask:
+		return libio.DxgiFormatBC4Unorm
+	}
+	if img.Channels == 4 {
+		for i := 3; i < len(img.Pix); i += 4 {
+			if img.Pix[i] != 255 {
+				return libio.DxgiFormatBC3UnormSrgb
+			}
+		}
+	}
+	return libio.DxgiFormatBC1UnormSrgb
+}
+
+// Returns the sRGB or the linear variant of a format, formats without an sRGB variant are returned as they are
+func WithSrgb(format libio.DxgiFormat, srgb bool) libio.DxgiFormat {
+	pairs := [][2]libio.DxgiFormat{
+		{libio.DxgiFormatBC1Unorm, libio.DxgiFormatBC1UnormSrgb},
+		{libio.DxgiFormatBC3Unorm, libio.DxgiFormatBC3UnormSrgb},
+		{libio.DxgiFormatBC7Unorm, libio.DxgiFormatBC7UnormSrgb},
+	}
+	for _, pair := range pairs {
+		if format == pair[0] || format == pair[1] {
+			if srgb {
+				return pair[1]
+			}
+			return pair[0]
+		}
+	}
+	return format
+}
+
+// Generates the mip levels of an image, a complete mip chain is generated when levels is 0.
+// Colors are filtered in linear space and normals are renormalized.
+func GenerateMips(img *libio.IntImage, kind TextureKind, levels int, filter libio.MipFilter) (*libio.IntTexture, error) {
+	tex := libio.IntTextureFromImage(img).ToFloatTexture()
+	if kind == TextureKindColor {
+		mapColors(tex.Pix, tex.Channels, libio.SrgbToLinear)
+	}
+
+	tex, err := libio.GenerateMips(tex, levels, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if kind == TextureKindColor {
+		mapColors(tex.Pix, tex.Channels, libio.LinearToSrgb)
+	}
+	if kind == TextureKindNormal && tex.Channels >= 3 {
+		for lvl := 1; lvl < tex.Levels; lvl++ {
+			renormalize(tex.Level(lvl), tex.Channels)
+		}
+	}
+
+	result := tex.ToIntTexture()
+	// the base level is copied as it is, without the round trip through floats
+	copy(result.Level(0), img.Pix)
+	return result, nil
+}
+
+// Applies fn to the rgb channels
+func mapColors(pix []float32, channels int, fn func(float32) float32) {
+	rgb := channels
+	if rgb > 3 {
+		rgb = 3
+	}
+	for i := 0; i < len(pix); i += channels {
+		for ch := 0; ch < rgb; ch++ {
+			pix[i+ch] = fn(pix[i+ch])
+		}
+	}
+}
+
+// Normalizes the normals encoded in [0, 1] of the first three channels
+func renormalize(pix []float32, channels int) {
+	for i := 0; i < len(pix); i += channels {
+		x, y, z := pix[i]*2-1, pix[i+1]*2-1, pix[i+2]*2-1
+		length := math32.Sqrt(x*x + y*y + z*z)
+		if length < 1e-6 {
+			x, y, z, length = 0, 0, 1, 1
+		}
+		pix[i] = x/length*0.5 + 0.5
+		pix[i+1] = y/length*0.5 + 0.5
+		pix[i+2] = z/length*0.5 + 0.5
+	}
+}
@@ -0,0 +1,23 @@
+package libtex
+
+import (
+	"advanced-gl/Project03/libio"
+	"math"
+)
+
+// Returns the peak signal to noise ratio in dB of the first 'channels' channels of two images of the same size.
+// Identical images have an infinite PSNR.
+func PSNR(a, b *libio.IntImage, channels int) float64 {
+	if a.Width != b.Width || a.Height != b.Height || channels > a.Channels || channels > b.Channels {
+		return 0
+	}
+	var sum float64
+	for i := 0; i < a.Count(); i++ {
+		for ch := 0; ch < channels; ch++ {
+			d := float64(a.Pix[i*a.Channels+ch]) - float64(b.Pix[i*b.Channels+ch])
+			sum += d * d
+		}
+	}
+	mse := sum / float64(a.Count()*channels)
+	return 10 * math.Log10(255*255/mse)
+}
@@ -26,6 +26,9 @@ import (
 
 var Arguments struct {
 	EnableCompatibilityProfile bool
+	CompactVertices            bool
+	GpuCulling                 bool
+	OcclusionCulling           bool
 }
 
 func main() {
@@ -38,6 +41,9 @@ func main() {
 	log.Println("Parsing arguments")
 
 	flag.BoolVar(&Arguments.EnableCompatibilityProfile, "enable-compatibility-profile", Arguments.EnableCompatibilityProfile, "")
+	flag.BoolVar(&Arguments.CompactVertices, "compact-vertices", Arguments.CompactVertices, "quantize the vertices of the meshes to 20 bytes")
+	flag.BoolVar(&Arguments.GpuCulling, "gpu-culling", Arguments.GpuCulling, "cull the instances in a compute shader, requires GL_ARB_indirect_parameters")
+	flag.BoolVar(&Arguments.OcclusionCulling, "occlusion-culling", Arguments.OcclusionCulling, "cull the instances behind the depth of the previous frame, requires -gpu-culling")
 	flag.Parse()
 
 	runtime.LockOSThread()
@@ -112,8 +118,9 @@ func main() {
 	gl.DebugMessageControl(gl.DONT_CARE, gl.DEBUG_TYPE_POP_GROUP, gl.DONT_CARE, 0, nil, false)
 
 	var (
-		pack  *DirPack
-		batch *RenderBatch
+		pack      *DirPack
+		batch     *RenderBatch
+		instances []InstanceHandle
 	)
 
 	lm := &SimpleLoadManager{}
@@ -121,20 +128,24 @@ func main() {
 	lm.OnLoad(func(ctx *glfw.Window) {
 		pack = &DirPack{}
 		pack.AddIndexFile("assets/index.json")
-		mesh, err := pack.LoadMesh(selectedMesh)
-		check(err)
 		material, err := pack.LoadMaterial(selectedMaterial)
 		check(err)
 
-		batch = NewRenderBatch()
-		batch.Upload(mesh)
+		layout := VertexLayoutFloat
+		if Arguments.CompactVertices {
+			layout = VertexLayoutCompact
+		}
+		batch = NewRenderBatchWithLayout(layout)
+		meshName, err := pack.UploadMesh(batch, selectedMesh)
+		check(err)
 		batch.AddMaterial(material)
 
+		instances = instances[:0]
 		for x := -2; x <= 2; x++ {
 			for z := -2; z <= 2; z++ {
-				batch.Add(mesh.Name, material.Name, InstanceAttributes{
+				instances = append(instances, batch.Add(meshName, material.Name, InstanceAttributes{
 					ModelMatrix: mgl32.Translate3D(float32(x*2), 0, float32(z*2)),
-				})
+				}))
 			}
 		}
 
@@ -162,21 +173,33 @@ func main() {
 	hdrFbo.AttachTexture(gl.DEPTH_ATTACHMENT, hdrDepthAttachment)
 	check(hdrFbo.Check(gl.DRAW_FRAMEBUFFER))
 
+	var culler *GpuCuller
+	if Arguments.GpuCulling {
+		if culler, err = NewGpuCuller(); err != nil {
+			log.Printf("Falling back to CPU culling: %v\n", err)
+		}
+	}
+
 	var (
-		pbrShader          UnboundShaderPipeline
-		skyShader          UnboundShaderPipeline
-		postShader         UnboundShaderPipeline
-		dd                 *libutil.DirectBuffer
-		gui                *ImGui
-		envCubemap         UnboundTexture
-		iblDiffuseCubemap  UnboundTexture
-		iblSpecularCubemap UnboundTexture
-		iblBdrfLut         UnboundTexture
-		bloom              *effects.BloomEffect
+		pbrShader            UnboundShaderPipeline
+		skyShader            UnboundShaderPipeline
+		postShader           UnboundShaderPipeline
+		dd                   *libutil.DirectBuffer
+		gui                  *ImGui
+		envCubemap           UnboundTexture
+		iblDiffuseCubemap    UnboundTexture
+		iblSpecularCubemap   UnboundTexture
+		iblSpecularRoughness []float32
+		iblBdrfLut           UnboundTexture
+		bloom                *effects.BloomEffect
 	)
 
 	lm.OnLoad(func(ctx *glfw.Window) {
-		pbrShader, err = pack.LoadShaderPipeline("pbr")
+		pbrShaderName := "pbr"
+		if Arguments.CompactVertices {
+			pbrShaderName = "pbr_compact"
+		}
+		pbrShader, err = pack.LoadShaderPipeline(pbrShaderName)
 		check(err)
 
 		directShader, err := pack.LoadShaderPipeline("direct")
@@ -240,13 +263,15 @@ func main() {
 		for i := 0; i < hdriReflection.Levels; i++ {
 			iblSpecularCubemap.Load(i, hdriReflection.Size(i), hdriReflection.Size(i), 6, gl.RGB, hdriReflection.Level(i))
 		}
+		iblSpecularRoughness = hdriReflection.Roughness.Levels(hdriReflection.Levels)
+		if len(iblSpecularRoughness) > 8 {
+			// the size of u_environment_roughness
+			iblSpecularRoughness = iblSpecularRoughness[:8]
+		}
 
-		lut, err := pack.LoadTextureFloat("ibl_brdf_lut")
+		iblBdrfLut, err = pack.LoadFloatTexture("ibl_brdf_lut", gl.RG32F)
 		check(err)
-		iblBdrfLut = NewTexture(gl.TEXTURE_2D)
 		iblBdrfLut.SetDebugLabel("ibl_lut")
-		iblBdrfLut.Allocate(1, gl.RG32F, lut.Width, lut.Height, 0)
-		iblBdrfLut.Load(0, lut.Width, lut.Height, 0, gl.RG, lut.Pix)
 	})
 
 	var colorLut UnboundTexture
@@ -348,7 +373,16 @@ func main() {
 			State.PolygonMode(gl.FRONT_AND_BACK, gl.LINE)
 		}
 
-		materials := batch.GenerateDrawCommands()
+		// a pixel of error is not visible
+		batch.SelectLods(cam, 1)
+		var materials []MaterialSlice
+		if culler != nil {
+			materials = culler.Cull(batch, cam.ProjectionMatrix.Mul4(cam.ViewMatrix), Arguments.OcclusionCulling)
+			culler.CountBuffer.Bind(gl.PARAMETER_BUFFER_ARB)
+		} else {
+			batch.CullInstances(cam.Frustum())
+			materials = batch.GenerateDrawCommands()
+		}
 		batch.CommandBuffer.Bind(gl.DRAW_INDIRECT_BUFFER)
 		batch.VertexArray.Bind()
 		pbrShader.Bind()
@@ -363,6 +397,10 @@ func main() {
 			pbrShader.FragmentStage().SetUniformIndexed("u_light_positions", i, lightPositions[i])
 			pbrShader.FragmentStage().SetUniformIndexed("u_light_colors", i, lightColors[i])
 		}
+		pbrShader.FragmentStage().SetUniform("u_environment_levels", len(iblSpecularRoughness))
+		for i, r := range iblSpecularRoughness {
+			pbrShader.FragmentStage().SetUniformIndexed("u_environment_roughness", i, r)
+		}
 
 		texAlbedoSampler.Bind(0)
 		texNormalSampler.Bind(1)
@@ -374,12 +412,17 @@ func main() {
 		iblDiffuseCubemap.Bind(3)
 		iblSpecularCubemap.Bind(4)
 		iblBdrfLut.Bind(5)
-		for _, mat := range materials {
+		for i, mat := range materials {
 			mat.Material.Albedo.Bind(0)
 			mat.Material.Normal.Bind(1)
 			mat.Material.ORM.Bind(2)
+			pbrShader.FragmentStage().SetUniform("u_normal_two_channel", mat.Material.TwoChannelNormal)
 
-			gl.MultiDrawElementsIndirect(gl.TRIANGLES, gl.UNSIGNED_INT, gl.PtrOffset(mat.ElementOffset), int32(mat.ElementCount), 0)
+			if culler != nil {
+				gl.MultiDrawElementsIndirectCountARB(gl.TRIANGLES, gl.UNSIGNED_INT, gl.PtrOffset(mat.ElementOffset), i*4, int32(mat.ElementCount), 0)
+			} else {
+				gl.MultiDrawElementsIndirect(gl.TRIANGLES, gl.UNSIGNED_INT, gl.PtrOffset(mat.ElementOffset), int32(mat.ElementCount), 0)
+			}
 		}
 
 		skyShader.Bind()
@@ -393,6 +436,10 @@ func main() {
 		State.DepthFunc(gl.LEQUAL)
 		gl.DrawArrays(gl.TRIANGLES, 0, 6*6)
 
+		if culler != nil && Arguments.OcclusionCulling {
+			culler.UpdatePyramid(hdrDepthAttachment, viewportWidth, viewportHeight)
+		}
+
 		bloom.Resize(viewportWidth, viewportHeight)
 		bloomResult := bloom.Render(hdrFbo.GetTexture(0))
 
@@ -473,7 +520,9 @@ func main() {
 					check(err)
 					batch.AddMaterial(mat)
 					selectedMaterial = name
-					// TODO: implement material change
+					for _, instance := range instances {
+						batch.SetMaterial(instance, name)
+					}
 				}
 			}
 
@@ -485,11 +534,14 @@ func main() {
 			slices.Sort(meshes)
 			for _, name := range meshes {
 				if im.Selectable(name) {
-					mesh, err := pack.LoadMesh(name)
+					meshName, err := pack.UploadMesh(batch, name)
 					check(err)
-					batch.Upload(mesh)
 					selectedMesh = name
-					// TODO: implement mesh change
+					for i, instance := range instances {
+						attributes := batch.Instance(instance).Attributes
+						batch.Remove(instance)
+						instances[i] = batch.Add(meshName, selectedMaterial, attributes)
+					}
 				}
 			}
 
@@ -20,3 +20,5 @@ require github.com/Qendolin/go-opencl v0.0.0-20230823133503-e8ab840ad9f5
 require golang.org/x/image v0.0.0-20190321063152-3fc05d484e9f // indirect
 
 require golang.org/x/exp v0.0.0-20230801115018-d63ba01acd4b
+
+require github.com/DataDog/zstd v1.5.7